@@ -0,0 +1,272 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+package bot
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/velour/catbase/bot/migrate"
+	"github.com/velour/catbase/bot/user"
+	"github.com/velour/catbase/config"
+)
+
+func init() {
+	config.Declare(
+		config.Key{Name: "bot.url", Description: "address people reach the web pages at, for login links; http://HttpAddr when empty"},
+		config.Key{Name: "bot.sessionDays", Type: config.Int, Default: "30", Min: 1, Max: 365,
+			Description: "days a web login lasts"},
+	)
+	migrate.Register("accounts", migrate.Step{
+		Version: 1,
+		Name:    "create web login tables",
+		SQL: `create table if not exists web_logins (
+			token string primary key,
+			connector string,
+			user_id string,
+			name string,
+			expires integer
+		);
+		create table if not exists web_sessions (
+			token string primary key,
+			connector string,
+			user_id string,
+			name string,
+			expires integer
+		);`,
+	})
+}
+
+const (
+	// SessionCookie holds the session of someone logged in to the web pages
+	SessionCookie = "catbase_session"
+	// WebConnector is the connector web pages send messages through
+	// Its users are the connector:id identities people logged in as.
+	WebConnector = "cli"
+
+	loginTTL = 15 * time.Minute
+)
+
+// ErrBadLogin is returned for login links that are unknown, used or expired
+var ErrBadLogin = errors.New("that login link is no good, ask for another")
+
+// WebUser is the chat identity someone logged in to the web pages with
+type WebUser struct {
+	Connector string
+	ID        string `db:"user_id"`
+	Name      string
+}
+
+// User gives the identity as a chat user, for messages sent from the web
+// The ID is the connector:id target so roles follow the user to WebConnector.
+func (u WebUser) User() *user.User {
+	return &user.User{ID: Target(u.Connector, u.ID), Name: u.Name}
+}
+
+// Accounts lets chat users log in to the web pages with links sent to them in chat
+type Accounts struct {
+	config *config.Config
+	perms  *Permissions
+}
+
+// NewAccounts creates the login and session storage
+func NewAccounts(c *config.Config, perms *Permissions) *Accounts {
+	migrate.MustUp(c.DB, "accounts")
+	return &Accounts{config: c, perms: perms}
+}
+
+func newSecret() (string, string) {
+	raw := make([]byte, 32)
+	rand.Read(raw)
+	token := hex.EncodeToString(raw)
+	return token, hashSecret(token)
+}
+
+// hashSecret is how tokens are stored, so the database can't be used to log in
+func hashSecret(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// LoginLink makes a one-time link that logs whoever opens it in as a chat user
+func (a *Accounts) LoginLink(connector, id, name string) (string, error) {
+	if id == "" {
+		return "", errors.New("I don't know who you are")
+	}
+	token, hash := newSecret()
+	_, err := a.config.Exec(`insert into web_logins (token, connector, user_id, name, expires)
+		values (?, ?, ?, ?, ?)`, hash, connector, id, name, time.Now().Add(loginTTL).Unix())
+	if err != nil {
+		return "", err
+	}
+	base := a.config.Get("bot.url", "")
+	if base == "" {
+		base = "http://" + a.config.Get("HttpAddr", "127.0.0.1:1337")
+	}
+	return strings.TrimSuffix(base, "/") + "/login?token=" + token, nil
+}
+
+// Login spends a login link's token on a new session
+func (a *Accounts) Login(token string) (string, WebUser, error) {
+	now := time.Now().Unix()
+	if _, err := a.config.Exec(`delete from web_logins where expires < ?`, now); err != nil {
+		log.Error().Err(err).Msg("Could not clean up login links")
+	}
+	var u WebUser
+	hash := hashSecret(token)
+	err := a.config.DB.Get(&u, `select connector, user_id, name from web_logins where token=?`, hash)
+	if err == sql.ErrNoRows {
+		return "", u, ErrBadLogin
+	} else if err != nil {
+		return "", u, err
+	}
+	res, err := a.config.Exec(`delete from web_logins where token=?`, hash)
+	if err != nil {
+		return "", u, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		// somebody else used it first
+		return "", u, ErrBadLogin
+	}
+
+	session, hash := newSecret()
+	expires := time.Now().Add(a.sessionLength()).Unix()
+	if _, err := a.config.Exec(`delete from web_sessions where expires < ?`, now); err != nil {
+		log.Error().Err(err).Msg("Could not clean up sessions")
+	}
+	_, err = a.config.Exec(`insert into web_sessions (token, connector, user_id, name, expires)
+		values (?, ?, ?, ?, ?)`, hash, u.Connector, u.ID, u.Name, expires)
+	return session, u, err
+}
+
+func (a *Accounts) sessionLength() time.Duration {
+	return time.Duration(a.config.GetInt("bot.sessionDays", 30)) * 24 * time.Hour
+}
+
+// Session finds who a request is logged in as
+func (a *Accounts) Session(r *http.Request) (WebUser, bool) {
+	var u WebUser
+	c, err := r.Cookie(SessionCookie)
+	if err != nil || c.Value == "" {
+		return u, false
+	}
+	err = a.config.DB.Get(&u, `select connector, user_id, name from web_sessions
+		where token=? and expires >= ?`, hashSecret(c.Value), time.Now().Unix())
+	if err != nil && err != sql.ErrNoRows {
+		log.Error().Err(err).Msg("Could not look up session")
+	}
+	return u, err == nil
+}
+
+// Logout ends a session
+func (a *Accounts) Logout(session string) error {
+	_, err := a.config.Exec(`delete from web_sessions where token=?`, hashSecret(session))
+	return err
+}
+
+// Allowed checks whether a web user may do what a command permission covers
+func (a *Accounts) Allowed(u WebUser, command string) bool {
+	return a.perms.Role(u.Connector, u.ID) >= a.perms.Required(command)
+}
+
+// Authorize finds who is making a request and checks they may do what a command permission covers
+// When they can't, it answers the request with a JSON error and returns false.
+// An empty command only requires a login.
+func (a *Accounts) Authorize(w http.ResponseWriter, r *http.Request, command string) (WebUser, bool) {
+	u, ok := a.Session(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		j, _ := json.Marshal(struct{ Err string }{Err: "Log in first: say login to me in chat"})
+		w.Write(j)
+		return u, false
+	}
+	if command != "" && !a.Allowed(u, command) {
+		log.Info().
+			Str("connector", u.Connector).
+			Str("user", u.ID).
+			Str("permission", command).
+			Msg("Refused a web request")
+		w.WriteHeader(http.StatusForbidden)
+		j, _ := json.Marshal(struct{ Err string }{Err: NoPermission})
+		w.Write(j)
+		return u, false
+	}
+	return u, true
+}
+
+var loginTpl = template.Must(template.New("login").Parse(loginPage))
+
+type loginData struct {
+	Token string
+	Err   string
+}
+
+// serveLogin asks before spending a link's token, so link previews can't use it up
+func (a *Accounts) serveLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		loginTpl.Execute(w, loginData{Token: r.URL.Query().Get("token")})
+		return
+	}
+	session, u, err := a.Login(r.FormValue("token"))
+	if err != nil {
+		if err != ErrBadLogin {
+			log.Error().Err(err).Msg("Could not log in")
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		loginTpl.Execute(w, loginData{Err: err.Error()})
+		return
+	}
+	log.Info().Str("connector", u.Connector).Str("user", u.ID).Msg("Logged in to the web pages")
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    session,
+		Path:     "/",
+		Expires:  time.Now().Add(a.sessionLength()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(a.config.Get("bot.url", ""), "https:"),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (a *Accounts) serveLogout(w http.ResponseWriter, r *http.Request) {
+	if c, err := r.Cookie(SessionCookie); err == nil {
+		if err := a.Logout(c.Value); err != nil {
+			log.Error().Err(err).Msg("Could not log out")
+		}
+	}
+	http.SetCookie(w, &http.Cookie{Name: SessionCookie, Path: "/", MaxAge: -1})
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+var loginPage = `
+<!DOCTYPE html>
+<html lang="en">
+<head>
+    <link type="text/css" rel="stylesheet" href="//unpkg.com/bootstrap/dist/css/bootstrap.min.css" />
+    <meta charset="UTF-8">
+    <title>Log in</title>
+</head>
+<body>
+<div class="container my-5">
+{{ if .Err }}
+    <div class="alert alert-danger">{{ .Err }}</div>
+{{ else }}
+    <form method="post" action="/login">
+        <input type="hidden" name="token" value="{{ .Token }}">
+        <button type="submit" class="btn btn-primary">Log in to catbase</button>
+    </form>
+{{ end }}
+</div>
+</body>
+</html>
+`
@@ -0,0 +1,100 @@
+package bot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/velour/catbase/bot/msg"
+)
+
+func testAccounts(t *testing.T) *Accounts {
+	mb := NewMockBot()
+	mb.DB().MustExec(`delete from web_logins; delete from web_sessions; delete from roles; delete from config;`)
+	return mb.Accounts()
+}
+
+func token(link string) string {
+	return link[strings.Index(link, "token=")+len("token="):]
+}
+
+func TestLoginLinkIsSpentOnce(t *testing.T) {
+	a := testAccounts(t)
+	link, err := a.LoginLink("slack", "U1", "alice")
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(link, "http://127.0.0.1:1337/login?token="))
+
+	session, u, err := a.Login(token(link))
+	assert.Nil(t, err)
+	assert.NotEmpty(t, session)
+	assert.Equal(t, WebUser{"slack", "U1", "alice"}, u)
+	_, _, err = a.Login(token(link))
+	assert.Equal(t, ErrBadLogin, err)
+	_, _, err = a.Login("made up")
+	assert.Equal(t, ErrBadLogin, err)
+}
+
+func TestServeLogin(t *testing.T) {
+	a := testAccounts(t)
+	link, _ := a.LoginLink("slack", "U1", "alice")
+
+	// opening the link only asks, so link previews can't spend it
+	w := httptest.NewRecorder()
+	a.serveLogin(w, httptest.NewRequest(http.MethodGet, link, nil))
+	assert.Contains(t, w.Body.String(), token(link))
+	assert.Empty(t, w.Result().Cookies())
+
+	r := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(url.Values{"token": {token(link)}}.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	a.serveLogin(w, r)
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	cookies := w.Result().Cookies()
+	assert.Len(t, cookies, 1)
+	assert.True(t, cookies[0].HttpOnly)
+
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(cookies[0])
+	u, ok := a.Session(r)
+	assert.True(t, ok)
+	assert.Equal(t, "alice", u.Name)
+
+	assert.Nil(t, a.Logout(cookies[0].Value))
+	_, ok = a.Session(r)
+	assert.False(t, ok)
+}
+
+func TestAuthorize(t *testing.T) {
+	a := testAccounts(t)
+	a.perms.Declare("test.write", Moderator)
+	link, _ := a.LoginLink("slack", "U1", "alice")
+	session, _, _ := a.Login(token(link))
+
+	w := httptest.NewRecorder()
+	_, ok := a.Authorize(w, httptest.NewRequest(http.MethodPost, "/", nil), "")
+	assert.False(t, ok)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.AddCookie(&http.Cookie{Name: SessionCookie, Value: session})
+	w = httptest.NewRecorder()
+	_, ok = a.Authorize(w, r, "test.write")
+	assert.False(t, ok)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	a.perms.Grant("slack", "U1", Moderator)
+	u, ok := a.Authorize(httptest.NewRecorder(), r, "test.write")
+	assert.True(t, ok)
+	assert.Equal(t, "slack:U1", u.User().ID)
+}
+
+func TestWebUsersKeepTheirRole(t *testing.T) {
+	a := testAccounts(t)
+	a.perms.Grant("slack", "U1", Admin)
+	u := WebUser{"slack", "U1", "alice"}
+	m := msg.Message{Connector: WebConnector, User: u.User()}
+	assert.Equal(t, Admin, a.perms.RoleOf(m))
+}
@@ -0,0 +1,54 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+package bot
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+	"github.com/velour/catbase/bot/backup"
+	"github.com/velour/catbase/bot/schedule"
+	"github.com/velour/catbase/config"
+)
+
+func init() {
+	backup.Register("bot", backup.Table{Name: "variables"})
+	backup.Register("config", backup.Table{
+		Name: "config",
+		Key:  "key",
+		Skip: func(row map[string]interface{}) bool {
+			return config.IsSecret(fmt.Sprint(row["key"]))
+		},
+	})
+	config.Declare(
+		config.Key{Name: "backup.schedule", Default: "@daily",
+			Description: "cron expression for automatic backups, empty to turn them off"},
+		config.Key{Name: "backup.dir", Default: "backups", Description: "where automatic backups are written"},
+		config.Key{Name: "backup.keep", Type: config.Int, Default: "7", Min: 1, Max: 1000,
+			Description: "automatic backups kept before the oldest are removed"},
+	)
+}
+
+// scheduleBackups sets up the automatic backup job from backup.schedule
+func (b *bot) scheduleBackups() {
+	b.sched.Handle("backup", b.runBackup)
+	spec := b.config.Get("backup.schedule", "@daily")
+	// Postgres has its own tools for this
+	if spec == "" || b.config.Dialect() == config.Postgres {
+		b.sched.Cancel("backup")
+		return
+	}
+	if err := b.sched.Cron("backup", "backup", spec, 0, ""); err != nil {
+		log.Error().Err(err).Msg("Could not schedule backups")
+	}
+}
+
+func (b *bot) runBackup(job schedule.Job) {
+	dir := b.config.Get("backup.dir", "backups")
+	path, err := backup.Rotate(b.DB(), dir, b.config.GetInt("backup.keep", 7))
+	if err != nil {
+		log.Error().Err(err).Msg("Backup failed")
+		return
+	}
+	log.Info().Msgf("Backed up the database to %s", path)
+}
@@ -0,0 +1,290 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+// Package backup copies the database safely while the bot runs and moves plugin data in and out as JSON
+package backup
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mattn/go-sqlite3"
+	"github.com/rs/zerolog/log"
+	"github.com/velour/catbase/config"
+)
+
+// Table is a table a plugin wants exported
+type Table struct {
+	Name string
+	// Skip leaves out rows that must not leave the database, like secrets
+	// Tables with Skip are merged on import by Key so the skipped rows survive.
+	Skip func(row map[string]interface{}) bool
+	// Key is the unique column rows are merged on
+	Key string
+}
+
+var (
+	lock   sync.Mutex
+	tables = map[string][]Table{}
+)
+
+// Register adds the tables of a plugin to exports
+func Register(plugin string, t ...Table) {
+	lock.Lock()
+	defer lock.Unlock()
+	tables[plugin] = append(tables[plugin], t...)
+}
+
+// Backup writes a consistent copy of the database to path using SQLite's online backup
+// The bot can keep using the database while the copy is made. Postgres databases
+// are backed up with pg_dump instead.
+func Backup(db *sqlx.DB, path string) error {
+	if config.DialectOf(db) == config.Postgres {
+		return fmt.Errorf("Postgres databases are backed up with pg_dump")
+	}
+	d := &sqlite3.SQLiteDriver{}
+	dc, err := d.Open(path)
+	if err != nil {
+		return err
+	}
+	dest := dc.(*sqlite3.SQLiteConn)
+	defer dest.Close()
+
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Raw(func(raw interface{}) error {
+		// the config database wraps the driver's connection
+		if w, ok := raw.(interface{ Unwrap() driver.Conn }); ok {
+			raw = w.Unwrap()
+		}
+		src, ok := raw.(*sqlite3.SQLiteConn)
+		if !ok {
+			return fmt.Errorf("Only SQLite databases can be backed up")
+		}
+		b, err := dest.Backup("main", src, "main")
+		if err != nil {
+			return err
+		}
+		for {
+			// copy a chunk at a time so writers aren't locked out for long
+			done, err := b.Step(256)
+			if err != nil {
+				b.Finish()
+				return err
+			}
+			if done {
+				return b.Finish()
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+}
+
+// Rotate makes a timestamped backup in dir and removes all but the newest keep backups
+func Rotate(db *sqlx.DB, dir string, keep int) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, "catbase-"+time.Now().Format("20060102-150405")+".db")
+	if err := Backup(db, path); err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	old, err := filepath.Glob(filepath.Join(dir, "catbase-*.db"))
+	if err != nil {
+		return path, err
+	}
+	// the timestamps sort oldest first
+	sort.Strings(old)
+	for keep > 0 && len(old) > keep {
+		if err := os.Remove(old[0]); err != nil {
+			log.Error().Err(err).Msgf("Could not remove old backup %s", old[0])
+		}
+		old = old[1:]
+	}
+	return path, nil
+}
+
+// Export writes every registered plugin's tables to dir as <plugin>.json
+func Export(db *sqlx.DB, dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	for plugin, ts := range tables {
+		data := map[string][]map[string]interface{}{}
+		for _, t := range ts {
+			rows, err := dump(db, t)
+			if err != nil {
+				return fmt.Errorf("exporting %s: %w", t.Name, err)
+			}
+			data[t.Name] = rows
+		}
+		j, err := json.MarshalIndent(data, "", "\t")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, plugin+".json"), j, 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// columns maps the lower cased columns of a table to their names
+// This keeps imported names out of the SQL unless they are real, and lets an
+// export from SQLite load into Postgres, which folds names to lower case.
+func columns(tx *sqlx.Tx, table string) (map[string]string, error) {
+	cols, err := config.Columns(tx, table)
+	if err != nil {
+		return nil, err
+	}
+	known := map[string]string{}
+	for _, c := range cols {
+		known[strings.ToLower(c)] = c
+	}
+	return known, nil
+}
+
+func dump(db *sqlx.DB, t Table) ([]map[string]interface{}, error) {
+	out := []map[string]interface{}{}
+	if !config.TableExists(db, t.Name) {
+		return out, nil
+	}
+	rows, err := db.Queryx(`select * from ` + t.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		row := map[string]interface{}{}
+		if err := rows.MapScan(row); err != nil {
+			return nil, err
+		}
+		for k, v := range row {
+			if b, ok := v.([]byte); ok {
+				row[k] = string(b)
+			}
+		}
+		if t.Skip != nil && t.Skip(row) {
+			continue
+		}
+		out = append(out, row)
+	}
+	return out, rows.Err()
+}
+
+// Import loads the files written by Export, replacing what the tables held
+// Each plugin is loaded in its own transaction. Tables missing from dir are left alone.
+func Import(db *sqlx.DB, dir string) error {
+	lock.Lock()
+	defer lock.Unlock()
+	for plugin, ts := range tables {
+		f, err := os.Open(filepath.Join(dir, plugin+".json"))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		data := map[string][]map[string]interface{}{}
+		dec := json.NewDecoder(f)
+		// keep numbers as they were written so the database sees the same values
+		dec.UseNumber()
+		err = dec.Decode(&data)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", plugin, err)
+		}
+		if err := load(db, ts, data); err != nil {
+			return fmt.Errorf("importing %s: %w", plugin, err)
+		}
+		log.Info().Msgf("Imported %s", plugin)
+	}
+	return nil
+}
+
+func load(db *sqlx.DB, ts []Table, data map[string][]map[string]interface{}) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	for _, t := range ts {
+		rows, ok := data[t.Name]
+		if !ok {
+			continue
+		}
+		if !config.TableExists(tx, t.Name) {
+			tx.Rollback()
+			return fmt.Errorf("table %s does not exist", t.Name)
+		}
+		known, err := columns(tx, t.Name)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if t.Skip == nil {
+			if _, err := tx.Exec(`delete from ` + t.Name); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		for _, row := range rows {
+			if err := insert(tx, t, known, row); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		if _, ok := known["id"]; ok && config.DialectOf(tx) == config.Postgres {
+			// ids were loaded as they were, so move the sequence past them
+			if _, err := tx.Exec(`select setval(pg_get_serial_sequence(?, 'id'), max(id)) from `+t.Name,
+				strings.ToLower(t.Name)); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+func insert(tx *sqlx.Tx, t Table, known map[string]string, row map[string]interface{}) error {
+	keys := []string{}
+	for k := range row {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	cols := make([]string, len(keys))
+	args := make([]interface{}, len(keys))
+	var merge interface{}
+	for i, k := range keys {
+		name, ok := known[strings.ToLower(k)]
+		if !ok {
+			return fmt.Errorf("table %s has no column %q", t.Name, k)
+		}
+		cols[i], args[i] = name, row[k]
+		if strings.EqualFold(k, t.Key) {
+			merge = row[k]
+		}
+	}
+	if t.Skip != nil && t.Key != "" {
+		// merging by deleting first works the same on every database
+		if _, err := tx.Exec(`delete from `+t.Name+` where `+t.Key+` = ?`, merge); err != nil {
+			return err
+		}
+	}
+	q := fmt.Sprintf(`insert into %s (%s) values (%s)`, t.Name,
+		strings.Join(cols, ", "), strings.TrimSuffix(strings.Repeat("?, ", len(cols)), ", "))
+	_, err := tx.Exec(q, args...)
+	return err
+}
@@ -0,0 +1,99 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/velour/catbase/config"
+)
+
+func setup(t *testing.T) *sqlx.DB {
+	db := sqlx.MustOpen("sqlite3", filepath.Join(t.TempDir(), "catbase.db"))
+	db.MustExec(`create table things (id integer primary key, name string, count integer);
+		insert into things (name, count) values ('cheese', 3), ('tea', 5);
+		create table settings (key string primary key, value string);
+		insert into settings values ('nick', 'catbase'), ('token', 'hunter2');`)
+	return db
+}
+
+func TestBackup(t *testing.T) {
+	db := setup(t)
+	path := filepath.Join(t.TempDir(), "copy.db")
+	assert.Nil(t, Backup(db, path))
+	copy := sqlx.MustOpen("sqlite3", path)
+	var count int
+	assert.Nil(t, copy.Get(&count, `select count(*) from things`))
+	assert.Equal(t, 2, count)
+}
+
+func TestBackupConfigDB(t *testing.T) {
+	c := config.ReadConfig(filepath.Join(t.TempDir(), "catbase.db"))
+	assert.Nil(t, c.Set("nick", "catbase"))
+	path := filepath.Join(t.TempDir(), "copy.db")
+	assert.Nil(t, Backup(c.DB, path))
+	copy := sqlx.MustOpen("sqlite3", path)
+	var nick string
+	assert.Nil(t, copy.Get(&nick, `select value from config where key='nick'`))
+	assert.Equal(t, "catbase", nick)
+}
+
+func TestRotateKeepsNewest(t *testing.T) {
+	db := setup(t)
+	dir := t.TempDir()
+	for _, name := range []string{"catbase-20190101-000000.db", "catbase-20190102-000000.db"} {
+		os.WriteFile(filepath.Join(dir, name), nil, 0600)
+	}
+	path, err := Rotate(db, dir, 2)
+	assert.Nil(t, err)
+	left, _ := filepath.Glob(filepath.Join(dir, "catbase-*.db"))
+	assert.Equal(t, []string{filepath.Join(dir, "catbase-20190102-000000.db"), path}, left)
+	assert.Contains(t, path, time.Now().Format("20060102"))
+}
+
+func TestExportImport(t *testing.T) {
+	Register("test",
+		Table{Name: "things"},
+		Table{Name: "settings", Key: "key", Skip: func(row map[string]interface{}) bool { return row["key"] == "token" }},
+	)
+	db := setup(t)
+	dir := t.TempDir()
+	assert.Nil(t, Export(db, dir))
+
+	other := setup(t)
+	other.MustExec(`delete from things; insert into things (name, count) values ('gone', 1);
+		update settings set value='kitty' where key='nick'; update settings set value='other' where key='token';`)
+	assert.Nil(t, Import(other, dir))
+
+	var things []struct {
+		Name  string
+		Count int
+	}
+	assert.Nil(t, other.Select(&things, `select name, count from things order by id`))
+	assert.Len(t, things, 2)
+	assert.Equal(t, "tea", things[1].Name)
+	assert.Equal(t, 5, things[1].Count)
+
+	var nick, token string
+	other.Get(&nick, `select value from settings where key='nick'`)
+	other.Get(&token, `select value from settings where key='token'`)
+	assert.Equal(t, "catbase", nick)
+	assert.Equal(t, "other", token, "Skipped rows should be left alone")
+}
+
+func TestImportRejectsUnknownColumns(t *testing.T) {
+	db := setup(t)
+	err := load(db, []Table{{Name: "things"}}, map[string][]map[string]interface{}{
+		"things": {{"name": "x", "count = 1; drop table things; --": 1}},
+	})
+	assert.NotNil(t, err)
+	var count int
+	assert.Nil(t, db.Get(&count, `select count(*) from things`))
+	assert.Equal(t, 2, count)
+}
@@ -3,21 +3,42 @@
 package bot
 
 import (
-	"fmt"
-	"math/rand"
 	"net/http"
 	"reflect"
 	"strings"
-	"time"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/rs/zerolog/log"
+	"github.com/velour/catbase/bot/metrics"
+	"github.com/velour/catbase/bot/migrate"
 	"github.com/velour/catbase/bot/msg"
 	"github.com/velour/catbase/bot/msglog"
+	"github.com/velour/catbase/bot/schedule"
 	"github.com/velour/catbase/bot/user"
 	"github.com/velour/catbase/config"
 )
 
+func init() {
+	migrate.Register("bot", migrate.Step{
+		Version: 1,
+		Name:    "create variables table",
+		SQL: `create table if not exists variables (
+			id integer primary key,
+			name string,
+			value string
+		);`,
+	})
+	config.Declare(
+		config.Key{Name: "Nick", Default: "bot", Description: "the name I answer to"},
+		config.Key{Name: "channels", Type: config.Array, Description: "connector:channel targets I join and post to"},
+		config.Key{Name: "type", Type: config.Array, Default: "slackapp", Description: "connectors to start; the first is the default"},
+		config.Key{Name: "CommandChar", Type: config.Array, Default: "!", Description: "prefixes that mark a message as a command"},
+		config.Key{Name: "HttpAddr", Default: "127.0.0.1:1337", Description: "address of the web pages"},
+		config.Key{Name: "MsgLog.TailSize", Type: config.Int, Default: "50", Min: 1, Max: 10000,
+			Description: "messages of each channel kept in memory"},
+	)
+}
+
 // bot type provides storage for bot-wide information, configs, and database connections
 type bot struct {
 	// Each plugin must be registered in our plugins handler. To come: a map so that this
@@ -32,10 +53,41 @@ type bot struct {
 
 	config *config.Config
 
-	conn Connector
+	// connectors holds every chat service the bot is attached to, by name
+	connectors     map[string]Connector
+	connectorNames map[Connector]string
+	// defaultConn is the name of the first connector added
+	defaultConn string
+
+	// msglog keeps the history of every channel
+	msglog *msglog.MsgLogger
+
+	// perms holds the roles of users and the commands they may run
+	perms *Permissions
+
+	// accounts holds who is logged in to the web pages
+	accounts *Accounts
+
+	// limits keeps people from flooding commands
+	limits *Limiter
+
+	// sched runs timed work for the plugins
+	sched *schedule.Scheduler
 
-	logIn  chan msg.Message
-	logOut chan msg.Messages
+	// health tracks failing plugins
+	health *pluginHealth
+
+	// life lets Stop wait for the events being handled
+	life lifecycle
+
+	// bus carries events between plugins
+	bus eventBus
+
+	// sends queues messages under each channel's rate limits
+	sends sender
+
+	// convos are the questions plugins are waiting on answers to
+	convos conversations
 
 	version string
 
@@ -47,8 +99,8 @@ type bot struct {
 
 	callbacks CallbackMap
 
-	password        string
-	passwordCreated time.Time
+	// commands declared by plugins
+	commands *commandRegistry
 }
 
 type EndPoint struct {
@@ -60,13 +112,8 @@ type Variable struct {
 	Variable, Value string
 }
 
-// New creates a bot for a given connection and set of handlers.
-func New(config *config.Config, connector Connector) Bot {
-	logIn := make(chan msg.Message)
-	logOut := make(chan msg.Messages)
-
-	msglog.RunNew(logIn, logOut)
-
+// New creates a bot with no connections. Use AddConnector to attach chat services.
+func New(config *config.Config) Bot {
 	users := []user.User{
 		{
 			Name: config.Get("Nick", "bot"),
@@ -77,27 +124,96 @@ func New(config *config.Config, connector Connector) Bot {
 		config:         config,
 		plugins:        make(map[string]Plugin),
 		pluginOrdering: make([]string, 0),
-		conn:           connector,
+		connectors:     make(map[string]Connector),
+		connectorNames: make(map[Connector]string),
 		users:          users,
 		me:             users[0],
-		logIn:          logIn,
-		logOut:         logOut,
+		msglog:         msglog.New(config.DB, config.GetInt("MsgLog.TailSize", msglog.DefaultTail)),
+		perms:          NewPermissions(config),
+		sched:          schedule.New(config.DB),
+		health:         newPluginHealth(config),
 		httpEndPoints:  make([]EndPoint, 0),
 		filters:        make(map[string]func(string) string),
 		callbacks:      make(CallbackMap),
+		commands:       newCommandRegistry(),
 	}
 
+	bot.accounts = NewAccounts(config, bot.perms)
+	bot.limits = NewLimiter(config, bot.perms, bot.Send)
 	bot.migrateDB()
+	bot.scheduleBackups()
 
 	http.HandleFunc("/", bot.serveRoot)
-
-	connector.RegisterEvent(bot.Receive)
+	http.HandleFunc("/help", bot.serveHelp)
+	bot.RegisterWeb("/help", "Help")
+	http.HandleFunc("/schedule", bot.serveSchedule)
+	bot.RegisterWeb("/schedule", "Schedule")
+	http.Handle("/metrics", metrics.Handler())
+	http.HandleFunc("/healthz", bot.serveHealthz)
+	http.HandleFunc("/readyz", bot.serveReadyz)
+	http.HandleFunc("/login", bot.accounts.serveLogin)
+	http.HandleFunc("/logout", bot.accounts.serveLogout)
 
 	return bot
 }
 
+// AddConnector attaches a chat service to the bot under the given name
+// The first connector added becomes the default connector
+func (b *bot) AddConnector(name string, conn Connector) {
+	if _, ok := b.connectors[name]; ok {
+		log.Fatal().Msgf("Connector %s was added twice", name)
+	}
+	if b.defaultConn == "" {
+		b.defaultConn = name
+	}
+	b.connectors[name] = conn
+	b.connectorNames[conn] = name
+	conn.RegisterEvent(b.Receive)
+}
+
 func (b *bot) DefaultConnector() Connector {
-	return b.conn
+	return b.connectors[b.defaultConn]
+}
+
+// GetConnector returns the named connector or nil if it does not exist
+func (b *bot) GetConnector(name string) Connector {
+	return b.connectors[name]
+}
+
+// ResolveTarget finds the connector and channel for a config entry
+// Entries are of the form "connector:channel"; a bare channel uses the default connector
+func (b *bot) ResolveTarget(target string) (Connector, string) {
+	name, channel := ParseTarget(target)
+	if name == "" {
+		return b.DefaultConnector(), channel
+	}
+	return b.connectors[name], channel
+}
+
+// ParseTarget splits a "connector:channel" config entry into its parts
+// The connector is empty if the entry does not name one
+func ParseTarget(target string) (string, string) {
+	parts := strings.SplitN(target, ":", 2)
+	if len(parts) != 2 {
+		return "", target
+	}
+	return parts[0], parts[1]
+}
+
+// Target joins a connector name and channel into a config entry understood by ParseTarget
+func Target(connector, channel string) string {
+	if connector == "" {
+		return channel
+	}
+	return connector + ":" + channel
+}
+
+// connectorFor finds the connector a message came from, falling back to the default
+func (b *bot) connectorFor(message msg.Message) Connector {
+	if conn, ok := b.connectors[message.Connector]; ok {
+		return conn
+	}
+	return b.DefaultConnector()
 }
 
 func (b *bot) WhoAmI() string {
@@ -113,17 +229,35 @@ func (b *bot) DB() *sqlx.DB {
 	return b.config.DB
 }
 
-// Create any tables if necessary based on version of DB
-// Plugins should create their own tables, these are only for official bot stuff
+// Permissions gives access to user roles and command permissions
+func (b *bot) Permissions() *Permissions {
+	return b.perms
+}
+
+// Accounts gives access to who is logged in to the web pages
+func (b *bot) Accounts() *Accounts {
+	return b.accounts
+}
+
+// Limits gives access to command cooldowns and who is ignored for flooding
+func (b *bot) Limits() *Limiter {
+	return b.limits
+}
+
+// Scheduler runs timed work for the plugins
+func (b *bot) Scheduler() *schedule.Scheduler {
+	return b.sched
+}
+
+// MessageLog gives access to the history of every channel
+func (b *bot) MessageLog() *msglog.MsgLogger {
+	return b.msglog
+}
+
+// migrateDB brings every registered schema up to date before any plugin starts
 // Note: This does not return an error. Database issues are all fatal at this stage.
 func (b *bot) migrateDB() {
-	if _, err := b.DB().Exec(`create table if not exists variables (
-			id integer primary key,
-			name string,
-			value string
-		);`); err != nil {
-		log.Fatal().Err(err).Msgf("Initial DB migration create variables table")
-	}
+	migrate.MustUp(b.DB())
 }
 
 // Adds a constructed handler to the bots handlers list
@@ -133,8 +267,11 @@ func (b *bot) AddPlugin(h Plugin) {
 	b.pluginOrdering = append(b.pluginOrdering, name)
 }
 
-func (b *bot) Who(channel string) []user.User {
-	names := b.conn.Who(channel)
+func (b *bot) Who(conn Connector, channel string) []user.User {
+	if conn == nil {
+		return []user.User{}
+	}
+	names := conn.Who(channel)
 	users := []user.User{}
 	for _, n := range names {
 		users = append(users, user.New(n))
@@ -180,44 +317,8 @@ func IsCmd(c *config.Config, message string) (bool, string) {
 	return iscmd, message
 }
 
-func (b *bot) CheckAdmin(nick string) bool {
-	for _, u := range b.Config().GetArray("Admins", []string{}) {
-		if nick == u {
-			return true
-		}
-	}
-	return false
-}
-
-var users = map[string]*user.User{}
-
-func (b *bot) GetUser(nick string) *user.User {
-	if _, ok := users[nick]; !ok {
-		users[nick] = &user.User{
-			Name:  nick,
-			Admin: b.checkAdmin(nick),
-		}
-	}
-	return users[nick]
-}
-
-func (b *bot) NewUser(nick string) *user.User {
-	return &user.User{
-		Name:  nick,
-		Admin: b.checkAdmin(nick),
-	}
-}
-
-func (b *bot) checkAdmin(nick string) bool {
-	for _, u := range b.Config().GetArray("Admins", []string{}) {
-		if nick == u {
-			return true
-		}
-	}
-	return false
-}
-
 // Register a text filter which every outgoing message is passed through
+// RegisterFilter adds a function the text of every message sent is run through
 func (b *bot) RegisterFilter(name string, f func(string) string) {
 	b.filters[name] = f
 }
@@ -234,18 +335,17 @@ func (b *bot) Register(p Plugin, kind Kind, cb Callback) {
 	b.callbacks[t][kind] = append(b.callbacks[t][kind], cb)
 }
 
-func (b *bot) RegisterWeb(root, name string) {
-	b.httpEndPoints = append(b.httpEndPoints, EndPoint{name, root})
+// RegisterCommand declares a command of a plugin
+// The bot matches messages against it and generates help from the declaration
+func (b *bot) RegisterCommand(p Plugin, cmd Command) {
+	if cmd.Permission != "" && cmd.Role != Nobody {
+		b.perms.Declare(cmd.Permission, cmd.Role)
+	}
+	if err := b.commands.add(reflect.TypeOf(p).String(), cmd); err != nil {
+		log.Fatal().Err(err).Msg("Could not register command")
+	}
 }
 
-func (b *bot) GetPassword() string {
-	if b.passwordCreated.Before(time.Now().Add(-24 * time.Hour)) {
-		adjs := b.config.GetArray("bot.passwordAdjectives", []string{"very"})
-		nouns := b.config.GetArray("bot.passwordNouns", []string{"noun"})
-		verbs := b.config.GetArray("bot.passwordVerbs", []string{"do"})
-		a, n, v := adjs[rand.Intn(len(adjs))], nouns[rand.Intn(len(nouns))], verbs[rand.Intn(len(verbs))]
-		b.passwordCreated = time.Now()
-		b.password = fmt.Sprintf("%s-%s-%s", a, n, v)
-	}
-	return b.password
+func (b *bot) RegisterWeb(root, name string) {
+	b.httpEndPoints = append(b.httpEndPoints, EndPoint{name, root})
 }
@@ -0,0 +1,26 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTarget(t *testing.T) {
+	conn, ch := ParseTarget("irc:#general")
+	assert.Equal(t, "irc", conn)
+	assert.Equal(t, "#general", ch)
+}
+
+func TestParseTargetBare(t *testing.T) {
+	conn, ch := ParseTarget("C0S04SMRC")
+	assert.Equal(t, "", conn)
+	assert.Equal(t, "C0S04SMRC", ch)
+}
+
+func TestTargetRoundTrip(t *testing.T) {
+	conn, ch := ParseTarget(Target("slack", "C0S04SMRC"))
+	assert.Equal(t, "slack", conn)
+	assert.Equal(t, "C0S04SMRC", ch)
+	assert.Equal(t, "#general", Target("", "#general"))
+}
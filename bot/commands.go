@@ -0,0 +1,337 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+package bot
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/velour/catbase/bot/msg"
+)
+
+// Command declares something a plugin does when it is addressed
+// The bot matches the pattern and hands the handler the parsed arguments
+type Command struct {
+	// Pattern is a list of words and {arguments}, like "remind {who} in {when:duration} {what:text}"
+	// Arguments may be typed as word (the default), int, float, duration or text,
+	// which takes the rest of the message. A trailing ? makes an argument optional: {who?}
+	Pattern string
+	// Usage describes what the command does
+	Usage string
+	// Examples of the command being used
+	Examples []string
+	// Permission names the permission needed to run the command, if any
+	Permission string
+	// Role is declared as the requirement for Permission when it is set
+	Role Role
+	// Ambient commands also match messages that are not addressed to the bot
+	Ambient bool
+	// Cooldown limits how often the command may be used, when it has a time
+	// Its name defaults to the plugin's.
+	Cooldown Cooldown
+	// Handler runs the command. Commands without one are only documented in help.
+	Handler CommandHandler
+}
+
+// CommandHandler runs a matched command
+type CommandHandler func(Connector, msg.Message, Args) bool
+
+// Args holds the arguments a command matched, converted to their declared types
+type Args map[string]interface{}
+
+// Has checks whether an optional argument was given
+func (a Args) Has(name string) bool {
+	_, ok := a[name]
+	return ok
+}
+
+func (a Args) String(name string) string {
+	s, _ := a[name].(string)
+	return s
+}
+
+func (a Args) Int(name string) int {
+	i, _ := a[name].(int)
+	return i
+}
+
+func (a Args) Float(name string) float64 {
+	f, _ := a[name].(float64)
+	return f
+}
+
+func (a Args) Duration(name string) time.Duration {
+	d, _ := a[name].(time.Duration)
+	return d
+}
+
+const (
+	argWord     = "word"
+	argInt      = "int"
+	argFloat    = "float"
+	argDuration = "duration"
+	argText     = "text"
+)
+
+var argPattern = regexp.MustCompile(`^\{(\w+)(?::(\w+))?(\?)?\}$`)
+var inlineArgPattern = regexp.MustCompile(`\{(\w+)(?::(\w+))?(\?)?\}`)
+var fieldPattern = regexp.MustCompile(`\S+`)
+
+type commandPart struct {
+	literal  string
+	name     string
+	kind     string
+	optional bool
+}
+
+// command is a Command with its pattern parsed
+type command struct {
+	Command
+	parts []commandPart
+}
+
+func compileCommand(cmd Command) (*command, error) {
+	c := &command{Command: cmd}
+	fields := strings.Fields(cmd.Pattern)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("Empty command pattern")
+	}
+	// documentation, like "{item}++", may describe things the pattern language can't match
+	if cmd.Handler == nil {
+		return c, nil
+	}
+	for i, f := range fields {
+		m := argPattern.FindStringSubmatch(f)
+		if m == nil {
+			if strings.ContainsAny(f, "{}") {
+				return nil, fmt.Errorf("Bad argument %s in %q", f, cmd.Pattern)
+			}
+			if len(c.parts) > 0 && c.parts[len(c.parts)-1].optional {
+				return nil, fmt.Errorf("Word %s follows an optional argument in %q", f, cmd.Pattern)
+			}
+			c.parts = append(c.parts, commandPart{literal: f})
+			continue
+		}
+		part := commandPart{name: m[1], kind: m[2], optional: m[3] != ""}
+		if part.kind == "" {
+			part.kind = argWord
+		}
+		switch part.kind {
+		case argWord, argInt, argFloat, argDuration:
+		case argText:
+			if i != len(fields)-1 {
+				return nil, fmt.Errorf("Text argument %s must come last in %q", part.name, cmd.Pattern)
+			}
+		default:
+			return nil, fmt.Errorf("Unknown argument type %s in %q", part.kind, cmd.Pattern)
+		}
+		if !part.optional && len(c.parts) > 0 && c.parts[len(c.parts)-1].optional {
+			return nil, fmt.Errorf("Argument %s follows an optional argument in %q", part.name, cmd.Pattern)
+		}
+		c.parts = append(c.parts, part)
+	}
+	return c, nil
+}
+
+// match checks a message body against the pattern and extracts the arguments
+func (c *command) match(body string) (Args, bool) {
+	fields := fieldPattern.FindAllStringIndex(body, -1)
+	args := Args{}
+	i := 0
+	for _, part := range c.parts {
+		if i >= len(fields) {
+			if part.optional {
+				continue
+			}
+			return nil, false
+		}
+		word := body[fields[i][0]:fields[i][1]]
+		if part.literal != "" {
+			if !strings.EqualFold(part.literal, word) {
+				return nil, false
+			}
+			i++
+			continue
+		}
+		var err error
+		switch part.kind {
+		case argWord:
+			args[part.name] = word
+		case argInt:
+			args[part.name], err = strconv.Atoi(word)
+		case argFloat:
+			args[part.name], err = strconv.ParseFloat(word, 64)
+		case argDuration:
+			args[part.name], err = time.ParseDuration(word)
+		case argText:
+			args[part.name] = strings.TrimSpace(body[fields[i][0]:])
+			i = len(fields)
+			continue
+		}
+		if err != nil {
+			return nil, false
+		}
+		i++
+	}
+	if i != len(fields) {
+		return nil, false
+	}
+	return args, true
+}
+
+// Syntax shows the pattern the way help prints it
+func (c *command) Syntax() string {
+	return inlineArgPattern.ReplaceAllStringFunc(c.Pattern, func(arg string) string {
+		m := inlineArgPattern.FindStringSubmatch(arg)
+		name := m[1]
+		if m[2] == argText {
+			name += "..."
+		}
+		if m[3] != "" {
+			return "[<" + name + ">]"
+		}
+		return "<" + name + ">"
+	})
+}
+
+// HelpEntry is the documentation of one command
+type HelpEntry struct {
+	Syntax   string
+	Usage    string
+	Examples []string
+	Role     string
+}
+
+// HelpTopic lists the documented commands of one plugin
+type HelpTopic struct {
+	Plugin   string
+	Commands []HelpEntry
+}
+
+// commandRegistry holds every command declared by the plugins, by plugin type name
+type commandRegistry struct {
+	sync.RWMutex
+	commands map[string][]*command
+	// order keeps the plugins in the order they declared their first command
+	order []string
+}
+
+func newCommandRegistry() *commandRegistry {
+	return &commandRegistry{commands: make(map[string][]*command)}
+}
+
+func (r *commandRegistry) add(plugin string, cmd Command) error {
+	c, err := compileCommand(cmd)
+	if err != nil {
+		return err
+	}
+	r.Lock()
+	defer r.Unlock()
+	if _, ok := r.commands[plugin]; !ok {
+		r.order = append(r.order, plugin)
+	}
+	r.commands[plugin] = append(r.commands[plugin], c)
+	return nil
+}
+
+func (r *commandRegistry) has(plugin string) bool {
+	r.RLock()
+	defer r.RUnlock()
+	return len(r.commands[plugin]) > 0
+}
+
+// dispatch runs the first of a plugin's commands that matches the message
+func (r *commandRegistry) dispatch(b Bot, conn Connector, plugin string, message msg.Message) bool {
+	r.RLock()
+	commands := r.commands[plugin]
+	r.RUnlock()
+	for _, c := range commands {
+		if c.Handler == nil || (!message.Command && !c.Ambient) {
+			continue
+		}
+		args, ok := c.match(message.Body)
+		if !ok {
+			continue
+		}
+		if c.Permission != "" && !b.Permissions().Allowed(message, c.Permission) {
+			b.Send(conn, Message, message.Channel, NoPermission)
+			return true
+		}
+		if c.Cooldown.User > 0 || c.Cooldown.Channel > 0 {
+			cd := c.Cooldown
+			if cd.Name == "" {
+				cd.Name = pluginName(plugin)
+			}
+			if !b.Limits().Allow(conn, message, cd) {
+				return true
+			}
+		}
+		if c.Handler(conn, message, args) {
+			return true
+		}
+	}
+	return false
+}
+
+// help documents the commands of a plugin
+func (r *commandRegistry) help(b Bot, plugin string) HelpTopic {
+	r.RLock()
+	defer r.RUnlock()
+	topic := HelpTopic{Plugin: pluginName(plugin)}
+	for _, c := range r.commands[plugin] {
+		e := HelpEntry{
+			Syntax:   c.Syntax(),
+			Usage:    c.Usage,
+			Examples: c.Examples,
+		}
+		if c.Permission != "" {
+			if role := b.Permissions().Required(c.Permission); role != Nobody {
+				e.Role = role.String()
+			}
+		}
+		topic.Commands = append(topic.Commands, e)
+	}
+	return topic
+}
+
+// topics documents every plugin that declared commands, sorted by name
+func (r *commandRegistry) topics(b Bot) []HelpTopic {
+	r.RLock()
+	plugins := append([]string{}, r.order...)
+	r.RUnlock()
+	topics := []HelpTopic{}
+	for _, p := range plugins {
+		topics = append(topics, r.help(b, p))
+	}
+	sort.Slice(topics, func(i, j int) bool { return topics[i].Plugin < topics[j].Plugin })
+	return topics
+}
+
+// String formats a help topic for chat
+func (t HelpTopic) String() string {
+	lines := []string{}
+	for _, c := range t.Commands {
+		line := c.Syntax
+		if c.Usage != "" {
+			line += " - " + c.Usage
+		}
+		if c.Role != "" {
+			line += fmt.Sprintf(" (%s only)", c.Role)
+		}
+		if len(c.Examples) > 0 {
+			line += fmt.Sprintf(" e.g. %s", strings.Join(c.Examples, "; "))
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// pluginName shortens a plugin type name like *counter.CounterPlugin to counter
+func pluginName(t string) string {
+	return strings.Split(strings.TrimPrefix(t, "*"), ".")[0]
+}
@@ -0,0 +1,119 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/bot/user"
+)
+
+func noop(Connector, msg.Message, Args) bool { return true }
+
+func mustCompile(t *testing.T, pattern string) *command {
+	c, err := compileCommand(Command{Pattern: pattern, Handler: noop})
+	assert.Nil(t, err)
+	return c
+}
+
+func TestCommandMatch(t *testing.T) {
+	c := mustCompile(t, "remind {who} in {when:duration} {what:text}")
+	args, ok := c.match("Remind me in 5m  to  go home")
+	assert.True(t, ok)
+	assert.Equal(t, "me", args.String("who"))
+	assert.Equal(t, 5*time.Minute, args.Duration("when"))
+	assert.Equal(t, "to  go home", args.String("what"))
+}
+
+func TestCommandMatchTypes(t *testing.T) {
+	c := mustCompile(t, "pad {n:int} {f:float}")
+	args, ok := c.match("pad 3 1.5")
+	assert.True(t, ok)
+	assert.Equal(t, 3, args.Int("n"))
+	assert.Equal(t, 1.5, args.Float("f"))
+	_, ok = c.match("pad three 1.5")
+	assert.False(t, ok)
+}
+
+func TestCommandMatchExtraWords(t *testing.T) {
+	c := mustCompile(t, "whoami")
+	_, ok := c.match("whoami")
+	assert.True(t, ok)
+	_, ok = c.match("whoami really")
+	assert.False(t, ok)
+	_, ok = c.match("who")
+	assert.False(t, ok)
+}
+
+func TestCommandMatchOptional(t *testing.T) {
+	c := mustCompile(t, "leaderboard {item?}")
+	args, ok := c.match("leaderboard")
+	assert.True(t, ok)
+	assert.False(t, args.Has("item"))
+	args, ok = c.match("leaderboard beer")
+	assert.True(t, ok)
+	assert.Equal(t, "beer", args.String("item"))
+}
+
+func TestCommandBadPatterns(t *testing.T) {
+	for _, p := range []string{
+		"",
+		"say {what:text} now",
+		"roll {n:dice}",
+		"top {n?} items",
+		"broken {arg",
+	} {
+		_, err := compileCommand(Command{Pattern: p, Handler: noop})
+		assert.NotNil(t, err, p)
+	}
+}
+
+func TestDocumentationOnlyCommand(t *testing.T) {
+	c, err := compileCommand(Command{Pattern: "{item}++"})
+	assert.Nil(t, err)
+	assert.Equal(t, "<item>++", c.Syntax())
+}
+
+func TestCommandSyntax(t *testing.T) {
+	c := mustCompile(t, "tell {who} {what:text}")
+	assert.Equal(t, "tell <who> <what...>", c.Syntax())
+	c = mustCompile(t, "leaderboard {item?}")
+	assert.Equal(t, "leaderboard [<item>]", c.Syntax())
+}
+
+type testPlugin struct{}
+
+func TestDispatch(t *testing.T) {
+	mb := NewMockBot()
+	mb.DB().MustExec(`delete from roles`)
+	said := ""
+	p := &testPlugin{}
+	mb.RegisterCommand(p, Command{
+		Pattern: "say {what:text}",
+		Usage:   "repeats something",
+		Handler: func(c Connector, m msg.Message, args Args) bool {
+			said = args.String("what")
+			return true
+		},
+	})
+	mb.RegisterCommand(p, Command{
+		Pattern:    "secret",
+		Permission: "test.secret",
+		Role:       Admin,
+		Handler:    noop,
+	})
+	m := msg.Message{User: &user.User{Name: "tester"}, Body: "say hi there"}
+	assert.False(t, mb.Receive(nil, Message, m), "commands must be addressed")
+	m.Command = true
+	assert.True(t, mb.Receive(nil, Message, m))
+	assert.Equal(t, "hi there", said)
+
+	m.Body = "secret"
+	assert.True(t, mb.Receive(nil, Message, m))
+	assert.Equal(t, []string{NoPermission}, mb.Messages)
+
+	help := mb.Help(p)
+	assert.Contains(t, help, "say <what...> - repeats something")
+	assert.Contains(t, help, "secret (admin only)")
+}
@@ -0,0 +1,175 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+package bot
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/config"
+)
+
+func init() {
+	config.Declare(config.Key{Name: "conversation.timeout", Type: config.Int, Default: "300", Min: 1, Max: 86400,
+		Description: "seconds I wait for an answer to a question a plugin asked"})
+}
+
+// Answer handles the next message in a conversation
+// Returning false lets the plugins see the message as usual.
+type Answer func(Connector, msg.Message) bool
+
+// Prompt is a question a plugin asks and how to wait for its answer
+type Prompt struct {
+	Connector Connector
+	Channel   string
+	// Question is sent to the channel, or the thread, when it is not empty
+	Question string
+	// Thread is the ID of the message whose replies are awaited; empty waits in the channel
+	Thread string
+	// User is the UserKey of who may answer; empty lets anybody
+	User string
+	// Timeout is how long to wait, conversation.timeout seconds when zero
+	Timeout time.Duration
+	// Answer gets the next matching message, after which the conversation is over
+	Answer Answer
+	// Expired runs if no answer came in time
+	Expired func()
+}
+
+// Conversation is a prompt waiting for its answer
+type Conversation struct {
+	Prompt
+	plugin    string
+	connector string
+	timer     *time.Timer
+	convos    *conversations
+}
+
+// Cancel stops waiting for an answer
+func (c *Conversation) Cancel() {
+	c.convos.remove(c)
+}
+
+func (c *Conversation) key() string {
+	return Target(c.connector, c.Channel) + "|" + c.Thread
+}
+
+// conversations holds the prompts waiting for answers, keyed by connector:channel and thread
+// The zero value is ready to use.
+type conversations struct {
+	sync.Mutex
+	waiting map[string][]*Conversation
+}
+
+// ask starts waiting for an answer to a prompt, replacing the plugin's earlier prompt to the same people
+func (cs *conversations) ask(c *config.Config, plugin, connector string, p Prompt) *Conversation {
+	conv := &Conversation{Prompt: p, plugin: plugin, connector: connector, convos: cs}
+	if conv.Timeout <= 0 {
+		conv.Timeout = time.Duration(c.GetInt("conversation.timeout", 300)) * time.Second
+	}
+	cs.Lock()
+	defer cs.Unlock()
+	if cs.waiting == nil {
+		cs.waiting = make(map[string][]*Conversation)
+	}
+	key := conv.key()
+	kept := []*Conversation{}
+	for _, w := range cs.waiting[key] {
+		if w.plugin == plugin && w.User == p.User {
+			w.timer.Stop()
+			continue
+		}
+		kept = append(kept, w)
+	}
+	cs.waiting[key] = append(kept, conv)
+	conv.timer = time.AfterFunc(conv.Timeout, func() {
+		if cs.remove(conv) && conv.Expired != nil {
+			conv.Expired()
+		}
+	})
+	return conv
+}
+
+// remove stops a conversation, returning whether it was still waiting
+func (cs *conversations) remove(conv *Conversation) bool {
+	cs.Lock()
+	defer cs.Unlock()
+	conv.timer.Stop()
+	key := conv.key()
+	for i, w := range cs.waiting[key] {
+		if w == conv {
+			cs.waiting[key] = append(cs.waiting[key][:i:i], cs.waiting[key][i+1:]...)
+			if len(cs.waiting[key]) == 0 {
+				delete(cs.waiting, key)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// take finds and ends the newest conversation a message answers
+// Replies answer conversations in their thread, other messages those in the channel.
+func (cs *conversations) take(kind Kind, message msg.Message, args []interface{}) *Conversation {
+	if kind != Message && kind != Action && kind != Reply {
+		return nil
+	}
+	thread := ""
+	if kind == Reply && len(args) > 0 {
+		thread, _ = args[0].(string)
+	}
+	key := Target(message.Connector, message.Channel) + "|" + thread
+	user := UserKey(message)
+	cs.Lock()
+	waiting := cs.waiting[key]
+	cs.Unlock()
+	for i := len(waiting) - 1; i >= 0; i-- {
+		w := waiting[i]
+		if (w.User == "" || w.User == user) && cs.remove(w) {
+			return w
+		}
+	}
+	return nil
+}
+
+// Ask sends a prompt's question and waits for the answer
+func (b *bot) Ask(plugin Plugin, p Prompt) *Conversation {
+	conv := b.convos.ask(b.config, reflect.TypeOf(plugin).String(), b.connectorNames[p.Connector], p)
+	sendQuestion(b, p)
+	return conv
+}
+
+// sendQuestion asks a prompt's question in its thread or channel
+func sendQuestion(b Bot, p Prompt) {
+	if p.Question == "" {
+		return
+	}
+	var err error
+	if p.Thread != "" {
+		_, err = b.Send(p.Connector, Reply, p.Channel, p.Question, p.Thread)
+	} else {
+		_, err = b.Send(p.Connector, Message, p.Channel, p.Question)
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Could not ask a question")
+	}
+}
+
+// answer hands a message to the conversation waiting for it, if there is one
+// The bot's own messages never answer.
+func (b *bot) answer(conn Connector, kind Kind, message msg.Message, args []interface{}) bool {
+	if message.User != nil && strings.EqualFold(message.User.Name, b.config.Get("Nick", "bot")) {
+		return false
+	}
+	conv := b.convos.take(kind, message, args)
+	if conv == nil {
+		return false
+	}
+	return b.isolate(conv.plugin, kind, message, func(message msg.Message) bool {
+		return conv.Answer(conn, message)
+	})
+}
@@ -0,0 +1,88 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/bot/user"
+)
+
+func said(who, body string) msg.Message {
+	return msg.Message{User: &user.User{ID: who, Name: who}, Channel: "#c", Body: body}
+}
+
+func TestAskWaitsForTheUser(t *testing.T) {
+	p := &panicker{}
+	b := lifeBot(t, p)
+	r := &recorder{}
+	answers := []string{}
+	b.Ask(p, Prompt{
+		Connector: r,
+		Channel:   "#c",
+		Question:  "Are you sure?",
+		User:      "asked",
+		Answer: func(_ Connector, m msg.Message) bool {
+			answers = append(answers, m.Body)
+			return true
+		},
+	})
+	assert.Equal(t, []string{"Are you sure?"}, r.sent)
+
+	b.Receive(r, Message, said("other", "no"))
+	b.Receive(r, Message, said("asked", "yes"))
+	b.Receive(r, Message, said("asked", "really"))
+	assert.Equal(t, []string{"yes"}, answers)
+}
+
+func TestAskInAThread(t *testing.T) {
+	mb := NewMockBot()
+	p := &panicker{}
+	answered := false
+	mb.Ask(p, Prompt{Channel: "#c", Question: "left or right?", Thread: "ts1",
+		Answer: func(Connector, msg.Message) bool {
+			answered = true
+			return true
+		}})
+	assert.False(t, mb.Receive(nil, Message, said("a", "left")))
+	assert.False(t, mb.Receive(nil, Reply, said("a", "left"), "ts2"))
+	assert.True(t, mb.Receive(nil, Reply, said("a", "left"), "ts1"))
+	assert.True(t, answered)
+}
+
+func TestAskExpires(t *testing.T) {
+	mb := NewMockBot()
+	p := &panicker{}
+	expired := make(chan bool, 1)
+	mb.Ask(p, Prompt{Channel: "#c", Timeout: 10 * time.Millisecond,
+		Answer:  func(Connector, msg.Message) bool { return true },
+		Expired: func() { expired <- true },
+	})
+	select {
+	case <-expired:
+	case <-time.After(time.Second):
+		t.Fatal("the question never expired")
+	}
+	assert.False(t, mb.Receive(nil, Message, said("a", "too late")))
+}
+
+func TestAskAgainReplacesTheQuestion(t *testing.T) {
+	mb := NewMockBot()
+	p := &panicker{}
+	answers := []string{}
+	ask := func(q string) *Conversation {
+		return mb.Ask(p, Prompt{Channel: "#c", Answer: func(_ Connector, m msg.Message) bool {
+			answers = append(answers, q+":"+m.Body)
+			return true
+		}})
+	}
+	ask("first")
+	ask("second")
+	assert.True(t, mb.Receive(nil, Message, said("a", "yes")))
+	assert.False(t, mb.Receive(nil, Message, said("a", "yes")))
+	assert.Equal(t, []string{"second:yes"}, answers)
+
+	ask("third").Cancel()
+	assert.False(t, mb.Receive(nil, Message, said("a", "yes")))
+}
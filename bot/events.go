@@ -0,0 +1,196 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+package bot
+
+import (
+	"reflect"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/velour/catbase/bot/metrics"
+)
+
+var eventsPublished = metrics.NewCounter("catbase_events_published_total",
+	"Events plugins published on the bus", "topic")
+
+// BusEvent is something a plugin announces for other plugins to react to
+// Subscribers get the event's own type back with a type switch or assertion.
+type BusEvent interface {
+	Topic() string
+}
+
+// EventHandler reacts to an event on the bus
+type EventHandler func(BusEvent)
+
+// AllEvents subscribes to every topic, for things like audit logs
+const AllEvents = "*"
+
+// CounterChanged is published when a counter goes up or down
+type CounterChanged struct {
+	Nick  string `json:"nick"`
+	Item  string `json:"item"`
+	Count int    `json:"count"`
+	Delta int    `json:"delta"`
+}
+
+func (CounterChanged) Topic() string { return "counter.changed" }
+
+// UpdateCounter asks the counter plugin to add Delta to a counter, or to set it to Value when Set is true
+// It is done when Publish returns, and Result, when not nil, holds the new count.
+type UpdateCounter struct {
+	Nick   string `json:"nick"`
+	Item   string `json:"item"`
+	Delta  int    `json:"delta"`
+	Set    bool   `json:"set"`
+	Value  int    `json:"value"`
+	Result *int   `json:"-"`
+}
+
+func (UpdateCounter) Topic() string { return "counter.update" }
+
+// LearnFactoid asks the fact plugin to learn a factoid another plugin made, like a quote
+// It is done when Publish returns, and Learned, when not nil, says whether it was saved.
+type LearnFactoid struct {
+	Fact    string `json:"fact"`
+	Verb    string `json:"verb"`
+	Tidbit  string `json:"tidbit"`
+	Owner   string `json:"owner"`
+	Target  string `json:"target"`
+	Learned *bool  `json:"-"`
+}
+
+func (LearnFactoid) Topic() string { return "fact.learn" }
+
+// FactoidLearned is published when someone teaches the bot a factoid
+type FactoidLearned struct {
+	ID     int64  `json:"id"`
+	Fact   string `json:"fact"`
+	Verb   string `json:"verb"`
+	Tidbit string `json:"tidbit"`
+	Owner  string `json:"owner"`
+	// Target is the connector:channel it was learned in
+	Target string `json:"target"`
+}
+
+func (FactoidLearned) Topic() string { return "fact.learned" }
+
+// FactoidForgotten is published when someone makes the bot forget a factoid
+type FactoidForgotten struct {
+	ID     int64  `json:"id"`
+	Fact   string `json:"fact"`
+	Verb   string `json:"verb"`
+	Tidbit string `json:"tidbit"`
+	// By is who asked for it to be forgotten
+	By     string `json:"by"`
+	Target string `json:"target"`
+}
+
+func (FactoidForgotten) Topic() string { return "fact.forgotten" }
+
+// BeerCheckedIn is published when someone drinks, by hand or on Untappd
+type BeerCheckedIn struct {
+	Nick    string `json:"nick"`
+	Count   int    `json:"count"`
+	Total   int    `json:"total"`
+	Untappd bool   `json:"untappd"`
+	Target  string `json:"target"`
+}
+
+func (BeerCheckedIn) Topic() string { return "beers.checkin" }
+
+// ReminderFired is published when a reminder is delivered
+type ReminderFired struct {
+	ID     int64  `json:"id"`
+	From   string `json:"from"`
+	Who    string `json:"who"`
+	What   string `json:"what"`
+	Target string `json:"target"`
+}
+
+func (ReminderFired) Topic() string { return "reminder.fired" }
+
+// FirstClaimed is published when someone says the first thing of the day
+type FirstClaimed struct {
+	Nick   string    `json:"nick"`
+	Body   string    `json:"body"`
+	Time   time.Time `json:"time"`
+	Target string    `json:"target"`
+}
+
+func (FirstClaimed) Topic() string { return "first.claimed" }
+
+type subscription struct {
+	plugin  string
+	handler EventHandler
+}
+
+// eventBus hands published events to subscribers, in the order they subscribed
+type eventBus struct {
+	sync.RWMutex
+	subs map[string][]subscription
+}
+
+func (e *eventBus) subscribe(p Plugin, topic string, h EventHandler) {
+	e.Lock()
+	defer e.Unlock()
+	if e.subs == nil {
+		e.subs = map[string][]subscription{}
+	}
+	name := pluginName(reflect.TypeOf(p).String())
+	e.subs[topic] = append(e.subs[topic], subscription{name, h})
+}
+
+func (e *eventBus) subscribers(topic string) []subscription {
+	e.RLock()
+	defer e.RUnlock()
+	subs := append([]subscription{}, e.subs[topic]...)
+	return append(subs, e.subs[AllEvents]...)
+}
+
+// deliver calls each subscriber in turn, so a panicking one can't stop the rest
+// It returns the plugins that panicked.
+func deliver(evt BusEvent, subs []subscription) []string {
+	failed := []string{}
+	for _, s := range subs {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Error().
+						Str("plugin", s.plugin).
+						Str("topic", evt.Topic()).
+						Str("stack", string(debug.Stack())).
+						Msgf("Event handler panicked: %v", r)
+					failed = append(failed, s.plugin)
+				}
+			}()
+			s.handler(evt)
+		}()
+	}
+	return failed
+}
+
+// Subscribe calls h with every event published on topic, or on every topic for AllEvents
+func (b *bot) Subscribe(p Plugin, topic string, h EventHandler) {
+	b.bus.subscribe(p, topic, h)
+}
+
+// Publish hands an event to its subscribers before returning
+// Disabled plugins are skipped and a subscriber that panics counts as a plugin failure.
+func (b *bot) Publish(evt BusEvent) {
+	eventsPublished.Inc(evt.Topic())
+	log.Debug().
+		Str("topic", evt.Topic()).
+		Interface("event", evt).
+		Msg("Published event")
+	subs := []subscription{}
+	for _, s := range b.bus.subscribers(evt.Topic()) {
+		if !b.health.isDisabled(s.plugin) {
+			subs = append(subs, s)
+		}
+	}
+	for _, name := range deliver(evt, subs) {
+		b.pluginFailed(name)
+	}
+}
@@ -0,0 +1,40 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type subscriber struct{}
+
+func TestPublish(t *testing.T) {
+	s := &subscriber{}
+	b := testBot(t, s)
+	got := []BusEvent{}
+	b.Subscribe(s, CounterChanged{}.Topic(), func(e BusEvent) {
+		got = append(got, e)
+	})
+	all := 0
+	b.Subscribe(s, AllEvents, func(BusEvent) { all++ })
+
+	b.Publish(CounterChanged{Nick: "tester", Item: "cheese", Count: 1, Delta: 1})
+	b.Publish(FirstClaimed{Nick: "tester"})
+	assert.Equal(t, []BusEvent{CounterChanged{Nick: "tester", Item: "cheese", Count: 1, Delta: 1}}, got)
+	assert.Equal(t, 2, all)
+}
+
+func TestPanickingSubscriber(t *testing.T) {
+	p := &panicker{}
+	s := &subscriber{}
+	b := testBot(t, p, s)
+	b.Subscribe(p, AllEvents, func(BusEvent) { panic("oops") })
+	calls := 0
+	b.Subscribe(s, AllEvents, func(BusEvent) { calls++ })
+
+	b.Publish(FirstClaimed{})
+	assert.Equal(t, 1, calls)
+	assert.False(t, b.health.isDisabled("bot"))
+	b.Publish(FirstClaimed{})
+	assert.True(t, b.health.isDisabled("bot"))
+}
@@ -3,25 +3,60 @@
 package bot
 
 import (
+	"context"
 	"database/sql"
-	"errors"
 	"fmt"
 	"math/rand"
 	"reflect"
 	"regexp"
+	"runtime/debug"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/rs/zerolog/log"
+	"github.com/velour/catbase/bot/markup"
+	"github.com/velour/catbase/bot/metrics"
 	"github.com/velour/catbase/bot/msg"
 )
 
+var (
+	messagesReceived = metrics.NewCounter("catbase_messages_received_total",
+		"Messages and actions received", "connector", "channel")
+	callbacksFired = metrics.NewCounter("catbase_callbacks_fired_total",
+		"Events handed to plugins", "plugin", "kind")
+	callbacksHandled = metrics.NewCounter("catbase_callbacks_handled_total",
+		"Events plugins said they handled", "plugin", "kind")
+	callbackTime = metrics.NewHistogram("catbase_callback_seconds",
+		"Time plugins took to handle an event", nil, "plugin", "kind")
+	sendErrors = metrics.NewCounter("catbase_send_errors_total",
+		"Messages a connector failed to send", "connector")
+)
+
 func (b *bot) Receive(conn Connector, kind Kind, msg msg.Message, args ...interface{}) bool {
+	if !b.life.begin() {
+		log.Debug().Msg("Dropping an event while shutting down")
+		return false
+	}
+	defer b.life.end()
+	msg.Connector = b.connectorNames[conn]
+	if kind == Message || kind == Action {
+		messagesReceived.Inc(msg.Connector, msg.Channel)
+	}
+
 	log.Debug().
 		Interface("msg", msg).
 		Msg("Received event")
 
+	if b.limits.Ignored(msg) {
+		log.Debug().Str("user", UserKey(msg)).Msg("Ignoring a flooding user")
+		goto RET
+	}
+
+	if b.answer(conn, kind, msg, args) {
+		goto RET
+	}
+
 	// msg := b.buildMessage(client, inMsg)
 	// do need to look up user and fix it
 	if kind == Message && strings.HasPrefix(msg.Body, "help") && msg.Command {
@@ -38,12 +73,83 @@ func (b *bot) Receive(conn Connector, kind Kind, msg msg.Message, args ...interf
 	}
 
 RET:
-	b.logIn <- msg
+	if err := b.msglog.Log(msg); err != nil {
+		log.Error().Err(err).Msg("Could not log message")
+	}
 	return true
 }
 
+// runCallback hands an event to a plugin, isolating the bot from its panics and hangs
+// A plugin that runs past its deadline is assumed to have handled the event.
 func (b *bot) runCallback(conn Connector, plugin Plugin, evt Kind, message msg.Message, args ...interface{}) bool {
 	t := reflect.TypeOf(plugin).String()
+	return b.isolate(t, evt, message, func(message msg.Message) bool {
+		return b.callPlugin(conn, t, evt, message, args...)
+	})
+}
+
+// isolate runs a plugin's code for an event under its deadline, recovering from panics
+func (b *bot) isolate(t string, evt Kind, message msg.Message, run func(msg.Message) bool) bool {
+	name := pluginName(t)
+	if b.health.isDisabled(name) {
+		return false
+	}
+	if message.Channel != "" && !b.PluginEnabled(name, Target(message.Connector, message.Channel)) {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), b.health.timeout(name))
+	defer cancel()
+	message.Context = ctx
+
+	callbacksFired.Inc(name, evt.String())
+	defer callbackTime.Since(time.Now(), name, evt.String())
+
+	type result struct{ handled, panicked bool }
+	done := make(chan result, 1)
+	running := b.life.running(name)
+	running.Add(1)
+	go func() {
+		defer running.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				log.Error().
+					Str("plugin", name).
+					Interface("msg", message).
+					Str("stack", string(debug.Stack())).
+					Msgf("Plugin panicked: %v", r)
+				done <- result{panicked: true}
+			}
+		}()
+		done <- result{handled: run(message)}
+	}()
+
+	select {
+	case r := <-done:
+		if r.panicked {
+			b.pluginFailed(name)
+			return false
+		}
+		b.health.succeeded(name)
+		if r.handled {
+			callbacksHandled.Inc(name, evt.String())
+		}
+		return r.handled
+	case <-ctx.Done():
+		log.Error().
+			Str("plugin", name).
+			Interface("msg", message).
+			Msg("Plugin timed out")
+		b.pluginFailed(name)
+		callbacksHandled.Inc(name, evt.String())
+		return true
+	}
+}
+
+func (b *bot) callPlugin(conn Connector, t string, evt Kind, message msg.Message, args ...interface{}) bool {
+	if evt == Message && b.commands.dispatch(b, conn, t, message) {
+		return true
+	}
 	for _, cb := range b.callbacks[t][evt] {
 		if cb(conn, evt, message, args...) {
 			return true
@@ -52,13 +158,63 @@ func (b *bot) runCallback(conn Connector, plugin Plugin, evt Kind, message msg.M
 	return false
 }
 
+func (b *bot) pluginFailed(name string) {
+	if b.health.failed(name) {
+		log.Error().Str("plugin", name).Msg("Plugin keeps failing and has been disabled")
+	}
+}
+
 // Send a message to the connection
 func (b *bot) Send(conn Connector, kind Kind, args ...interface{}) (string, error) {
-	return conn.Send(kind, args...)
+	return b.send(conn, kind, args, false)
+}
+
+// SendAndWait sends a message and waits its turn in the send queue for the connector's ID
+func (b *bot) SendAndWait(conn Connector, kind Kind, args ...interface{}) (string, error) {
+	return b.send(conn, kind, args, true)
+}
+
+func (b *bot) send(conn Connector, kind Kind, args []interface{}, wait bool) (string, error) {
+	args = b.outbound(conn, kind, args)
+	id, err := b.sends.send(b.config, conn, b.connectorNames[conn], kind, args, wait)
+	if err != nil {
+		sendErrors.Inc(b.connectorNames[conn])
+	}
+	return id, err
+}
+
+// outbound runs the filters over the text of a message and formats it for the connector
+func (b *bot) outbound(conn Connector, kind Kind, args []interface{}) []interface{} {
+	switch kind {
+	case Message, Action, Reply, Edit:
+	default:
+		return args
+	}
+	if len(args) < 2 {
+		return args
+	}
+	text, ok := args[1].(string)
+	if !ok {
+		return args
+	}
+	for _, f := range b.filters {
+		text = f(text)
+	}
+	if f, ok := conn.(Formatter); ok {
+		text = f.Format(text)
+	} else {
+		text = markup.Plain(text)
+	}
+	args = append([]interface{}{}, args...)
+	args[1] = text
+	return args
 }
 
-func (b *bot) GetEmojiList() map[string]string {
-	return b.conn.GetEmojiList()
+func (b *bot) GetEmojiList(conn Connector) map[string]string {
+	if conn == nil {
+		return map[string]string{}
+	}
+	return conn.GetEmojiList()
 }
 
 // Checks to see if the user is asking for help, returns true if so and handles the situation.
@@ -67,7 +223,7 @@ func (b *bot) checkHelp(conn Connector, channel string, parts []string) {
 		// just print out a list of help topics
 		topics := "Help topics: about variables"
 		for name := range b.plugins {
-			name = strings.Split(strings.TrimPrefix(name, "*"), ".")[0]
+			name = pluginName(name)
 			topics = fmt.Sprintf("%s, %s", topics, name)
 		}
 		b.Send(conn, Message, channel, topics)
@@ -81,15 +237,15 @@ func (b *bot) checkHelp(conn Connector, channel string, parts []string) {
 			b.listVars(conn, channel, parts)
 			return
 		}
-		for name, plugin := range b.plugins {
+		for name := range b.plugins {
 			if strings.HasPrefix(name, "*"+parts[1]) {
-				if b.runCallback(conn, plugin, Help, msg.Message{Channel: channel}, channel, parts) {
-					return
-				} else {
-					msg := fmt.Sprintf("I'm sorry, I don't know how to help you with %s.", parts[1])
-					b.Send(conn, Message, channel, msg)
+				if b.commands.has(name) {
+					b.Send(conn, Message, channel, b.commands.help(b, name).String())
 					return
 				}
+				msg := fmt.Sprintf("I'm sorry, I don't know how to help you with %s.", parts[1])
+				b.Send(conn, Message, channel, msg)
+				return
 			}
 		}
 		msg := fmt.Sprintf("I'm sorry, I don't know what %s is!", strings.Join(parts, " "))
@@ -97,18 +253,12 @@ func (b *bot) checkHelp(conn Connector, channel string, parts []string) {
 	}
 }
 
-func (b *bot) LastMessage(channel string) (msg.Message, error) {
-	log := <-b.logOut
-	if len(log) == 0 {
-		return msg.Message{}, errors.New("No messages found.")
-	}
-	for i := len(log) - 1; i >= 0; i-- {
-		msg := log[i]
-		if strings.ToLower(msg.Channel) == strings.ToLower(channel) {
-			return msg, nil
-		}
+// LastMessage gives the most recent message in a connector's channel, the default connector's when it is empty
+func (b *bot) LastMessage(connector, channel string) (msg.Message, error) {
+	if connector == "" {
+		connector = b.connectorNames[b.DefaultConnector()]
 	}
-	return msg.Message{}, errors.New("No messages found.")
+	return b.msglog.LastMessage(connector, channel)
 }
 
 // Take an input string and mutate it based on $vars in the string
@@ -126,7 +276,7 @@ func (b *bot) Filter(message msg.Message, input string) string {
 	}
 
 	for strings.Contains(input, "$someone") {
-		nicks := b.Who(message.Channel)
+		nicks := b.Who(b.connectorFor(message), message.Channel)
 		someone := nicks[rand.Intn(len(nicks))].Name
 		input = strings.Replace(input, "$someone", someone, 1)
 	}
@@ -146,10 +296,6 @@ func (b *bot) Filter(message msg.Message, input string) string {
 		panic(err)
 	}
 
-	for _, f := range b.filters {
-		input = f(input)
-	}
-
 	varname := r.FindString(input)
 	blacklist := make(map[string]bool)
 	blacklist["$and"] = true
@@ -0,0 +1,43 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/velour/catbase/bot/markup"
+)
+
+// recorder is a connector that keeps what it is sent
+type recorder struct {
+	sent []string
+}
+
+func (r *recorder) RegisterEvent(Callback) {}
+func (r *recorder) Send(kind Kind, args ...interface{}) (string, error) {
+	r.sent = append(r.sent, args[1].(string))
+	return "", nil
+}
+func (r *recorder) GetEmojiList() map[string]string { return nil }
+func (r *recorder) Serve() error                    { return nil }
+func (r *recorder) Who(string) []string             { return nil }
+func (r *recorder) Status() Status                  { return Status{State: Connected} }
+
+type ircRecorder struct{ recorder }
+
+func (r *ircRecorder) Format(text string) string { return markup.IRC(text) }
+
+func TestSendFormatsForTheConnector(t *testing.T) {
+	b := testBot(t)
+	b.filters = map[string]func(string) string{
+		"$item": func(s string) string { return strings.ReplaceAll(s, "$item", "a *rock*") },
+	}
+	plain, irc := &recorder{}, &ircRecorder{}
+	b.connectorNames = map[Connector]string{plain: "cli", irc: "irc"}
+
+	b.Send(plain, Message, "#c", "here is $item :tea:")
+	b.Send(irc, Action, "#c", "gives you $item")
+	b.Send(irc, Reaction, "#c", "*tea*", testMessage())
+	assert.Equal(t, []string{"here is a rock 🍵"}, plain.sent)
+	assert.Equal(t, []string{"gives you a \x02rock\x02", "*tea*"}, irc.sent)
+}
@@ -0,0 +1,206 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+package bot
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/velour/catbase/config"
+)
+
+func init() {
+	config.Declare(
+		config.Key{Name: "bot.timeout", Type: config.Int, Default: "10", Min: 1, Max: 3600,
+			Description: "seconds a plugin may take with an event"},
+		config.Key{Name: "bot.maxFailures", Type: config.Int, Default: "5", Min: 0, Max: 1000,
+			Description: "failures in a row before a plugin is disabled, 0 for never"},
+		config.Key{Name: "bot.neverDisable", Type: config.Array, Default: "admin", Description: "plugins that are never disabled"},
+		config.Key{Name: "bot.disabledPlugins", Type: config.Array, Description: "plugins turned off everywhere"},
+	)
+}
+
+// PluginStatus describes how well a plugin has been behaving
+type PluginStatus struct {
+	Name string
+	// Failures counts panics and timeouts since the plugin last succeeded
+	Failures int
+	// Total counts every panic and timeout since the bot started
+	Total    int
+	Disabled bool
+}
+
+// pluginHealth counts the failures of each plugin and disables the ones that keep failing
+// Disabled plugins are saved in bot.disabledPlugins until an admin enables them again.
+type pluginHealth struct {
+	config *config.Config
+
+	sync.Mutex
+	failures map[string]int
+	total    map[string]int
+	disabled map[string]bool
+}
+
+func newPluginHealth(c *config.Config) *pluginHealth {
+	h := &pluginHealth{
+		config:   c,
+		failures: make(map[string]int),
+		total:    make(map[string]int),
+		disabled: make(map[string]bool),
+	}
+	for _, name := range c.GetArray("bot.disabledPlugins", []string{}) {
+		h.disabled[name] = true
+	}
+	return h
+}
+
+// timeout is how long a plugin may take with an event, from bot.timeout.<plugin> or bot.timeout
+func (h *pluginHealth) timeout(name string) time.Duration {
+	secs := h.config.GetInt("bot.timeout", 10)
+	secs = h.config.GetInt("bot.timeout."+name, secs)
+	return time.Duration(secs) * time.Second
+}
+
+func (h *pluginHealth) isDisabled(name string) bool {
+	h.Lock()
+	defer h.Unlock()
+	return h.disabled[name]
+}
+
+func (h *pluginHealth) succeeded(name string) {
+	h.Lock()
+	defer h.Unlock()
+	h.failures[name] = 0
+}
+
+// protected plugins, like the one used to enable the others again, are never disabled
+func (h *pluginHealth) protected(name string) bool {
+	for _, p := range h.config.GetArray("bot.neverDisable", []string{"admin"}) {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// failed counts a failure and reports whether the plugin has now been disabled
+func (h *pluginHealth) failed(name string) bool {
+	max := h.config.GetInt("bot.maxFailures", 5)
+	protected := h.protected(name)
+	h.Lock()
+	h.failures[name]++
+	h.total[name]++
+	disable := max > 0 && h.failures[name] >= max && !h.disabled[name] && !protected
+	h.Unlock()
+	if disable {
+		h.setDisabled(name, true)
+	}
+	return disable
+}
+
+func (h *pluginHealth) setDisabled(name string, disabled bool) {
+	h.Lock()
+	if disabled {
+		h.disabled[name] = true
+	} else {
+		delete(h.disabled, name)
+		h.failures[name] = 0
+	}
+	names := []string{}
+	for n := range h.disabled {
+		names = append(names, n)
+	}
+	h.Unlock()
+	sort.Strings(names)
+	h.config.SetArray("bot.disabledPlugins", names)
+}
+
+func (h *pluginHealth) status(name string) PluginStatus {
+	h.Lock()
+	defer h.Unlock()
+	return PluginStatus{
+		Name:     name,
+		Failures: h.failures[name],
+		Total:    h.total[name],
+		Disabled: h.disabled[name],
+	}
+}
+
+// Plugins lists every plugin with its failure counts
+func (b *bot) Plugins() []PluginStatus {
+	out := []PluginStatus{}
+	for _, t := range b.pluginOrdering {
+		out = append(out, b.health.status(pluginName(t)))
+	}
+	return out
+}
+
+// EnablePlugin lets a disabled plugin handle events again and clears its failures
+func (b *bot) EnablePlugin(name string) error {
+	if !b.hasPlugin(name) {
+		return fmt.Errorf("No plugin named %s", name)
+	}
+	b.health.setDisabled(name, false)
+	return nil
+}
+
+// DisablePlugin stops a plugin from seeing any events
+func (b *bot) DisablePlugin(name string) error {
+	if !b.hasPlugin(name) {
+		return fmt.Errorf("No plugin named %s", name)
+	}
+	if b.health.protected(name) {
+		return fmt.Errorf("I can't turn off %s", name)
+	}
+	b.health.setDisabled(name, true)
+	return nil
+}
+
+func (b *bot) hasPlugin(name string) bool {
+	for t := range b.plugins {
+		if pluginName(t) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// enabledKey says whether a plugin is on; it is usually scoped to a channel
+func enabledKey(name string) string {
+	return "plugin." + name + ".enabled"
+}
+
+// pluginEnabledIn checks whether a plugin is switched on for a connector:channel target
+func pluginEnabledIn(c *config.Config, name, target string) bool {
+	return c.Scope(target).GetBool(enabledKey(name), true)
+}
+
+// PluginEnabled checks whether a plugin is switched on for a connector:channel target
+// Plugins are on everywhere unless they were turned off for the channel or globally.
+func (b *bot) PluginEnabled(name, target string) bool {
+	if b.health.protected(name) {
+		return true
+	}
+	return pluginEnabledIn(b.config, name, target)
+}
+
+// EnablePluginIn turns a plugin on for one connector:channel target
+func (b *bot) EnablePluginIn(name, target string) error {
+	if !b.hasPlugin(name) {
+		return fmt.Errorf("No plugin named %s", name)
+	}
+	return b.config.Scope(target).Set(enabledKey(name), "true")
+}
+
+// DisablePluginIn turns a plugin off for one connector:channel target
+func (b *bot) DisablePluginIn(name, target string) error {
+	if !b.hasPlugin(name) {
+		return fmt.Errorf("No plugin named %s", name)
+	}
+	if b.health.protected(name) {
+		return fmt.Errorf("I can't turn off %s", name)
+	}
+	return b.config.Scope(target).Set(enabledKey(name), "false")
+}
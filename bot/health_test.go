@@ -0,0 +1,138 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/bot/user"
+	"github.com/velour/catbase/config"
+)
+
+type panicker struct{}
+type sleeper struct{}
+
+// testBot builds just enough of a bot to run plugin callbacks
+func testBot(t *testing.T, plugins ...Plugin) *bot {
+	c := config.ReadConfig("file::memory:?mode=memory&cache=shared")
+	c.Set("bot.disabledPlugins", "")
+	c.Set("bot.timeout", "1")
+	c.Set("bot.maxFailures", "2")
+	b := &bot{
+		config:    c,
+		plugins:   make(map[string]Plugin),
+		callbacks: make(CallbackMap),
+		commands:  newCommandRegistry(),
+		health:    newPluginHealth(c),
+	}
+	b.perms = NewPermissions(c)
+	b.limits = NewLimiter(c, b.perms, b.Send)
+	for _, p := range plugins {
+		b.AddPlugin(p)
+	}
+	return b
+}
+
+func testMessage() msg.Message {
+	return msg.Message{User: &user.User{Name: "tester"}, Body: "hi"}
+}
+
+func TestPanicIsRecovered(t *testing.T) {
+	p := &panicker{}
+	b := testBot(t, p)
+	b.Register(p, Message, func(Connector, Kind, msg.Message, ...interface{}) bool {
+		panic("oops")
+	})
+	assert.False(t, b.runCallback(nil, p, Message, testMessage()))
+	assert.Equal(t, 1, b.health.status("bot").Failures)
+}
+
+func TestRepeatedFailuresDisable(t *testing.T) {
+	p := &panicker{}
+	b := testBot(t, p)
+	calls := 0
+	b.Register(p, Message, func(Connector, Kind, msg.Message, ...interface{}) bool {
+		calls++
+		panic("oops")
+	})
+	b.runCallback(nil, p, Message, testMessage())
+	b.runCallback(nil, p, Message, testMessage())
+	b.runCallback(nil, p, Message, testMessage())
+	assert.Equal(t, 2, calls)
+	assert.True(t, b.health.isDisabled("bot"))
+	assert.Equal(t, []string{"bot"}, b.config.GetArray("bot.disabledPlugins", nil))
+
+	assert.Nil(t, b.EnablePlugin("bot"))
+	b.runCallback(nil, p, Message, testMessage())
+	assert.Equal(t, 3, calls)
+	assert.NotNil(t, b.EnablePlugin("nothing"))
+}
+
+func TestSlowPluginTimesOut(t *testing.T) {
+	p := &sleeper{}
+	b := testBot(t, p)
+	cancelled := make(chan bool, 1)
+	b.Register(p, Message, func(c Connector, k Kind, m msg.Message, args ...interface{}) bool {
+		<-m.Ctx().Done()
+		cancelled <- true
+		return false
+	})
+	start := time.Now()
+	assert.True(t, b.runCallback(nil, p, Message, testMessage()))
+	assert.True(t, time.Since(start) < 2*time.Second)
+	assert.True(t, <-cancelled)
+	assert.Equal(t, 1, b.health.status("bot").Failures)
+}
+
+func TestSuccessResetsFailures(t *testing.T) {
+	p := &panicker{}
+	b := testBot(t, p)
+	fail := true
+	b.Register(p, Message, func(Connector, Kind, msg.Message, ...interface{}) bool {
+		if fail {
+			panic("oops")
+		}
+		return true
+	})
+	b.runCallback(nil, p, Message, testMessage())
+	fail = false
+	assert.True(t, b.runCallback(nil, p, Message, testMessage()))
+	s := b.health.status("bot")
+	assert.Equal(t, 0, s.Failures)
+	assert.Equal(t, 1, s.Total)
+}
+
+func TestDisabledInChannel(t *testing.T) {
+	p := &sleeper{}
+	b := testBot(t, p)
+	b.Register(p, Message, func(Connector, Kind, msg.Message, ...interface{}) bool {
+		return true
+	})
+	work, social := testMessage(), testMessage()
+	work.Connector, work.Channel = "slack", "#work"
+	social.Connector, social.Channel = "slack", "#social"
+
+	assert.Nil(t, b.DisablePluginIn("bot", "slack:#work"))
+	assert.False(t, b.runCallback(nil, p, Message, work))
+	assert.True(t, b.runCallback(nil, p, Message, social))
+
+	assert.Nil(t, b.EnablePluginIn("bot", "slack:#work"))
+	assert.True(t, b.runCallback(nil, p, Message, work))
+	assert.NotNil(t, b.DisablePluginIn("admin", "slack:#work"))
+}
+
+func TestCallbackMetrics(t *testing.T) {
+	p := &sleeper{}
+	b := testBot(t, p)
+	b.Register(p, Reaction, func(Connector, Kind, msg.Message, ...interface{}) bool {
+		return true
+	})
+	fired := callbacksFired.Value("bot", "reaction")
+	handled := callbacksHandled.Value("bot", "reaction")
+	timed := callbackTime.Count("bot", "reaction")
+	assert.True(t, b.runCallback(nil, p, Reaction, testMessage()))
+	assert.Equal(t, fired+1, callbacksFired.Value("bot", "reaction"))
+	assert.Equal(t, handled+1, callbacksHandled.Value("bot", "reaction"))
+	assert.Equal(t, timed+1, callbackTime.Count("bot", "reaction"))
+}
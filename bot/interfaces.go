@@ -3,8 +3,13 @@
 package bot
 
 import (
+	"context"
+	"fmt"
+
 	"github.com/jmoiron/sqlx"
 	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/bot/msglog"
+	"github.com/velour/catbase/bot/schedule"
 	"github.com/velour/catbase/bot/user"
 	"github.com/velour/catbase/config"
 )
@@ -36,6 +41,25 @@ type ImageAttachment struct {
 }
 
 type Kind int
+
+var kindNames = map[Kind]string{
+	Message:     "message",
+	Reply:       "reply",
+	Action:      "action",
+	Reaction:    "reaction",
+	Edit:        "edit",
+	Event:       "event",
+	Help:        "help",
+	SelfMessage: "selfmessage",
+}
+
+func (k Kind) String() string {
+	if name, ok := kindNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("kind%d", int(k))
+}
+
 type Callback func(Connector, Kind, msg.Message, ...interface{}) bool
 type CallbackMap map[string]map[Kind][]Callback
 
@@ -45,29 +69,72 @@ type Bot interface {
 	Config() *config.Config
 	// DB gives access to the current database
 	DB() *sqlx.DB
-	// Who lists users in a particular channel
-	Who(string) []user.User
+	// Who lists users in a particular channel of a connector
+	Who(Connector, string) []user.User
 	// WhoAmI gives a nick for the bot
 	WhoAmI() string
 	// AddPlugin registers a new plugin handler
 	AddPlugin(Plugin)
+	// Plugins lists every plugin and how often it has failed
+	Plugins() []PluginStatus
+	// EnablePlugin turns a plugin that was disabled back on
+	EnablePlugin(string) error
+	// DisablePlugin stops a plugin from receiving events
+	DisablePlugin(string) error
+	// PluginEnabled checks whether a plugin is on for a connector:channel target
+	PluginEnabled(name, target string) bool
+	// EnablePluginIn turns a plugin on for a connector:channel target
+	EnablePluginIn(name, target string) error
+	// DisablePluginIn turns a plugin off for a connector:channel target
+	DisablePluginIn(name, target string) error
 	// First arg should be one of bot.Message/Reply/Action/etc
 	Send(Connector, Kind, ...interface{}) (string, error)
+	// SendAndWait is Send for messages whose ID is needed, waiting out the send queue if it must
+	SendAndWait(Connector, Kind, ...interface{}) (string, error)
 	// First arg should be one of bot.Message/Reply/Action/etc
 	Receive(Connector, Kind, msg.Message, ...interface{}) bool
 	// Register a callback
 	Register(Plugin, Kind, Callback)
+	// RegisterCommand declares a command the bot matches and documents for a plugin
+	RegisterCommand(Plugin, Command)
+	// Ask sends a question and hands the answer to the plugin instead of the usual callbacks
+	Ask(Plugin, Prompt) *Conversation
+	// Subscribe hands a plugin every event published on a topic
+	Subscribe(Plugin, string, EventHandler)
+	// Publish announces an event to the plugins subscribed to its topic
+	Publish(BusEvent)
 
 	Filter(msg.Message, string) string
-	LastMessage(string) (msg.Message, error)
+	LastMessage(string, string) (msg.Message, error)
+	// MessageLog gives access to the stored history of every channel
+	MessageLog() *msglog.MsgLogger
 
-	CheckAdmin(string) bool
-	GetEmojiList() map[string]string
+	// Permissions gives access to user roles and command permissions
+	Permissions() *Permissions
+	// Accounts gives access to who is logged in to the web pages
+	Accounts() *Accounts
+	// Limits gives access to command cooldowns and who is ignored for flooding
+	Limits() *Limiter
+	// Scheduler runs timed jobs for plugins
+	Scheduler() *schedule.Scheduler
+	GetEmojiList(Connector) map[string]string
 	RegisterFilter(string, func(string) string)
 	RegisterWeb(string, string)
+	// AddConnector registers a named chat service with the bot
+	AddConnector(string, Connector)
+	// DefaultConnector is the first connector added to the bot
 	DefaultConnector() Connector
+	// GetConnector looks up a connector by name
+	GetConnector(string) Connector
+	// ResolveTarget turns a "connector:channel" config entry into a connector and channel
+	ResolveTarget(string) (Connector, string)
+	// Health reports whether the database and every connector are working
+	Health() Health
+	// Start starts plugins and connectors once everything has been added
+	Start() error
+	// Stop disconnects, waits for work in progress, stops plugins and closes the database
+	Stop(context.Context) error
 	GetWebNavigation() []EndPoint
-	GetPassword() string
 }
 
 // Connector represents a server connection to a chat service
@@ -80,6 +147,15 @@ type Connector interface {
 	Serve() error
 
 	Who(string) []string
+
+	// Status reports how the link to the chat service is doing
+	Status() Status
+}
+
+// Formatter is implemented by connectors that can show the neutral markup of package markup
+// Messages to other connectors are sent as plain text.
+type Formatter interface {
+	Format(string) string
 }
 
 // Plugin interface used for compatibility with the Plugin interface
@@ -0,0 +1,141 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+package bot
+
+import (
+	"context"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Starter is implemented by plugins and connectors with work to begin once the bot is assembled
+type Starter interface {
+	Start() error
+}
+
+// Stopper is implemented by plugins and connectors holding something to let go of at shutdown,
+// like a child process, a timer or a connection
+type Stopper interface {
+	Stop() error
+}
+
+// lifecycle tracks the events being handled so Stop can wait for them
+type lifecycle struct {
+	sync.RWMutex
+	stopping bool
+	inflight sync.WaitGroup
+	// calls counts each plugin's running code, including code that outlived its deadline
+	calls map[string]*sync.WaitGroup
+}
+
+// begin counts an event in, or says the bot is shutting down and it should be dropped
+func (l *lifecycle) begin() bool {
+	l.RLock()
+	defer l.RUnlock()
+	if l.stopping {
+		return false
+	}
+	l.inflight.Add(1)
+	return true
+}
+
+func (l *lifecycle) end() {
+	l.inflight.Done()
+}
+
+// running gives the count of a plugin's running code
+func (l *lifecycle) running(plugin string) *sync.WaitGroup {
+	l.Lock()
+	defer l.Unlock()
+	if l.calls == nil {
+		l.calls = map[string]*sync.WaitGroup{}
+	}
+	wg, ok := l.calls[plugin]
+	if !ok {
+		wg = &sync.WaitGroup{}
+		l.calls[plugin] = wg
+	}
+	return wg
+}
+
+// waitForPlugins waits until no plugin code is running
+func (l *lifecycle) waitForPlugins() {
+	l.RLock()
+	calls := []*sync.WaitGroup{}
+	for _, wg := range l.calls {
+		calls = append(calls, wg)
+	}
+	l.RUnlock()
+	for _, wg := range calls {
+		wg.Wait()
+	}
+}
+
+// Start starts the plugins, then serves every connector and runs scheduled jobs
+func (b *bot) Start() error {
+	for _, name := range b.pluginOrdering {
+		if s, ok := b.plugins[name].(Starter); ok {
+			if err := s.Start(); err != nil {
+				log.Error().Err(err).Msgf("Plugin %s did not start", pluginName(name))
+			}
+		}
+	}
+	for name, conn := range b.connectors {
+		if s, ok := conn.(Starter); ok {
+			if err := s.Start(); err != nil {
+				return err
+			}
+		}
+		go func(name string, conn Connector) {
+			if err := conn.Serve(); err != nil {
+				log.Error().Err(err).Msgf("Connector %s failed", name)
+			}
+		}(name, conn)
+	}
+	// plugins have registered their job handlers, so saved jobs can run
+	b.sched.Start()
+	return nil
+}
+
+// Stop shuts the bot down: it stops taking events, disconnects from every chat service,
+// waits for the events and jobs being handled, stops the plugins and closes the database.
+// Waiting gives up when ctx is done.
+func (b *bot) Stop(ctx context.Context) error {
+	b.life.Lock()
+	b.life.stopping = true
+	b.life.Unlock()
+
+	b.sched.Stop()
+	for name, conn := range b.connectors {
+		if s, ok := conn.(Stopper); ok {
+			if err := s.Stop(); err != nil {
+				log.Error().Err(err).Msgf("Connector %s did not stop cleanly", name)
+			}
+		}
+	}
+
+	drained := make(chan bool)
+	go func() {
+		b.life.inflight.Wait()
+		b.sched.Wait()
+		// callbacks that timed out may still be running after their events are done
+		b.life.waitForPlugins()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		log.Warn().Msg("Gave up waiting for plugins to finish")
+	}
+
+	for i := len(b.pluginOrdering) - 1; i >= 0; i-- {
+		name := b.pluginOrdering[i]
+		if s, ok := b.plugins[name].(Stopper); ok {
+			if err := s.Stop(); err != nil {
+				log.Error().Err(err).Msgf("Plugin %s did not stop cleanly", pluginName(name))
+			}
+		}
+	}
+	return b.DB().Close()
+}
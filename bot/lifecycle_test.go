@@ -0,0 +1,87 @@
+package bot
+
+import (
+	"context"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/bot/msglog"
+	"github.com/velour/catbase/bot/schedule"
+	"github.com/velour/catbase/config"
+)
+
+type lifer struct {
+	started, stopped bool
+}
+
+func (l *lifer) Start() error { l.started = true; return nil }
+func (l *lifer) Stop() error  { l.stopped = true; return nil }
+
+// lifeBot builds a bot on its own database, since Stop closes it
+func lifeBot(t *testing.T, plugins ...Plugin) *bot {
+	c := config.ReadConfig(filepath.Join(t.TempDir(), "life.db"))
+	b := &bot{
+		config:     c,
+		plugins:    make(map[string]Plugin),
+		callbacks:  make(CallbackMap),
+		commands:   newCommandRegistry(),
+		health:     newPluginHealth(c),
+		connectors: make(map[string]Connector),
+		msglog:     msglog.New(c.DB, 10),
+		sched:      schedule.New(c.DB),
+	}
+	b.perms = NewPermissions(c)
+	b.limits = NewLimiter(c, b.perms, b.Send)
+	for _, p := range plugins {
+		b.AddPlugin(p)
+	}
+	return b
+}
+
+func TestStartAndStop(t *testing.T) {
+	p := &lifer{}
+	b := lifeBot(t, p)
+	assert.Nil(t, b.Start())
+	assert.True(t, p.started)
+	assert.Nil(t, b.Stop(context.Background()))
+	assert.True(t, p.stopped)
+	assert.NotNil(t, b.DB().Ping())
+}
+
+func TestStopDrainsCallbacks(t *testing.T) {
+	p := &lifer{}
+	b := lifeBot(t, p)
+	running := make(chan bool)
+	finished := false
+	b.Register(p, Message, func(Connector, Kind, msg.Message, ...interface{}) bool {
+		close(running)
+		time.Sleep(100 * time.Millisecond)
+		finished = true
+		return true
+	})
+	go b.Receive(nil, Message, testMessage())
+	<-running
+	assert.Nil(t, b.Stop(context.Background()))
+	assert.True(t, finished)
+	assert.False(t, b.Receive(nil, Message, testMessage()))
+}
+
+func TestStopWaitsForTimedOutCallbacks(t *testing.T) {
+	p := &lifer{}
+	b := lifeBot(t, p)
+	b.config.Set("bot.timeout", "1")
+	var finished int32
+	b.Register(p, Message, func(Connector, Kind, msg.Message, ...interface{}) bool {
+		time.Sleep(1500 * time.Millisecond)
+		atomic.StoreInt32(&finished, 1)
+		return true
+	})
+	assert.True(t, b.Receive(nil, Message, testMessage()))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&finished), "the callback should have timed out")
+	assert.Nil(t, b.Stop(context.Background()))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&finished))
+}
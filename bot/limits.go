@@ -0,0 +1,245 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+package bot
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/velour/catbase/bot/metrics"
+	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/config"
+)
+
+func init() {
+	config.Declare(
+		config.Key{Name: "flood.strikes", Type: config.Int, Default: "5", Min: 1, Max: 100,
+			Description: "refused commands within flood.window before I ignore someone"},
+		config.Key{Name: "flood.window", Type: config.Int, Default: "60", Min: 1, Max: 3600,
+			Description: "seconds refused commands are counted over"},
+		config.Key{Name: "flood.ignoreMinutes", Type: config.Int, Default: "10", Min: 1, Max: 1440,
+			Description: "minutes I ignore someone for after too many refused commands"},
+		config.Key{Name: "flood.refusal", Default: "friendly", Choices: []string{"friendly", "rude", "silent"},
+			Description: "how I tell people to slow down"},
+	)
+}
+
+var (
+	cooldownsRefused = metrics.NewCounter("catbase_cooldowns_refused_total",
+		"Commands refused because they were used again too soon", "cooldown")
+	usersIgnored = metrics.NewCounter("catbase_users_ignored_total",
+		"Times someone was ignored for flooding", "connector")
+)
+
+// Cooldown limits how often a command may be used
+// The times can be changed per channel with cooldown.<Name>.user and
+// cooldown.<Name>.channel, in seconds.
+type Cooldown struct {
+	// Name is what the cooldown is counted and configured under
+	Name string
+	// User is how long one user waits between uses
+	User time.Duration
+	// Channel is how long everyone in a channel waits between uses
+	Channel time.Duration
+}
+
+// IgnoredUser is someone the bot is ignoring for flooding
+type IgnoredUser struct {
+	// Key is the connector:id of the user
+	Key   string
+	Name  string
+	Until time.Time
+}
+
+// Limiter keeps people from flooding commands that opt into cooldowns
+// Someone refused too often is ignored altogether for a while.
+// Moderators and above are never limited.
+type Limiter struct {
+	config *config.Config
+	perms  *Permissions
+	send   func(Connector, Kind, ...interface{}) (string, error)
+
+	sync.Mutex
+	last    map[string]time.Time
+	warned  map[string]time.Time
+	strikes map[string][]time.Time
+	ignored map[string]IgnoredUser
+}
+
+// NewLimiter creates a limiter that sends its refusals with send
+func NewLimiter(c *config.Config, perms *Permissions, send func(Connector, Kind, ...interface{}) (string, error)) *Limiter {
+	return &Limiter{
+		config:  c,
+		perms:   perms,
+		send:    send,
+		last:    make(map[string]time.Time),
+		warned:  make(map[string]time.Time),
+		strikes: make(map[string][]time.Time),
+		ignored: make(map[string]IgnoredUser),
+	}
+}
+
+func (l *Limiter) exempt(message msg.Message) bool {
+	return l.perms.RoleOf(message) >= Moderator
+}
+
+// Allow checks whether a message may use a command now and counts the use
+// When it may not, the sender is told how long to wait, once per wait, and false is returned.
+func (l *Limiter) Allow(conn Connector, message msg.Message, cd Cooldown) bool {
+	if l.exempt(message) {
+		return true
+	}
+	user := ""
+	if key := UserKey(message); key != "" {
+		user = Target(message.Connector, key)
+	}
+	channel := Target(message.Connector, message.Channel)
+	scope := l.config.Scope(channel)
+	userWait := seconds(scope, "cooldown."+cd.Name+".user", cd.User)
+	channelWait := seconds(scope, "cooldown."+cd.Name+".channel", cd.Channel)
+	userKey, channelKey := cd.Name+"|"+user, cd.Name+"|"+channel
+	if user == "" {
+		userWait = 0
+	}
+
+	now := time.Now()
+	l.Lock()
+	userLeft := l.last[userKey].Add(userWait).Sub(now)
+	channelLeft := l.last[channelKey].Add(channelWait).Sub(now)
+	if userLeft <= 0 && channelLeft <= 0 {
+		if userWait > 0 {
+			l.last[userKey] = now
+		}
+		if channelWait > 0 {
+			l.last[channelKey] = now
+		}
+		l.Unlock()
+		return true
+	}
+	cooldownsRefused.Inc(cd.Name)
+	left, blocking := userLeft, userKey
+	if channelLeft > userLeft {
+		left, blocking = channelLeft, channelKey
+	}
+	// a user is warned once for each wait, whichever cooldown it is
+	warnKey := userKey + "|" + blocking
+	warned, ok := l.warned[warnKey]
+	warn := !ok || warned.Before(l.last[blocking])
+	if warn {
+		l.warned[warnKey] = now
+	}
+	ignored := user != "" && l.strike(user, message, now)
+	l.Unlock()
+
+	tone := scope.Get("flood.refusal", "friendly")
+	name := ""
+	if message.User != nil {
+		name = message.User.Name
+	}
+	switch {
+	case tone == "silent":
+	case ignored:
+		minutes := l.config.GetInt("flood.ignoreMinutes", 10)
+		text := fmt.Sprintf("%s, that's enough for now. I'll listen to you again in %d minutes.", name, minutes)
+		if tone == "rude" {
+			text = fmt.Sprintf("%s, I'm not listening to you for %d minutes.", name, minutes)
+		}
+		l.refuse(conn, message.Channel, text)
+	case warn:
+		text := fmt.Sprintf("%s, give it %s before you do that again.", name, left.Round(time.Second))
+		if tone == "rude" {
+			text = "Slow down, cowboy."
+		}
+		l.refuse(conn, message.Channel, text)
+	}
+	return false
+}
+
+func (l *Limiter) refuse(conn Connector, channel, text string) {
+	if _, err := l.send(conn, Message, channel, text); err != nil {
+		log.Error().Err(err).Msg("Could not send a refusal")
+	}
+}
+
+// strike counts a refused command against a user and starts ignoring them after too many
+func (l *Limiter) strike(user string, message msg.Message, now time.Time) bool {
+	window := time.Duration(l.config.GetInt("flood.window", 60)) * time.Second
+	strikes := []time.Time{now}
+	for _, t := range l.strikes[user] {
+		if now.Sub(t) < window {
+			strikes = append(strikes, t)
+		}
+	}
+	if len(strikes) < l.config.GetInt("flood.strikes", 5) {
+		l.strikes[user] = strikes
+		return false
+	}
+	delete(l.strikes, user)
+	minutes := l.config.GetInt("flood.ignoreMinutes", 10)
+	l.ignored[user] = IgnoredUser{
+		Key:   user,
+		Name:  message.User.Name,
+		Until: now.Add(time.Duration(minutes) * time.Minute),
+	}
+	usersIgnored.Inc(message.Connector)
+	log.Info().Str("user", user).Int("minutes", minutes).Msg("Ignoring a user for flooding")
+	return true
+}
+
+func seconds(scope config.Scope, key string, fallback time.Duration) time.Duration {
+	if !scope.Has(key) {
+		return fallback
+	}
+	return time.Duration(scope.GetFloat64(key, fallback.Seconds()) * float64(time.Second))
+}
+
+// Ignored checks whether the sender of a message is being ignored for flooding
+func (l *Limiter) Ignored(message msg.Message) bool {
+	key := UserKey(message)
+	if key == "" {
+		return false
+	}
+	user := Target(message.Connector, key)
+	l.Lock()
+	defer l.Unlock()
+	i, ok := l.ignored[user]
+	if ok && time.Now().After(i.Until) {
+		delete(l.ignored, user)
+		return false
+	}
+	return ok
+}
+
+// Ignoring lists the users being ignored, soonest to be forgiven first
+func (l *Limiter) Ignoring() []IgnoredUser {
+	now := time.Now()
+	l.Lock()
+	defer l.Unlock()
+	users := []IgnoredUser{}
+	for key, i := range l.ignored {
+		if now.After(i.Until) {
+			delete(l.ignored, key)
+			continue
+		}
+		users = append(users, i)
+	}
+	sort.Slice(users, func(a, b int) bool { return users[a].Until.Before(users[b].Until) })
+	return users
+}
+
+// Forgive stops ignoring users by connector:id key or name, returning whether anyone was
+func (l *Limiter) Forgive(who string) bool {
+	l.Lock()
+	defer l.Unlock()
+	found := false
+	for key, i := range l.ignored {
+		if key == who || i.Name == who {
+			delete(l.ignored, key)
+			found = true
+		}
+	}
+	return found
+}
@@ -0,0 +1,120 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/bot/user"
+)
+
+func floodMessage(id, channel string) msg.Message {
+	return msg.Message{
+		User:      &user.User{ID: id, Name: id},
+		Channel:   channel,
+		Connector: "irc",
+		Body:      "1d20",
+		Command:   true,
+	}
+}
+
+func setFlood(t *testing.T, mb *MockBot, kv ...string) {
+	for i := 0; i < len(kv); i += 2 {
+		mb.Cfg.Set(kv[i], kv[i+1])
+		key := kv[i]
+		t.Cleanup(func() { mb.Cfg.Unset(key) })
+	}
+}
+
+func TestCooldownRefusesOnce(t *testing.T) {
+	mb := NewMockBot()
+	cd := Cooldown{Name: "dice", User: time.Minute}
+	m := floodMessage("roller", "#dice")
+	assert.True(t, mb.Limit.Allow(nil, m, cd))
+	assert.False(t, mb.Limit.Allow(nil, m, cd))
+	assert.False(t, mb.Limit.Allow(nil, m, cd))
+	assert.Len(t, mb.Messages, 1)
+	assert.Contains(t, mb.Messages[0], "roller, give it 1m0s")
+	assert.True(t, mb.Limit.Allow(nil, floodMessage("other", "#dice"), cd))
+}
+
+func TestChannelCooldown(t *testing.T) {
+	mb := NewMockBot()
+	setFlood(t, mb, "flood.refusal", "rude")
+	cd := Cooldown{Name: "tldr", Channel: time.Hour}
+	assert.True(t, mb.Limit.Allow(nil, floodMessage("a", "#tldr"), cd))
+	assert.False(t, mb.Limit.Allow(nil, floodMessage("b", "#tldr"), cd))
+	assert.True(t, mb.Limit.Allow(nil, floodMessage("b", "#other"), cd))
+	assert.Equal(t, []string{"Slow down, cowboy."}, mb.Messages)
+}
+
+func TestChannelCooldownsWarnInEachChannel(t *testing.T) {
+	mb := NewMockBot()
+	cd := Cooldown{Name: "tldr", Channel: time.Hour}
+	assert.True(t, mb.Limit.Allow(nil, floodMessage("a", "#one"), cd))
+	assert.True(t, mb.Limit.Allow(nil, floodMessage("a", "#two"), cd))
+	assert.False(t, mb.Limit.Allow(nil, floodMessage("b", "#two"), cd))
+	assert.False(t, mb.Limit.Allow(nil, floodMessage("b", "#one"), cd))
+	assert.False(t, mb.Limit.Allow(nil, floodMessage("b", "#one"), cd))
+	assert.Len(t, mb.Messages, 2)
+}
+
+func TestCooldownOverride(t *testing.T) {
+	mb := NewMockBot()
+	setFlood(t, mb, "cooldown.stock.user@irc:#free", "0")
+	cd := Cooldown{Name: "stock", User: time.Minute}
+	for i := 0; i < 3; i++ {
+		assert.True(t, mb.Limit.Allow(nil, floodMessage("trader", "#free"), cd))
+	}
+	assert.True(t, mb.Limit.Allow(nil, floodMessage("trader", "#paid"), cd))
+	assert.False(t, mb.Limit.Allow(nil, floodMessage("trader", "#paid"), cd))
+}
+
+func TestFloodingGetsIgnored(t *testing.T) {
+	mb := NewMockBot()
+	setFlood(t, mb, "flood.strikes", "3")
+	cd := Cooldown{Name: "quote", User: time.Minute}
+	m := floodMessage("spammer", "#quotes")
+	for i := 0; i < 3; i++ {
+		mb.Limit.Allow(nil, m, cd)
+	}
+	assert.False(t, mb.Limit.Ignored(m))
+	mb.Limit.Allow(nil, m, cd)
+	assert.True(t, mb.Limit.Ignored(m))
+	assert.Contains(t, mb.Messages[len(mb.Messages)-1], "10 minutes")
+	assert.Equal(t, "irc:spammer", mb.Limit.Ignoring()[0].Key)
+
+	assert.True(t, mb.Limit.Forgive("spammer"))
+	assert.False(t, mb.Limit.Ignored(m))
+	assert.Empty(t, mb.Limit.Ignoring())
+}
+
+func TestModeratorsAreNotLimited(t *testing.T) {
+	mb := NewMockBot()
+	assert.Nil(t, mb.Perms.Grant("irc", "mod", Moderator))
+	t.Cleanup(func() { mb.Perms.Revoke("irc", "mod") })
+	cd := Cooldown{Name: "dice", User: time.Minute}
+	for i := 0; i < 3; i++ {
+		assert.True(t, mb.Limit.Allow(nil, floodMessage("mod", "#dice"), cd))
+	}
+}
+
+func TestCommandCooldown(t *testing.T) {
+	mb := NewMockBot()
+	p := &panicker{}
+	rolls := 0
+	mb.RegisterCommand(p, Command{
+		Pattern:  "1d20",
+		Cooldown: Cooldown{User: time.Minute},
+		Handler: func(Connector, msg.Message, Args) bool {
+			rolls++
+			return true
+		},
+	})
+	m := floodMessage("commander", "#dice")
+	assert.True(t, mb.Receive(nil, Message, m))
+	assert.True(t, mb.Receive(nil, Message, m))
+	assert.Equal(t, 1, rolls)
+	assert.Len(t, mb.Messages, 1)
+}
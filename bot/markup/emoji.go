@@ -0,0 +1,58 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+package markup
+
+// emoji maps the shortcodes plugins use, and other common ones, to Unicode
+var emoji = map[string]string{
+	"+1":                         "👍",
+	"-1":                         "👎",
+	"100":                        "💯",
+	"beer":                       "🍺",
+	"beers":                      "🍻",
+	"black_large_square":         "⬛",
+	"cake":                       "🍰",
+	"cat":                        "🐱",
+	"chart_with_downwards_trend": "📉",
+	"chart_with_upwards_trend":   "📈",
+	"clap":                       "👏",
+	"cloud":                      "☁️",
+	"coffee":                     "☕",
+	"dog":                        "🐶",
+	"eyes":                       "👀",
+	"fire":                       "🔥",
+	"full_moon":                  "🌕",
+	"game_die":                   "🎲",
+	"heart":                      "❤️",
+	"joy":                        "😂",
+	"lion_face":                  "🦁",
+	"memo":                       "📝",
+	"memory":                     "📝",
+	"moneybag":                   "💰",
+	"new_moon":                   "🌑",
+	"ok_hand":                    "👌",
+	"pizza":                      "🍕",
+	"pray":                       "🙏",
+	"robot_face":                 "🤖",
+	"rocket":                     "🚀",
+	"skull":                      "💀",
+	"slightly_smiling_face":      "🙂",
+	"smile":                      "😄",
+	"snowflake":                  "❄️",
+	"sob":                        "😭",
+	"star":                       "⭐",
+	"sunny":                      "☀️",
+	"tada":                       "🎉",
+	"tea":                        "🍵",
+	"thinking_face":              "🤔",
+	"thumbsdown":                 "👎",
+	"thumbsup":                   "👍",
+	"trophy":                     "🏆",
+	"umbrella":                   "☔",
+	"warning":                    "⚠️",
+	"wave":                       "👋",
+	"white_check_mark":           "✅",
+	"white_large_square":         "⬜",
+	"wine_glass":                 "🍷",
+	"x":                          "❌",
+	"zap":                        "⚡",
+}
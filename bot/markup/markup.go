@@ -0,0 +1,198 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+// Package markup reads the small, neutral markup plugins write messages in,
+// so each connector can show it the way its chat service does.
+//
+// Spans of a line can be *bold*, _italic_ or `code`. A line starting with >
+// is quoted, and :shortcode: is an emoji. Markers only count at word edges,
+// so snake_case, 2 * 3 * 4 and URLs are left alone.
+package markup
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Style is how a span of text is shown
+type Style uint8
+
+const (
+	Bold Style = 1 << iota
+	Italic
+	Code
+)
+
+// Span is a run of text in one style, or an emoji
+type Span struct {
+	Text  string
+	Style Style
+	// Emoji is the shortcode of an emoji, without colons; Text is then its Unicode
+	// or, for emoji we don't know, the shortcode with colons.
+	Emoji string
+}
+
+// Line is one line of a message
+type Line struct {
+	Quote bool
+	Spans []Span
+}
+
+// Text is a message read into lines of spans
+type Text []Line
+
+var markers = map[byte]Style{'*': Bold, '_': Italic, '`': Code}
+
+var shortcode = regexp.MustCompile(`^:([a-z0-9_+-]+):`)
+
+// Parse reads a message's markup
+func Parse(s string) Text {
+	var t Text
+	for _, l := range strings.Split(s, "\n") {
+		var line Line
+		if strings.HasPrefix(l, ">") {
+			line.Quote = true
+			l = strings.TrimPrefix(strings.TrimPrefix(l, ">"), " ")
+		}
+		line.Spans = parseLine(l, 0)
+		t = append(t, line)
+	}
+	return t
+}
+
+// parseLine splits a line into spans, each inside the styles it is nested in
+func parseLine(s string, style Style) []Span {
+	spans := []Span{}
+	plain := strings.Builder{}
+	flush := func() {
+		if plain.Len() > 0 {
+			spans = append(spans, Span{Text: plain.String(), Style: style})
+			plain.Reset()
+		}
+	}
+	for i := 0; i < len(s); {
+		if m, ok := markers[s[i]]; ok && style&m == 0 && opens(s, i) {
+			if end := closing(s, i); end > 0 {
+				flush()
+				inner := s[i+1 : end]
+				if m == Code {
+					spans = append(spans, Span{Text: inner, Style: style | Code})
+				} else {
+					spans = append(spans, parseLine(inner, style|m)...)
+				}
+				i = end + 1
+				continue
+			}
+		}
+		if s[i] == ':' && style&Code == 0 && (i == 0 || !isWord(lastRune(s[:i]))) {
+			if m := shortcode.FindStringSubmatch(s[i:]); m != nil {
+				flush()
+				spans = append(spans, Span{Text: Emoji(m[1]), Style: style, Emoji: m[1]})
+				i += len(m[0])
+				continue
+			}
+		}
+		plain.WriteByte(s[i])
+		i++
+	}
+	flush()
+	return spans
+}
+
+// opens checks that the marker at i starts a word
+func opens(s string, i int) bool {
+	if i+1 >= len(s) || s[i+1] == ' ' || s[i+1] == s[i] {
+		return false
+	}
+	return i == 0 || s[i-1] != s[i] && !isWord(lastRune(s[:i]))
+}
+
+// closing finds the marker that ends the span opened at i, or -1
+func closing(s string, i int) int {
+	for j := i + 2; j < len(s); j++ {
+		if s[j] != s[i] || s[j-1] == ' ' || s[j-1] == s[i] {
+			continue
+		}
+		if j+1 == len(s) {
+			return j
+		}
+		if r, _ := utf8.DecodeRuneInString(s[j+1:]); !isWord(r) {
+			return j
+		}
+	}
+	return -1
+}
+
+func lastRune(s string) rune {
+	r, _ := utf8.DecodeLastRuneInString(s)
+	return r
+}
+
+func isWord(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// Emoji gives the Unicode of an emoji shortcode, or the shortcode with colons
+// when it's one we don't know, like a Slack custom emoji
+func Emoji(name string) string {
+	if e, ok := emoji[name]; ok {
+		return e
+	}
+	return ":" + name + ":"
+}
+
+// Render writes text back out, with wrap marking up each styled span
+func (t Text) Render(wrap func(Span) string, quote string) string {
+	lines := make([]string, len(t))
+	for i, l := range t {
+		out := strings.Builder{}
+		if l.Quote {
+			out.WriteString(quote)
+		}
+		for _, s := range l.Spans {
+			out.WriteString(wrap(s))
+		}
+		lines[i] = out.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Plain drops the markup, for connectors that show plain text
+func Plain(s string) string {
+	return Parse(s).Render(func(s Span) string { return s.Text }, "> ")
+}
+
+// Slack writes the markup as Slack mrkdwn, which it is a small part of
+func Slack(s string) string {
+	return s
+}
+
+// IRC control codes for text styles
+const (
+	ircBold      = "\x02"
+	ircItalic    = "\x1d"
+	ircMonospace = "\x11"
+)
+
+// IRC writes the markup with IRC control codes and Unicode emoji
+func IRC(s string) string {
+	return Parse(s).Render(func(s Span) string {
+		return wrap(s, ircBold, ircItalic, ircMonospace)
+	}, "> ")
+}
+
+// wrap surrounds a span with the codes of each of its styles
+func wrap(s Span, bold, italic, code string) string {
+	text := s.Text
+	if s.Style&Code != 0 {
+		text = code + text + code
+	}
+	if s.Style&Italic != 0 {
+		text = italic + text + italic
+	}
+	if s.Style&Bold != 0 {
+		text = bold + text + bold
+	}
+	return text
+}
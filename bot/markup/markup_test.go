@@ -0,0 +1,43 @@
+package markup
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	text := Parse("*Topic #1: _cats_* and `co*de*` :tea:\n>quoted")
+	assert.Len(t, text, 2)
+	assert.Equal(t, []Span{
+		{Text: "Topic #1: ", Style: Bold},
+		{Text: "cats", Style: Bold | Italic},
+		{Text: " and "},
+		{Text: "co*de*", Style: Code},
+		{Text: " "},
+		{Text: "🍵", Emoji: "tea"},
+	}, text[0].Spans)
+	assert.True(t, text[1].Quote)
+	assert.Equal(t, []Span{{Text: "quoted"}}, text[1].Spans)
+}
+
+func TestPlainTextIsLeftAlone(t *testing.T) {
+	for _, s := range []string{
+		"alice.beer--",
+		"2 * 3 * 4",
+		"snake_case_name",
+		"https://example.com/a_b_c?x=1",
+		"at 10:04:05",
+		"**not bold**",
+		"unknown :party_parrot: emoji",
+		"a * b*",
+	} {
+		assert.Equal(t, s, Plain(s), s)
+	}
+}
+
+func TestRenderers(t *testing.T) {
+	s := "*bold* _it_ `code` :beer:\n> said"
+	assert.Equal(t, "bold it code 🍺\n> said", Plain(s))
+	assert.Equal(t, "\x02bold\x02 \x1dit\x1d \x11code\x11 🍺\n> said", IRC(s))
+}
@@ -0,0 +1,251 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+// Package metrics counts what the bot does and serves the counts in the Prometheus text format
+// Metrics are created once, usually as package variables, and are served by Handler.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are histogram bounds in seconds, from a millisecond to ten seconds
+var DefaultBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type metric interface {
+	name() string
+	write(w io.Writer)
+}
+
+var registry = struct {
+	sync.Mutex
+	metrics map[string]metric
+}{metrics: map[string]metric{}}
+
+func register(m metric) {
+	registry.Lock()
+	defer registry.Unlock()
+	if _, ok := registry.metrics[m.name()]; ok {
+		panic(fmt.Sprintf("metric %s is registered twice", m.name()))
+	}
+	registry.metrics[m.name()] = m
+}
+
+// family holds the parts every kind of metric shares
+type family struct {
+	sync.Mutex
+	metricName string
+	help       string
+	labels     []string
+}
+
+func (f *family) name() string { return f.metricName }
+
+// key joins label values into a map key, checking there is one for each label
+func (f *family) key(values []string) string {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metric %s takes %d labels, got %d", f.metricName, len(f.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+func (f *family) header(w io.Writer, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.metricName, f.help, f.metricName, kind)
+}
+
+// labelString renders label pairs, with extra pairs appended, as {a="b",c="d"}
+func (f *family) labelString(key string, extra ...string) string {
+	pairs := []string{}
+	if len(f.labels) > 0 {
+		for i, v := range strings.Split(key, "\xff") {
+			pairs = append(pairs, fmt.Sprintf(`%s="%s"`, f.labels[i], escape(v)))
+		}
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extra[i], escape(extra[i+1])))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escape(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+func format(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Counter is a count that only goes up
+type Counter struct {
+	family
+	values map[string]float64
+}
+
+// NewCounter makes and registers a counter with the given label names
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{family: family{metricName: name, help: help, labels: labels}, values: map[string]float64{}}
+	register(c)
+	return c
+}
+
+// Inc adds one to the counter with the given label values
+func (c *Counter) Inc(labels ...string) {
+	c.Add(1, labels...)
+}
+
+// Add adds v to the counter with the given label values
+func (c *Counter) Add(v float64, labels ...string) {
+	k := c.key(labels)
+	c.Lock()
+	defer c.Unlock()
+	c.values[k] += v
+}
+
+// Value reads the counter with the given label values
+func (c *Counter) Value(labels ...string) float64 {
+	k := c.key(labels)
+	c.Lock()
+	defer c.Unlock()
+	return c.values[k]
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.Lock()
+	defer c.Unlock()
+	c.header(w, "counter")
+	keys := map[string]bool{}
+	for k := range c.values {
+		keys[k] = true
+	}
+	for _, k := range sortedKeys(keys) {
+		fmt.Fprintf(w, "%s%s %s\n", c.metricName, c.labelString(k), format(c.values[k]))
+	}
+}
+
+type observations struct {
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+// Histogram counts observations, like durations, into buckets
+type Histogram struct {
+	family
+	bounds []float64
+	values map[string]*observations
+}
+
+// NewHistogram makes and registers a histogram; nil bounds use DefaultBuckets
+func NewHistogram(name, help string, bounds []float64, labels ...string) *Histogram {
+	if bounds == nil {
+		bounds = DefaultBuckets
+	}
+	h := &Histogram{
+		family: family{metricName: name, help: help, labels: labels},
+		bounds: bounds,
+		values: map[string]*observations{},
+	}
+	register(h)
+	return h
+}
+
+// Observe records a value for the given label values
+func (h *Histogram) Observe(v float64, labels ...string) {
+	k := h.key(labels)
+	h.Lock()
+	defer h.Unlock()
+	o, ok := h.values[k]
+	if !ok {
+		o = &observations{buckets: make([]uint64, len(h.bounds))}
+		h.values[k] = o
+	}
+	for i, b := range h.bounds {
+		if v <= b {
+			o.buckets[i]++
+		}
+	}
+	o.count++
+	o.sum += v
+}
+
+// Since observes the seconds passed since start
+func (h *Histogram) Since(start time.Time, labels ...string) {
+	h.Observe(time.Since(start).Seconds(), labels...)
+}
+
+// Count reads how many values were observed for the given label values
+func (h *Histogram) Count(labels ...string) uint64 {
+	k := h.key(labels)
+	h.Lock()
+	defer h.Unlock()
+	if o, ok := h.values[k]; ok {
+		return o.count
+	}
+	return 0
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.Lock()
+	defer h.Unlock()
+	h.header(w, "histogram")
+	keys := map[string]bool{}
+	for k := range h.values {
+		keys[k] = true
+	}
+	for _, k := range sortedKeys(keys) {
+		o := h.values[k]
+		for i, b := range h.bounds {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, h.labelString(k, "le", format(b)), o.buckets[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, h.labelString(k, "le", "+Inf"), o.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.metricName, h.labelString(k), format(o.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.metricName, h.labelString(k), o.count)
+	}
+}
+
+// Write renders every registered metric, sorted by name
+func Write(w io.Writer) {
+	registry.Lock()
+	names := map[string]bool{}
+	for name := range registry.metrics {
+		names[name] = true
+	}
+	ms := []metric{}
+	for _, name := range sortedKeys(names) {
+		ms = append(ms, registry.metrics[name])
+	}
+	registry.Unlock()
+	for _, m := range ms {
+		m.write(w)
+	}
+}
+
+// Handler serves every registered metric for Prometheus to scrape
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		Write(w)
+	})
+}
@@ -0,0 +1,50 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounter(t *testing.T) {
+	c := NewCounter("test_counter_total", "A test counter", "channel")
+	c.Inc(`#a"b`)
+	c.Add(2, "#c")
+	var buf bytes.Buffer
+	c.write(&buf)
+	assert.Equal(t, `# HELP test_counter_total A test counter
+# TYPE test_counter_total counter
+test_counter_total{channel="#a\"b"} 1
+test_counter_total{channel="#c"} 2
+`, buf.String())
+	assert.Panics(t, func() { c.Inc() })
+}
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram("test_seconds", "A test histogram", []float64{1, 5})
+	h.Observe(0.5)
+	h.Observe(3)
+	h.Observe(10)
+	var buf bytes.Buffer
+	h.write(&buf)
+	assert.Equal(t, `# HELP test_seconds A test histogram
+# TYPE test_seconds histogram
+test_seconds_bucket{le="1"} 1
+test_seconds_bucket{le="5"} 2
+test_seconds_bucket{le="+Inf"} 3
+test_seconds_sum 13.5
+test_seconds_count 3
+`, buf.String())
+}
+
+func TestHandler(t *testing.T) {
+	NewCounter("test_served_total", "Served").Inc()
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, w.Body.String(), "test_served_total 1\n")
+	assert.Panics(t, func() { NewCounter("test_served_total", "Again") })
+}
@@ -0,0 +1,178 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+// Package migrate keeps the database schema of each plugin up to date
+// Plugins register numbered steps from init. Up runs the steps a database
+// hasn't seen yet, each in its own transaction, and records them in the
+// schema_migrations table. A plugin's first step should be the create table
+// if not exists it always ran, so older databases pick up where they are.
+// SQL is written for SQLite; on Postgres its column types are rewritten by
+// config.Dialect.Schema.
+package migrate
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog/log"
+	"github.com/velour/catbase/config"
+)
+
+// Step is one change to the schema
+type Step struct {
+	// Version orders the steps of a plugin; each must be greater than the last
+	Version int
+	// Name says what the step does
+	Name string
+	// SQL is run first and may hold several statements
+	SQL string
+	// Func runs after the SQL, for changes that need Go
+	Func func(*sqlx.Tx) error
+}
+
+// State describes how far a database has come for one plugin
+type State struct {
+	Plugin  string
+	Current int
+	Latest  int
+	Pending []Step
+}
+
+var (
+	lock  sync.Mutex
+	steps = map[string][]Step{}
+)
+
+// Register adds the steps of a plugin
+func Register(plugin string, s ...Step) {
+	lock.Lock()
+	defer lock.Unlock()
+	all := append(append([]Step{}, steps[plugin]...), s...)
+	sort.Slice(all, func(i, j int) bool { return all[i].Version < all[j].Version })
+	for i := 1; i < len(all); i++ {
+		if all[i].Version == all[i-1].Version {
+			panic(fmt.Sprintf("migration %s %d is registered twice", plugin, all[i].Version))
+		}
+	}
+	steps[plugin] = all
+}
+
+// Plugins lists everything with registered steps
+func Plugins() []string {
+	lock.Lock()
+	defer lock.Unlock()
+	names := []string{}
+	for name := range steps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func setup(db *sqlx.DB) error {
+	_, err := db.Exec(config.DialectOf(db).Schema(`create table if not exists schema_migrations (
+			plugin string,
+			version integer,
+			name string,
+			applied integer,
+			primary key (plugin, version)
+		);`))
+	return err
+}
+
+func current(db *sqlx.DB, plugin string) (int, error) {
+	var v int
+	err := db.Get(&v, `select coalesce(max(version), 0) from schema_migrations where plugin=?`, plugin)
+	return v, err
+}
+
+// Up runs the pending steps of the named plugins, or of every plugin if none are named
+// It stops at the first step that fails; that step is rolled back.
+func Up(db *sqlx.DB, plugins ...string) error {
+	lock.Lock()
+	defer lock.Unlock()
+	if err := setup(db); err != nil {
+		return err
+	}
+	if len(plugins) == 0 {
+		for name := range steps {
+			plugins = append(plugins, name)
+		}
+		sort.Strings(plugins)
+	}
+	for _, plugin := range plugins {
+		have, err := current(db, plugin)
+		if err != nil {
+			return err
+		}
+		for _, s := range steps[plugin] {
+			if s.Version <= have {
+				continue
+			}
+			if err := apply(db, plugin, s); err != nil {
+				return fmt.Errorf("migration %s %d (%s): %w", plugin, s.Version, s.Name, err)
+			}
+			log.Info().Msgf("Migrated %s to %d: %s", plugin, s.Version, s.Name)
+		}
+	}
+	return nil
+}
+
+// MustUp runs Up and stops the bot if it fails
+func MustUp(db *sqlx.DB, plugins ...string) {
+	if err := Up(db, plugins...); err != nil {
+		log.Fatal().Err(err).Msg("Could not migrate the database")
+	}
+}
+
+func apply(db *sqlx.DB, plugin string, s Step) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	if s.SQL != "" {
+		if _, err := tx.Exec(config.DialectOf(tx).Schema(s.SQL)); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if s.Func != nil {
+		if err := s.Func(tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if _, err := tx.Exec(`insert into schema_migrations (plugin, version, name, applied) values (?, ?, ?, ?)`,
+		plugin, s.Version, s.Name, time.Now().Unix()); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Status reports how far the database has come for every registered plugin
+func Status(db *sqlx.DB) ([]State, error) {
+	if err := setup(db); err != nil {
+		return nil, err
+	}
+	out := []State{}
+	for _, plugin := range Plugins() {
+		have, err := current(db, plugin)
+		if err != nil {
+			return nil, err
+		}
+		lock.Lock()
+		s := State{Plugin: plugin, Current: have}
+		for _, step := range steps[plugin] {
+			s.Latest = step.Version
+			if step.Version > have {
+				s.Pending = append(s.Pending, step)
+			}
+		}
+		lock.Unlock()
+		out = append(out, s)
+	}
+	return out, nil
+}
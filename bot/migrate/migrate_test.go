@@ -0,0 +1,73 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+package migrate
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupDB(t *testing.T) *sqlx.DB {
+	db := sqlx.MustOpen("sqlite3", ":memory:")
+	db.SetMaxOpenConns(1)
+	return db
+}
+
+func TestUpRunsInOrder(t *testing.T) {
+	db := setupDB(t)
+	Register("ordered",
+		Step{Version: 2, Name: "add column", SQL: `alter table ordered add column b string;`},
+		Step{Version: 1, Name: "create table", SQL: `create table if not exists ordered (a string);`},
+	)
+	assert.Nil(t, Up(db, "ordered"))
+	_, err := db.Exec(`insert into ordered (a, b) values ('a', 'b')`)
+	assert.Nil(t, err)
+
+	// running again changes nothing
+	assert.Nil(t, Up(db, "ordered"))
+	var count int
+	db.Get(&count, `select count(*) from schema_migrations where plugin='ordered'`)
+	assert.Equal(t, 2, count)
+}
+
+func TestExistingTablesAreKept(t *testing.T) {
+	db := setupDB(t)
+	db.MustExec(`create table kept (a string); insert into kept values ('old');`)
+	Register("kept", Step{Version: 1, Name: "create table", SQL: `create table if not exists kept (a string);`})
+	assert.Nil(t, Up(db, "kept"))
+	var a string
+	assert.Nil(t, db.Get(&a, `select a from kept`))
+	assert.Equal(t, "old", a)
+}
+
+func TestFailedStepRollsBack(t *testing.T) {
+	db := setupDB(t)
+	Register("broken",
+		Step{Version: 1, Name: "create table", SQL: `create table broken (a string);`},
+		Step{Version: 2, Name: "half done", SQL: `create table broken_too (a string);`,
+			Func: func(*sqlx.Tx) error { return errors.New("nope") }},
+	)
+	assert.NotNil(t, Up(db, "broken"))
+	var count int
+	db.Get(&count, `select count(*) from sqlite_master where name='broken_too'`)
+	assert.Equal(t, 0, count)
+
+	states, err := Status(db)
+	assert.Nil(t, err)
+	for _, s := range states {
+		if s.Plugin == "broken" {
+			assert.Equal(t, 1, s.Current)
+			assert.Equal(t, 2, s.Latest)
+			assert.Len(t, s.Pending, 1)
+		}
+	}
+}
+
+func TestDuplicateVersionPanics(t *testing.T) {
+	Register("dupe", Step{Version: 1})
+	assert.Panics(t, func() { Register("dupe", Step{Version: 1}) })
+}
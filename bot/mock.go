@@ -3,15 +3,23 @@
 package bot
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	"net/http"
+	"net/url"
+	"os"
+	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/rs/zerolog/log"
 	"github.com/stretchr/testify/mock"
 	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/bot/msglog"
+	"github.com/velour/catbase/bot/schedule"
 	"github.com/velour/catbase/bot/user"
 	"github.com/velour/catbase/config"
 )
@@ -20,27 +28,67 @@ type MockBot struct {
 	mock.Mock
 	db *sqlx.DB
 
-	Cfg *config.Config
+	Cfg    *config.Config
+	MsgLog *msglog.MsgLogger
+	Perms  *Permissions
+	Accts  *Accounts
+	Limit  *Limiter
+	Sched  *schedule.Scheduler
+
+	commands *commandRegistry
+	convos   conversations
 
 	Messages  []string
 	Actions   []string
 	Reactions []string
+	// Replies holds messages sent in a thread
+	Replies []string
+
+	// Conn is the connector targets resolve to, nil unless a test sets it
+	Conn Connector
+
+	// Statuses stand in for the connectors' statuses in Health
+	Statuses map[string]Status
+
+	// Events holds everything published, in order
+	Events []BusEvent
+	bus    eventBus
 }
 
-func (mb *MockBot) Config() *config.Config      { return mb.Cfg }
-func (mb *MockBot) DB() *sqlx.DB                { return mb.Cfg.DB }
-func (mb *MockBot) Who(string) []user.User      { return []user.User{} }
-func (mb *MockBot) WhoAmI() string              { return "tester" }
-func (mb *MockBot) DefaultConnector() Connector { return nil }
-func (mb *MockBot) GetPassword() string         { return "12345" }
+func (mb *MockBot) Config() *config.Config            { return mb.Cfg }
+func (mb *MockBot) DB() *sqlx.DB                      { return mb.Cfg.DB }
+func (mb *MockBot) Who(Connector, string) []user.User { return []user.User{} }
+func (mb *MockBot) WhoAmI() string                    { return "tester" }
+func (mb *MockBot) DefaultConnector() Connector       { return mb.Conn }
+func (mb *MockBot) GetConnector(string) Connector     { return mb.Conn }
+func (mb *MockBot) AddConnector(string, Connector)    {}
+func (mb *MockBot) Start() error                      { return nil }
+func (mb *MockBot) Subscribe(p Plugin, topic string, h EventHandler) {
+	mb.bus.subscribe(p, topic, h)
+}
+func (mb *MockBot) Publish(evt BusEvent) {
+	mb.Events = append(mb.Events, evt)
+	deliver(evt, mb.bus.subscribers(evt.Topic()))
+}
+func (mb *MockBot) Stop(context.Context) error { return nil }
+func (mb *MockBot) Health() Health {
+	return newHealth(mb.DB().Ping(), mb.Statuses, 0)
+}
+func (mb *MockBot) ResolveTarget(t string) (Connector, string) {
+	_, ch := ParseTarget(t)
+	return mb.Conn, ch
+}
 func (mb *MockBot) Send(c Connector, kind Kind, args ...interface{}) (string, error) {
 	switch kind {
 	case Message:
 		mb.Messages = append(mb.Messages, args[1].(string))
-		return fmt.Sprintf("m-%d", len(mb.Actions)-1), nil
+		return fmt.Sprintf("m-%d", len(mb.Messages)-1), nil
 	case Action:
 		mb.Actions = append(mb.Actions, args[1].(string))
 		return fmt.Sprintf("a-%d", len(mb.Actions)-1), nil
+	case Reply:
+		mb.Replies = append(mb.Replies, args[1].(string))
+		return fmt.Sprintf("r-%d", len(mb.Replies)-1), nil
 	case Edit:
 		ch, m, id := args[0].(string), args[1].(string), args[2].(string)
 		return mb.edit(c, ch, m, id)
@@ -50,16 +98,74 @@ func (mb *MockBot) Send(c Connector, kind Kind, args ...interface{}) (string, er
 	}
 	return "ERR", fmt.Errorf("Mesasge type unhandled")
 }
-func (mb *MockBot) AddPlugin(f Plugin)                        {}
+func (mb *MockBot) SendAndWait(c Connector, kind Kind, args ...interface{}) (string, error) {
+	return mb.Send(c, kind, args...)
+}
+func (mb *MockBot) AddPlugin(f Plugin)         {}
+func (mb *MockBot) Plugins() []PluginStatus    { return nil }
+func (mb *MockBot) EnablePlugin(string) error  { return nil }
+func (mb *MockBot) DisablePlugin(string) error { return nil }
+func (mb *MockBot) PluginEnabled(name, target string) bool {
+	return pluginEnabledIn(mb.Cfg, name, target)
+}
+func (mb *MockBot) EnablePluginIn(name, target string) error {
+	return mb.Cfg.Scope(target).Set(enabledKey(name), "true")
+}
+func (mb *MockBot) DisablePluginIn(name, target string) error {
+	return mb.Cfg.Scope(target).Set(enabledKey(name), "false")
+}
 func (mb *MockBot) Register(p Plugin, kind Kind, cb Callback) {}
-func (mb *MockBot) RegisterWeb(_, _ string)                   {}
-func (mb *MockBot) GetWebNavigation() []EndPoint              { return nil }
+func (mb *MockBot) RegisterCommand(p Plugin, cmd Command) {
+	if cmd.Permission != "" && cmd.Role != Nobody {
+		mb.Perms.Declare(cmd.Permission, cmd.Role)
+	}
+	if err := mb.commands.add(reflect.TypeOf(p).String(), cmd); err != nil {
+		panic(err)
+	}
+}
+func (mb *MockBot) RegisterWeb(_, _ string)      {}
+func (mb *MockBot) GetWebNavigation() []EndPoint { return nil }
+
+// Receive only runs declared commands, since callbacks are not kept by the mock
 func (mb *MockBot) Receive(c Connector, kind Kind, msg msg.Message, args ...interface{}) bool {
+	if mb.Limit.Ignored(msg) {
+		return false
+	}
+	if conv := mb.convos.take(kind, msg, args); conv != nil && conv.Answer(c, msg) {
+		return true
+	}
+	if kind != Message {
+		return false
+	}
+	mb.commands.RLock()
+	plugins := append([]string{}, mb.commands.order...)
+	mb.commands.RUnlock()
+	for _, p := range plugins {
+		if mb.commands.dispatch(mb, c, p, msg) {
+			return true
+		}
+	}
 	return false
 }
-func (mb *MockBot) Filter(msg msg.Message, s string) string    { return s }
-func (mb *MockBot) LastMessage(ch string) (msg.Message, error) { return msg.Message{}, nil }
-func (mb *MockBot) CheckAdmin(nick string) bool                { return false }
+
+// Ask waits for the answer to a question like the bot does, with every connector named ""
+func (mb *MockBot) Ask(p Plugin, prompt Prompt) *Conversation {
+	conv := mb.convos.ask(mb.Cfg, reflect.TypeOf(p).String(), "", prompt)
+	sendQuestion(mb, prompt)
+	return conv
+}
+
+// Help generates the help text of a plugin from its declared commands
+func (mb *MockBot) Help(p Plugin) string {
+	return mb.commands.help(mb, reflect.TypeOf(p).String()).String()
+}
+func (mb *MockBot) Filter(msg msg.Message, s string) string          { return s }
+func (mb *MockBot) LastMessage(conn, ch string) (msg.Message, error) { return msg.Message{}, nil }
+func (mb *MockBot) MessageLog() *msglog.MsgLogger                    { return mb.MsgLog }
+func (mb *MockBot) Permissions() *Permissions                        { return mb.Perms }
+func (mb *MockBot) Accounts() *Accounts                              { return mb.Accts }
+func (mb *MockBot) Limits() *Limiter                                 { return mb.Limit }
+func (mb *MockBot) Scheduler() *schedule.Scheduler                   { return mb.Sched }
 
 func (mb *MockBot) react(c Connector, channel, reaction string, message msg.Message) (string, error) {
 	mb.Reactions = append(mb.Reactions, reaction)
@@ -97,16 +203,63 @@ func (mb *MockBot) edit(c Connector, channel, newMessage, identifier string) (st
 	return "", nil
 }
 
-func (mb *MockBot) GetEmojiList() map[string]string                { return make(map[string]string) }
+func (mb *MockBot) GetEmojiList(Connector) map[string]string       { return make(map[string]string) }
 func (mb *MockBot) RegisterFilter(s string, f func(string) string) {}
 
+// TestDBEnv names the variable that points the mock bot at a Postgres database
+// Each test binary works in its own schema there, so packages can run in parallel.
+const TestDBEnv = "CATBASE_TEST_DB"
+
+var (
+	testDBOnce sync.Once
+	testDB     string
+)
+
+// mockDB picks the database of the mock bot, an in memory SQLite database unless TestDBEnv is set
+func mockDB() string {
+	testDBOnce.Do(func() {
+		testDB = os.Getenv(TestDBEnv)
+		if testDB == "" {
+			testDB = "file::memory:?mode=memory&cache=shared"
+			return
+		}
+		schema := fmt.Sprintf("catbase_test_%d", os.Getpid())
+		db, err := sql.Open("postgres", testDB)
+		if err == nil {
+			_, err = db.Exec(`drop schema if exists ` + schema + ` cascade; create schema ` + schema)
+			db.Close()
+		}
+		if err != nil {
+			log.Fatal().Err(err).Msgf("Could not set up %s", schema)
+		}
+		u, err := url.Parse(testDB)
+		if err != nil {
+			log.Fatal().Err(err).Msgf("Bad %s", TestDBEnv)
+		}
+		q := u.Query()
+		q.Set("search_path", schema)
+		u.RawQuery = q.Encode()
+		testDB = u.String()
+	})
+	return testDB
+}
+
 func NewMockBot() *MockBot {
-	cfg := config.ReadConfig("file::memory:?mode=memory&cache=shared")
+	cfg := config.ReadConfig(mockDB())
+	// keep tests from writing a key file
+	cfg.SetSecretKey("catbase mock key")
 	b := MockBot{
 		Cfg:      cfg,
+		MsgLog:   msglog.New(cfg.DB, msglog.DefaultTail),
+		Perms:    NewPermissions(cfg),
+		Sched:    schedule.New(cfg.DB),
+		commands: newCommandRegistry(),
 		Messages: make([]string, 0),
 		Actions:  make([]string, 0),
 	}
+	b.Accts = NewAccounts(cfg, b.Perms)
+	b.Limit = NewLimiter(cfg, b.Perms, b.Send)
+	b.Sched.Start()
 	// If any plugin registered a route, we need to reset those before any new test
 	http.DefaultServeMux = new(http.ServeMux)
 	return &b
@@ -3,6 +3,7 @@
 package msg
 
 import (
+	"context"
 	"time"
 
 	"github.com/velour/catbase/bot/user"
@@ -13,6 +14,8 @@ type Messages []Message
 
 type Message struct {
 	User *user.User
+	// Connector is the name of the chat service the message came from
+	Connector string
 	// With Slack, channel is the ID of a channel
 	Channel string
 	// With slack, channelName is the nice name of a channel
@@ -25,4 +28,14 @@ type Message struct {
 	Time           time.Time
 	Host           string
 	AdditionalData map[string]string
+	// Context is cancelled when a plugin runs past its deadline
+	Context context.Context `json:"-"`
+}
+
+// Ctx gives the context of a message, which is never nil
+func (m Message) Ctx() context.Context {
+	if m.Context == nil {
+		return context.Background()
+	}
+	return m.Context
 }
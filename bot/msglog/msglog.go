@@ -1,36 +1,261 @@
 // © 2013 the CatBase Authors under the WTFPL. See AUTHORS for the list of authors.
 
+// Package msglog stores every message the bot sees so plugins can look back at history
 package msglog
 
-import "github.com/velour/catbase/bot/msg"
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
 
-type MsgLogger struct {
-	in      <-chan msg.Message
-	out     chan<- msg.Messages
-	entries msg.Messages
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog/log"
+	"github.com/velour/catbase/bot/migrate"
+	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/bot/user"
+	"github.com/velour/catbase/config"
+)
+
+func init() {
+	migrate.Register("msglog", migrate.Step{
+		Version: 1,
+		Name:    "create msglog table",
+		SQL: `create table if not exists msglog (
+			id integer primary key,
+			connector string,
+			channel string,
+			user_id string,
+			user_name string,
+			body string,
+			action boolean,
+			time integer
+		);
+		create index if not exists msglog_channel_time
+			on msglog (channel, time);`,
+	}, migrate.Step{
+		Version: 2,
+		Name:    "index msglog by connector",
+		SQL: `drop index if exists msglog_channel_time;
+		create index if not exists msglog_connector_channel_time
+			on msglog (connector, channel, time);`,
+	})
 }
 
-func New(in chan msg.Message, out chan msg.Messages) *MsgLogger {
-	return &MsgLogger{in, out, make(msg.Messages, 0)}
+// DefaultTail is the number of messages kept in memory for each channel
+const DefaultTail = 50
+
+// ErrNoMessages is returned when a channel has no history
+var ErrNoMessages = errors.New("No messages found.")
+
+// MsgLogger writes messages to the database and keeps a short tail of each channel in memory
+type MsgLogger struct {
+	db *sqlx.DB
+
+	// fts is set when SQLite was built with FTS5 support
+	fts bool
+
+	sync.Mutex
+	tailSize int
+	tails    map[string]msg.Messages
 }
 
-func RunNew(in chan msg.Message, out chan msg.Messages) {
-	logger := New(in, out)
-	go logger.Run()
+type entry struct {
+	ID        int64
+	Connector string
+	Channel   string
+	UserID    string `db:"user_id"`
+	UserName  string `db:"user_name"`
+	Body      string
+	Action    bool
+	Time      int64
 }
 
-func (l *MsgLogger) sendEntries() {
-	l.out <- l.entries
+func (e entry) message() msg.Message {
+	return msg.Message{
+		User: &user.User{
+			ID:   e.UserID,
+			Name: e.UserName,
+		},
+		Connector: e.Connector,
+		Channel:   e.Channel,
+		Body:      e.Body,
+		Action:    e.Action,
+		Time:      time.Unix(e.Time, 0),
+	}
 }
 
-func (l *MsgLogger) Run() {
-	var msg msg.Message
-	for {
-		select {
-		case msg = <-l.in:
-			l.entries = append(l.entries, msg)
-		case l.out <- l.entries:
-			go l.sendEntries()
+// New creates a logger and any tables it needs
+func New(db *sqlx.DB, tailSize int) *MsgLogger {
+	migrate.MustUp(db, "msglog")
+
+	l := &MsgLogger{
+		db:       db,
+		tailSize: tailSize,
+		tails:    make(map[string]msg.Messages),
+	}
+
+	// FTS5 is only available when go-sqlite3 is built with -tags sqlite_fts5
+	if config.DialectOf(db) != config.SQLite {
+		log.Info().Msg("Full text search needs SQLite, message search will be slow")
+	} else {
+		var existed int
+		db.Get(&existed, `select count(*) from sqlite_master where name='msglog_fts'`)
+		if _, err := db.Exec(`create virtual table if not exists msglog_fts
+			using fts5(body, content='msglog', content_rowid='id');`); err != nil {
+			log.Info().Err(err).Msg("Full text search unavailable, message search will be slow")
+		} else {
+			l.fts = true
+		}
+		// index the messages logged before the table existed
+		if l.fts && existed == 0 {
+			if _, err := db.Exec(`insert into msglog_fts (msglog_fts) values ('rebuild')`); err != nil {
+				log.Error().Err(err).Msg("Could not index the message log")
+			}
 		}
 	}
+
+	return l
+}
+
+// channelKey keys a channel's tail by its connector too, since channels on different connectors can share a name
+func channelKey(connector, channel string) string {
+	return strings.ToLower(connector + ":" + channel)
+}
+
+// Log records a message
+func (l *MsgLogger) Log(m msg.Message) error {
+	l.Lock()
+	key := channelKey(m.Connector, m.Channel)
+	tail := append(l.tails[key], m)
+	if len(tail) > l.tailSize {
+		tail = tail[len(tail)-l.tailSize:]
+	}
+	l.tails[key] = tail
+	l.Unlock()
+
+	var userID, userName string
+	if m.User != nil {
+		userID, userName = m.User.ID, m.User.Name
+	}
+	if m.Time.IsZero() {
+		m.Time = time.Now()
+	}
+
+	res, err := l.db.Exec(`insert into msglog
+		(connector, channel, user_id, user_name, body, action, time)
+		values (?, ?, ?, ?, ?, ?, ?)`,
+		m.Connector, m.Channel, userID, userName, m.Body, m.Action, m.Time.Unix())
+	if err != nil {
+		return err
+	}
+	if !l.fts {
+		return nil
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	_, err = l.db.Exec(`insert into msglog_fts (rowid, body) values (?, ?)`, id, m.Body)
+	return err
+}
+
+// LastMessage returns the most recent message seen in a connector's channel
+func (l *MsgLogger) LastMessage(connector, channel string) (msg.Message, error) {
+	l.Lock()
+	defer l.Unlock()
+	tail := l.tails[channelKey(connector, channel)]
+	if len(tail) == 0 {
+		return msg.Message{}, ErrNoMessages
+	}
+	return tail[len(tail)-1], nil
+}
+
+// Range returns up to limit of the most recent messages in a connector's channel
+// between since and until, oldest first
+func (l *MsgLogger) Range(connector, channel string, since, until time.Time, limit int) (msg.Messages, error) {
+	q := `select id, connector, channel, user_id, user_name, body, action, time
+		from msglog
+		where connector = ? and channel = ? and time >= ? and time <= ?
+		order by time desc, id desc
+		limit ?`
+	var entries []entry
+	if err := l.db.Select(&entries, q, connector, channel, since.Unix(), until.Unix(), limit); err != nil {
+		return nil, err
+	}
+	return reversed(entries), nil
+}
+
+// Search finds up to limit of the most recent messages in a connector's channel, oldest first,
+// where text appears starting at the beginning of a word: "brown fo" finds "the brown fox"
+// but "rown" does not. Full text search can only find words by their start, so the
+// slow search without it matches the same way.
+func (l *MsgLogger) Search(connector, channel, text string, limit int) (msg.Messages, error) {
+	var entries []entry
+	var err error
+	// the text follows a space, or starts the message; % and _ in it are only themselves
+	wordStart := "% " + strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(text) + "%"
+	if l.fts {
+		q := `select m.id, m.connector, m.channel, m.user_id, m.user_name, m.body, m.action, m.time
+			from msglog m
+			inner join msglog_fts f on f.rowid = m.id
+			where msglog_fts match ? and lower(' ' || m.body) like lower(?) escape '\'
+				and m.connector = ? and m.channel = ?
+			order by m.time desc, m.id desc
+			limit ?`
+		// quote the text so it is treated as a phrase prefix rather than FTS syntax
+		phrase := `"` + strings.Replace(text, `"`, `""`, -1) + `"*`
+		err = l.db.Select(&entries, q, phrase, wordStart, connector, channel, limit)
+	} else {
+		q := `select id, connector, channel, user_id, user_name, body, action, time
+			from msglog
+			where lower(' ' || body) like lower(?) escape '\' and connector = ? and channel = ?
+			order by time desc, id desc
+			limit ?`
+		err = l.db.Select(&entries, q, wordStart, connector, channel, limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return reversed(entries), nil
+}
+
+// Channel is somewhere the bot has seen a message
+type Channel struct {
+	Connector string
+	Channel   string
+}
+
+// Channels lists every channel that has been logged
+func (l *MsgLogger) Channels() ([]Channel, error) {
+	var channels []Channel
+	q := `select distinct connector, channel from msglog order by connector, channel`
+	if err := l.db.Select(&channels, q); err != nil {
+		return nil, err
+	}
+	return channels, nil
+}
+
+// FindUser looks up the most recent speaker on a connector with the given name
+func (l *MsgLogger) FindUser(connector, name string) (user.User, error) {
+	var u struct {
+		ID   string `db:"user_id"`
+		Name string `db:"user_name"`
+	}
+	q := `select user_id, user_name from msglog
+		where connector = ? and lower(user_name) = lower(?)
+		order by time desc, id desc
+		limit 1`
+	if err := l.db.Get(&u, q, connector, name); err != nil {
+		return user.User{}, err
+	}
+	return user.User{ID: u.ID, Name: u.Name}, nil
+}
+
+func reversed(entries []entry) msg.Messages {
+	out := make(msg.Messages, len(entries))
+	for i, e := range entries {
+		out[len(entries)-1-i] = e.message()
+	}
+	return out
 }
@@ -4,25 +4,189 @@ package msglog
 
 import (
 	"testing"
+	"time"
 
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
 	"github.com/stretchr/testify/assert"
 	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/bot/user"
 )
 
+func setup(t *testing.T, tail int) *MsgLogger {
+	db := sqlx.MustOpen("sqlite3", ":memory:")
+	db.SetMaxOpenConns(1)
+	return New(db, tail)
+}
+
+func makeMessage(channel, nick, body string, when time.Time) msg.Message {
+	return msg.Message{
+		User:    &user.User{ID: nick, Name: nick},
+		Channel: channel,
+		Body:    body,
+		Time:    when,
+	}
+}
+
 func TestNew(t *testing.T) {
-	in := make(chan msg.Message)
-	out := make(chan msg.Messages)
-	logger := New(in, out)
-	assert.NotNil(t, logger)
+	l := setup(t, DefaultTail)
+	assert.NotNil(t, l)
 }
 
-func TestRunNew(t *testing.T) {
-	in := make(chan msg.Message)
-	out := make(chan msg.Messages)
-	RunNew(in, out)
+func TestLastMessage(t *testing.T) {
+	l := setup(t, DefaultTail)
+	now := time.Now()
+	assert.Nil(t, l.Log(makeMessage("#a", "tester", "first", now)))
+	assert.Nil(t, l.Log(makeMessage("#b", "tester", "other", now)))
+	assert.Nil(t, l.Log(makeMessage("#A", "tester", "second", now)))
+	m, err := l.LastMessage("", "#a")
+	assert.Nil(t, err)
+	assert.Equal(t, "second", m.Body)
+}
+
+func TestChannelsAreKeyedByConnector(t *testing.T) {
+	l := setup(t, DefaultTail)
+	now := time.Now()
+	for _, conn := range []string{"irc", "slack"} {
+		m := makeMessage("#a", "tester", "brown fox on "+conn, now)
+		m.Connector = conn
+		assert.Nil(t, l.Log(m))
+	}
+	m, err := l.LastMessage("irc", "#a")
+	assert.Nil(t, err)
+	assert.Equal(t, "brown fox on irc", m.Body)
+	msgs, err := l.Range("slack", "#a", now.Add(-time.Minute), now, 10)
+	assert.Nil(t, err)
+	assert.Len(t, msgs, 1)
+	assert.Equal(t, "slack", msgs[0].Connector)
+	msgs, err = l.Search("irc", "#a", "brown fox", 10)
+	assert.Nil(t, err)
+	assert.Len(t, msgs, 1)
+	assert.Equal(t, "irc", msgs[0].Connector)
+}
+
+func TestLastMessageEmpty(t *testing.T) {
+	l := setup(t, DefaultTail)
+	_, err := l.LastMessage("", "#a")
+	assert.Equal(t, ErrNoMessages, err)
+}
+
+func TestTailIsBounded(t *testing.T) {
+	l := setup(t, 2)
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		l.Log(makeMessage("#a", "tester", "hi", now))
+	}
+	assert.Len(t, l.tails[channelKey("", "#a")], 2)
+}
+
+func TestRange(t *testing.T) {
+	l := setup(t, DefaultTail)
+	t0 := time.Now().Add(-time.Hour)
+	for i, b := range []string{"one", "two", "three", "four"} {
+		l.Log(makeMessage("#a", "tester", b, t0.Add(time.Duration(i)*time.Minute)))
+	}
+	l.Log(makeMessage("#b", "tester", "elsewhere", t0))
+
+	msgs, err := l.Range("", "#a", t0.Add(time.Minute), time.Now(), 10)
+	assert.Nil(t, err)
+	assert.Len(t, msgs, 3)
+	assert.Equal(t, "two", msgs[0].Body)
+	assert.Equal(t, "four", msgs[2].Body)
+
+	msgs, err = l.Range("", "#a", t0, time.Now(), 2)
+	assert.Nil(t, err)
+	assert.Len(t, msgs, 2)
+	assert.Equal(t, "three", msgs[0].Body)
+}
+
+func TestSearch(t *testing.T) {
+	l := setup(t, DefaultTail)
+	now := time.Now()
+	l.Log(makeMessage("#a", "tester", "the quick brown fox", now))
+	l.Log(makeMessage("#a", "tester", "the lazy dog", now))
+	l.Log(makeMessage("#b", "tester", "another brown fox", now))
+	msgs, err := l.Search("", "#a", "brown fox", 10)
+	assert.Nil(t, err)
+	assert.Len(t, msgs, 1)
+	assert.Equal(t, "tester", msgs[0].User.Name)
+	assert.Equal(t, "the quick brown fox", msgs[0].Body)
+}
+
+func TestSearchMatchesWordStarts(t *testing.T) {
+	l := setup(t, DefaultTail)
+	now := time.Now()
+	for _, b := range []string{"the quick brown fox", "Brownies for all", "a cabrown fox", "the brown dog"} {
+		l.Log(makeMessage("#a", "tester", b, now))
+	}
+	// with and without full text search, which needs -tags sqlite_fts5
+	for _, fts := range []bool{l.fts, false} {
+		l.fts = fts
+		msgs, err := l.Search("", "#a", "brown", 10)
+		assert.Nil(t, err)
+		assert.Len(t, msgs, 3, "fts %v", fts)
+		msgs, err = l.Search("", "#a", "brown fo", 10)
+		assert.Nil(t, err)
+		assert.Len(t, msgs, 1, "fts %v", fts)
+		msgs, err = l.Search("", "#a", "rown", 10)
+		assert.Nil(t, err)
+		assert.Len(t, msgs, 0, "fts %v", fts)
+	}
+}
+
+func TestSearchTakesWildcardsLiterally(t *testing.T) {
+	l := setup(t, DefaultTail)
+	now := time.Now()
+	for _, b := range []string{"100% done", "1000 done", "snake_case", "snakescase"} {
+		l.Log(makeMessage("#a", "tester", b, now))
+	}
+	for _, fts := range []bool{l.fts, false} {
+		l.fts = fts
+		msgs, err := l.Search("", "#a", "100%", 10)
+		assert.Nil(t, err)
+		assert.Len(t, msgs, 1, "fts %v", fts)
+		msgs, err = l.Search("", "#a", "snake_", 10)
+		assert.Nil(t, err)
+		assert.Len(t, msgs, 1, "fts %v", fts)
+	}
+}
+
+func TestSearchIndexesEarlierMessages(t *testing.T) {
+	db := sqlx.MustOpen("sqlite3", ":memory:")
+	db.SetMaxOpenConns(1)
+	l := New(db, DefaultTail)
+	if !l.fts {
+		t.Skip("full text search needs -tags sqlite_fts5")
+	}
+	l.Log(makeMessage("#a", "tester", "the quick brown fox", time.Now()))
+	db.MustExec(`drop table msglog_fts`)
+	l = New(db, DefaultTail)
+	msgs, err := l.Search("", "#a", "brown", 10)
+	assert.Nil(t, err)
+	assert.Len(t, msgs, 1)
+}
+
+func TestFindUser(t *testing.T) {
+	l := setup(t, DefaultTail)
+	m := makeMessage("#a", "Tester", "hi", time.Now())
+	m.User.ID = "U123"
+	m.Connector = "slack"
+	l.Log(m)
+	u, err := l.FindUser("slack", "tester")
+	assert.Nil(t, err)
+	assert.Equal(t, "U123", u.ID)
+	_, err = l.FindUser("irc", "tester")
+	assert.NotNil(t, err)
+}
 
-	in <- msg.Message{}
-	msg := <-out
-	assert.Empty(t, out)
-	assert.NotNil(t, msg)
+func TestChannels(t *testing.T) {
+	l := setup(t, DefaultTail)
+	for _, ch := range []string{"#b", "#a", "#b"} {
+		m := makeMessage(ch, "tester", "hi", time.Now())
+		m.Connector = "irc"
+		l.Log(m)
+	}
+	channels, err := l.Channels()
+	assert.Nil(t, err)
+	assert.Equal(t, []Channel{{"irc", "#a"}, {"irc", "#b"}}, channels)
 }
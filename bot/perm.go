@@ -0,0 +1,215 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+package bot
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	"github.com/velour/catbase/bot/migrate"
+	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/config"
+)
+
+func init() {
+	migrate.Register("permissions", migrate.Step{
+		Version: 1,
+		Name:    "create roles table",
+		SQL: `create table if not exists roles (
+			connector string,
+			user_id string,
+			role string,
+			primary key (connector, user_id)
+		);`,
+	})
+}
+
+// Role is the level of trust a user has been given
+// Each role includes every permission of the roles below it
+type Role int
+
+const (
+	Nobody Role = iota
+	Trusted
+	Moderator
+	Admin
+	Owner
+)
+
+var roleNames = []string{"nobody", "trusted", "moderator", "admin", "owner"}
+
+func (r Role) String() string {
+	if r < Nobody || r > Owner {
+		return fmt.Sprintf("role(%d)", int(r))
+	}
+	return roleNames[r]
+}
+
+// ParseRole reads a role name as used in chat and config
+func ParseRole(name string) (Role, error) {
+	for i, n := range roleNames {
+		if strings.ToLower(name) == n {
+			return Role(i), nil
+		}
+	}
+	return Nobody, fmt.Errorf("Unknown role %s", name)
+}
+
+// NoPermission is the standard refusal for a command a user may not run
+const NoPermission = "Sorry, you don't have permission to do that."
+
+// Permissions stores the roles users have been granted and the roles commands require
+// Users are identified by connector name and their stable user ID
+type Permissions struct {
+	config *config.Config
+
+	sync.Mutex
+	commands map[string]Role
+}
+
+// NewPermissions creates the role storage
+func NewPermissions(c *config.Config) *Permissions {
+	migrate.MustUp(c.DB, "permissions")
+	return &Permissions{
+		config:   c,
+		commands: make(map[string]Role),
+	}
+}
+
+// Declare registers a command and the role needed to run it
+// The required role may be overridden with the perm.<command> config key
+func (p *Permissions) Declare(command string, role Role) {
+	p.Lock()
+	defer p.Unlock()
+	p.commands[strings.ToLower(command)] = role
+}
+
+// Required finds the role needed to run a command
+// Undeclared commands are open to everybody
+func (p *Permissions) Required(command string) Role {
+	command = strings.ToLower(command)
+	p.Lock()
+	role := p.commands[command]
+	p.Unlock()
+	if override := p.config.Get("perm."+command, ""); override != "" {
+		r, err := ParseRole(override)
+		if err != nil {
+			log.Error().Err(err).Msgf("Bad permission override for %s", command)
+			return role
+		}
+		return r
+	}
+	return role
+}
+
+// Commands lists every declared command by name
+func (p *Permissions) Commands() []string {
+	p.Lock()
+	defer p.Unlock()
+	commands := []string{}
+	for c := range p.commands {
+		commands = append(commands, c)
+	}
+	sort.Strings(commands)
+	return commands
+}
+
+// UserKey gives the stable identity of the user who sent a message
+// Connectors without user IDs fall back to the nick
+func UserKey(message msg.Message) string {
+	if message.User == nil {
+		return ""
+	}
+	if message.User.ID != "" {
+		return message.User.ID
+	}
+	return message.User.Name
+}
+
+// DMChannel is where a connector delivers a private message to whoever sent a message
+// IRC and the terminal address people by nick, the Slack connectors by user ID.
+func DMChannel(message msg.Message) string {
+	if message.IsIM {
+		return message.Channel
+	}
+	switch message.Connector {
+	case "irc", "term":
+		return message.User.Name
+	}
+	return UserKey(message)
+}
+
+// Role looks up the role of a user on a connector
+// Owners listed as connector:id in bot.owners can not be changed from chat
+func (p *Permissions) Role(connector, id string) Role {
+	if id == "" {
+		return Nobody
+	}
+	for _, owner := range p.config.GetArray("bot.owners", []string{}) {
+		if c, i := ParseTarget(owner); c == connector && i == id {
+			return Owner
+		}
+	}
+	var name string
+	err := p.config.DB.Get(&name, `select role from roles where connector=? and user_id=?`, connector, id)
+	if err == sql.ErrNoRows {
+		return Nobody
+	} else if err != nil {
+		log.Error().Err(err).Msg("Could not look up role")
+		return Nobody
+	}
+	role, err := ParseRole(name)
+	if err != nil {
+		log.Error().Err(err).Msg("Bad role in database")
+	}
+	return role
+}
+
+// RoleOf finds the role of whoever sent a message
+// Messages from the web pages carry the connector:id their sender logged in as.
+func (p *Permissions) RoleOf(message msg.Message) Role {
+	if message.Connector == WebConnector {
+		return p.Role(ParseTarget(UserKey(message)))
+	}
+	return p.Role(message.Connector, UserKey(message))
+}
+
+// Allowed checks whether the sender of a message may run a command
+func (p *Permissions) Allowed(message msg.Message, command string) bool {
+	return p.RoleOf(message) >= p.Required(command)
+}
+
+// Grant gives a user a role, replacing any role they had
+func (p *Permissions) Grant(connector, id string, role Role) error {
+	if role == Nobody {
+		return p.Revoke(connector, id)
+	}
+	_, err := p.config.Exec(`insert into roles (connector, user_id, role) values (?, ?, ?)
+		on conflict(connector, user_id) do update set role=excluded.role`,
+		connector, id, role.String())
+	return err
+}
+
+// Revoke removes any role a user has
+func (p *Permissions) Revoke(connector, id string) error {
+	_, err := p.config.Exec(`delete from roles where connector=? and user_id=?`, connector, id)
+	return err
+}
+
+// Grantee is a user who has been given a role
+type Grantee struct {
+	Connector string
+	UserID    string `db:"user_id"`
+	Role      string
+}
+
+// Grantees lists everybody with a role stored in the database
+func (p *Permissions) Grantees() ([]Grantee, error) {
+	var grantees []Grantee
+	err := p.config.Select(&grantees, `select connector, user_id, role from roles order by connector, user_id`)
+	return grantees, err
+}
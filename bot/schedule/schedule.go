@@ -0,0 +1,457 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+// Package schedule runs timed work for plugins
+// Jobs are stored in the database so they survive restarts. Since functions can't
+// be stored, a job names a handler which plugins register each time they start.
+package schedule
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog/log"
+	"github.com/velour/catbase/bot/migrate"
+)
+
+func init() {
+	migrate.Register("schedule", migrate.Step{
+		Version: 1,
+		Name:    "create schedule table",
+		SQL: `create table if not exists schedule (
+			name string primary key,
+			handler string,
+			kind string,
+			spec string,
+			jitter integer,
+			payload string,
+			next integer
+		);`,
+	})
+}
+
+const (
+	// Once jobs run a single time and are then removed
+	Once = "once"
+	// Every jobs run repeatedly at an interval
+	Every = "every"
+	// Cron jobs run at times matching a cron expression
+	Cron = "cron"
+)
+
+// retryDelay is how long a job waits when nothing is handling it yet
+const retryDelay = time.Minute
+
+// Job is a piece of timed work
+type Job struct {
+	// Name identifies the job; scheduling another job with the same name replaces it
+	Name string
+	// Handler names the function that does the work
+	Handler string
+	Kind    string
+	// Spec is an RFC3339 time for Once jobs, a duration for Every jobs and an expression for Cron jobs
+	Spec string
+	// Jitter is the most random delay added to each run
+	Jitter time.Duration
+	// Payload is handed to the handler, usually to say which channel the job is for
+	Payload string
+	Next    time.Time
+}
+
+// Handler does the work of a job
+type Handler func(Job)
+
+type jobRow struct {
+	Name    string
+	Handler string
+	Kind    string
+	Spec    string
+	Jitter  int64
+	Payload string
+	Next    int64
+}
+
+// Scheduler runs jobs when they are due
+type Scheduler struct {
+	db *sqlx.DB
+
+	sync.Mutex
+	handlers map[string]Handler
+	jobs     map[string]*Job
+
+	wake    chan bool
+	stop    chan bool
+	running bool
+
+	// inflight counts jobs that are running
+	inflight sync.WaitGroup
+}
+
+// New creates the job storage and loads any saved jobs
+// Nothing runs until Start is called
+func New(db *sqlx.DB) *Scheduler {
+	migrate.MustUp(db, "schedule")
+	s := &Scheduler{
+		db:       db,
+		handlers: make(map[string]Handler),
+		jobs:     make(map[string]*Job),
+		wake:     make(chan bool, 1),
+		stop:     make(chan bool),
+	}
+	var rows []jobRow
+	if err := db.Select(&rows, `select name, handler, kind, spec, jitter, payload, next from schedule`); err != nil {
+		log.Error().Err(err).Msg("Could not load scheduled jobs")
+	}
+	for _, r := range rows {
+		s.jobs[r.Name] = &Job{
+			Name:    r.Name,
+			Handler: r.Handler,
+			Kind:    r.Kind,
+			Spec:    r.Spec,
+			Jitter:  time.Duration(r.Jitter),
+			Payload: r.Payload,
+			Next:    time.Unix(r.Next, 0),
+		}
+	}
+	return s
+}
+
+// Handle registers the function behind a handler name
+func (s *Scheduler) Handle(name string, h Handler) {
+	s.Lock()
+	s.handlers[name] = h
+	s.Unlock()
+	s.poke()
+}
+
+// Once runs a handler a single time
+func (s *Scheduler) Once(name, handler string, at time.Time, payload string) error {
+	return s.add(&Job{
+		Name:    name,
+		Handler: handler,
+		Kind:    Once,
+		Spec:    at.Format(time.RFC3339),
+		Payload: payload,
+		Next:    at,
+	})
+}
+
+// Every runs a handler repeatedly, waiting the interval plus some jitter between runs
+// A job that was already saved with the same interval keeps its next run time.
+func (s *Scheduler) Every(name, handler string, interval, jitter time.Duration, payload string) error {
+	if interval <= 0 {
+		return fmt.Errorf("Interval for %s must be positive", name)
+	}
+	j := &Job{
+		Name:    name,
+		Handler: handler,
+		Kind:    Every,
+		Spec:    interval.String(),
+		Jitter:  jitter,
+		Payload: payload,
+	}
+	j.Next = next(j, time.Now())
+	return s.add(j)
+}
+
+// Cron runs a handler at times matching a five field cron expression, plus some jitter
+// A job that was already saved with the same expression keeps its next run time.
+func (s *Scheduler) Cron(name, handler, spec string, jitter time.Duration, payload string) error {
+	c, err := parseCron(spec)
+	if err != nil {
+		return err
+	}
+	if c.next(time.Now()).IsZero() {
+		return fmt.Errorf("Cron expression %q never matches", spec)
+	}
+	j := &Job{
+		Name:    name,
+		Handler: handler,
+		Kind:    Cron,
+		Spec:    spec,
+		Jitter:  jitter,
+		Payload: payload,
+	}
+	j.Next = next(j, time.Now())
+	return s.add(j)
+}
+
+func (s *Scheduler) add(j *Job) error {
+	s.Lock()
+	if old, ok := s.jobs[j.Name]; ok && j.Kind != Once &&
+		old.Kind == j.Kind && old.Spec == j.Spec && old.Handler == j.Handler {
+		j.Next = old.Next
+	}
+	s.jobs[j.Name] = j
+	err := s.save(j)
+	s.Unlock()
+	s.poke()
+	return err
+}
+
+// Cancel removes a job
+func (s *Scheduler) Cancel(name string) error {
+	s.Lock()
+	_, ok := s.jobs[name]
+	if !ok {
+		s.Unlock()
+		return fmt.Errorf("No job named %s", name)
+	}
+	delete(s.jobs, name)
+	_, err := s.db.Exec(`delete from schedule where name=?`, name)
+	s.Unlock()
+	s.poke()
+	return err
+}
+
+// Prune cancels a handler's jobs whose payload is not one of keep
+// Plugins with a job per channel use it at startup so channels taken out of the config stop running.
+func (s *Scheduler) Prune(handler string, keep []string) error {
+	kept := map[string]bool{}
+	for _, k := range keep {
+		kept[k] = true
+	}
+	stale := []string{}
+	s.Lock()
+	for name, j := range s.jobs {
+		if j.Handler == handler && !kept[j.Payload] {
+			stale = append(stale, name)
+		}
+	}
+	s.Unlock()
+	for _, name := range stale {
+		log.Info().Msgf("Cancelling %s, its channel is no longer configured", name)
+		if err := s.Cancel(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get looks up a job by name
+func (s *Scheduler) Get(name string) (Job, bool) {
+	s.Lock()
+	defer s.Unlock()
+	j, ok := s.jobs[name]
+	if !ok {
+		return Job{}, false
+	}
+	return *j, true
+}
+
+// Upcoming lists every job, soonest first
+func (s *Scheduler) Upcoming() []Job {
+	s.Lock()
+	defer s.Unlock()
+	jobs := []Job{}
+	for _, j := range s.jobs {
+		jobs = append(jobs, *j)
+	}
+	sort.Slice(jobs, func(i, k int) bool { return jobs[i].Next.Before(jobs[k].Next) })
+	return jobs
+}
+
+// RunNow runs a job immediately without changing when it next runs
+func (s *Scheduler) RunNow(name string) error {
+	s.Lock()
+	j, ok := s.jobs[name]
+	var h Handler
+	if ok {
+		h = s.handlers[j.Handler]
+	}
+	s.Unlock()
+	if !ok {
+		return fmt.Errorf("No job named %s", name)
+	}
+	if h == nil {
+		return fmt.Errorf("Nothing handles %s", j.Handler)
+	}
+	s.inflight.Add(1)
+	go s.safeRun(h, *j)
+	return nil
+}
+
+// Start runs jobs in the background until Stop is called
+func (s *Scheduler) Start() {
+	s.Lock()
+	defer s.Unlock()
+	if s.running {
+		return
+	}
+	s.running = true
+	go s.loop()
+}
+
+// Stop halts the scheduler; jobs already running are left to finish
+func (s *Scheduler) Stop() {
+	s.Lock()
+	if !s.running {
+		s.Unlock()
+		return
+	}
+	s.running = false
+	s.Unlock()
+	s.stop <- true
+}
+
+// Wait blocks until the jobs that are running have finished
+func (s *Scheduler) Wait() {
+	s.inflight.Wait()
+}
+
+// poke wakes the loop so it notices changed jobs
+func (s *Scheduler) poke() {
+	select {
+	case s.wake <- true:
+	default:
+	}
+}
+
+func (s *Scheduler) loop() {
+	for {
+		var due <-chan time.Time
+		var timer *time.Timer
+		if at, ok := s.nextRun(); ok {
+			timer = time.NewTimer(time.Until(at))
+			due = timer.C
+		}
+		select {
+		case <-s.stop:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case <-s.wake:
+			if timer != nil {
+				timer.Stop()
+			}
+		case <-due:
+			s.runDue(time.Now())
+		}
+	}
+}
+
+func (s *Scheduler) nextRun() (time.Time, bool) {
+	s.Lock()
+	defer s.Unlock()
+	var at time.Time
+	for _, j := range s.jobs {
+		if at.IsZero() || j.Next.Before(at) {
+			at = j.Next
+		}
+	}
+	return at, !at.IsZero()
+}
+
+// runDue starts every job whose time has come and works out when each runs next
+func (s *Scheduler) runDue(now time.Time) {
+	s.Lock()
+	type run struct {
+		h Handler
+		j Job
+	}
+	runs := []run{}
+	changed := []Job{}
+	removed := []string{}
+	for name, j := range s.jobs {
+		if j.Next.After(now) {
+			continue
+		}
+		h, ok := s.handlers[j.Handler]
+		if !ok {
+			log.Warn().Msgf("Nothing handles %s for job %s yet", j.Handler, name)
+			j.Next = now.Add(retryDelay)
+			changed = append(changed, *j)
+			continue
+		}
+		runs = append(runs, run{h, *j})
+		if j.Kind == Once {
+			delete(s.jobs, name)
+			removed = append(removed, name)
+			continue
+		}
+		j.Next = next(j, now)
+		if j.Next.IsZero() {
+			log.Error().Msgf("Job %s will never run again", name)
+			delete(s.jobs, name)
+			removed = append(removed, name)
+			continue
+		}
+		changed = append(changed, *j)
+	}
+	// saved before unlocking so a Cancel or a replacement can't be undone by an older copy
+	for _, j := range changed {
+		if err := s.save(&j); err != nil {
+			log.Error().Err(err).Msgf("Could not save job %s", j.Name)
+		}
+	}
+	for _, name := range removed {
+		if _, err := s.db.Exec(`delete from schedule where name=?`, name); err != nil {
+			log.Error().Err(err).Msgf("Could not remove job %s", name)
+		}
+	}
+	s.Unlock()
+
+	for _, r := range runs {
+		log.Debug().Msgf("Running job %s", r.j.Name)
+		s.inflight.Add(1)
+		go s.safeRun(r.h, r.j)
+	}
+}
+
+// safeRun keeps a panicking job from taking the bot down with it
+func (s *Scheduler) safeRun(h Handler, j Job) {
+	defer s.inflight.Done()
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error().
+				Str("job", j.Name).
+				Str("stack", string(debug.Stack())).
+				Msgf("Job panicked: %v", r)
+		}
+	}()
+	h(j)
+}
+
+// save writes a job to the database
+// The scheduler must be locked, so what is saved matches the jobs in memory.
+func (s *Scheduler) save(j *Job) error {
+	_, err := s.db.Exec(`insert into schedule (name, handler, kind, spec, jitter, payload, next)
+		values (?, ?, ?, ?, ?, ?, ?)
+		on conflict(name) do update set handler=excluded.handler, kind=excluded.kind, spec=excluded.spec,
+			jitter=excluded.jitter, payload=excluded.payload, next=excluded.next`,
+		j.Name, j.Handler, j.Kind, j.Spec, int64(j.Jitter), j.Payload, j.Next.Unix())
+	return err
+}
+
+// next works out when a repeating job runs after the given time
+func next(j *Job, after time.Time) time.Time {
+	var at time.Time
+	switch j.Kind {
+	case Every:
+		interval, err := time.ParseDuration(j.Spec)
+		if err != nil {
+			return time.Time{}
+		}
+		at = after.Add(interval)
+	case Cron:
+		c, err := parseCron(j.Spec)
+		if err != nil {
+			return time.Time{}
+		}
+		at = c.next(after)
+		if at.IsZero() {
+			return at
+		}
+	default:
+		return time.Time{}
+	}
+	if j.Jitter > 0 {
+		at = at.Add(time.Duration(rand.Int63n(int64(j.Jitter))))
+	}
+	return at
+}
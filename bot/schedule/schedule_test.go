@@ -0,0 +1,145 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+)
+
+func setup(t *testing.T) (*Scheduler, *sqlx.DB) {
+	db := sqlx.MustOpen("sqlite3", ":memory:")
+	db.SetMaxOpenConns(1)
+	return New(db), db
+}
+
+func TestOnce(t *testing.T) {
+	s, _ := setup(t)
+	ran := make(chan Job, 1)
+	s.Handle("test", func(j Job) { ran <- j })
+	s.Start()
+	defer s.Stop()
+	assert.Nil(t, s.Once("job", "test", time.Now().Add(10*time.Millisecond), "payload"))
+	select {
+	case j := <-ran:
+		assert.Equal(t, "payload", j.Payload)
+	case <-time.After(time.Second):
+		t.Fatal("job never ran")
+	}
+	time.Sleep(10 * time.Millisecond)
+	_, ok := s.Get("job")
+	assert.False(t, ok)
+}
+
+func TestEvery(t *testing.T) {
+	s, _ := setup(t)
+	ran := make(chan Job, 10)
+	s.Handle("test", func(j Job) { ran <- j })
+	s.Start()
+	defer s.Stop()
+	assert.Nil(t, s.Every("job", "test", 20*time.Millisecond, 0, ""))
+	for i := 0; i < 2; i++ {
+		select {
+		case <-ran:
+		case <-time.After(time.Second):
+			t.Fatal("job didn't repeat")
+		}
+	}
+	_, ok := s.Get("job")
+	assert.True(t, ok)
+}
+
+func TestCancel(t *testing.T) {
+	s, _ := setup(t)
+	ran := make(chan Job, 1)
+	s.Handle("test", func(j Job) { ran <- j })
+	s.Start()
+	defer s.Stop()
+	assert.Nil(t, s.Once("job", "test", time.Now().Add(50*time.Millisecond), ""))
+	assert.Nil(t, s.Cancel("job"))
+	select {
+	case <-ran:
+		t.Fatal("cancelled job ran")
+	case <-time.After(100 * time.Millisecond):
+	}
+	assert.NotNil(t, s.Cancel("job"))
+}
+
+func TestPrune(t *testing.T) {
+	s, _ := setup(t)
+	assert.Nil(t, s.Every("test:a", "test", time.Hour, 0, "a"))
+	assert.Nil(t, s.Every("test:b", "test", time.Hour, 0, "b"))
+	assert.Nil(t, s.Every("other:b", "other", time.Hour, 0, "b"))
+	assert.Nil(t, s.Prune("test", []string{"a"}))
+	_, ok := s.Get("test:a")
+	assert.True(t, ok)
+	_, ok = s.Get("test:b")
+	assert.False(t, ok)
+	_, ok = s.Get("other:b")
+	assert.True(t, ok)
+}
+
+func TestJobsSurviveRestart(t *testing.T) {
+	s, db := setup(t)
+	assert.Nil(t, s.Every("job", "test", time.Hour, 0, "#general"))
+	first, _ := s.Get("job")
+
+	s2 := New(db)
+	j, ok := s2.Get("job")
+	assert.True(t, ok)
+	assert.Equal(t, "#general", j.Payload)
+	assert.Equal(t, first.Next.Unix(), j.Next.Unix())
+
+	// registering the same job again keeps its place
+	assert.Nil(t, s2.Every("job", "test", time.Hour, 0, "#general"))
+	j, _ = s2.Get("job")
+	assert.Equal(t, first.Next.Unix(), j.Next.Unix())
+}
+
+func TestUpcomingIsSorted(t *testing.T) {
+	s, _ := setup(t)
+	now := time.Now()
+	s.Once("later", "test", now.Add(time.Hour), "")
+	s.Once("sooner", "test", now.Add(time.Minute), "")
+	jobs := s.Upcoming()
+	assert.Len(t, jobs, 2)
+	assert.Equal(t, "sooner", jobs[0].Name)
+}
+
+func TestJitter(t *testing.T) {
+	j := &Job{Kind: Every, Spec: "1h", Jitter: time.Minute}
+	now := time.Now()
+	for i := 0; i < 20; i++ {
+		at := next(j, now)
+		assert.False(t, at.Before(now.Add(time.Hour)))
+		assert.True(t, at.Before(now.Add(time.Hour+time.Minute)))
+	}
+}
+
+func TestCron(t *testing.T) {
+	c, err := parseCron("*/15 9-17 * * 1-5")
+	assert.Nil(t, err)
+	// a Saturday afternoon moves to Monday morning
+	sat := time.Date(2019, time.August, 17, 14, 3, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2019, time.August, 19, 9, 0, 0, 0, time.UTC), c.next(sat))
+	mon := time.Date(2019, time.August, 19, 9, 7, 30, 0, time.UTC)
+	assert.Equal(t, time.Date(2019, time.August, 19, 9, 15, 0, 0, time.UTC), c.next(mon))
+}
+
+func TestCronAliases(t *testing.T) {
+	c, err := parseCron("@daily")
+	assert.Nil(t, err)
+	at := time.Date(2019, time.December, 31, 23, 59, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC), c.next(at))
+}
+
+func TestBadCron(t *testing.T) {
+	s, _ := setup(t)
+	for _, spec := range []string{"* * *", "60 * * * *", "*/0 * * * *", "a * * * *", "0 0 31 2 *"} {
+		assert.NotNil(t, s.Cron("job", "test", spec, 0, ""), spec)
+	}
+}
@@ -0,0 +1,354 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+package bot
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/rs/zerolog/log"
+	"github.com/velour/catbase/bot/metrics"
+	"github.com/velour/catbase/config"
+)
+
+func init() {
+	config.Declare(
+		config.Key{Name: "send.rate", Type: config.Float, Default: "1", Min: 0.01, Max: 100,
+			Description: "messages a second I send to one channel once a burst is used up"},
+		config.Key{Name: "send.burst", Type: config.Int, Default: "4", Min: 1, Max: 100,
+			Description: "messages I send to one channel at once before slowing down"},
+		config.Key{Name: "send.connectorRate", Type: config.Float, Default: "5", Min: 0.01, Max: 100,
+			Description: "messages a second I send through one connector, across its channels"},
+		config.Key{Name: "send.connectorBurst", Type: config.Int, Default: "10", Min: 1, Max: 1000,
+			Description: "messages I send through one connector at once before slowing down"},
+		config.Key{Name: "send.maxLength", Type: config.Int, Default: "4000", Min: 100, Max: 40000,
+			Description: "bytes in one message before it is split at line breaks"},
+		config.Key{Name: "send.queueSize", Type: config.Int, Default: "20", Min: 1, Max: 1000,
+			Description: "messages waiting for one channel before sending more fails"},
+	)
+}
+
+var (
+	sendWait = metrics.NewHistogram("catbase_send_wait_seconds",
+		"Time messages waited in the send queue", nil, "connector")
+	sendsCoalesced = metrics.NewCounter("catbase_sends_coalesced_total",
+		"Queued messages joined onto the one before them", "connector")
+	sendsRefused = metrics.NewCounter("catbase_sends_refused_total",
+		"Messages refused because the channel's send queue was full", "connector")
+)
+
+// ErrSendQueueFull is returned by Send when a channel has too many messages waiting to go out
+var ErrSendQueueFull = errors.New("too many messages are waiting to be sent to that channel")
+
+// LineConnector is implemented by connectors whose chat service takes one line per message, like IRC
+// The send queue gives them every line on its own and never joins messages.
+type LineConnector interface {
+	OneLinePerMessage()
+}
+
+// bucket is a token bucket holding up to burst tokens and refilling at rate a second
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func (b *bucket) refill(now time.Time, rate float64, burst int) {
+	if b.last.IsZero() {
+		b.tokens = float64(burst)
+	} else {
+		b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+	}
+	b.last = now
+}
+
+// wait is how long until the bucket has a token
+func (b *bucket) wait(rate float64) time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / rate * float64(time.Second))
+}
+
+// limits are the send settings of a connector:channel target
+type limits struct {
+	rate, connectorRate   float64
+	burst, connectorBurst int
+	maxLength, queueSize  int
+}
+
+// limitsFor reads the settings of a channel, then of its connector, then the global ones
+func limitsFor(c *config.Config, connector, target string) limits {
+	get := func(key string) config.Scope {
+		if s := c.Scope(target); s.Has(key) {
+			return s
+		}
+		return c.Scope(connector)
+	}
+	return limits{
+		rate:           get("send.rate").GetFloat64("send.rate", 1),
+		burst:          get("send.burst").GetInt("send.burst", 4),
+		connectorRate:  c.Scope(connector).GetFloat64("send.connectorRate", 5),
+		connectorBurst: c.Scope(connector).GetInt("send.connectorBurst", 10),
+		maxLength:      get("send.maxLength").GetInt("send.maxLength", 4000),
+		queueSize:      get("send.queueSize").GetInt("send.queueSize", 20),
+	}
+}
+
+// outgoing is a message waiting in a send queue
+type outgoing struct {
+	kind   Kind
+	args   []interface{}
+	queued time.Time
+	// done, when set, is handed what the connector said once the message is sent
+	done chan sent
+}
+
+// sent is the ID or error a connector gave for a message
+type sent struct {
+	id  string
+	err error
+}
+
+// text of a message, for the kinds the queue can split and join
+func (o *outgoing) text() string {
+	return o.args[1].(string)
+}
+
+// channelQueue holds the messages waiting to go to one channel
+type channelQueue struct {
+	pending []*outgoing
+	bucket  bucket
+	running bool
+}
+
+// sender queues messages so each connector and channel stays under its rate limits
+// The zero value is ready to use.
+type sender struct {
+	sync.Mutex
+	queues     map[string]*channelQueue
+	connectors map[string]*bucket
+}
+
+// send queues a message for a connector, split if it's long
+// When the channel has nothing waiting and the limits allow it, the first part
+// is sent right away and its ID and error returned. Otherwise send returns as
+// soon as the message is queued, with no ID, so plugins never wait out their
+// deadline on the queue; the only back-pressure is ErrSendQueueFull.
+// With wait set, a queued message is waited for instead, its first part is
+// never joined onto others, and the connector's ID and error are returned.
+func (s *sender) send(c *config.Config, conn Connector, name string, kind Kind, args []interface{}, wait bool) (string, error) {
+	if kind != Message && kind != Action && kind != Reply || len(args) < 2 {
+		return conn.Send(kind, args...)
+	}
+	channel, ok := args[0].(string)
+	text, isText := args[1].(string)
+	if !ok || !isText {
+		return conn.Send(kind, args...)
+	}
+	target := Target(name, channel)
+	l := limitsFor(c, name, target)
+	_, lines := conn.(LineConnector)
+
+	parts := []*outgoing{}
+	chunks := split(text, l.maxLength, lines)
+	for i, chunk := range chunks {
+		// a reply refers to its message in every part, other extras go with the last part
+		partArgs := []interface{}{channel, chunk}
+		extra := args[2:]
+		if kind == Reply && len(extra) > 0 {
+			partArgs = append(partArgs, extra[0])
+			extra = extra[1:]
+		}
+		if i == len(chunks)-1 {
+			partArgs = append(partArgs, extra...)
+		}
+		parts = append(parts, &outgoing{kind: kind, args: partArgs, queued: time.Now()})
+	}
+
+	s.Lock()
+	if s.queues == nil {
+		s.queues = map[string]*channelQueue{}
+		s.connectors = map[string]*bucket{}
+	}
+	q, ok := s.queues[target]
+	if !ok {
+		q = &channelQueue{}
+		s.queues[target] = q
+	}
+	if len(q.pending) > 0 && len(q.pending)+len(parts) > l.queueSize {
+		s.Unlock()
+		sendsRefused.Inc(name)
+		return "", ErrSendQueueFull
+	}
+	if q.running || s.wait(name, q, l) > 0 {
+		if wait {
+			parts[0].done = make(chan sent, 1)
+		}
+		q.pending = append(q.pending, parts...)
+		if !q.running {
+			q.running = true
+			go s.run(c, conn, name, target, q)
+		}
+		s.Unlock()
+		if wait {
+			r := <-parts[0].done
+			return r.id, r.err
+		}
+		return "", nil
+	}
+	// the queue stays marked running so later messages wait behind this one
+	q.running = true
+	q.pending = append(q.pending, parts[1:]...)
+	s.Unlock()
+
+	sendWait.Observe(0, name)
+	id, err := conn.Send(kind, parts[0].args...)
+	go s.run(c, conn, name, target, q)
+	return id, err
+}
+
+// wait refills a channel's and its connector's buckets and takes a token from each,
+// or says how long until both have one
+// The sender must be locked.
+func (s *sender) wait(name string, q *channelQueue, l limits) time.Duration {
+	cb, ok := s.connectors[name]
+	if !ok {
+		cb = &bucket{}
+		s.connectors[name] = cb
+	}
+	now := time.Now()
+	q.bucket.refill(now, l.rate, l.burst)
+	cb.refill(now, l.connectorRate, l.connectorBurst)
+	if wait := maxDuration(q.bucket.wait(l.rate), cb.wait(l.connectorRate)); wait > 0 {
+		return wait
+	}
+	q.bucket.tokens--
+	cb.tokens--
+	return 0
+}
+
+// run sends a channel's messages as the limits allow, until none are left
+func (s *sender) run(c *config.Config, conn Connector, name, target string, q *channelQueue) {
+	_, lines := conn.(LineConnector)
+	for {
+		l := limitsFor(c, name, target)
+		s.Lock()
+		if len(q.pending) == 0 {
+			q.running = false
+			s.Unlock()
+			return
+		}
+		if wait := s.wait(name, q, l); wait > 0 {
+			s.Unlock()
+			time.Sleep(wait)
+			continue
+		}
+		batch := 1
+		if !lines {
+			batch = coalesce(q.pending, l.maxLength)
+		}
+		out := q.pending[:batch]
+		q.pending = q.pending[batch:]
+		s.Unlock()
+
+		msg := out[0]
+		if batch > 1 {
+			texts := []string{}
+			for _, o := range out {
+				texts = append(texts, o.text())
+			}
+			msg = &outgoing{kind: Message, args: []interface{}{msg.args[0], strings.Join(texts, "\n")}}
+			sendsCoalesced.Add(float64(batch-1), name)
+		}
+		for _, o := range out {
+			sendWait.Since(o.queued, name)
+		}
+		id, err := conn.Send(msg.kind, msg.args...)
+		if msg.done != nil {
+			msg.done <- sent{id, err}
+		} else if err != nil {
+			sendErrors.Inc(name)
+			log.Error().Err(err).Str("connector", name).Msg("Could not send a queued message")
+		}
+	}
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// coalesce counts the plain messages at the front of a queue that fit in one message
+// Messages someone waits on for an ID are never joined, since they may be edited later.
+func coalesce(pending []*outgoing, max int) int {
+	n, length := 0, -1
+	for _, o := range pending {
+		if o.kind != Message || len(o.args) != 2 || o.done != nil {
+			break
+		}
+		length += len(o.text()) + 1
+		if n > 0 && length > max {
+			break
+		}
+		n++
+	}
+	if n == 0 {
+		return 1
+	}
+	return n
+}
+
+// split breaks text into parts no longer than max, at line breaks where it can,
+// or into every line for connectors that take one line per message
+func split(text string, max int, everyLine bool) []string {
+	if len(text) <= max && (!everyLine || !strings.Contains(text, "\n")) {
+		return []string{text}
+	}
+	parts := []string{}
+	cur := ""
+	flush := func() {
+		if strings.TrimSpace(cur) != "" {
+			parts = append(parts, cur)
+		}
+		cur = ""
+	}
+	for _, line := range strings.Split(text, "\n") {
+		for len(line) > max {
+			flush()
+			cut := cutAt(line, max)
+			parts = append(parts, line[:cut])
+			line = strings.TrimLeft(line[cut:], " ")
+		}
+		if everyLine || cur != "" && len(cur)+1+len(line) > max {
+			flush()
+		}
+		if cur == "" {
+			cur = line
+		} else {
+			cur += "\n" + line
+		}
+	}
+	flush()
+	if len(parts) == 0 {
+		return []string{text}
+	}
+	return parts
+}
+
+// cutAt finds where to break a line that's too long, at a space if there is one
+func cutAt(line string, max int) int {
+	if i := strings.LastIndex(line[:max], " "); i > 0 {
+		return i
+	}
+	cut := max
+	for cut > 0 && !utf8.RuneStart(line[cut]) {
+		cut--
+	}
+	return cut
+}
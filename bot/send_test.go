@@ -0,0 +1,184 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/velour/catbase/bot/msg"
+)
+
+// gated is a connector that holds each send until the test lets it through
+type gated struct {
+	sync.Mutex
+	recorder
+	started chan bool
+	gate    chan bool
+}
+
+func newGated() *gated {
+	return &gated{started: make(chan bool, 10), gate: make(chan bool)}
+}
+
+func (g *gated) Send(kind Kind, args ...interface{}) (string, error) {
+	g.started <- true
+	<-g.gate
+	g.Lock()
+	defer g.Unlock()
+	return g.recorder.Send(kind, args...)
+}
+
+// locked is a connector that keeps what it is sent, safe to read while the queue sends
+type locked struct {
+	sync.Mutex
+	sent []string
+	at   []time.Time
+}
+
+func (l *locked) RegisterEvent(Callback) {}
+func (l *locked) Send(kind Kind, args ...interface{}) (string, error) {
+	l.Lock()
+	defer l.Unlock()
+	l.sent = append(l.sent, args[1].(string))
+	l.at = append(l.at, time.Now())
+	return fmt.Sprintf("%d", len(l.sent)-1), nil
+}
+func (l *locked) GetEmojiList() map[string]string { return nil }
+func (l *locked) Serve() error                    { return nil }
+func (l *locked) Who(string) []string             { return nil }
+func (l *locked) Status() Status                  { return Status{State: Connected} }
+
+// waitFor waits until n messages have gone out and gives them with when they went
+func (l *locked) waitFor(t *testing.T, n int) ([]string, []time.Time) {
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(5 * time.Millisecond) {
+		l.Lock()
+		if len(l.sent) >= n {
+			defer l.Unlock()
+			return append([]string{}, l.sent...), append([]time.Time{}, l.at...)
+		}
+		l.Unlock()
+	}
+	t.Fatalf("only some of %d messages were sent", n)
+	return nil, nil
+}
+
+type lineLocked struct{ locked }
+
+func (l *lineLocked) OneLinePerMessage() {}
+
+func setSendLimits(t *testing.T, b *bot, kv ...string) {
+	for i := 0; i < len(kv); i += 2 {
+		b.config.Set(kv[i], kv[i+1])
+		key := kv[i]
+		t.Cleanup(func() { b.config.Unset(key) })
+	}
+}
+
+func TestSplit(t *testing.T) {
+	assert.Equal(t, []string{"short"}, split("short", 100, false))
+	assert.Equal(t, []string{"aaaa\nbbbb", "cccc"}, split("aaaa\nbbbb\ncccc", 10, false))
+	assert.Equal(t, []string{"one", "two"}, split("one\n\ntwo", 100, true))
+	assert.Equal(t, []string{"a long", "line of", "words"}, split("a long line of words", 8, false))
+	assert.Equal(t, []string{"ééé", "éé"}, split("ééééé", 7, false))
+}
+
+func TestSendSplitsLongMessages(t *testing.T) {
+	b := testBot(t)
+	setSendLimits(t, b, "send.maxLength", "100")
+	l := &locked{}
+	text := strings.Repeat("x", 60) + "\n" + strings.Repeat("y", 60)
+	_, err := b.Send(l, Message, "#c", text)
+	assert.Nil(t, err)
+	sent, _ := l.waitFor(t, 2)
+	assert.Equal(t, []string{strings.Repeat("x", 60), strings.Repeat("y", 60)}, sent)
+}
+
+func TestSendCoalescesBursts(t *testing.T) {
+	b := testBot(t)
+	g := newGated()
+	go b.Send(g, Message, "#c", "first")
+	<-g.started
+
+	for _, m := range []string{"two", "three", "four"} {
+		id, err := b.Send(g, Message, "#c", m)
+		assert.Equal(t, "", id, "queued messages have no ID yet")
+		assert.Nil(t, err)
+	}
+	g.gate <- true
+	<-g.started
+	g.gate <- true
+	for sent := 0; sent < 2; time.Sleep(5 * time.Millisecond) {
+		g.Lock()
+		sent = len(g.sent)
+		g.Unlock()
+	}
+	assert.Equal(t, []string{"first", "two\nthree\nfour"}, g.sent)
+}
+
+func TestSendQueueFull(t *testing.T) {
+	b := testBot(t)
+	setSendLimits(t, b, "send.queueSize", "2")
+	g := newGated()
+	go b.Send(g, Message, "#c", "first")
+	<-g.started
+
+	go b.Send(g, Message, "#c", "two")
+	go b.Send(g, Message, "#c", "three")
+	for waiting := 0; waiting < 2; {
+		time.Sleep(5 * time.Millisecond)
+		b.sends.Lock()
+		waiting = len(b.sends.queues["#c"].pending)
+		b.sends.Unlock()
+	}
+	_, err := b.Send(g, Message, "#c", "four")
+	assert.Equal(t, ErrSendQueueFull, err)
+	close(g.gate)
+}
+
+func TestSendWaitsForTheRate(t *testing.T) {
+	b := testBot(t)
+	setSendLimits(t, b, "send.rate", "20", "send.burst", "1")
+	l := &lineLocked{}
+	start := time.Now()
+	b.Send(l, Message, "#slow", "one")
+	b.Send(l, Message, "#slow", "two")
+	assert.True(t, time.Since(start) < 40*time.Millisecond, "Send must not wait for the queue")
+	sent, at := l.waitFor(t, 2)
+	assert.Equal(t, []string{"one", "two"}, sent)
+	assert.True(t, at[1].Sub(at[0]) >= 40*time.Millisecond)
+}
+
+func TestSendAndWaitGivesTheQueuedID(t *testing.T) {
+	b := testBot(t)
+	setSendLimits(t, b, "send.rate", "20", "send.burst", "1")
+	l := &locked{}
+	b.Send(l, Message, "#busy", "one")
+	id, _ := b.Send(l, Message, "#busy", "two")
+	assert.Equal(t, "", id)
+	id, err := b.SendAndWait(l, Message, "#busy", "three")
+	assert.Nil(t, err)
+	assert.Equal(t, "2", id)
+	sent, _ := l.waitFor(t, 3)
+	assert.Equal(t, []string{"one", "two", "three"}, sent, "a message waited on is never joined")
+}
+
+func TestLongRepliesDontTimeOutPlugins(t *testing.T) {
+	p := &panicker{}
+	b := testBot(t, p)
+	l := &lineLocked{}
+	lines := []string{}
+	for i := 0; i < 30; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	b.Register(p, Message, func(c Connector, _ Kind, m msg.Message, _ ...interface{}) bool {
+		b.Send(c, Message, "#irc", strings.Join(lines, "\n"))
+		return true
+	})
+	assert.True(t, b.runCallback(l, p, Message, testMessage()))
+	assert.Equal(t, 0, b.health.status("bot").Failures)
+	sent, _ := l.waitFor(t, 4)
+	assert.Equal(t, lines[:4], sent[:4])
+}
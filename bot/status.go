@@ -0,0 +1,154 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/velour/catbase/config"
+)
+
+func init() {
+	config.Declare(config.Key{Name: "bot.staleAfter", Type: config.Int, Default: "0", Min: 0, Max: 86400,
+		Description: "seconds without events before a connector counts as not ready, 0 to never"})
+}
+
+// State is how a connector's link to its chat service is doing
+type State string
+
+const (
+	Connecting   State = "connecting"
+	Connected    State = "connected"
+	Reconnecting State = "reconnecting"
+	Failed       State = "failed"
+)
+
+// Status reports the health of a connector
+type Status struct {
+	State State `json:"state"`
+	// Since is when the connector entered State
+	Since     time.Time `json:"since"`
+	LastEvent time.Time `json:"last_event"`
+	LastError string    `json:"last_error,omitempty"`
+	ErrorTime time.Time `json:"error_time,omitempty"`
+}
+
+// StatusTracker keeps the Status of a connector
+// Connectors embed it, which gives them the Status method, and update it as things happen.
+type StatusTracker struct {
+	mu     sync.Mutex
+	status Status
+}
+
+// Status reports the tracked status; a tracker that was never set is connecting
+func (t *StatusTracker) Status() Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.status
+	if s.State == "" {
+		s.State = Connecting
+	}
+	return s
+}
+
+// SetState records a change of state
+func (t *StatusTracker) SetState(s State) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.status.State != s {
+		t.status.State = s
+		t.status.Since = time.Now()
+	}
+}
+
+// Seen records that the service sent something
+func (t *StatusTracker) Seen() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status.LastEvent = time.Now()
+}
+
+// Error records the last thing that went wrong
+func (t *StatusTracker) Error(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status.LastError = config.Redact(err.Error())
+	t.status.ErrorTime = time.Now()
+}
+
+// Health is the state of the bot and each of its connectors
+type Health struct {
+	// Ready is true when the database answers and every connector is connected
+	Ready      bool              `json:"ready"`
+	Database   string            `json:"database"`
+	Connectors map[string]Status `json:"connectors"`
+	// Problems says what keeps the bot from being ready
+	Problems []string `json:"problems,omitempty"`
+}
+
+// newHealth works out whether the bot is ready
+// Connectors that have been quiet for longer than staleAfter aren't, unless staleAfter is 0.
+func newHealth(dbErr error, connectors map[string]Status, staleAfter time.Duration) Health {
+	h := Health{Database: "ok", Connectors: connectors, Problems: []string{}}
+	if dbErr != nil {
+		h.Database = config.Redact(dbErr.Error())
+		h.Problems = append(h.Problems, "the database is unreachable")
+	}
+	names := []string{}
+	for name := range connectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s := connectors[name]
+		if s.State != Connected {
+			h.Problems = append(h.Problems, fmt.Sprintf("%s is %s", name, s.State))
+			continue
+		}
+		last := s.LastEvent
+		if s.Since.After(last) {
+			last = s.Since
+		}
+		if staleAfter > 0 && time.Since(last) > staleAfter {
+			h.Problems = append(h.Problems, fmt.Sprintf("%s has been quiet since %s", name, last.Format(time.RFC3339)))
+		}
+	}
+	h.Ready = len(h.Problems) == 0
+	return h
+}
+
+// Health checks the database and collects the status of every connector
+func (b *bot) Health() Health {
+	statuses := map[string]Status{}
+	for name, conn := range b.connectors {
+		statuses[name] = conn.Status()
+	}
+	stale := time.Duration(b.config.GetInt("bot.staleAfter", 0)) * time.Second
+	return newHealth(b.DB().Ping(), statuses, stale)
+}
+
+func writeHealth(w http.ResponseWriter, h Health, ok bool) {
+	w.Header().Set("Content-Type", "application/json")
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	j, _ := json.Marshal(h)
+	w.Write(j)
+}
+
+// serveHealthz answers whether the bot is alive, which only needs the database
+func (b *bot) serveHealthz(w http.ResponseWriter, r *http.Request) {
+	h := b.Health()
+	writeHealth(w, h, h.Database == "ok")
+}
+
+// serveReadyz answers whether the bot is alive and talking to every chat service
+func (b *bot) serveReadyz(w http.ResponseWriter, r *http.Request) {
+	h := b.Health()
+	writeHealth(w, h, h.Ready)
+}
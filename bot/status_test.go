@@ -0,0 +1,52 @@
+package bot
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusTracker(t *testing.T) {
+	var s StatusTracker
+	assert.Equal(t, Connecting, s.Status().State)
+	s.SetState(Connected)
+	s.Seen()
+	s.Error(errors.New("lost the server"))
+	st := s.Status()
+	assert.Equal(t, Connected, st.State)
+	assert.False(t, st.LastEvent.IsZero())
+	assert.Equal(t, "lost the server", st.LastError)
+}
+
+func TestHealthReady(t *testing.T) {
+	h := newHealth(nil, map[string]Status{
+		"irc": {State: Connected, Since: time.Now()},
+	}, time.Minute)
+	assert.True(t, h.Ready)
+	assert.Empty(t, h.Problems)
+}
+
+func TestHealthProblems(t *testing.T) {
+	h := newHealth(errors.New("gone"), map[string]Status{
+		"irc":   {State: Reconnecting},
+		"slack": {State: Connected, Since: time.Now().Add(-time.Hour)},
+	}, time.Minute)
+	assert.False(t, h.Ready)
+	assert.Equal(t, "gone", h.Database)
+	assert.Len(t, h.Problems, 3)
+	assert.Contains(t, h.Problems[1], "irc is reconnecting")
+	assert.Contains(t, h.Problems[2], "slack has been quiet")
+}
+
+func TestReadyz(t *testing.T) {
+	b := testBot(t)
+	b.connectors = map[string]Connector{}
+	w := httptest.NewRecorder()
+	b.serveReadyz(w, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"ready":true`)
+}
@@ -13,6 +13,24 @@ func (b *bot) serveRoot(w http.ResponseWriter, r *http.Request) {
 	t.Execute(w, context)
 }
 
+// serveHelp is the command reference generated from the plugins' declarations
+func (b *bot) serveHelp(w http.ResponseWriter, r *http.Request) {
+	context := make(map[string]interface{})
+	context["Nav"] = b.GetWebNavigation()
+	context["Topics"] = b.commands.topics(b)
+	t := template.Must(template.New("helpIndex").Parse(helpIndex))
+	t.Execute(w, context)
+}
+
+// serveSchedule lists the jobs waiting to run
+func (b *bot) serveSchedule(w http.ResponseWriter, r *http.Request) {
+	context := make(map[string]interface{})
+	context["Nav"] = b.GetWebNavigation()
+	context["Jobs"] = b.sched.Upcoming()
+	t := template.Must(template.New("scheduleIndex").Parse(scheduleIndex))
+	t.Execute(w, context)
+}
+
 // GetWebNavigation returns a list of bootstrap-vue <b-nav-item> links
 // The parent <nav> is not included so each page may display it as
 // best fits
@@ -71,3 +89,119 @@ var rootIndex = `
 </body>
 </html>
 `
+
+var helpIndex = `
+<!DOCTYPE html>
+<html lang="en">
+<head>
+    <!-- Load required Bootstrap and BootstrapVue CSS -->
+    <link type="text/css" rel="stylesheet" href="//unpkg.com/bootstrap/dist/css/bootstrap.min.css" />
+    <link type="text/css" rel="stylesheet" href="//unpkg.com/bootstrap-vue@latest/dist/bootstrap-vue.min.css" />
+
+    <!-- Load polyfills to support older browsers -->
+    <script src="//polyfill.io/v3/polyfill.min.js?features=es2015%2CMutationObserver"></script>
+
+    <!-- Load Vue followed by BootstrapVue -->
+    <script src="//unpkg.com/vue@latest/dist/vue.min.js"></script>
+    <script src="//unpkg.com/bootstrap-vue@latest/dist/bootstrap-vue.min.js"></script>
+    <meta charset="UTF-8">
+    <title>Help</title>
+</head>
+<body>
+
+<div id="app">
+	<b-navbar>
+		<b-navbar-brand>Help</b-navbar-brand>
+		<b-navbar-nav>
+			<b-nav-item v-for="item in nav" :href="item.URL" :active="item.Name === 'Help'">{{ "{{ item.Name }}" }}</b-nav-item>
+		</b-navbar-nav>
+	</b-navbar>
+	<b-container>
+		<b-form-input placeholder="Filter commands" v-model="filter" class="my-3"></b-form-input>
+		<div v-for="topic in filtered" :key="topic.Plugin">
+			<h3>{{ "{{ topic.Plugin }}" }}</h3>
+			<b-table :items="topic.Commands" :fields="fields" small>
+				<template v-slot:cell(Syntax)="data"><code>{{ "{{ data.value }}" }}</code></template>
+				<template v-slot:cell(Examples)="data">
+					<div v-for="e in data.value"><code>{{ "{{ e }}" }}</code></div>
+				</template>
+			</b-table>
+		</div>
+	</b-container>
+</div>
+
+<script>
+    var app = new Vue({
+        el: '#app',
+        data: {
+            nav: {{ .Nav }},
+            topics: {{ .Topics }},
+            filter: '',
+            fields: ['Syntax', 'Usage', 'Examples', 'Role'],
+        },
+        computed: {
+            filtered: function() {
+                var f = this.filter.toLowerCase();
+                if (f === '') {
+                    return this.topics;
+                }
+                return this.topics.filter(function(t) {
+                    return t.Plugin.indexOf(f) >= 0 || t.Commands.some(function(c) {
+                        return c.Syntax.toLowerCase().indexOf(f) >= 0 || c.Usage.toLowerCase().indexOf(f) >= 0;
+                    });
+                });
+            },
+        },
+    })
+</script>
+</body>
+</html>
+`
+
+var scheduleIndex = `
+<!DOCTYPE html>
+<html lang="en">
+<head>
+    <!-- Load required Bootstrap and BootstrapVue CSS -->
+    <link type="text/css" rel="stylesheet" href="//unpkg.com/bootstrap/dist/css/bootstrap.min.css" />
+    <link type="text/css" rel="stylesheet" href="//unpkg.com/bootstrap-vue@latest/dist/bootstrap-vue.min.css" />
+
+    <!-- Load polyfills to support older browsers -->
+    <script src="//polyfill.io/v3/polyfill.min.js?features=es2015%2CMutationObserver"></script>
+
+    <!-- Load Vue followed by BootstrapVue -->
+    <script src="//unpkg.com/vue@latest/dist/vue.min.js"></script>
+    <script src="//unpkg.com/bootstrap-vue@latest/dist/bootstrap-vue.min.js"></script>
+    <meta charset="UTF-8">
+    <title>Schedule</title>
+</head>
+<body>
+
+<div id="app">
+	<b-navbar>
+		<b-navbar-brand>Schedule</b-navbar-brand>
+		<b-navbar-nav>
+			<b-nav-item v-for="item in nav" :href="item.URL" :active="item.Name === 'Schedule'">{{ "{{ item.Name }}" }}</b-nav-item>
+		</b-navbar-nav>
+	</b-navbar>
+	<b-container>
+		<p v-if="jobs.length === 0">Nothing is scheduled.</p>
+		<b-table v-else :items="jobs" :fields="fields" small>
+			<template v-slot:cell(Next)="data">{{ "{{ new Date(data.value).toLocaleString() }}" }}</template>
+		</b-table>
+	</b-container>
+</div>
+
+<script>
+    var app = new Vue({
+        el: '#app',
+        data: {
+            nav: {{ .Nav }},
+            jobs: {{ .Jobs }},
+            fields: ['Name', 'Handler', 'Kind', 'Spec', 'Payload', 'Next'],
+        },
+    })
+</script>
+</body>
+</html>
+`
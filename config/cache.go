@@ -0,0 +1,131 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+package config
+
+import (
+	"strings"
+	"sync"
+)
+
+// Change describes a config value that was set or removed
+type Change struct {
+	Key string
+	// Scope is empty for global values
+	Scope string
+	Value string
+	// Unset is true when the value was removed
+	Unset bool
+}
+
+// Subscriber is told about changes to a key it subscribed to
+// Subscribers run on the goroutine that made the change, so they should be quick.
+type Subscriber func(Change)
+
+type cached struct {
+	value string
+	found bool
+}
+
+type subscription struct {
+	id int
+	fn Subscriber
+}
+
+// cache keeps database values in memory; it is updated by every write made through Config
+type cache struct {
+	sync.RWMutex
+	values map[string]cached
+	// gen counts writes, so a lookup that read the database before a Set doesn't cache the old value
+	gen uint64
+
+	subLock sync.Mutex
+	nextID  int
+	subs    map[string][]subscription
+}
+
+func newCache() *cache {
+	return &cache{
+		values: make(map[string]cached),
+		subs:   make(map[string][]subscription),
+	}
+}
+
+func (c *cache) get(key string) (cached, bool) {
+	c.RLock()
+	defer c.RUnlock()
+	v, ok := c.values[key]
+	return v, ok
+}
+
+// generation is the number of writes so far, to hand to fill
+func (c *cache) generation() uint64 {
+	c.RLock()
+	defer c.RUnlock()
+	return c.gen
+}
+
+// put stores a value that was just written
+func (c *cache) put(key string, v cached) {
+	c.Lock()
+	defer c.Unlock()
+	c.gen++
+	c.values[key] = v
+}
+
+// fill stores a value read from the database, unless something was written since generation gen
+func (c *cache) fill(key string, v cached, gen uint64) {
+	c.Lock()
+	defer c.Unlock()
+	if c.gen == gen {
+		c.values[key] = v
+	}
+}
+
+func (c *cache) clear() {
+	c.Lock()
+	defer c.Unlock()
+	c.gen++
+	c.values = make(map[string]cached)
+}
+
+// Subscribe calls fn whenever a key is set or unset, globally or in any scope
+// The returned function cancels the subscription.
+func (c *Config) Subscribe(key string, fn Subscriber) func() {
+	key = strings.ToLower(key)
+	c.cache.subLock.Lock()
+	defer c.cache.subLock.Unlock()
+	c.cache.nextID++
+	id := c.cache.nextID
+	c.cache.subs[key] = append(c.cache.subs[key], subscription{id, fn})
+	return func() {
+		c.cache.subLock.Lock()
+		defer c.cache.subLock.Unlock()
+		subs := c.cache.subs[key]
+		for i, s := range subs {
+			if s.id == id {
+				c.cache.subs[key] = append(subs[:i:i], subs[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// notify tells subscribers that a stored key changed
+func (c *Config) notify(stored, value string, unset bool) {
+	ch := Change{Key: stored, Value: value, Unset: unset}
+	if i := strings.Index(stored, "@"); i >= 0 {
+		ch.Key, ch.Scope = stored[:i], stored[i+1:]
+	}
+	c.cache.subLock.Lock()
+	subs := append([]subscription{}, c.cache.subs[ch.Key]...)
+	c.cache.subLock.Unlock()
+	for _, s := range subs {
+		s.fn(ch)
+	}
+}
+
+// Refresh forgets every cached value
+// Call it after changing the config table without going through Set.
+func (c *Config) Refresh() {
+	c.cache.clear()
+}
@@ -6,12 +6,11 @@ import (
 	"database/sql"
 	"fmt"
 	"os"
-	"regexp"
 	"strconv"
 	"strings"
 
 	"github.com/jmoiron/sqlx"
-	"github.com/mattn/go-sqlite3"
+	"github.com/jmoiron/sqlx/reflectx"
 	"github.com/rs/zerolog/log"
 )
 
@@ -21,30 +20,45 @@ type Config struct {
 	*sqlx.DB
 
 	DBFile string
+
+	cache   *cache
+	secrets *secretBox
 }
 
 // GetFloat64 returns the config value for a string key
 // It will first look in the env vars for the key
 // It will check the DB for the key if an env DNE
-// Finally, it will return a zero value if the key does not exist
-// It will attempt to convert the value to a float64 if it exists
+// Finally, it will return the fallback if the key does not exist
+// It will attempt to convert the value to a float64 if it exists,
+// returning the fallback if it can't
 func (c *Config) GetFloat64(key string, fallback float64) float64 {
-	f, err := strconv.ParseFloat(c.GetString(key, fmt.Sprintf("%f", fallback)), 64)
-	if err != nil {
-		return 0.0
-	}
-	return f
+	return parseFloat(key, c.GetString(key, fmt.Sprintf("%f", fallback)), fallback)
 }
 
 // GetInt returns the config value for a string key
 // It will first look in the env vars for the key
 // It will check the DB for the key if an env DNE
-// Finally, it will return a zero value if the key does not exist
-// It will attempt to convert the value to an int if it exists
+// Finally, it will return the fallback if the key does not exist
+// It will attempt to convert the value to an int if it exists,
+// returning the fallback if it can't
 func (c *Config) GetInt(key string, fallback int) int {
-	i, err := strconv.Atoi(c.GetString(key, strconv.Itoa(fallback)))
+	return parseInt(key, c.GetString(key, strconv.Itoa(fallback)), fallback)
+}
+
+func parseFloat(key, value string, fallback float64) float64 {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Error().Err(err).Msgf("%s is not a number, using %v", key, fallback)
+		return fallback
+	}
+	return f
+}
+
+func parseInt(key, value string, fallback int) int {
+	i, err := strconv.Atoi(value)
 	if err != nil {
-		return 0
+		log.Error().Err(err).Msgf("%s is not a whole number, using %d", key, fallback)
+		return fallback
 	}
 	return i
 }
@@ -62,22 +76,51 @@ func envkey(key string) string {
 
 // GetString returns the config value for a string key
 // It will first look in the env vars for the key
-// It will check the DB for the key if an env DNE
+// It will check the cache and then the DB for the key if an env DNE
 // Finally, it will return a zero value if the key does not exist
 // It will convert the value to a string if it exists
 func (c *Config) GetString(key, fallback string) string {
 	key = strings.ToLower(key)
 	if v, found := os.LookupEnv(envkey(key)); found {
+		if IsSecret(key) {
+			reveal(v)
+		}
 		return v
 	}
+	v, found := c.lookup(key)
+	if !found {
+		log.Debug().Msgf("WARN: Key %s is empty", key)
+		return fallback
+	}
+	return v
+}
+
+// lookup finds a stored key, remembering the answer until the key is next set
+func (c *Config) lookup(key string) (string, bool) {
+	if v, ok := c.cache.get(key); ok {
+		return v.value, v.found
+	}
+	gen := c.cache.generation()
 	var configValue string
 	q := `select value from config where key=?`
 	err := c.DB.Get(&configValue, q, key)
-	if err != nil {
-		log.Debug().Msgf("WARN: Key %s is empty", key)
-		return fallback
+	switch {
+	case err == sql.ErrNoRows:
+		c.cache.fill(key, cached{}, gen)
+		return "", false
+	case err != nil:
+		log.Error().Err(err).Msgf("Could not look up %s", key)
+		return "", false
 	}
-	return configValue
+	if IsSecret(key) {
+		if configValue, err = c.secrets.decrypt(configValue); err != nil {
+			log.Error().Err(err).Msgf("Could not read secret %s", key)
+			return "", false
+		}
+		reveal(configValue)
+	}
+	c.cache.fill(key, cached{configValue, true}, gen)
+	return configValue, true
 }
 
 // GetArray returns the string slice config value for a string key
@@ -96,15 +139,29 @@ func (c *Config) GetArray(key string, fallback []string) []string {
 
 // Set changes the value for a configuration in the database
 // Note, this is always a string. Use the SetArray for an array helper
+// Values for declared keys are checked against their declaration first.
+// Secret values are encrypted before they are stored.
 func (c *Config) Set(key, value string) error {
 	key = strings.ToLower(key)
+	if err := c.Validate(key, value); err != nil {
+		return err
+	}
+	stored := value
+	if IsSecret(key) {
+		reveal(value)
+		var err error
+		if stored, err = c.secrets.encrypt(value); err != nil {
+			return fmt.Errorf("could not encrypt %s: %w", key, err)
+		}
+	}
 	q := `insert into config (key,value) values (?, ?)
 			on conflict(key) do update set value=?;`
 	tx, err := c.Begin()
 	if err != nil {
 		return err
 	}
-	_, err = tx.Exec(q, key, value, value)
+	defer tx.Rollback()
+	_, err = tx.Exec(q, key, stored, stored)
 	if err != nil {
 		return err
 	}
@@ -112,6 +169,19 @@ func (c *Config) Set(key, value string) error {
 	if err != nil {
 		return err
 	}
+	c.cache.put(key, cached{value, true})
+	c.notify(key, value, false)
+	return nil
+}
+
+// Unset removes a value from the database so its fallback applies again
+func (c *Config) Unset(key string) error {
+	key = strings.ToLower(key)
+	if _, err := c.Exec(`delete from config where key=?`, key); err != nil {
+		return err
+	}
+	c.cache.put(key, cached{})
+	c.notify(key, "", true)
 	return nil
 }
 
@@ -120,41 +190,45 @@ func (c *Config) SetArray(key string, values []string) error {
 	return c.Set(key, vals)
 }
 
-func init() {
-	regex := func(re, s string) (bool, error) {
-		return regexp.MatchString(re, s)
-	}
-	sql.Register("sqlite3_custom",
-		&sqlite3.SQLiteDriver{
-			ConnectHook: func(conn *sqlite3.SQLiteConn) error {
-				return conn.RegisterFunc("REGEXP", regex, true)
-			},
-		})
-}
-
 // Readconfig loads the config data out of a JSON file located in cfile
 func ReadConfig(dbpath string) *Config {
 	if dbpath == "" {
 		dbpath = "catbase.db"
 	}
-	log.Info().Msgf("Using %s as database file.\n", dbpath)
 
-	sqlDB, err := sqlx.Open("sqlite3_custom", dbpath)
+	var sqlDB *sqlx.DB
+	var err error
+	if IsPostgres(dbpath) {
+		log.Info().Msgf("Using Postgres database.")
+		sqlDB, err = sqlx.Open(postgresDriver, dbpath)
+		// Postgres folds column names to lower case, so struct tags have to match them that way
+		if err == nil {
+			sqlDB.Mapper = reflectx.NewMapperTagFunc("db", strings.ToLower, strings.ToLower)
+		}
+	} else {
+		log.Info().Msgf("Using %s as database file.\n", dbpath)
+		sqlDB, err = sqlx.Open(sqliteDriver, dbpath)
+	}
 	if err != nil {
-		log.Fatal().Err(err)
+		log.Fatal().Err(err).Msg("Could not open the database")
 	}
 	c := Config{
-		DBFile: dbpath,
+		DBFile:  dbpath,
+		cache:   newCache(),
+		secrets: newSecretBox(),
 	}
 	c.DB = sqlDB
 
-	if _, err := c.Exec(`create table if not exists config (
+	if _, err := c.Exec(c.Dialect().Schema(`create table if not exists config (
 		key string,
 		value string,
 		primary key (key)
-	);`); err != nil {
+	);`)); err != nil {
 		panic(err)
 	}
+	if err := c.EncryptSecrets(); err != nil {
+		log.Error().Err(err).Msg("Could not encrypt secret config values")
+	}
 
 	log.Info().Msgf("catbase is running.")
 
@@ -1,6 +1,9 @@
 package config
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -21,3 +24,189 @@ func TestSetGetArray(t *testing.T) {
 	actual := cfg.GetArray("test", []string{"NOPE"})
 	assert.Equal(t, expected, actual, "Config did not store values")
 }
+
+func TestScopeOverridesGlobal(t *testing.T) {
+	cfg := ReadConfig(":memory:")
+	cfg.Set("chance", "0.5")
+	social := cfg.Scope("slack:#Social")
+	work := cfg.Scope("slack:#work")
+	assert.Nil(t, social.Set("chance", "0.9"))
+	assert.Equal(t, 0.9, social.GetFloat64("chance", 0))
+	assert.Equal(t, 0.5, work.GetFloat64("chance", 0))
+	assert.Equal(t, "0.5", cfg.Get("chance", ""), "Scoped value leaked into the global one")
+
+	assert.Nil(t, social.Unset("chance"))
+	assert.Equal(t, 0.5, social.GetFloat64("chance", 0))
+}
+
+func TestScopeBool(t *testing.T) {
+	cfg := ReadConfig(":memory:")
+	s := cfg.Scope("irc:#a")
+	assert.True(t, s.GetBool("on", true))
+	s.Set("on", "off")
+	assert.False(t, s.GetBool("on", true))
+	s.Set("on", "garbage")
+	assert.True(t, s.GetBool("on", true))
+}
+
+func TestOverrides(t *testing.T) {
+	cfg := ReadConfig(":memory:")
+	cfg.Scope("irc:#a").Set("plugin.reaction.enabled", "false")
+	cfg.Scope("irc:#b").Set("plugin.reaction.enabled", "true")
+	cfg.Scope("irc:#b").Set("plugin.reactions.enabled", "true")
+	o, err := cfg.Overrides("plugin.reaction.enabled")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"irc:#a": "false", "irc:#b": "true"}, o)
+}
+
+func TestGetIsCached(t *testing.T) {
+	cfg := ReadConfig(":memory:")
+	cfg.Set("test", "value")
+	cfg.MustExec(`update config set value='changed' where key='test'`)
+	assert.Equal(t, "value", cfg.Get("test", "NOPE"))
+	cfg.Refresh()
+	assert.Equal(t, "changed", cfg.Get("test", "NOPE"))
+}
+
+func TestMissingKeyIsCached(t *testing.T) {
+	cfg := ReadConfig(":memory:")
+	assert.Equal(t, "NOPE", cfg.Get("test", "NOPE"))
+	cfg.Set("test", "value")
+	assert.Equal(t, "value", cfg.Get("test", "NOPE"))
+	cfg.Unset("test")
+	assert.Equal(t, "NOPE", cfg.Get("test", "NOPE"))
+}
+
+func TestLookupRacingSetIsNotCached(t *testing.T) {
+	cfg := ReadConfig(":memory:")
+	// a lookup reads nothing, then a Set lands before it can cache that
+	gen := cfg.cache.generation()
+	cfg.Set("test", "value")
+	cfg.cache.fill("test", cached{}, gen)
+	assert.Equal(t, "value", cfg.Get("test", "NOPE"))
+}
+
+func TestSubscribe(t *testing.T) {
+	cfg := ReadConfig(":memory:")
+	changes := []Change{}
+	cancel := cfg.Subscribe("Twitch.Freq", func(c Change) { changes = append(changes, c) })
+	cfg.Set("twitch.freq", "30")
+	cfg.Scope("irc:#a").Set("Twitch.Freq", "10")
+	cfg.Scope("irc:#a").Unset("twitch.freq")
+	cfg.Set("twitch.other", "1")
+	cancel()
+	cfg.Set("twitch.freq", "60")
+	assert.Equal(t, []Change{
+		{Key: "twitch.freq", Value: "30"},
+		{Key: "twitch.freq", Scope: "irc:#a", Value: "10"},
+		{Key: "twitch.freq", Scope: "irc:#a", Unset: true},
+	}, changes)
+}
+
+func TestSetValidates(t *testing.T) {
+	cfg := ReadConfig(":memory:")
+	cfg.Declare(Key{Name: "Test.Chance", Type: Float, Min: 0, Max: 1})
+	assert.Nil(t, cfg.Set("test.chance", "0.5"))
+	assert.NotNil(t, cfg.Set("test.chance", "lots"))
+	assert.NotNil(t, cfg.Set("test.chance", "2"))
+	assert.NotNil(t, cfg.Scope("irc:#a").Set("test.chance", "-1"))
+	assert.Equal(t, 0.5, cfg.GetFloat64("test.chance", 0))
+}
+
+func TestBadValueUsesFallback(t *testing.T) {
+	cfg := ReadConfig(":memory:")
+	cfg.Set("test.int", "many")
+	assert.Equal(t, 30, cfg.GetInt("test.int", 30))
+	assert.Equal(t, 0.99, cfg.GetFloat64("test.int", 0.99))
+}
+
+func TestKeyValidate(t *testing.T) {
+	assert.Nil(t, Key{Name: "a", Type: Int}.Validate("3"))
+	assert.NotNil(t, Key{Name: "a", Type: Int}.Validate("3.5"))
+	assert.Nil(t, Key{Name: "a", Type: Bool}.Validate("on"))
+	assert.NotNil(t, Key{Name: "a", Type: Bool}.Validate("maybe"))
+	assert.Nil(t, Key{Name: "a", Choices: []string{"irc", "slack"}}.Validate("IRC"))
+	assert.NotNil(t, Key{Name: "a", Choices: []string{"irc", "slack"}}.Validate("aim"))
+}
+
+func TestSettings(t *testing.T) {
+	cfg := ReadConfig(":memory:")
+	cfg.Declare(
+		Key{Name: "Test.Default", Default: "d"},
+		Key{Name: "Test.DB", Default: "d"},
+		Key{Name: "Test.Env", Default: "d"},
+	)
+	cfg.Set("test.db", "db")
+	os.Setenv("TESTENV", "env")
+	defer os.Unsetenv("TESTENV")
+	found := map[string]Setting{}
+	for _, s := range cfg.Settings() {
+		found[s.Name] = s
+	}
+	assert.Equal(t, Setting{Key{Name: "Test.Default", Type: String, Default: "d"}, "d", FromDefault}, found["Test.Default"])
+	assert.Equal(t, FromDB, found["Test.DB"].Source)
+	assert.Equal(t, "db", found["Test.DB"].Value)
+	assert.Equal(t, FromEnv, found["Test.Env"].Source)
+	assert.Equal(t, "env", found["Test.Env"].Value)
+}
+
+func TestRebind(t *testing.T) {
+	assert.Equal(t, `select a from b where c=$1 and d='?' and e=$2`,
+		rebind(`select a from b where c=? and d='?' and e=?`))
+	assert.Equal(t, `select 'it''s?' from t where x=$1`, rebind(`select 'it''s?' from t where x=?`))
+}
+
+func TestSchema(t *testing.T) {
+	q := `create table t (id integer PRIMARY KEY AUTOINCREMENT, name string, n interger);`
+	assert.Equal(t, q, SQLite.Schema(q))
+	assert.Equal(t, `create table t (id bigserial primary key, name text, n bigint);`, Postgres.Schema(q))
+	q = `create table u (user string primary key, users int)`
+	assert.Equal(t, `create table u ("user" text primary key, users bigint)`, Postgres.Schema(q))
+}
+
+func TestDialect(t *testing.T) {
+	cfg := ReadConfig(":memory:")
+	assert.Equal(t, SQLite, cfg.Dialect())
+	assert.True(t, TableExists(cfg.DB, "config"))
+	assert.False(t, TableExists(cfg.DB, "nope"))
+	cols, err := Columns(cfg.DB, "config")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"key", "value"}, cols)
+	assert.True(t, IsPostgres("postgres://localhost/catbase"))
+	assert.False(t, IsPostgres("catbase.db"))
+}
+
+func TestSecretsAreEncrypted(t *testing.T) {
+	cfg := ReadConfig(":memory:")
+	cfg.SetSecretKey("test key")
+	cfg.Declare(Key{Name: "Test.Token", Secret: true})
+	assert.Nil(t, cfg.Set("test.token", "hunter22"))
+
+	var stored string
+	assert.Nil(t, cfg.DB.Get(&stored, `select value from config where key='test.token'`))
+	assert.True(t, strings.HasPrefix(stored, secretPrefix))
+	assert.NotContains(t, stored, "hunter22")
+
+	cfg.Refresh()
+	assert.Equal(t, "hunter22", cfg.Get("test.token", ""))
+	assert.Equal(t, "token is [redacted]", Redact("token is hunter22"))
+
+	cfg.SetSecretKey("wrong key")
+	cfg.Refresh()
+	assert.Equal(t, "none", cfg.Get("test.token", "none"))
+}
+
+func TestEncryptSecrets(t *testing.T) {
+	t.Setenv(SecretKeyFileEnv, filepath.Join(t.TempDir(), "catbase.key"))
+	cfg := ReadConfig(":memory:")
+	cfg.Declare(Key{Name: "Test.Old", Secret: true})
+	cfg.MustExec(`insert into config (key, value) values ('test.old', 'plaintext')`)
+	assert.Nil(t, cfg.EncryptSecrets())
+
+	var stored string
+	cfg.DB.Get(&stored, `select value from config where key='test.old'`)
+	assert.True(t, strings.HasPrefix(stored, secretPrefix))
+	_, err := os.Stat(os.Getenv(SecretKeyFileEnv))
+	assert.Nil(t, err, "A key file should have been made")
+	assert.Equal(t, "plaintext", cfg.Get("test.old", ""))
+}
@@ -13,7 +13,7 @@ INSERT INTO config VALUES('nick','{{.Nick}}');
 INSERT INTO config VALUES('channels','{{.Channel}}');
 INSERT INTO config VALUES('untappd.channels','{{.Channel}}');
 INSERT INTO config VALUES('twitch.channels','{{.Channel}}');
-INSERT INTO config VALUES('init',1);
+INSERT INTO config VALUES('init','1');
 `
 
 func (c *Config) SetDefaults(mainChannel, nick string) {
@@ -34,5 +34,6 @@ func (c *Config) SetDefaults(mainChannel, nick string) {
 	t.Execute(&buf, vals)
 	c.MustExec(`delete from config;`)
 	c.MustExec(buf.String())
+	c.Refresh()
 	log.Info().Msgf("Configuration initialized.")
 }
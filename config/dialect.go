@@ -0,0 +1,136 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+package config
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Dialect is the flavor of SQL a database speaks
+// Plugins write SQLite-style SQL with ? placeholders. The few things that can't
+// be written for both engines go through the helpers here.
+type Dialect string
+
+const (
+	SQLite   Dialect = "sqlite"
+	Postgres Dialect = "postgres"
+)
+
+const (
+	sqliteDriver   = "sqlite3_custom"
+	postgresDriver = "catbase_postgres"
+)
+
+// IsPostgres checks whether a -db value is a Postgres URL rather than a SQLite file
+func IsPostgres(dbpath string) bool {
+	return strings.HasPrefix(dbpath, "postgres://") || strings.HasPrefix(dbpath, "postgresql://")
+}
+
+type driverNamer interface {
+	DriverName() string
+}
+
+// DialectOf tells which dialect a database or transaction speaks
+func DialectOf(db driverNamer) Dialect {
+	if db.DriverName() == postgresDriver {
+		return Postgres
+	}
+	return SQLite
+}
+
+// Dialect tells which dialect the config database speaks
+func (c *Config) Dialect() Dialect {
+	return DialectOf(c.DB)
+}
+
+var (
+	serialKey  = regexp.MustCompile(`(?i)\binteger\s+primary\s+key(\s+autoincrement)?`)
+	stringType = regexp.MustCompile(`(?i)\bstring\b`)
+	intType    = regexp.MustCompile(`(?i)\b(integer|interger|int)\b`)
+	userColumn = regexp.MustCompile(`([(,]\s*)user(\s)`)
+)
+
+// Schema rewrites create statements written for SQLite
+// On Postgres string columns become text, integers become bigint and integer
+// primary keys become a bigserial, which SQLite fills in by itself. Columns named
+// user are quoted, since Postgres reserves the word.
+func (d Dialect) Schema(q string) string {
+	if d != Postgres {
+		return q
+	}
+	q = userColumn.ReplaceAllString(q, `$1"user"$2`)
+	q = serialKey.ReplaceAllString(q, "bigserial primary key")
+	q = stringType.ReplaceAllString(q, "text")
+	return intType.ReplaceAllString(q, "bigint")
+}
+
+// TableExists checks for a table by name
+func TableExists(db sqlx.Ext, table string) bool {
+	q := `select count(*) from sqlite_master where type='table' and name=?`
+	if DialectOf(db) == Postgres {
+		q = `select count(*) from information_schema.tables
+			where table_schema = current_schema() and table_name = lower(?)`
+	}
+	var n int
+	err := sqlx.Get(db, &n, q, table)
+	return err == nil && n > 0
+}
+
+// Columns lists the columns of a table
+// Postgres folds unquoted names to lower case, so compare names without case.
+func Columns(db sqlx.Ext, table string) ([]string, error) {
+	q := `select name from pragma_table_info(?)`
+	if DialectOf(db) == Postgres {
+		q = `select column_name from information_schema.columns
+			where table_schema = current_schema() and table_name = lower(?)
+			order by ordinal_position`
+	}
+	var cols []string
+	err := sqlx.Select(db, &cols, q, table)
+	return cols, err
+}
+
+// Insert runs an insert into a table with an id column and returns the new id
+func Insert(db sqlx.Ext, query string, args ...interface{}) (int64, error) {
+	if DialectOf(db) == Postgres {
+		var id int64
+		query = strings.TrimRight(strings.TrimSpace(query), ";") + " returning id"
+		err := db.QueryRowx(query, args...).Scan(&id)
+		return id, err
+	}
+	res, err := db.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// rebind turns ? placeholders into Postgres' $1, $2... leaving quoted text alone
+func rebind(q string) string {
+	if !strings.Contains(q, "?") {
+		return q
+	}
+	var b strings.Builder
+	var quote rune
+	n := 0
+	for _, r := range q {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '?':
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,158 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+package config
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"regexp"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+	"github.com/velour/catbase/bot/metrics"
+)
+
+var queryTime = metrics.NewHistogram("catbase_db_query_seconds",
+	"Time taken by database queries and statements", nil, "op")
+
+func init() {
+	regex := func(re, s string) (bool, error) {
+		return regexp.MatchString(re, s)
+	}
+	sql.Register(sqliteDriver, wrapped{
+		Driver: &sqlite3.SQLiteDriver{
+			ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+				return conn.RegisterFunc("REGEXP", regex, true)
+			},
+		},
+	})
+	sql.Register(postgresDriver, wrapped{Driver: &pq.Driver{}, rewrite: rebind})
+}
+
+// wrapped times every statement for the metrics page and, for Postgres,
+// rewrites the ? placeholders plugins write
+type wrapped struct {
+	driver.Driver
+	rewrite func(string) string
+}
+
+func (d wrapped) Open(name string) (driver.Conn, error) {
+	c, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{Conn: c, rewrite: d.rewrite}, nil
+}
+
+type conn struct {
+	driver.Conn
+	rewrite func(string) string
+}
+
+// Unwrap gives the driver's own connection, for things like SQLite's online backup
+func (c *conn) Unwrap() driver.Conn {
+	return c.Conn
+}
+
+func (c *conn) sql(q string) string {
+	if c.rewrite == nil {
+		return q
+	}
+	return c.rewrite(q)
+}
+
+func (c *conn) Prepare(q string) (driver.Stmt, error) {
+	s, err := c.Conn.Prepare(c.sql(q))
+	if err != nil {
+		return nil, err
+	}
+	return &stmt{s}, nil
+}
+
+func (c *conn) PrepareContext(ctx context.Context, q string) (driver.Stmt, error) {
+	p, ok := c.Conn.(driver.ConnPrepareContext)
+	if !ok {
+		return c.Prepare(q)
+	}
+	s, err := p.PrepareContext(ctx, c.sql(q))
+	if err != nil {
+		return nil, err
+	}
+	return &stmt{s}, nil
+}
+
+func (c *conn) ExecContext(ctx context.Context, q string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	defer queryTime.Since(time.Now(), "exec")
+	return e.ExecContext(ctx, c.sql(q), args)
+}
+
+func (c *conn) QueryContext(ctx context.Context, q string, args []driver.NamedValue) (driver.Rows, error) {
+	e, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	defer queryTime.Since(time.Now(), "query")
+	return e.QueryContext(ctx, c.sql(q), args)
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *conn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *conn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *conn) CheckNamedValue(v *driver.NamedValue) error {
+	if n, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(v)
+	}
+	return driver.ErrSkip
+}
+
+type stmt struct {
+	driver.Stmt
+}
+
+func values(args []driver.NamedValue) []driver.Value {
+	vs := make([]driver.Value, len(args))
+	for i, a := range args {
+		vs[i] = a.Value
+	}
+	return vs
+}
+
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	defer queryTime.Since(time.Now(), "exec")
+	if e, ok := s.Stmt.(driver.StmtExecContext); ok {
+		return e.ExecContext(ctx, args)
+	}
+	return s.Stmt.Exec(values(args))
+}
+
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	defer queryTime.Since(time.Now(), "query")
+	if q, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		return q.QueryContext(ctx, args)
+	}
+	return s.Stmt.Query(values(args))
+}
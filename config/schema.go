@@ -0,0 +1,180 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Type is the kind of value a key holds
+type Type string
+
+const (
+	String Type = "string"
+	Int    Type = "int"
+	Float  Type = "float"
+	Bool   Type = "bool"
+	// Array values are separated by ;;
+	Array Type = "array"
+)
+
+// Key describes a config value a plugin reads
+type Key struct {
+	Name        string
+	Type        Type
+	Default     string
+	Description string
+	// Min and Max bound Int and Float values when Max is greater than Min
+	Min, Max float64
+	// Choices limits a String to a set of values when it is not empty
+	Choices []string
+	// Secret values, like tokens, are never exported
+	Secret bool
+}
+
+// Validate checks that a value fits the key
+func (k Key) Validate(value string) error {
+	var n float64
+	var err error
+	switch k.Type {
+	case Int:
+		var i int
+		i, err = strconv.Atoi(value)
+		n = float64(i)
+	case Float:
+		n, err = strconv.ParseFloat(value, 64)
+	case Bool:
+		_, err = parseBool(value)
+	}
+	if err != nil {
+		return fmt.Errorf("%s takes %s values", k.Name, k.Type)
+	}
+	if (k.Type == Int || k.Type == Float) && k.Max > k.Min && (n < k.Min || n > k.Max) {
+		return fmt.Errorf("%s must be between %v and %v", k.Name, k.Min, k.Max)
+	}
+	if len(k.Choices) > 0 {
+		for _, c := range k.Choices {
+			if strings.EqualFold(c, value) {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s must be one of %s", k.Name, strings.Join(k.Choices, ", "))
+	}
+	return nil
+}
+
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "true", "on", "yes", "1":
+		return true, nil
+	case "false", "off", "no", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("%q is not a bool", value)
+}
+
+// schema holds every declared key
+// Plugins declare their keys from init so they are known before the bot starts,
+// which lets -set validate values too.
+type schema struct {
+	sync.RWMutex
+	keys map[string]Key
+}
+
+var declared = &schema{keys: make(map[string]Key)}
+
+// Declare adds keys to the schema shared by every Config
+func Declare(keys ...Key) {
+	declared.Lock()
+	defer declared.Unlock()
+	for _, k := range keys {
+		if k.Type == "" {
+			k.Type = String
+		}
+		declared.keys[strings.ToLower(k.Name)] = k
+	}
+}
+
+// Declare adds keys to the schema
+func (c *Config) Declare(keys ...Key) {
+	Declare(keys...)
+}
+
+// Lookup finds the declaration of a key
+// Scoped keys are described by the key they override.
+func (c *Config) Lookup(key string) (Key, bool) {
+	return lookupKey(key)
+}
+
+func lookupKey(key string) (Key, bool) {
+	key = strings.ToLower(key)
+	if i := strings.Index(key, "@"); i >= 0 {
+		key = key[:i]
+	}
+	declared.RLock()
+	defer declared.RUnlock()
+	k, ok := declared.keys[key]
+	return k, ok
+}
+
+// Validate checks a value against the declaration of its key; undeclared keys take anything
+func (c *Config) Validate(key, value string) error {
+	k, ok := c.Lookup(key)
+	if !ok {
+		return nil
+	}
+	return k.Validate(value)
+}
+
+// IsSecret checks whether a key, or the key a scoped key overrides, was declared secret
+func IsSecret(key string) bool {
+	k, ok := lookupKey(key)
+	return ok && k.Secret
+}
+
+// Source says where a value came from
+type Source string
+
+const (
+	FromEnv     Source = "env"
+	FromDB      Source = "db"
+	FromDefault Source = "default"
+)
+
+// Setting is the current state of a declared key
+type Setting struct {
+	Key
+	Value  string
+	Source Source
+}
+
+// Settings describes every declared key, sorted by name
+func (c *Config) Settings() []Setting {
+	declared.RLock()
+	keys := make([]Key, 0, len(declared.keys))
+	for _, k := range declared.keys {
+		keys = append(keys, k)
+	}
+	declared.RUnlock()
+	sort.Slice(keys, func(i, j int) bool {
+		return strings.ToLower(keys[i].Name) < strings.ToLower(keys[j].Name)
+	})
+
+	out := []Setting{}
+	for _, k := range keys {
+		s := Setting{Key: k, Value: k.Default, Source: FromDefault}
+		name := strings.ToLower(k.Name)
+		if v, ok := os.LookupEnv(envkey(name)); ok {
+			s.Value, s.Source = v, FromEnv
+		} else if v, ok := c.lookup(name); ok {
+			s.Value, s.Source = v, FromDB
+		}
+		out = append(out, s)
+	}
+	return out
+}
@@ -0,0 +1,119 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Scope reads config values for one channel, falling back to the global values
+// Scoped values are stored as key@scope, where the scope is usually a connector:channel target.
+type Scope struct {
+	c     *Config
+	scope string
+}
+
+// Scope gives the config of a channel
+// An empty scope is the same as the global config.
+func (c *Config) Scope(scope string) Scope {
+	return Scope{c, strings.ToLower(scope)}
+}
+
+// ScopedKey is the key a scoped value is stored under
+func ScopedKey(scope, key string) string {
+	return strings.ToLower(key) + "@" + strings.ToLower(scope)
+}
+
+// Name of the scope
+func (s Scope) Name() string {
+	return s.scope
+}
+
+// lookup finds the value set for this scope only
+func (s Scope) lookup(key string) (string, bool) {
+	if s.scope == "" {
+		return "", false
+	}
+	return s.c.lookup(ScopedKey(s.scope, key))
+}
+
+// Has checks whether the scope overrides a key
+func (s Scope) Has(key string) bool {
+	_, ok := s.lookup(key)
+	return ok
+}
+
+// Get returns the scoped value of a key, then the global value, then the fallback
+func (s Scope) Get(key, fallback string) string {
+	if v, ok := s.lookup(key); ok {
+		return v
+	}
+	return s.c.GetString(key, fallback)
+}
+
+func (s Scope) GetInt(key string, fallback int) int {
+	return parseInt(key, s.Get(key, strconv.Itoa(fallback)), fallback)
+}
+
+func (s Scope) GetFloat64(key string, fallback float64) float64 {
+	return parseFloat(key, s.Get(key, fmt.Sprintf("%f", fallback)), fallback)
+}
+
+// GetBool understands true/false, on/off and yes/no
+func (s Scope) GetBool(key string, fallback bool) bool {
+	b, err := parseBool(s.Get(key, strconv.FormatBool(fallback)))
+	if err != nil {
+		return fallback
+	}
+	return b
+}
+
+func (s Scope) GetArray(key string, fallback []string) []string {
+	val := s.Get(key, "")
+	if val == "" {
+		return fallback
+	}
+	return strings.Split(val, ";;")
+}
+
+// Set stores a value for this scope only
+func (s Scope) Set(key, value string) error {
+	if s.scope == "" {
+		return s.c.Set(key, value)
+	}
+	return s.c.Set(ScopedKey(s.scope, key), value)
+}
+
+// Unset removes the scoped value so the global one applies again
+func (s Scope) Unset(key string) error {
+	if s.scope == "" {
+		return fmt.Errorf("Can't unset a global value")
+	}
+	return s.c.Unset(ScopedKey(s.scope, key))
+}
+
+// Overrides lists every scope that sets a key, with its value
+func (c *Config) Overrides(key string) (map[string]string, error) {
+	var rows []struct {
+		Key   string
+		Value string
+	}
+	prefix := strings.ToLower(key) + "@"
+	err := c.Select(&rows, `select key, value from config where key like ? escape '\'`,
+		strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix)+"%")
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]string{}
+	for _, r := range rows {
+		if IsSecret(r.Key) {
+			if r.Value, err = c.secrets.decrypt(r.Value); err != nil {
+				return nil, err
+			}
+		}
+		out[strings.TrimPrefix(r.Key, prefix)] = r.Value
+	}
+	return out, nil
+}
@@ -0,0 +1,204 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// SecretKeyEnv holds the key secret values are encrypted with
+	SecretKeyEnv = "CATBASE_SECRET_KEY"
+	// SecretKeyFileEnv names a file holding the key when SecretKeyEnv is not set
+	// It defaults to catbase.key and is created the first time a secret is stored.
+	SecretKeyFileEnv = "CATBASE_SECRET_KEY_FILE"
+
+	defaultKeyFile = "catbase.key"
+	secretPrefix   = "enc:v1:"
+	redacted       = "[redacted]"
+)
+
+// secretBox encrypts the values of secret keys before they reach the database
+type secretBox struct {
+	sync.Mutex
+	aead cipher.AEAD
+	file string
+}
+
+func newSecretBox() *secretBox {
+	file := os.Getenv(SecretKeyFileEnv)
+	if file == "" {
+		file = defaultKeyFile
+	}
+	return &secretBox{file: file}
+}
+
+// SetSecretKey sets the key secret values are encrypted with instead of reading it
+func (c *Config) SetSecretKey(key string) {
+	c.secrets.Lock()
+	defer c.secrets.Unlock()
+	c.secrets.aead = newAEAD(key)
+}
+
+func newAEAD(key string) cipher.AEAD {
+	sum := sha256.Sum256([]byte(key))
+	block, _ := aes.NewCipher(sum[:])
+	aead, _ := cipher.NewGCM(block)
+	return aead
+}
+
+// cipher loads the key, creating a key file if create is set and there is none
+func (s *secretBox) cipher(create bool) (cipher.AEAD, error) {
+	s.Lock()
+	defer s.Unlock()
+	if s.aead != nil {
+		return s.aead, nil
+	}
+	if key := os.Getenv(SecretKeyEnv); key != "" {
+		s.aead = newAEAD(key)
+		return s.aead, nil
+	}
+	key, err := os.ReadFile(s.file)
+	if os.IsNotExist(err) && create {
+		raw := make([]byte, 32)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		key = []byte(hex.EncodeToString(raw))
+		if err := os.WriteFile(s.file, key, 0600); err != nil {
+			return nil, err
+		}
+		log.Info().Msgf("Created secret key file %s, keep it with your backups", s.file)
+	} else if err != nil {
+		return nil, fmt.Errorf("no secret key in %s or $%s: %w", s.file, SecretKeyEnv, err)
+	}
+	s.aead = newAEAD(strings.TrimSpace(string(key)))
+	return s.aead, nil
+}
+
+func (s *secretBox) encrypt(value string) (string, error) {
+	aead, err := s.cipher(true)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), nil)
+	return secretPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decrypt opens a stored value; values stored before they were encrypted come back as they are
+func (s *secretBox) decrypt(stored string) (string, error) {
+	if !strings.HasPrefix(stored, secretPrefix) {
+		return stored, nil
+	}
+	aead, err := s.cipher(false)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, secretPrefix))
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", errors.New("malformed secret")
+	}
+	n := aead.NonceSize()
+	plain, err := aead.Open(nil, sealed[:n], sealed[n:], nil)
+	if err != nil {
+		return "", errors.New("secret key does not match")
+	}
+	return string(plain), nil
+}
+
+// EncryptSecrets encrypts secret values that were stored in plain text
+func (c *Config) EncryptSecrets() error {
+	var rows []struct {
+		Key   string
+		Value string
+	}
+	if err := c.Select(&rows, `select key, value from config`); err != nil {
+		return err
+	}
+	n := 0
+	for _, r := range rows {
+		if !IsSecret(r.Key) || strings.HasPrefix(r.Value, secretPrefix) {
+			continue
+		}
+		stored, err := c.secrets.encrypt(r.Value)
+		if err != nil {
+			return err
+		}
+		if _, err := c.Exec(`update config set value=? where key=?`, stored, r.Key); err != nil {
+			return err
+		}
+		n++
+	}
+	if n > 0 {
+		log.Info().Msgf("Encrypted %d secret config values", n)
+	}
+	return nil
+}
+
+// known secret values, which are cut out of the logs
+var revealed = struct {
+	sync.RWMutex
+	values map[string]bool
+	sorted []string
+}{values: map[string]bool{}}
+
+// reveal remembers a secret value so Redact can hide it
+func reveal(value string) {
+	// very short values would redact ordinary words
+	if len(value) < 4 {
+		return
+	}
+	revealed.Lock()
+	defer revealed.Unlock()
+	if revealed.values[value] {
+		return
+	}
+	revealed.values[value] = true
+	revealed.sorted = append(revealed.sorted, value)
+	// replace longer values first so one secret inside another doesn't leave a piece behind
+	sort.Slice(revealed.sorted, func(i, j int) bool { return len(revealed.sorted[i]) > len(revealed.sorted[j]) })
+}
+
+// Redact replaces every secret value that has been read or set with [redacted]
+func Redact(s string) string {
+	revealed.RLock()
+	defer revealed.RUnlock()
+	for _, v := range revealed.sorted {
+		s = strings.Replace(s, v, redacted, -1)
+	}
+	return s
+}
+
+type redactWriter struct {
+	w io.Writer
+}
+
+func (r redactWriter) Write(p []byte) (int, error) {
+	if _, err := r.w.Write([]byte(Redact(string(p)))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// RedactWriter wraps a log output so secret values never reach it
+func RedactWriter(w io.Writer) io.Writer {
+	return redactWriter{w}
+}
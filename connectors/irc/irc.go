@@ -7,16 +7,22 @@ import (
 	"io"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/markup"
 	"github.com/velour/catbase/bot/msg"
 	"github.com/velour/catbase/bot/user"
 	"github.com/velour/catbase/config"
 	"github.com/velour/velour/irc"
 )
 
+func init() {
+	config.Declare(config.Key{Name: "Irc.Pass", Secret: true, Description: "IRC server password"})
+}
+
 const (
 	// DefaultPort is the port used to connect to
 	// the server if one is not specified.
@@ -28,30 +34,61 @@ const (
 	// a connection is made successfully.
 	initialTimeout = 2 * time.Second
 
+	// maxTimeout caps the delay between reconnections
+	maxTimeout = 5 * time.Minute
+
 	// PingTime is the amount of inactive time
 	// to wait before sending a ping to the server.
 	pingTime = 120 * time.Second
 
+	// quitTimeout is how long Stop waits for the server to hang up after QUIT
+	quitTimeout = 5 * time.Second
+
 	actionPrefix = "\x01ACTION"
 )
 
-var throttle <-chan time.Time
-
 type Irc struct {
+	bot.StatusTracker
+
 	Client *irc.Client
 	config *config.Config
 	quit   chan bool
 
+	// stopping is closed by Stop and stopped by Serve when it returns
+	stopping chan struct{}
+	stopOnce sync.Once
+	stopped  chan struct{}
+
 	event bot.Callback
 }
 
 func New(c *config.Config) *Irc {
 	i := Irc{}
 	i.config = c
+	i.stopping = make(chan struct{})
+	i.stopped = make(chan struct{})
+	migrateRate(c)
 
 	return &i
 }
 
+// migrateRate moves the old RatePerSec setting onto the send queue's limit for IRC
+func migrateRate(c *config.Config) {
+	rate := c.Get("RatePerSec", "")
+	if rate == "" {
+		return
+	}
+	if c.Scope("irc").Has("send.connectorRate") {
+		log.Warn().Msg("RatePerSec is deprecated and ignored; send.connectorRate@irc is set")
+		return
+	}
+	if err := c.Set(config.ScopedKey("irc", "send.connectorRate"), rate); err != nil {
+		log.Error().Err(err).Msgf("Could not move RatePerSec=%s to send.connectorRate@irc", rate)
+		return
+	}
+	log.Warn().Msgf("RatePerSec is deprecated; moved %s to send.connectorRate@irc", rate)
+}
+
 func (i *Irc) RegisterEvent(f bot.Callback) {
 	i.event = f
 }
@@ -74,6 +111,9 @@ func (i *Irc) JoinChannel(channel string) {
 }
 
 func (i *Irc) sendMessage(channel, message string, args ...interface{}) (string, error) {
+	if i.Status().State != bot.Connected {
+		return "", fmt.Errorf("not connected to IRC")
+	}
 	for len(message) > 0 {
 		m := irc.Msg{
 			Cmd:  "PRIVMSG",
@@ -88,13 +128,6 @@ func (i *Irc) sendMessage(channel, message string, args ...interface{}) (string,
 			message = ""
 		}
 
-		if throttle == nil {
-			ratePerSec := i.config.GetInt("RatePerSec", 5)
-			throttle = time.Tick(time.Second / time.Duration(ratePerSec))
-		}
-
-		<-throttle
-
 		i.Client.Out <- m
 
 		if len(args) > 0 {
@@ -107,8 +140,6 @@ func (i *Irc) sendMessage(channel, message string, args ...interface{}) (string,
 							a.AltTxt, a.URL)},
 					}
 
-					<-throttle
-
 					i.Client.Out <- m
 				}
 			}
@@ -124,16 +155,72 @@ func (i *Irc) sendAction(channel, message string, args ...interface{}) (string,
 	return i.sendMessage(channel, message, args...)
 }
 
+// Format shows the neutral markup of messages as IRC control codes and Unicode emoji
+func (i *Irc) Format(text string) string {
+	return markup.IRC(text)
+}
+
+// OneLinePerMessage has the bot's send queue give IRC each line of a message on its own
+func (i *Irc) OneLinePerMessage() {}
+
 func (i *Irc) GetEmojiList() map[string]string {
 	//we're not going to do anything because it's IRC
 	return make(map[string]string)
 }
 
+// Serve connects to the server, reconnecting with a growing delay whenever the connection drops
 func (i *Irc) Serve() error {
+	defer close(i.stopped)
 	if i.event == nil {
+		i.SetState(bot.Failed)
 		return fmt.Errorf("Missing an event handler")
 	}
 
+	wait := initialTimeout
+	for {
+		if err := i.connect(); err != nil {
+			i.Error(err)
+			i.SetState(bot.Reconnecting)
+			log.Error().Err(err).Msgf("Could not connect to IRC, trying again in %s", wait)
+			select {
+			case <-time.After(wait):
+			case <-i.stopping:
+				return nil
+			}
+			if wait *= 2; wait > maxTimeout {
+				wait = maxTimeout
+			}
+			continue
+		}
+		wait = initialTimeout
+		i.SetState(bot.Connected)
+
+		i.quit = make(chan bool)
+		go i.handleConnection()
+		<-i.quit
+		select {
+		case <-i.stopping:
+			log.Info().Msg("Left IRC")
+			return nil
+		default:
+		}
+		i.SetState(bot.Reconnecting)
+		log.Info().Msg("Lost the IRC connection, reconnecting")
+	}
+}
+
+// Stop sends QUIT and waits a little for the server to hang up
+func (i *Irc) Stop() error {
+	i.stopOnce.Do(func() { close(i.stopping) })
+	select {
+	case <-i.stopped:
+	case <-time.After(quitTimeout):
+		return fmt.Errorf("the IRC server did not hang up within %s", quitTimeout)
+	}
+	return nil
+}
+
+func (i *Irc) connect() error {
 	var err error
 	i.Client, err = irc.DialSSL(
 		i.config.Get("Irc.Server", "localhost"),
@@ -146,31 +233,40 @@ func (i *Irc) Serve() error {
 		return fmt.Errorf("%s", err)
 	}
 
-	for _, c := range i.config.GetArray("channels", []string{}) {
-		i.JoinChannel(c)
+	for _, target := range i.config.GetArray("channels", []string{}) {
+		// channels may be shared with other connectors
+		if conn, c := bot.ParseTarget(target); conn == "" || conn == "irc" {
+			i.JoinChannel(c)
+		}
 	}
-
-	i.quit = make(chan bool)
-	go i.handleConnection()
-	<-i.quit
 	return nil
 }
 
 func (i *Irc) handleConnection() {
 	t := time.NewTimer(pingTime)
+	// Serve replaces i.Client when it reconnects
+	client := i.Client
 
 	defer func() {
 		t.Stop()
-		close(i.Client.Out)
-		for err := range i.Client.Errors {
+		close(client.Out)
+		for err := range client.Errors {
 			if err != io.EOF {
 				log.Error().Err(err)
 			}
 		}
 	}()
 
+	// pinged is set while a ping we sent is unanswered
+	pinged := false
+	stopping := i.stopping
 	for {
 		select {
+		case <-stopping:
+			client.Out <- irc.Msg{Cmd: irc.QUIT, Args: []string{"shutting down"}}
+			// keep reading until the server hangs up
+			stopping = nil
+
 		case msg, ok := <-i.Client.In:
 			if !ok { // disconnect
 				i.quit <- true
@@ -178,15 +274,25 @@ func (i *Irc) handleConnection() {
 			}
 			t.Stop()
 			t = time.NewTimer(pingTime)
+			pinged = false
+			i.Seen()
 			i.handleMsg(msg)
 
 		case <-t.C:
+			if pinged {
+				i.Error(fmt.Errorf("no reply to ping in %s", pingTime))
+				log.Error().Msg("The IRC server stopped answering")
+				i.quit <- true
+				return
+			}
 			i.Client.Out <- irc.Msg{Cmd: irc.PING, Args: []string{i.Client.Server}}
+			pinged = true
 			t = time.NewTimer(pingTime)
 
 		case err, ok := <-i.Client.Errors:
 			if ok && err != io.EOF {
 				log.Error().Err(err)
+				i.Error(err)
 				i.quit <- true
 				return
 			}
@@ -265,9 +371,13 @@ func (i *Irc) handleMsg(msg irc.Msg) {
 // Builds our internal message type out of a Conn & Line from irc
 func (i *Irc) buildMessage(inMsg irc.Msg) msg.Message {
 	// Check for the user
+	// Nicks are easy to take, so the ID is the more stable user@host
 	u := user.User{
 		Name: inMsg.Origin,
 	}
+	if inMsg.User != "" {
+		u.ID = inMsg.User + "@" + inMsg.Host
+	}
 
 	channel := inMsg.Args[0]
 	if channel == i.config.Get("Nick", "bot") {
@@ -307,6 +417,6 @@ func (i *Irc) buildMessage(inMsg irc.Msg) msg.Message {
 	return msg
 }
 
-func (i Irc) Who(channel string) []string {
+func (i *Irc) Who(channel string) []string {
 	return []string{}
 }
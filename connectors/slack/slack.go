@@ -16,19 +16,26 @@ import (
 	"strconv"
 	"strings"
 
-	// "sync/atomic"
 	"context"
+	"sync/atomic"
 	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/markup"
 	"github.com/velour/catbase/bot/msg"
 	"github.com/velour/catbase/bot/user"
 	"github.com/velour/catbase/config"
 	"github.com/velour/chat/websocket"
 )
 
+func init() {
+	config.Declare(config.Key{Name: "slack.token", Secret: true, Description: "slack bot token"})
+}
+
 type Slack struct {
+	bot.StatusTracker
+
 	config *config.Config
 
 	url   string
@@ -45,6 +52,9 @@ type Slack struct {
 	emoji map[string]string
 
 	event bot.Callback
+
+	// stopping is set by Stop so Serve knows the closed socket was on purpose
+	stopping int32
 }
 
 var idCounter uint64
@@ -366,6 +376,11 @@ func (s *Slack) edit(channel, newMessage, identifier string) (string, error) {
 	return "", checkReturnStatus(resp)
 }
 
+// Format shows the neutral markup of messages as mrkdwn
+func (s *Slack) Format(text string) string {
+	return markup.Slack(text)
+}
+
 func (s *Slack) GetEmojiList() map[string]string {
 	return s.emoji
 }
@@ -407,7 +422,14 @@ func (s *Slack) ping(ctx context.Context) {
 		case <-ticker.C:
 			ping := map[string]interface{}{"type": "ping", "time": time.Now().UnixNano()}
 			if err := s.ws.Send(context.TODO(), ping); err != nil {
-				panic(err)
+				if atomic.LoadInt32(&s.stopping) == 1 {
+					return
+				}
+				log.Error().Err(err).Msg("Error sending ping")
+				s.Error(err)
+				s.SetState(bot.Failed)
+				s.ws.Close(context.TODO())
+				return
 			}
 		}
 	}
@@ -417,9 +439,10 @@ func (s *Slack) receiveMessage() (slackMessage, error) {
 	m := slackMessage{}
 	err := s.ws.Recv(context.TODO(), &m)
 	if err != nil {
-		log.Error().Msgf("Error decoding WS message")
-		panic(fmt.Errorf("%v\n%v", m, err))
+		log.Error().Err(err).Msgf("Error decoding WS message")
+		return m, err
 	}
+	s.Seen()
 	return m, nil
 }
 
@@ -432,7 +455,12 @@ func slackTStoTime(t string) time.Time {
 }
 
 func (s *Slack) Serve() error {
-	s.connect()
+	if err := s.connect(); err != nil {
+		s.Error(err)
+		s.SetState(bot.Failed)
+		return err
+	}
+	s.SetState(bot.Connected)
 	s.populateEmojiList()
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -441,10 +469,17 @@ func (s *Slack) Serve() error {
 
 	for {
 		msg, err := s.receiveMessage()
-		if err != nil && err == io.EOF {
-			log.Fatal().Msg("Slack API EOF")
-		} else if err != nil {
-			return fmt.Errorf("Slack API error: %s", err)
+		if err != nil && atomic.LoadInt32(&s.stopping) == 1 {
+			return nil
+		}
+		if err != nil {
+			if err == io.EOF {
+				err = errors.New("Slack API EOF")
+			}
+			err = fmt.Errorf("Slack API error: %w", err)
+			s.Error(err)
+			s.SetState(bot.Failed)
+			return err
 		}
 		switch msg.Type {
 		case "message":
@@ -631,29 +666,38 @@ func (s *Slack) markChannelAsRead(slackChanId string) error {
 	return nil
 }
 
-func (s *Slack) connect() {
+// Stop closes the RTM socket, which ends Serve
+func (s *Slack) Stop() error {
+	atomic.StoreInt32(&s.stopping, 1)
+	if s.ws == nil {
+		return nil
+	}
+	return s.ws.Close(context.TODO())
+}
+
+func (s *Slack) connect() error {
 	token := s.token
 	u := fmt.Sprintf("https://slack.com/api/rtm.connect?token=%s", token)
 	resp, err := http.Get(u)
 	if err != nil {
-		return
+		return err
 	}
 	if resp.StatusCode != 200 {
-		log.Fatal().Msgf("Slack API failed. Code: %d", resp.StatusCode)
+		return fmt.Errorf("Slack API failed. Code: %d", resp.StatusCode)
 	}
 	body, err := ioutil.ReadAll(resp.Body)
 	resp.Body.Close()
 	if err != nil {
-		log.Fatal().Err(err).Msg("Error reading Slack API body")
+		return fmt.Errorf("error reading Slack API body: %w", err)
 	}
 	var rtm rtmStart
 	err = json.Unmarshal(body, &rtm)
 	if err != nil {
-		return
+		return err
 	}
 
 	if !rtm.Ok {
-		log.Fatal().Msgf("Slack error: %s", rtm.Error)
+		return fmt.Errorf("Slack error: %s", rtm.Error)
 	}
 
 	s.url = "https://slack.com/api/"
@@ -664,9 +708,7 @@ func (s *Slack) connect() {
 
 	rtmURL, _ := url.Parse(rtm.URL)
 	s.ws, err = websocket.Dial(context.TODO(), rtmURL)
-	if err != nil {
-		log.Fatal().Err(err)
-	}
+	return err
 }
 
 // Get username for Slack user ID
@@ -23,11 +23,20 @@ import (
 	"github.com/nlopes/slack/slackevents"
 
 	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/markup"
 	"github.com/velour/catbase/bot/msg"
 	"github.com/velour/catbase/bot/user"
 	"github.com/velour/catbase/config"
 )
 
+func init() {
+	config.Declare(
+		config.Key{Name: "slack.token", Secret: true, Description: "slack bot token"},
+		config.Key{Name: "slack.usertoken", Secret: true, Description: "slack user token, needed for emoji"},
+		config.Key{Name: "slack.verification", Secret: true, Description: "slack event verification token"},
+	)
+}
+
 const DefaultRing = 5
 const defaultLogFormat = "[{{fixDate .Time \"2006-01-02 15:04:05\"}}] {{if .TopicChange}}*** {{.User.Name}}{{else if .Action}}* {{.User.Name}}{{else}}<{{.User.Name}}>{{end}} {{.Body}}\n"
 
@@ -39,6 +48,8 @@ const defaultLogFormat = "[{{fixDate .Time \"2006-01-02 15:04:05\"}}] {{if .Topi
 // "User":{"Admin":false,"ID":"U0RLUDELD","Name":"flyngpngn"}}
 
 type SlackApp struct {
+	bot.StatusTracker
+
 	bot    bot.Bot
 	config *config.Config
 	api    *slack.Client
@@ -107,6 +118,8 @@ func (s *SlackApp) RegisterEvent(f bot.Callback) {
 
 func (s *SlackApp) Serve() error {
 	s.populateEmojiList()
+	// Slack pushes events to us, so there is no connection to lose
+	s.SetState(bot.Connected)
 
 	http.HandleFunc("/evt", func(w http.ResponseWriter, r *http.Request) {
 		buf := new(bytes.Buffer)
@@ -115,7 +128,10 @@ func (s *SlackApp) Serve() error {
 		eventsAPIEvent, e := slackevents.ParseEvent(json.RawMessage(body), slackevents.OptionVerifyToken(&slackevents.TokenComparator{VerificationToken: s.verification}))
 		if e != nil {
 			log.Error().Err(e)
+			s.Error(e)
 			w.WriteHeader(http.StatusInternalServerError)
+		} else {
+			s.Seen()
 		}
 
 		if eventsAPIEvent.Type == slackevents.URLVerification {
@@ -361,6 +377,11 @@ func (s *SlackApp) edit(channel, newMessage, identifier string) (string, error)
 	return ts, err
 }
 
+// Format shows the neutral markup of messages as mrkdwn
+func (s *SlackApp) Format(text string) string {
+	return markup.Slack(text)
+}
+
 func (s *SlackApp) GetEmojiList() map[string]string {
 	return s.emoji
 }
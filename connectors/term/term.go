@@ -0,0 +1,212 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+// Package term connects the bot to a terminal for local development
+package term
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/bot/user"
+	"github.com/velour/catbase/config"
+)
+
+// Term reads chat lines from stdin and prints everything the bot says to stdout
+type Term struct {
+	bot.StatusTracker
+
+	config *config.Config
+	in     io.Reader
+	out    io.Writer
+
+	// outLock keeps concurrent sends from interleaving
+	outLock sync.Mutex
+
+	nick    string
+	channel string
+	// counter numbers sent messages; sends come from many goroutines
+	counter int64
+
+	event bot.Callback
+}
+
+func New(c *config.Config) *Term {
+	return newTerm(c, os.Stdin, os.Stdout)
+}
+
+func newTerm(c *config.Config, in io.Reader, out io.Writer) *Term {
+	nick := os.Getenv("USER")
+	if nick == "" {
+		nick = "user"
+	}
+	return &Term{
+		config:  c,
+		in:      in,
+		out:     out,
+		nick:    c.Get("Term.User", nick),
+		channel: c.Get("Term.Channel", "#term"),
+	}
+}
+
+func (t *Term) RegisterEvent(f bot.Callback) {
+	t.event = f
+}
+
+// Serve reads from the terminal until it is closed
+func (t *Term) Serve() error {
+	if t.event == nil {
+		return fmt.Errorf("Missing an event handler")
+	}
+	t.SetState(bot.Connected)
+	go t.readLoop()
+	return nil
+}
+
+func (t *Term) readLoop() {
+	scanner := bufio.NewScanner(t.in)
+	for scanner.Scan() {
+		t.Seen()
+		t.handleLine(scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		log.Error().Err(err).Msg("Error reading from terminal")
+		t.Error(err)
+	}
+	t.SetState(bot.Failed)
+	log.Info().Msg("Terminal closed")
+}
+
+// handleLine turns a line of input into a bot event, handling IRC style switches
+func (t *Term) handleLine(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
+	}
+
+	action := false
+	switch cmd, rest := splitCommand(line); cmd {
+	case "/me":
+		action = true
+		line = rest
+	case "/join":
+		if rest == "" {
+			t.printf("usage: /join <channel>")
+			return
+		}
+		t.channel = rest
+		t.printf("now talking in %s", t.channel)
+		return
+	case "/nick":
+		if rest == "" {
+			t.printf("usage: /nick <name>")
+			return
+		}
+		t.nick = rest
+		t.printf("you are now known as %s", t.nick)
+		return
+	}
+
+	t.event(t, bot.Message, t.buildMessage(line, action))
+}
+
+func splitCommand(line string) (string, string) {
+	if !strings.HasPrefix(line, "/") {
+		return "", line
+	}
+	parts := strings.SplitN(line, " ", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], strings.TrimSpace(parts[1])
+}
+
+// Builds our internal message type out of a line from the terminal
+func (t *Term) buildMessage(line string, action bool) msg.Message {
+	iscmd := false
+	body := line
+	if !action {
+		iscmd, body = bot.IsCmd(t.config, line)
+	}
+	return msg.Message{
+		User: &user.User{
+			ID:   t.nick,
+			Name: t.nick,
+		},
+		Channel:     t.channel,
+		ChannelName: t.channel,
+		Body:        body,
+		Raw:         line,
+		Command:     iscmd,
+		Action:      action,
+		Time:        time.Now(),
+		Host:        "localhost",
+	}
+}
+
+func (t *Term) Send(kind bot.Kind, args ...interface{}) (string, error) {
+	nick := t.config.Get("Nick", "bot")
+	switch kind {
+	case bot.Message:
+		t.printf("[%s] <%s> %s", args[0], nick, args[1])
+		t.printAttachments(args[0].(string), args...)
+	case bot.Action:
+		t.printf("[%s] * %s %s", args[0], nick, args[1])
+		t.printAttachments(args[0].(string), args...)
+	case bot.Reply:
+		t.printf("[%s] <%s> (in reply to %s) %s", args[0], nick, describe(args[2]), args[1])
+	case bot.Reaction:
+		t.printf("[%s] %s reacted :%s: to %s", args[0], nick, args[1], describe(args[2]))
+	case bot.Edit:
+		t.printf("[%s] <%s> (edited %s) %s", args[0], nick, args[2], args[1])
+	default:
+		return "", fmt.Errorf("No handler for message type %d", kind)
+	}
+	return fmt.Sprintf("%d", atomic.AddInt64(&t.counter, 1)), nil
+}
+
+// describe prints the message a reply or reaction refers to
+func describe(ref interface{}) string {
+	switch ref := ref.(type) {
+	case msg.Message:
+		name := "someone"
+		if ref.User != nil {
+			name = ref.User.Name
+		}
+		return fmt.Sprintf("<%s> %s", name, ref.Body)
+	default:
+		return fmt.Sprintf("%v", ref)
+	}
+}
+
+func (t *Term) printAttachments(channel string, args ...interface{}) {
+	for _, a := range args {
+		switch a := a.(type) {
+		case bot.ImageAttachment:
+			t.printf("[%s] %s: %s", channel, a.AltTxt, a.URL)
+		}
+	}
+}
+
+func (t *Term) printf(format string, args ...interface{}) {
+	t.outLock.Lock()
+	defer t.outLock.Unlock()
+	fmt.Fprintf(t.out, format+"\n", args...)
+}
+
+func (t *Term) GetEmojiList() map[string]string {
+	return make(map[string]string)
+}
+
+// Who only knows about the person at the keyboard
+func (t *Term) Who(channel string) []string {
+	return []string{t.nick}
+}
@@ -0,0 +1,89 @@
+package term
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/bot/user"
+	"github.com/velour/catbase/config"
+)
+
+func setup(t *testing.T) (*Term, *bytes.Buffer, *[]msg.Message) {
+	c := config.ReadConfig("file::memory:?mode=memory&cache=shared")
+	c.Set("nick", "catbase")
+	c.Set("Term.User", "tester")
+	c.Set("Term.Channel", "#test")
+	out := &bytes.Buffer{}
+	term := newTerm(c, strings.NewReader(""), out)
+	received := []msg.Message{}
+	term.RegisterEvent(func(conn bot.Connector, kind bot.Kind, m msg.Message, args ...interface{}) bool {
+		received = append(received, m)
+		return true
+	})
+	return term, out, &received
+}
+
+func TestMessage(t *testing.T) {
+	term, _, received := setup(t)
+	term.handleLine("catbase: hello")
+	assert.Len(t, *received, 1)
+	m := (*received)[0]
+	assert.True(t, m.Command)
+	assert.Equal(t, "hello", m.Body)
+	assert.Equal(t, "tester", m.User.Name)
+	assert.Equal(t, "#test", m.Channel)
+}
+
+func TestMe(t *testing.T) {
+	term, _, received := setup(t)
+	term.handleLine("/me dances")
+	assert.Len(t, *received, 1)
+	assert.True(t, (*received)[0].Action)
+	assert.Equal(t, "dances", (*received)[0].Body)
+}
+
+func TestJoinAndNick(t *testing.T) {
+	term, out, received := setup(t)
+	term.handleLine("/join #other")
+	term.handleLine("/nick someone")
+	term.handleLine("hi")
+	assert.Len(t, *received, 1)
+	assert.Equal(t, "#other", (*received)[0].Channel)
+	assert.Equal(t, "someone", (*received)[0].User.Name)
+	assert.Contains(t, out.String(), "now talking in #other")
+}
+
+func TestSend(t *testing.T) {
+	term, out, _ := setup(t)
+	term.Send(bot.Message, "#test", "hello")
+	term.Send(bot.Action, "#test", "waves")
+	term.Send(bot.Reaction, "#test", "cat", msg.Message{User: &user.User{Name: "tester"}, Body: "meow"})
+	term.Send(bot.Edit, "#test", "hello again", "1")
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Equal(t, []string{
+		"[#test] <catbase> hello",
+		"[#test] * catbase waves",
+		"[#test] catbase reacted :cat: to <tester> meow",
+		"[#test] <catbase> (edited 1) hello again",
+	}, lines)
+}
+
+func TestConcurrentSendsGetTheirOwnIDs(t *testing.T) {
+	term, _, _ := setup(t)
+	ids := make(chan string, 20)
+	for i := 0; i < cap(ids); i++ {
+		go func() {
+			id, _ := term.Send(bot.Message, "#test", "hi")
+			ids <- id
+		}()
+	}
+	seen := map[string]bool{}
+	for i := 0; i < cap(ids); i++ {
+		seen[<-ids] = true
+	}
+	assert.Len(t, seen, cap(ids))
+}
@@ -3,22 +3,29 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"github.com/velour/catbase/plugins/cli"
 	"github.com/velour/catbase/plugins/newsbid"
 	"math/rand"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
 	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/backup"
+	"github.com/velour/catbase/bot/migrate"
 	"github.com/velour/catbase/config"
 	"github.com/velour/catbase/connectors/irc"
 	"github.com/velour/catbase/connectors/slack"
 	"github.com/velour/catbase/connectors/slackapp"
+	"github.com/velour/catbase/connectors/term"
 	"github.com/velour/catbase/plugins/admin"
 	"github.com/velour/catbase/plugins/babbler"
 	"github.com/velour/catbase/plugins/beers"
@@ -43,28 +50,36 @@ import (
 	"github.com/velour/catbase/plugins/tell"
 	"github.com/velour/catbase/plugins/tldr"
 	"github.com/velour/catbase/plugins/twitch"
+	"github.com/velour/catbase/plugins/webhook"
 	"github.com/velour/catbase/plugins/your"
 	"github.com/velour/catbase/plugins/zork"
 )
 
 var (
-	key       = flag.String("set", "", "Configuration key to set")
-	val       = flag.String("val", "", "Configuration value to set")
-	initDB    = flag.Bool("init", false, "Initialize the configuration DB")
-	prettyLog = flag.Bool("pretty", false, "Use pretty console logger")
-	debug     = flag.Bool("debug", false, "Turn on debug logging")
+	key           = flag.String("set", "", "Configuration key to set")
+	val           = flag.String("val", "", "Configuration value to set")
+	initDB        = flag.Bool("init", false, "Initialize the configuration DB")
+	prettyLog     = flag.Bool("pretty", false, "Use pretty console logger")
+	debug         = flag.Bool("debug", false, "Turn on debug logging")
+	migrateStatus = flag.Bool("migrate-status", false, "Show which database migrations have run and exit")
+	backupPath    = flag.String("backup", "", "Copy the database to this file and exit")
+	exportDir     = flag.String("export", "", "Write plugin data as JSON to this directory and exit")
+	importDir     = flag.String("import", "", "Load plugin data written by -export from this directory and exit")
 )
 
+// shutdownTimeout bounds how long a shutdown waits for plugins to finish
+const shutdownTimeout = 30 * time.Second
+
 func main() {
 	rand.Seed(time.Now().Unix())
 
 	var dbpath = flag.String("db", "catbase.db",
-		"Database file to load. (Defaults to catbase.db)")
+		"Database file to load, or a postgres:// URL. (Defaults to catbase.db)")
 	flag.Parse() // parses the logging flags.
 
-	log.Logger = log.With().Caller().Stack().Logger()
+	log.Logger = log.With().Caller().Stack().Logger().Output(config.RedactWriter(os.Stderr))
 	if *prettyLog {
-		log.Logger = log.Logger.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+		log.Logger = log.Logger.Output(zerolog.ConsoleWriter{Out: config.RedactWriter(os.Stderr)})
 	}
 	zerolog.SetGlobalLevel(zerolog.InfoLevel)
 	if *debug {
@@ -74,10 +89,37 @@ func main() {
 	c := config.ReadConfig(*dbpath)
 
 	if *key != "" && *val != "" {
-		c.Set(*key, *val)
+		if err := c.Set(*key, *val); err != nil {
+			log.Fatal().Err(err).Msgf("Could not set %s", *key)
+		}
 		log.Info().Msgf("Set config %s: %s", *key, *val)
 		return
 	}
+	if *migrateStatus {
+		printMigrations(c)
+		return
+	}
+	if *backupPath != "" {
+		if err := backup.Backup(c.DB, *backupPath); err != nil {
+			log.Fatal().Err(err).Msg("Backup failed")
+		}
+		log.Info().Msgf("Backed up to %s", *backupPath)
+		return
+	}
+	if *exportDir != "" || *importDir != "" {
+		migrate.MustUp(c.DB)
+		if *importDir != "" {
+			if err := backup.Import(c.DB, *importDir); err != nil {
+				log.Fatal().Err(err).Msg("Import failed")
+			}
+			return
+		}
+		if err := backup.Export(c.DB, *exportDir); err != nil {
+			log.Fatal().Err(err).Msg("Export failed")
+		}
+		log.Info().Msgf("Exported to %s", *exportDir)
+		return
+	}
 	if (*initDB && len(flag.Args()) != 2) || (!*initDB && c.GetInt("init", 0) != 1) {
 		log.Fatal().Msgf(`You must run "catbase -init <channel> <nick>"`)
 	} else if *initDB {
@@ -85,22 +127,32 @@ func main() {
 		return
 	}
 
-	var client bot.Connector
-
-	switch c.Get("type", "slackapp") {
-	case "irc":
-		client = irc.New(c)
-	case "slack":
-		client = slack.New(c)
-	case "slackapp":
-		client = slackapp.New(c)
-	default:
-		log.Fatal().Msgf("Unknown connection type: %s", c.Get("type", "UNSET"))
+	b := bot.New(c)
+
+	// type may list several connectors, the first is the default
+	for _, t := range c.GetArray("type", []string{"slackapp"}) {
+		switch t {
+		case "irc":
+			b.AddConnector(t, irc.New(c))
+		case "slack":
+			b.AddConnector(t, slack.New(c))
+		case "slackapp":
+			b.AddConnector(t, slackapp.New(c))
+		case "term":
+			b.AddConnector(t, term.New(c))
+		case "cli":
+			// the web console is a plugin as well as a connector
+			cp := cli.New(b)
+			b.AddConnector(t, cp)
+			b.AddPlugin(cp)
+		default:
+			log.Fatal().Msgf("Unknown connection type: %s", t)
+		}
 	}
 
-	b := bot.New(c, client)
-
 	b.AddPlugin(admin.New(b))
+	// webhooks see every message before other plugins claim it
+	b.AddPlugin(webhook.New(b))
 	b.AddPlugin(emojifyme.New(b))
 	b.AddPlugin(first.New(b))
 	b.AddPlugin(leftpad.New(b))
@@ -126,14 +178,47 @@ func main() {
 	b.AddPlugin(tldr.New(b))
 	b.AddPlugin(stock.New(b))
 	b.AddPlugin(newsbid.New(b))
-	b.AddPlugin(cli.New(b))
 	// catches anything left, will always return true
 	b.AddPlugin(fact.New(b))
 
-	if err := client.Serve(); err != nil {
-		log.Fatal().Err(err)
+	if err := b.Start(); err != nil {
+		log.Fatal().Err(err).Msg("Could not start")
 	}
 
-	addr := c.Get("HttpAddr", "127.0.0.1:1337")
-	log.Fatal().Err(http.ListenAndServe(addr, nil))
+	srv := &http.Server{Addr: c.Get("HttpAddr", "127.0.0.1:1337")}
+	go func() {
+		if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+			log.Fatal().Err(err).Msg("Web server failed")
+		}
+	}()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	log.Info().Msgf("Got %s, shutting down", <-sig)
+	// a second signal skips the wait
+	signal.Reset()
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Error().Err(err).Msg("Web server did not shut down cleanly")
+	}
+	if err := b.Stop(ctx); err != nil {
+		log.Error().Err(err).Msg("Did not shut down cleanly")
+	}
+	log.Info().Msg("Bye")
+}
+
+// printMigrations shows how far the database has come for each plugin without changing it
+func printMigrations(c *config.Config) {
+	states, err := migrate.Status(c.DB)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Could not read migration status")
+	}
+	for _, s := range states {
+		fmt.Printf("%-12s %d/%d\n", s.Plugin, s.Current, s.Latest)
+		for _, step := range s.Pending {
+			fmt.Printf("%12s %d pending: %s\n", "", step.Version, step.Name)
+		}
+	}
 }
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"html/template"
 	"net/http"
+	"sort"
 	"strings"
 	"time"
 
@@ -15,9 +16,19 @@ import (
 	"github.com/jmoiron/sqlx"
 	"github.com/velour/catbase/bot"
 	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/bot/schedule"
 	"github.com/velour/catbase/config"
 )
 
+func init() {
+	config.Declare(
+		config.Key{Name: "quietDuration", Type: config.Int, Default: "5", Min: 1, Max: 1440,
+			Description: "minutes I stay quiet when told to shut up"},
+		config.Key{Name: "Admin.MaxJobs", Type: config.Int, Default: "10", Min: 1, Max: 1000,
+			Description: "jobs listed by the jobs command"},
+	)
+}
+
 // This is a admin plugin to serve as an example and quick copy/paste for new plugins.
 
 type AdminPlugin struct {
@@ -36,18 +47,12 @@ func New(b bot.Bot) *AdminPlugin {
 		cfg: b.Config(),
 	}
 	b.Register(p, bot.Message, p.message)
-	b.Register(p, bot.Help, p.help)
+	b.Scheduler().Handle("admin.wake", p.wake)
+	p.registerCommands()
 	p.registerWeb()
 	return p
 }
 
-var forbiddenKeys = map[string]bool{
-	"twitch.authorization": true,
-	"twitch.clientid":      true,
-	"untappd.token":        true,
-	"slack.token":          true,
-}
-
 // Message responds to the bot hook on recieving messages.
 // This function returns true if the plugin responds in a meaningful way to the users message.
 // Otherwise, the function returns false and the bot continues execution of other plugins.
@@ -62,49 +67,530 @@ func (p *AdminPlugin) message(conn bot.Connector, k bot.Kind, message msg.Messag
 		return p.handleVariables(conn, message)
 	}
 
-	if !message.Command {
-		return false
+	return false
+}
+
+func (p *AdminPlugin) registerCommands() {
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern: "shut up",
+		Usage:   "keeps me quiet for a few minutes",
+		Handler: p.shutUp,
+	})
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern: "login",
+		Usage:   "sends you a private link that logs you in to the web pages",
+		Handler: p.login,
+	})
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern:    "set here {key} {value:text}",
+		Usage:      "changes a config value for this channel only",
+		Examples:   []string{"set here reaction.generalchance 0.5"},
+		Permission: "admin.set",
+		Handler:    p.setHere,
+	})
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern:    "get here {key}",
+		Usage:      "shows a config value as this channel sees it",
+		Permission: "admin.get",
+		Handler:    p.getHere,
+	})
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern:    "unset here {key}",
+		Usage:      "goes back to the global config value in this channel",
+		Permission: "admin.set",
+		Handler:    p.unsetHere,
+	})
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern:    "set {key} {value:text}",
+		Usage:      "changes a config value",
+		Examples:   []string{"set nick catbase"},
+		Permission: "admin.set",
+		Role:       bot.Admin,
+		Handler:    p.set,
+	})
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern:    "get {key}",
+		Usage:      "shows a config value",
+		Examples:   []string{"get nick"},
+		Permission: "admin.get",
+		Role:       bot.Trusted,
+		Handler:    p.get,
+	})
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern:    "config list {prefix?}",
+		Usage:      "lists the config keys plugins know about, their values and where they came from",
+		Examples:   []string{"config list", "config list factoid"},
+		Permission: "admin.get",
+		Handler:    p.listConfig,
+	})
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern:    "grant {role} to {who}",
+		Usage:      "gives somebody a role: trusted, moderator, admin or owner",
+		Examples:   []string{"grant moderator to alice"},
+		Permission: "admin.grant",
+		Role:       bot.Admin,
+		Handler:    p.grant,
+	})
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern:    "revoke {who}",
+		Usage:      "takes away somebody's role",
+		Permission: "admin.grant",
+		Handler:    p.revoke,
+	})
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern: "whoami",
+		Usage:   "shows who I think you are and your role",
+		Handler: func(conn bot.Connector, message msg.Message, args bot.Args) bool {
+			role := p.bot.Permissions().RoleOf(message)
+			p.bot.Send(conn, bot.Message, message.Channel, fmt.Sprintf("You are %s on %s and your role is %s.",
+				bot.UserKey(message), message.Connector, role))
+			return true
+		},
+	})
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern: "roles",
+		Usage:   "lists everybody who has been given a role",
+		Handler: p.listRoles,
+	})
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern: "jobs",
+		Usage:   "lists the scheduled jobs, soonest first",
+		Handler: p.listJobs,
+	})
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern:    "cancel job {name}",
+		Usage:      "stops a scheduled job",
+		Examples:   []string{"cancel job reminder.next"},
+		Permission: "admin.jobs",
+		Role:       bot.Admin,
+		Handler:    p.cancelJob,
+	})
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern:    "run job {name}",
+		Usage:      "runs a scheduled job right away",
+		Permission: "admin.jobs",
+		Role:       bot.Admin,
+		Handler:    p.runJob,
+	})
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern: "ignored",
+		Usage:   "lists who I'm ignoring for flooding",
+		Handler: p.listIgnored,
+	})
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern:    "forgive {who}",
+		Usage:      "stops ignoring someone for flooding",
+		Permission: "admin.forgive",
+		Role:       bot.Moderator,
+		Handler:    p.forgive,
+	})
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern: "plugins",
+		Usage:   "lists plugins that have failed or been disabled",
+		Handler: p.listPlugins,
+	})
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern:    "status",
+		Usage:      "says whether the database and every chat connection are working",
+		Permission: "admin.status",
+		Role:       bot.Trusted,
+		Handler:    p.status,
+	})
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern:    "enable plugin {name}",
+		Usage:      "turns a disabled plugin back on",
+		Examples:   []string{"enable plugin stock"},
+		Permission: "admin.plugins",
+		Role:       bot.Admin,
+		Handler:    p.enablePlugin,
+	})
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern:    "disable plugin {name}",
+		Usage:      "turns a plugin off",
+		Permission: "admin.plugins",
+		Role:       bot.Admin,
+		Handler:    p.disablePlugin,
+	})
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern:    "enable plugin {name} here",
+		Usage:      "turns a plugin on in this channel",
+		Examples:   []string{"enable plugin reaction here"},
+		Permission: "admin.plugins.channel",
+		Role:       bot.Moderator,
+		Handler:    p.enablePluginHere,
+	})
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern:    "disable plugin {name} here",
+		Usage:      "turns a plugin off in this channel",
+		Examples:   []string{"disable plugin emojifyme here"},
+		Permission: "admin.plugins.channel",
+		Handler:    p.disablePluginHere,
+	})
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern:  "{variable} = {value:text}",
+		Usage:    "adds a value to a $variable, or removes it with !=",
+		Examples: []string{"$color = blue", "$color != blue"},
+	})
+}
+
+func (p *AdminPlugin) shutUp(conn bot.Connector, message msg.Message, args bot.Args) bool {
+	dur := time.Duration(p.cfg.GetInt("quietDuration", 5)) * time.Minute
+	log.Info().Msgf("Going to sleep for %v, %v", dur, time.Now().Add(dur))
+	p.bot.Send(conn, bot.Message, message.Channel, "Okay. I'll be back later.")
+	p.quiet = true
+	if err := p.bot.Scheduler().Once("admin.wake", "admin.wake", time.Now().Add(dur), ""); err != nil {
+		log.Error().Err(err).Msg("Could not schedule waking up")
+	}
+	return true
+}
+
+func (p *AdminPlugin) login(conn bot.Connector, message msg.Message, args bot.Args) bool {
+	if message.Connector == bot.WebConnector {
+		p.bot.Send(conn, bot.Message, message.Channel, "You're already logged in.")
+		return true
+	}
+	link, err := p.bot.Accounts().LoginLink(message.Connector, bot.UserKey(message), message.User.Name)
+	if err != nil {
+		log.Error().Err(err).Msg("Could not make a login link")
+		p.bot.Send(conn, bot.Message, message.Channel, "I couldn't make you a login link.")
+		return true
+	}
+	if _, err := p.bot.Send(conn, bot.Message, bot.DMChannel(message), "Log in with "+link); err != nil {
+		log.Error().Err(err).Msg("Could not send a login link")
+		p.bot.Send(conn, bot.Message, message.Channel, "I couldn't send you a private message.")
+		return true
+	}
+	if !message.IsIM {
+		p.bot.Send(conn, bot.Message, message.Channel, "I sent you a login link.")
+	}
+	return true
+}
+
+func (p *AdminPlugin) wake(job schedule.Job) {
+	p.quiet = false
+	log.Info().Msg("Waking up from nap.")
+}
+
+func (p *AdminPlugin) listJobs(conn bot.Connector, message msg.Message, args bot.Args) bool {
+	jobs := p.bot.Scheduler().Upcoming()
+	if len(jobs) == 0 {
+		p.bot.Send(conn, bot.Message, message.Channel, "Nothing is scheduled.")
+		return true
+	}
+	max := p.cfg.GetInt("Admin.MaxJobs", 10)
+	out := "Upcoming jobs:"
+	for i, j := range jobs {
+		if i == max {
+			out += fmt.Sprintf("\n...%d more...", len(jobs)-max)
+			break
+		}
+		out += fmt.Sprintf("\n%s in %s", j.Name, time.Until(j.Next).Round(time.Second))
+	}
+	p.bot.Send(conn, bot.Message, message.Channel, out)
+	return true
+}
+
+func (p *AdminPlugin) cancelJob(conn bot.Connector, message msg.Message, args bot.Args) bool {
+	name := args.String("name")
+	if err := p.bot.Scheduler().Cancel(name); err != nil {
+		p.bot.Send(conn, bot.Message, message.Channel, fmt.Sprintf("I couldn't cancel %s: %s", name, err))
+		return true
+	}
+	p.bot.Send(conn, bot.Message, message.Channel, fmt.Sprintf("Cancelled %s.", name))
+	return true
+}
+
+func (p *AdminPlugin) runJob(conn bot.Connector, message msg.Message, args bot.Args) bool {
+	name := args.String("name")
+	if err := p.bot.Scheduler().RunNow(name); err != nil {
+		p.bot.Send(conn, bot.Message, message.Channel, fmt.Sprintf("I couldn't run %s: %s", name, err))
+		return true
+	}
+	p.bot.Send(conn, bot.Message, message.Channel, fmt.Sprintf("Running %s.", name))
+	return true
+}
+
+func (p *AdminPlugin) listIgnored(conn bot.Connector, message msg.Message, args bot.Args) bool {
+	users := p.bot.Limits().Ignoring()
+	if len(users) == 0 {
+		p.bot.Send(conn, bot.Message, message.Channel, "I'm not ignoring anybody.")
+		return true
+	}
+	out := "Ignoring:"
+	for _, u := range users {
+		out += fmt.Sprintf("\n%s (%s) for %s", u.Name, u.Key, time.Until(u.Until).Round(time.Second))
+	}
+	p.bot.Send(conn, bot.Message, message.Channel, out)
+	return true
+}
+
+func (p *AdminPlugin) forgive(conn bot.Connector, message msg.Message, args bot.Args) bool {
+	who := args.String("who")
+	if !p.bot.Limits().Forgive(who) {
+		p.bot.Send(conn, bot.Message, message.Channel, fmt.Sprintf("I'm not ignoring %s.", who))
+		return true
 	}
+	log.Info().Str("user", who).Str("by", bot.UserKey(message)).Msg("Forgave a flooding user")
+	p.bot.Send(conn, bot.Message, message.Channel, fmt.Sprintf("Okay, I'm listening to %s again.", who))
+	return true
+}
 
-	if strings.ToLower(body) == "shut up" {
-		dur := time.Duration(p.cfg.GetInt("quietDuration", 5)) * time.Minute
-		log.Info().Msgf("Going to sleep for %v, %v", dur, time.Now().Add(dur))
-		p.bot.Send(conn, bot.Message, message.Channel, "Okay. I'll be back later.")
-		p.quiet = true
-		go func() {
-			select {
-			case <-time.After(dur):
-				p.quiet = false
-				log.Info().Msg("Waking up from nap.")
-			}
-		}()
+func (p *AdminPlugin) set(conn bot.Connector, message msg.Message, args bot.Args) bool {
+	key := args.String("key")
+	// set here without a value lands here, and nobody means a key called here
+	if key == "here" {
+		p.bot.Send(conn, bot.Message, message.Channel, "To change a value for this channel, say set here <key> <value>")
 		return true
 	}
+	if config.IsSecret(key) {
+		p.bot.Send(conn, bot.Message, message.Channel, "You cannot access that key")
+		return true
+	}
+	if err := p.cfg.Set(key, args.String("value")); err != nil {
+		p.bot.Send(conn, bot.Message, message.Channel, fmt.Sprintf("I couldn't set %s: %s", key, err))
+		return true
+	}
+	p.bot.Send(conn, bot.Message, message.Channel, fmt.Sprintf("Set %s", key))
+	return true
+}
 
-	if strings.ToLower(body) == "password" {
-		p.bot.Send(conn, bot.Message, message.Channel, p.bot.GetPassword())
+func (p *AdminPlugin) get(conn bot.Connector, message msg.Message, args bot.Args) bool {
+	key := args.String("key")
+	if config.IsSecret(key) {
+		p.bot.Send(conn, bot.Message, message.Channel, "You cannot access that key")
 		return true
 	}
+	v := p.cfg.Get(key, "<unknown>")
+	p.bot.Send(conn, bot.Message, message.Channel, fmt.Sprintf("%s: %s", key, v))
+	return true
+}
 
-	parts := strings.Split(body, " ")
-	if parts[0] == "set" && len(parts) > 2 && forbiddenKeys[parts[1]] {
+func (p *AdminPlugin) setHere(conn bot.Connector, message msg.Message, args bot.Args) bool {
+	key := args.String("key")
+	if config.IsSecret(key) {
 		p.bot.Send(conn, bot.Message, message.Channel, "You cannot access that key")
 		return true
-	} else if parts[0] == "set" && len(parts) > 2 {
-		p.cfg.Set(parts[1], strings.Join(parts[2:], " "))
-		p.bot.Send(conn, bot.Message, message.Channel, fmt.Sprintf("Set %s", parts[1]))
+	}
+	if err := p.here(message).Set(key, args.String("value")); err != nil {
+		p.bot.Send(conn, bot.Message, message.Channel, fmt.Sprintf("I couldn't set %s: %s", key, err))
 		return true
 	}
-	if parts[0] == "get" && len(parts) == 2 && forbiddenKeys[parts[1]] {
+	p.bot.Send(conn, bot.Message, message.Channel, fmt.Sprintf("Set %s here", key))
+	return true
+}
+
+func (p *AdminPlugin) getHere(conn bot.Connector, message msg.Message, args bot.Args) bool {
+	key := args.String("key")
+	if config.IsSecret(key) {
 		p.bot.Send(conn, bot.Message, message.Channel, "You cannot access that key")
 		return true
-	} else if parts[0] == "get" && len(parts) == 2 {
-		v := p.cfg.Get(parts[1], "<unknown>")
-		p.bot.Send(conn, bot.Message, message.Channel, fmt.Sprintf("%s: %s", parts[1], v))
+	}
+	scope := p.here(message)
+	v := scope.Get(key, "<unknown>")
+	if !scope.Has(key) {
+		v += " (global)"
+	}
+	p.bot.Send(conn, bot.Message, message.Channel, fmt.Sprintf("%s: %s", key, v))
+	return true
+}
+
+func (p *AdminPlugin) unsetHere(conn bot.Connector, message msg.Message, args bot.Args) bool {
+	key := args.String("key")
+	if err := p.here(message).Unset(key); err != nil {
+		log.Error().Err(err).Msg("Could not unset scoped config")
+		p.bot.Send(conn, bot.Message, message.Channel, "I couldn't remove that.")
 		return true
 	}
+	p.bot.Send(conn, bot.Message, message.Channel, fmt.Sprintf("%s uses the global value here", key))
+	return true
+}
 
-	return false
+func (p *AdminPlugin) listConfig(conn bot.Connector, message msg.Message, args bot.Args) bool {
+	prefix := strings.ToLower(args.String("prefix"))
+	out := ""
+	for _, s := range p.cfg.Settings() {
+		if !strings.HasPrefix(strings.ToLower(s.Name), prefix) {
+			continue
+		}
+		value := s.Value
+		if s.Secret {
+			value = "<hidden>"
+		}
+		out += fmt.Sprintf("\n%s (%s): %s [%s]", s.Name, s.Type, value, s.Source)
+	}
+	if out == "" {
+		p.bot.Send(conn, bot.Message, message.Channel, "I don't know any keys like that.")
+		return true
+	}
+	p.bot.Send(conn, bot.Message, message.Channel, "Config:"+out)
+	return true
+}
+
+// here is the config of the channel a message came from
+func (p *AdminPlugin) here(message msg.Message) config.Scope {
+	return p.cfg.Scope(bot.Target(message.Connector, message.Channel))
+}
+
+// findUser turns a nick into the stable ID of someone who has spoken on this connector
+func (p *AdminPlugin) findUser(conn bot.Connector, message msg.Message, nick string) (string, bool) {
+	u, err := p.bot.MessageLog().FindUser(message.Connector, nick)
+	if err != nil {
+		p.bot.Send(conn, bot.Message, message.Channel, fmt.Sprintf("I haven't heard %s say anything.", nick))
+		return "", false
+	}
+	return bot.UserKey(msg.Message{User: &u}), true
+}
+
+func (p *AdminPlugin) grant(conn bot.Connector, message msg.Message, args bot.Args) bool {
+	perms := p.bot.Permissions()
+	roleName, nick := args.String("role"), args.String("who")
+	role, err := bot.ParseRole(roleName)
+	if err != nil {
+		p.bot.Send(conn, bot.Message, message.Channel, fmt.Sprintf("I don't know the %s role.", roleName))
+		return true
+	}
+	// only owners may hand out roles as powerful as their own
+	if mine := perms.RoleOf(message); role >= mine && mine != bot.Owner {
+		p.bot.Send(conn, bot.Message, message.Channel, bot.NoPermission)
+		return true
+	}
+	id, ok := p.findUser(conn, message, nick)
+	if !ok {
+		return true
+	}
+	if err := perms.Grant(message.Connector, id, role); err != nil {
+		log.Error().Err(err).Msg("Could not grant role")
+		p.bot.Send(conn, bot.Message, message.Channel, "I couldn't save that role.")
+		return true
+	}
+	p.bot.Send(conn, bot.Message, message.Channel, fmt.Sprintf("%s is now %s.", nick, role))
+	return true
+}
+
+func (p *AdminPlugin) revoke(conn bot.Connector, message msg.Message, args bot.Args) bool {
+	perms := p.bot.Permissions()
+	nick := args.String("who")
+	id, ok := p.findUser(conn, message, nick)
+	if !ok {
+		return true
+	}
+	if mine := perms.RoleOf(message); perms.Role(message.Connector, id) >= mine && mine != bot.Owner {
+		p.bot.Send(conn, bot.Message, message.Channel, bot.NoPermission)
+		return true
+	}
+	if err := perms.Revoke(message.Connector, id); err != nil {
+		log.Error().Err(err).Msg("Could not revoke role")
+		p.bot.Send(conn, bot.Message, message.Channel, "I couldn't remove that role.")
+		return true
+	}
+	p.bot.Send(conn, bot.Message, message.Channel, fmt.Sprintf("%s is nobody special now.", nick))
+	return true
+}
+
+func (p *AdminPlugin) listRoles(conn bot.Connector, message msg.Message, args bot.Args) bool {
+	grantees, err := p.bot.Permissions().Grantees()
+	if err != nil {
+		log.Error().Err(err).Msg("Could not list roles")
+		p.bot.Send(conn, bot.Message, message.Channel, "I couldn't find the roles.")
+		return true
+	}
+	if len(grantees) == 0 {
+		p.bot.Send(conn, bot.Message, message.Channel, "Nobody has been given a role.")
+		return true
+	}
+	out := "Roles:"
+	for _, g := range grantees {
+		out += fmt.Sprintf("\n%s: %s", bot.Target(g.Connector, g.UserID), g.Role)
+	}
+	p.bot.Send(conn, bot.Message, message.Channel, out)
+	return true
+}
+
+func (p *AdminPlugin) listPlugins(conn bot.Connector, message msg.Message, args bot.Args) bool {
+	out := ""
+	for _, s := range p.bot.Plugins() {
+		switch {
+		case s.Disabled:
+			out += fmt.Sprintf("\n%s: disabled after %d failures", s.Name, s.Total)
+		case s.Total > 0:
+			out += fmt.Sprintf("\n%s: %d failures", s.Name, s.Total)
+		case !p.bot.PluginEnabled(s.Name, bot.Target(message.Connector, message.Channel)):
+			out += fmt.Sprintf("\n%s: off here", s.Name)
+		}
+	}
+	if out == "" {
+		p.bot.Send(conn, bot.Message, message.Channel, "Every plugin is behaving.")
+		return true
+	}
+	p.bot.Send(conn, bot.Message, message.Channel, "Plugins:"+out)
+	return true
+}
+
+func (p *AdminPlugin) status(conn bot.Connector, message msg.Message, args bot.Args) bool {
+	h := p.bot.Health()
+	out := "Database: " + h.Database
+	names := []string{}
+	for name := range h.Connectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s := h.Connectors[name]
+		out += fmt.Sprintf("\n%s: %s", name, s.State)
+		if !s.LastEvent.IsZero() {
+			out += fmt.Sprintf(", last heard from %s ago", time.Since(s.LastEvent).Round(time.Second))
+		}
+		if s.LastError != "" {
+			out += fmt.Sprintf(", last error %s ago: %s", time.Since(s.ErrorTime).Round(time.Second), s.LastError)
+		}
+	}
+	if h.Ready {
+		out += "\nReady."
+	} else {
+		out += "\nNot ready: " + strings.Join(h.Problems, "; ")
+	}
+	p.bot.Send(conn, bot.Message, message.Channel, out)
+	return true
+}
+
+func (p *AdminPlugin) enablePlugin(conn bot.Connector, message msg.Message, args bot.Args) bool {
+	name := args.String("name")
+	if err := p.bot.EnablePlugin(name); err != nil {
+		p.bot.Send(conn, bot.Message, message.Channel, err.Error())
+		return true
+	}
+	p.bot.Send(conn, bot.Message, message.Channel, fmt.Sprintf("%s is back on.", name))
+	return true
+}
+
+func (p *AdminPlugin) disablePlugin(conn bot.Connector, message msg.Message, args bot.Args) bool {
+	name := args.String("name")
+	if err := p.bot.DisablePlugin(name); err != nil {
+		p.bot.Send(conn, bot.Message, message.Channel, err.Error())
+		return true
+	}
+	p.bot.Send(conn, bot.Message, message.Channel, fmt.Sprintf("%s is off.", name))
+	return true
+}
+
+func (p *AdminPlugin) enablePluginHere(conn bot.Connector, message msg.Message, args bot.Args) bool {
+	name := args.String("name")
+	if err := p.bot.EnablePluginIn(name, bot.Target(message.Connector, message.Channel)); err != nil {
+		p.bot.Send(conn, bot.Message, message.Channel, err.Error())
+		return true
+	}
+	p.bot.Send(conn, bot.Message, message.Channel, fmt.Sprintf("%s is on here.", name))
+	return true
+}
+
+func (p *AdminPlugin) disablePluginHere(conn bot.Connector, message msg.Message, args bot.Args) bool {
+	name := args.String("name")
+	if err := p.bot.DisablePluginIn(name, bot.Target(message.Connector, message.Channel)); err != nil {
+		p.bot.Send(conn, bot.Message, message.Channel, err.Error())
+		return true
+	}
+	p.bot.Send(conn, bot.Message, message.Channel, fmt.Sprintf("%s is off here.", name))
+	return true
 }
 
 func (p *AdminPlugin) handleVariables(conn bot.Connector, message msg.Message) bool {
@@ -132,7 +618,7 @@ func (p *AdminPlugin) handleVariables(conn bot.Connector, message msg.Message) b
 	value := strings.TrimSpace(parts[1])
 
 	var count int64
-	row := p.db.QueryRow(`select count(*) from variables where value = ?`, variable, value)
+	row := p.db.QueryRow(`select count(*) from variables where name = ? and value = ?`, variable, value)
 	err := row.Scan(&count)
 	if err != nil {
 		p.bot.Send(conn, bot.Message, message.Channel, "I'm broke and need attention in my variable creation code.")
@@ -154,25 +640,55 @@ func (p *AdminPlugin) handleVariables(conn bot.Connector, message msg.Message) b
 	return true
 }
 
-// Help responds to help requests. Every plugin must implement a help function.
-func (p *AdminPlugin) help(conn bot.Connector, kind bot.Kind, m msg.Message, args ...interface{}) bool {
-	p.bot.Send(conn, bot.Message, m.Channel, "This does super secret things that you're not allowed to know about.")
-	return true
-}
-
 func (p *AdminPlugin) registerWeb() {
 	http.HandleFunc("/vars/api", p.handleWebAPI)
 	http.HandleFunc("/vars", p.handleWeb)
 	p.bot.RegisterWeb("/vars", "Variables")
+	http.HandleFunc("/plugins/api", p.handlePluginsAPI)
+	http.HandleFunc("/plugins", p.handlePlugins)
+	p.bot.RegisterWeb("/plugins", "Plugins")
+	http.HandleFunc("/config/api", p.handleConfigAPI)
+	http.HandleFunc("/config", p.handleConfig)
+	p.bot.RegisterWeb("/config", "Config")
 }
 
 var tpl = template.Must(template.New("factoidIndex").Parse(varIndex))
+var pluginTpl = template.Must(template.New("pluginIndex").Parse(pluginIndex))
+var configTpl = template.Must(template.New("configIndex").Parse(configIndex))
 
 func (p *AdminPlugin) handleWeb(w http.ResponseWriter, r *http.Request) {
 	tpl.Execute(w, struct{ Nav []bot.EndPoint }{p.bot.GetWebNavigation()})
 }
 
 func (p *AdminPlugin) handleWebAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		info := struct {
+			Key   string
+			Value string
+		}{}
+		u, ok := p.bot.Accounts().Authorize(w, r, "admin.set")
+		if !ok {
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&info); err != nil {
+			w.WriteHeader(400)
+			fmt.Fprint(w, err)
+			return
+		}
+		if config.IsSecret(info.Key) {
+			w.WriteHeader(http.StatusForbidden)
+			j, _ := json.Marshal(struct{ Err string }{Err: "You cannot access that key"})
+			w.Write(j)
+			return
+		}
+		if err := p.cfg.Set(info.Key, info.Value); err != nil {
+			w.WriteHeader(400)
+			j, _ := json.Marshal(struct{ Err string }{Err: err.Error()})
+			w.Write(j)
+			return
+		}
+		log.Info().Str("user", u.Name).Str("key", info.Key).Msg("Config set from the web")
+	}
 	var configEntries []struct {
 		Key   string `json:"key"`
 		Value string `json:"value"`
@@ -188,6 +704,10 @@ func (p *AdminPlugin) handleWebAPI(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	for i, e := range configEntries {
+		if config.IsSecret(e.Key) {
+			configEntries[i].Value = "<hidden>"
+			continue
+		}
 		if strings.Contains(e.Value, ";;") {
 			e.Value = strings.ReplaceAll(e.Value, ";;", ", ")
 			e.Value = fmt.Sprintf("[%s]", e.Value)
@@ -197,3 +717,108 @@ func (p *AdminPlugin) handleWebAPI(w http.ResponseWriter, r *http.Request) {
 	j, _ := json.Marshal(configEntries)
 	fmt.Fprintf(w, "%s", j)
 }
+
+func (p *AdminPlugin) handlePlugins(w http.ResponseWriter, r *http.Request) {
+	pluginTpl.Execute(w, struct{ Nav []bot.EndPoint }{p.bot.GetWebNavigation()})
+}
+
+// channels lists the configured channels and every channel I have heard from
+func (p *AdminPlugin) channels() []string {
+	seen := map[string]bool{}
+	for _, target := range p.cfg.GetArray("channels", []string{}) {
+		seen[target] = true
+	}
+	logged, err := p.bot.MessageLog().Channels()
+	if err != nil {
+		log.Error().Err(err).Msg("Could not list logged channels")
+	}
+	for _, c := range logged {
+		seen[bot.Target(c.Connector, c.Channel)] = true
+	}
+	out := []string{}
+	for target := range seen {
+		out = append(out, target)
+	}
+	sort.Strings(out)
+	return out
+}
+
+type pluginState struct {
+	Name     string
+	Disabled bool
+	Failures int
+	// Enabled says whether the plugin is on in each channel
+	Enabled map[string]bool
+}
+
+func (p *AdminPlugin) handlePluginsAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		info := struct {
+			Plugin  string
+			Channel string
+			Enabled bool
+		}{}
+		u, ok := p.bot.Accounts().Authorize(w, r, "admin.plugins")
+		if !ok {
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&info); err != nil {
+			w.WriteHeader(400)
+			fmt.Fprint(w, err)
+			return
+		}
+		log.Info().
+			Str("user", u.Name).
+			Str("plugin", info.Plugin).
+			Str("channel", info.Channel).
+			Bool("enabled", info.Enabled).
+			Msg("Plugin toggled from the web")
+		var err error
+		if info.Enabled {
+			err = p.bot.EnablePluginIn(info.Plugin, info.Channel)
+		} else {
+			err = p.bot.DisablePluginIn(info.Plugin, info.Channel)
+		}
+		if err != nil {
+			w.WriteHeader(400)
+			j, _ := json.Marshal(struct{ Err string }{Err: err.Error()})
+			w.Write(j)
+			return
+		}
+	}
+
+	channels := p.channels()
+	plugins := []pluginState{}
+	for _, s := range p.bot.Plugins() {
+		state := pluginState{
+			Name:     s.Name,
+			Disabled: s.Disabled,
+			Failures: s.Total,
+			Enabled:  map[string]bool{},
+		}
+		for _, c := range channels {
+			state.Enabled[c] = p.bot.PluginEnabled(s.Name, c)
+		}
+		plugins = append(plugins, state)
+	}
+	j, _ := json.Marshal(struct {
+		Channels []string
+		Plugins  []pluginState
+	}{channels, plugins})
+	fmt.Fprintf(w, "%s", j)
+}
+
+func (p *AdminPlugin) handleConfig(w http.ResponseWriter, r *http.Request) {
+	configTpl.Execute(w, struct{ Nav []bot.EndPoint }{p.bot.GetWebNavigation()})
+}
+
+func (p *AdminPlugin) handleConfigAPI(w http.ResponseWriter, r *http.Request) {
+	settings := p.cfg.Settings()
+	for i, s := range settings {
+		if s.Secret {
+			settings[i].Value = "<hidden>"
+		}
+	}
+	j, _ := json.Marshal(settings)
+	fmt.Fprintf(w, "%s", j)
+}
@@ -4,11 +4,13 @@ import (
 	"github.com/velour/catbase/plugins/cli"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/velour/catbase/bot"
 	"github.com/velour/catbase/bot/msg"
 	"github.com/velour/catbase/bot/user"
+	"github.com/velour/catbase/config"
 )
 
 var (
@@ -19,7 +21,8 @@ var (
 func setup(t *testing.T) (*AdminPlugin, *bot.MockBot) {
 	mb = bot.NewMockBot()
 	a = New(mb)
-	mb.DB().MustExec(`delete from config`)
+	mb.DB().MustExec(`delete from config; delete from roles;`)
+	mb.Permissions().Grant("", "tester", bot.Admin)
 	return a, mb
 }
 
@@ -38,34 +41,170 @@ func makeMessage(payload string) (bot.Connector, bot.Kind, msg.Message) {
 }
 
 func TestSet(t *testing.T) {
-	a, mb := setup(t)
+	_, mb := setup(t)
 	expected := "test value"
-	a.message(makeMessage("!set test.key " + expected))
+	mb.Receive(makeMessage("!set test.key " + expected))
 	actual := mb.Config().Get("test.key", "ERR")
 	assert.Equal(t, expected, actual)
 }
 
 func TestGetValue(t *testing.T) {
-	a, mb := setup(t)
+	_, mb := setup(t)
 	expected := "value"
 	mb.Config().Set("test.key", "value")
-	a.message(makeMessage("!get test.key"))
+	mb.Receive(makeMessage("!get test.key"))
 	assert.Len(t, mb.Messages, 1)
 	assert.Contains(t, mb.Messages[0], expected)
 }
 
 func TestGetEmpty(t *testing.T) {
-	a, mb := setup(t)
+	_, mb := setup(t)
 	expected := "test.key: <unknown>"
-	a.message(makeMessage("!get test.key"))
+	mb.Receive(makeMessage("!get test.key"))
 	assert.Len(t, mb.Messages, 1)
 	assert.Equal(t, expected, mb.Messages[0])
 }
 
 func TestGetForbidden(t *testing.T) {
-	a, mb := setup(t)
+	_, mb := setup(t)
+	config.Declare(config.Key{Name: "slack.token", Secret: true})
 	expected := "cannot access"
-	a.message(makeMessage("!get slack.token"))
+	mb.Receive(makeMessage("!get slack.token"))
 	assert.Len(t, mb.Messages, 1)
 	assert.Contains(t, mb.Messages[0], expected)
 }
+
+func TestSetNeedsAdmin(t *testing.T) {
+	_, mb := setup(t)
+	mb.Permissions().Revoke("", "tester")
+	mb.Receive(makeMessage("!set test.key value"))
+	assert.Equal(t, "ERR", mb.Config().Get("test.key", "ERR"))
+	assert.Len(t, mb.Messages, 1)
+	assert.Equal(t, bot.NoPermission, mb.Messages[0])
+}
+
+func TestGrant(t *testing.T) {
+	_, mb := setup(t)
+	mb.MessageLog().Log(msg.Message{User: &user.User{ID: "friend", Name: "Friend"}, Channel: "test"})
+	mb.Receive(makeMessage("!grant moderator to friend"))
+	assert.Equal(t, bot.Moderator, mb.Permissions().Role("", "friend"))
+	mb.Receive(makeMessage("!revoke friend"))
+	assert.Equal(t, bot.Nobody, mb.Permissions().Role("", "friend"))
+}
+
+func TestGrantAboveOwnRole(t *testing.T) {
+	_, mb := setup(t)
+	mb.MessageLog().Log(msg.Message{User: &user.User{ID: "friend", Name: "friend"}, Channel: "test"})
+	mb.Receive(makeMessage("!grant admin to friend"))
+	assert.Equal(t, bot.Nobody, mb.Permissions().Role("", "friend"))
+	assert.Contains(t, mb.Messages, bot.NoPermission)
+}
+
+func TestHelpIsGenerated(t *testing.T) {
+	a, mb := setup(t)
+	help := mb.Help(a)
+	assert.Contains(t, help, "set <key> <value...> - changes a config value (admin only)")
+	assert.Contains(t, help, "e.g. grant moderator to alice")
+}
+
+func TestJobs(t *testing.T) {
+	_, mb := setup(t)
+	mb.DB().MustExec(`delete from schedule`)
+	mb.Scheduler().Once("test.job", "test", time.Now().Add(time.Hour), "")
+	mb.Receive(makeMessage("!jobs"))
+	assert.Len(t, mb.Messages, 1)
+	assert.Contains(t, mb.Messages[0], "test.job in 1h")
+	mb.Receive(makeMessage("!cancel job test.job"))
+	_, ok := mb.Scheduler().Get("test.job")
+	assert.False(t, ok)
+}
+
+func TestSetHere(t *testing.T) {
+	_, mb := setup(t)
+	mb.Config().Set("test.key", "global")
+	mb.Receive(makeMessage("!set here test.key local"))
+	assert.Equal(t, "global", mb.Config().Get("test.key", "ERR"))
+	assert.Equal(t, "local", mb.Config().Scope("test").Get("test.key", "ERR"))
+
+	mb.Receive(makeMessage("!unset here test.key"))
+	mb.Receive(makeMessage("!get here test.key"))
+	assert.Contains(t, mb.Messages[len(mb.Messages)-1], "global")
+}
+
+func TestSetHereNeedsAValue(t *testing.T) {
+	_, mb := setup(t)
+	mb.Receive(makeMessage("!set here test.key"))
+	assert.Contains(t, mb.Messages[0], "set here <key> <value>")
+	assert.Equal(t, "ERR", mb.Config().Get("here", "ERR"))
+}
+
+func TestDisablePluginHere(t *testing.T) {
+	_, mb := setup(t)
+	mb.Receive(makeMessage("!disable plugin reaction here"))
+	assert.False(t, mb.PluginEnabled("reaction", "test"))
+	assert.True(t, mb.PluginEnabled("reaction", "other"))
+	mb.Receive(makeMessage("!enable plugin reaction here"))
+	assert.True(t, mb.PluginEnabled("reaction", "test"))
+}
+
+func TestSetNotifies(t *testing.T) {
+	_, mb := setup(t)
+	got := ""
+	mb.Config().Subscribe("test.key", func(c config.Change) { got = c.Value })
+	mb.Receive(makeMessage("!set test.key changed"))
+	assert.Equal(t, "changed", got)
+}
+
+func TestSetRejectsBadValue(t *testing.T) {
+	_, mb := setup(t)
+	mb.Receive(makeMessage("!set quietDuration forever"))
+	assert.Contains(t, mb.Messages[0], "takes int values")
+	assert.Equal(t, "ERR", mb.Config().Get("quietDuration", "ERR"))
+}
+
+func TestConfigList(t *testing.T) {
+	_, mb := setup(t)
+	mb.Config().Set("Admin.MaxJobs", "3")
+	mb.Receive(makeMessage("!config list admin"))
+	assert.Len(t, mb.Messages, 1)
+	assert.Contains(t, mb.Messages[0], "Admin.MaxJobs (int): 3 [db]")
+}
+
+func TestStatus(t *testing.T) {
+	_, mb := setup(t)
+	mb.Statuses = map[string]bot.Status{
+		"irc": {State: bot.Reconnecting, LastError: "connection refused", ErrorTime: time.Now()},
+	}
+	mb.Receive(makeMessage("!status"))
+	assert.Len(t, mb.Messages, 1)
+	assert.Contains(t, mb.Messages[0], "Database: ok")
+	assert.Contains(t, mb.Messages[0], "irc: reconnecting")
+	assert.Contains(t, mb.Messages[0], "connection refused")
+	assert.Contains(t, mb.Messages[0], "Not ready: irc is reconnecting")
+}
+
+func TestLogin(t *testing.T) {
+	_, mb := setup(t)
+	mb.Receive(makeMessage("!login"))
+	assert.Len(t, mb.Messages, 2)
+	assert.Contains(t, mb.Messages[0], "/login?token=")
+	assert.Equal(t, "I sent you a login link.", mb.Messages[1])
+}
+
+func TestForgive(t *testing.T) {
+	_, mb := setup(t)
+	mb.Config().Set("flood.strikes", "1")
+	spam := msg.Message{User: &user.User{ID: "spammer", Name: "spammer"}, Connector: "irc", Channel: "test"}
+	cd := bot.Cooldown{Name: "spam", User: time.Minute}
+	mb.Limits().Allow(nil, spam, cd)
+	mb.Limits().Allow(nil, spam, cd)
+	assert.True(t, mb.Limits().Ignored(spam))
+
+	mb.Messages = nil
+	mb.Receive(makeMessage("!ignored"))
+	mb.Receive(makeMessage("!forgive spammer"))
+	assert.Len(t, mb.Messages, 2)
+	assert.Contains(t, mb.Messages[0], "spammer (irc:spammer)")
+	assert.Equal(t, "Okay, I'm listening to spammer again.", mb.Messages[1])
+	assert.False(t, mb.Limits().Ignored(spam))
+}
@@ -35,6 +35,11 @@ var varIndex = `
         {{ "{{ err }}" }}
     </b-alert>
     <b-container>
+        <b-form inline @submit.prevent="set" class="my-3">
+            <b-input v-model="key" placeholder="key" class="mr-2"></b-input>
+            <b-input v-model="value" placeholder="value" class="mr-2"></b-input>
+            <b-button type="submit" variant="primary">Set</b-button>
+        </b-form>
         <b-table
                 fixed
                 :items="vars"
@@ -50,6 +55,8 @@ var varIndex = `
             err: '',
 			nav: {{ .Nav }},
             vars: [],
+            key: '',
+            value: '',
             sortBy: 'key',
             fields: [
                 { key: { sortable: true } },
@@ -66,6 +73,110 @@ var varIndex = `
                         this.vars = resp.data;
                     })
                     .catch(err => this.err = err);
+            },
+            set: function() {
+                axios.post('/vars/api', {key: this.key, value: this.value})
+                    .then(resp => {
+                        this.vars = resp.data;
+                        this.err = '';
+                    })
+                    .catch(err => this.err = (err.response && err.response.data.Err) || err);
+            }
+        }
+    })
+</script>
+</body>
+</html>
+`
+
+var pluginIndex = `
+<!DOCTYPE html>
+<html lang="en">
+<head>
+    <!-- Load required Bootstrap and BootstrapVue CSS -->
+    <link type="text/css" rel="stylesheet" href="//unpkg.com/bootstrap/dist/css/bootstrap.min.css" />
+    <link type="text/css" rel="stylesheet" href="//unpkg.com/bootstrap-vue@latest/dist/bootstrap-vue.min.css" />
+
+    <!-- Load polyfills to support older browsers -->
+    <script src="//polyfill.io/v3/polyfill.min.js?features=es2015%2CMutationObserver"></script>
+
+    <!-- Load Vue followed by BootstrapVue -->
+    <script src="//unpkg.com/vue@latest/dist/vue.min.js"></script>
+    <script src="//unpkg.com/bootstrap-vue@latest/dist/bootstrap-vue.min.js"></script>
+    <script src="//unpkg.com/axios/dist/axios.min.js"></script>
+    <meta charset="UTF-8">
+    <title>Plugins</title>
+</head>
+<body>
+
+<div id="app">
+	<b-navbar>
+		<b-navbar-brand>Plugins</b-navbar-brand>
+		<b-navbar-nav>
+			<b-nav-item v-for="item in nav" :href="item.URL" :active="item.Name === 'Plugins'">{{ "{{ item.Name }}" }}</b-nav-item>
+		</b-navbar-nav>
+	</b-navbar>
+    <b-alert
+            dismissable
+            variant="error"
+            :show="err"
+            @dismissed="err = ''">
+        {{ "{{ err }}" }}
+    </b-alert>
+    <b-container>
+        <table class="table table-sm">
+            <thead>
+                <tr>
+                    <th>Plugin</th>
+                    <th v-for="channel in channels">{{ "{{ channel }}" }}</th>
+                </tr>
+            </thead>
+            <tbody>
+                <tr v-for="plugin in plugins">
+                    <td>
+                        {{ "{{ plugin.Name }}" }}
+                        <b-badge v-if="plugin.Disabled" variant="danger">disabled</b-badge>
+                        <b-badge v-else-if="plugin.Failures" variant="warning">{{ "{{ plugin.Failures }}" }} failures</b-badge>
+                    </td>
+                    <td v-for="channel in channels">
+                        <b-form-checkbox switch
+                                :checked="plugin.Enabled[channel]"
+                                @change="toggle(plugin.Name, channel, $event)"></b-form-checkbox>
+                    </td>
+                </tr>
+            </tbody>
+        </table>
+    </b-container>
+</div>
+
+<script>
+    var app = new Vue({
+        el: '#app',
+        data: {
+            err: '',
+            nav: {{ .Nav }},
+            channels: [],
+            plugins: []
+        },
+        mounted() {
+            axios.get('/plugins/api')
+                .then(resp => this.update(resp.data))
+                .catch(err => this.err = err);
+        },
+        methods: {
+            update: function(data) {
+                this.channels = data.Channels;
+                this.plugins = data.Plugins;
+                this.err = '';
+            },
+            toggle: function(plugin, channel, enabled) {
+                axios.post('/plugins/api',
+                    {plugin: plugin, channel: channel, enabled: enabled})
+                    .then(resp => this.update(resp.data))
+                    .catch(err => {
+                        this.err = (err.response && err.response.data.Err) || err;
+                        axios.get('/plugins/api').then(resp => this.plugins = resp.data.Plugins);
+                    });
             }
         }
     })
@@ -73,3 +184,77 @@ var varIndex = `
 </body>
 </html>
 `
+
+var configIndex = `
+<!DOCTYPE html>
+<html lang="en">
+<head>
+    <!-- Load required Bootstrap and BootstrapVue CSS -->
+    <link type="text/css" rel="stylesheet" href="//unpkg.com/bootstrap/dist/css/bootstrap.min.css" />
+    <link type="text/css" rel="stylesheet" href="//unpkg.com/bootstrap-vue@latest/dist/bootstrap-vue.min.css" />
+
+    <!-- Load polyfills to support older browsers -->
+    <script src="//polyfill.io/v3/polyfill.min.js?features=es2015%2CMutationObserver"></script>
+
+    <!-- Load Vue followed by BootstrapVue -->
+    <script src="//unpkg.com/vue@latest/dist/vue.min.js"></script>
+    <script src="//unpkg.com/bootstrap-vue@latest/dist/bootstrap-vue.min.js"></script>
+    <script src="//unpkg.com/axios/dist/axios.min.js"></script>
+    <meta charset="UTF-8">
+    <title>Config</title>
+</head>
+<body>
+
+<div id="app">
+	<b-navbar>
+		<b-navbar-brand>Config</b-navbar-brand>
+		<b-navbar-nav>
+			<b-nav-item v-for="item in nav" :href="item.URL" :active="item.Name === 'Config'">{{ "{{ item.Name }}" }}</b-nav-item>
+		</b-navbar-nav>
+	</b-navbar>
+    <b-alert
+            dismissable
+            variant="error"
+            :show="err"
+            @dismissed="err = ''">
+        {{ "{{ err }}" }}
+    </b-alert>
+    <b-container>
+        <b-form-input v-model="filter" placeholder="Filter"></b-form-input>
+        <b-table
+                small
+                :items="settings"
+                :filter="filter"
+                :sort-by.sync="sortBy"
+                :fields="fields"></b-table>
+    </b-container>
+</div>
+
+<script>
+    var app = new Vue({
+        el: '#app',
+        data: {
+            err: '',
+            nav: {{ .Nav }},
+            filter: '',
+            settings: [],
+            sortBy: 'Name',
+            fields: [
+                { key: 'Name', sortable: true },
+                'Type',
+                'Value',
+                { key: 'Source', sortable: true },
+                'Default',
+                'Description'
+            ]
+        },
+        mounted() {
+            axios.get('/config/api')
+                .then(resp => this.settings = resp.data)
+                .catch(err => this.err = err);
+        }
+    })
+</script>
+</body>
+</html>
+`
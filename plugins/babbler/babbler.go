@@ -13,9 +13,46 @@ import (
 
 	"github.com/jmoiron/sqlx"
 	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/backup"
+	"github.com/velour/catbase/bot/migrate"
 	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/config"
 )
 
+func init() {
+	backup.Register("babbler",
+		backup.Table{Name: "babblers"},
+		backup.Table{Name: "babblerWords"},
+		backup.Table{Name: "babblerNodes"},
+		backup.Table{Name: "babblerArcs"},
+	)
+	migrate.Register("babbler", migrate.Step{
+		Version: 1,
+		Name:    "create babbler tables",
+		SQL: `create table if not exists babblers (
+			id integer primary key,
+			babbler string
+		);
+		create table if not exists babblerWords (
+			id integer primary key,
+			word string
+		);
+		create table if not exists babblerNodes (
+			id integer primary key,
+			babblerId integer,
+			wordId integer,
+			root integer,
+			rootFrequency integer
+		);
+		create table if not exists babblerArcs (
+			id integer primary key,
+			fromNodeId integer,
+			toNodeId interger,
+			frequency integer
+		);`,
+	})
+}
+
 var (
 	NO_BABBLER   = errors.New("babbler not found")
 	SAID_NOTHING = errors.New("hasn't said anything yet")
@@ -54,38 +91,7 @@ type BabblerArc struct {
 }
 
 func New(b bot.Bot) *BabblerPlugin {
-	if _, err := b.DB().Exec(`create table if not exists babblers (
-			id integer primary key,
-			babbler string
-		);`); err != nil {
-		log.Fatal().Err(err)
-	}
-
-	if _, err := b.DB().Exec(`create table if not exists babblerWords (
-			id integer primary key,
-			word string
-		);`); err != nil {
-		log.Fatal().Err(err)
-	}
-
-	if _, err := b.DB().Exec(`create table if not exists babblerNodes (
-			id integer primary key,
-			babblerId integer,
-			wordId integer,
-			root integer,
-			rootFrequency integer
-		);`); err != nil {
-		log.Fatal().Err(err)
-	}
-
-	if _, err := b.DB().Exec(`create table if not exists babblerArcs (
-			id integer primary key,
-			fromNodeId integer,
-			toNodeId interger,
-			frequency integer
-		);`); err != nil {
-		log.Fatal().Err(err)
-	}
+	migrate.MustUp(b.DB(), "babbler")
 
 	plugin := &BabblerPlugin{
 		Bot:            b,
@@ -95,8 +101,9 @@ func New(b bot.Bot) *BabblerPlugin {
 
 	plugin.createNewWord("")
 
+	b.Permissions().Declare("babbler.merge", bot.Moderator)
 	b.Register(plugin, bot.Message, plugin.message)
-	b.Register(plugin, bot.Help, plugin.help)
+	plugin.registerCommands()
 
 	return plugin
 }
@@ -136,7 +143,11 @@ func (p *BabblerPlugin) message(c bot.Connector, kind bot.Kind, message msg.Mess
 	} else if strings.Index(lowercase, "batch learn for ") == 0 {
 		saidWhat, saidSomething = p.batchLearn(tokens)
 	} else if len(tokens) == 5 && strings.Index(lowercase, "merge babbler") == 0 {
-		saidWhat, saidSomething = p.merge(tokens)
+		if p.Bot.Permissions().Allowed(message, "babbler.merge") {
+			saidWhat, saidSomething = p.merge(tokens)
+		} else {
+			saidWhat, saidSomething = bot.NoPermission, true
+		}
 	} else {
 		//this should always return "", false
 		saidWhat, saidSomething = p.addToBabbler(message.User.Name, lowercase)
@@ -148,27 +159,40 @@ func (p *BabblerPlugin) message(c bot.Connector, kind bot.Kind, message msg.Mess
 	return saidSomething
 }
 
-func (p *BabblerPlugin) help(c bot.Connector, kind bot.Kind, msg msg.Message, args ...interface{}) bool {
-	commands := []string{
-		"initialize babbler for seabass",
-		"merge babbler drseabass into seabass",
-		"seabass says ...",
-		"seabass says-tail ...",
-		"seabass says-middle-out ...",
-		"seabass says-bridge ... | ...",
-	}
-	p.Bot.Send(c, bot.Message, msg.Channel, strings.Join(commands, "\n\n"))
-	return true
+func (p *BabblerPlugin) registerCommands() {
+	p.Bot.RegisterCommand(p, bot.Command{
+		Pattern:  "initialize babbler for {who}",
+		Usage:    "starts learning how somebody talks",
+		Examples: []string{"initialize babbler for seabass"},
+	})
+	p.Bot.RegisterCommand(p, bot.Command{
+		Pattern:  "merge babbler {from} into {to}",
+		Usage:    "folds one babbler into another",
+		Examples: []string{"merge babbler drseabass into seabass"},
+	})
+	p.Bot.RegisterCommand(p, bot.Command{
+		Pattern:  "{who} says {start:text?}",
+		Usage:    "makes up something somebody might say, starting with some words",
+		Examples: []string{"seabass says", "seabass says the boat"},
+	})
+	p.Bot.RegisterCommand(p, bot.Command{
+		Pattern: "{who} says-tail {end:text}",
+		Usage:   "makes up something that ends with some words",
+	})
+	p.Bot.RegisterCommand(p, bot.Command{
+		Pattern: "{who} says-middle-out {middle:text}",
+		Usage:   "makes up something around some words",
+	})
+	p.Bot.RegisterCommand(p, bot.Command{
+		Pattern:  "{who} says-bridge {start:text} | {end:text}",
+		Usage:    "makes up something that starts and ends with some words",
+		Examples: []string{"seabass says-bridge the | boat"},
+	})
 }
 
 func (p *BabblerPlugin) makeBabbler(name string) (*Babbler, error) {
-	res, err := p.db.Exec(`insert into babblers (babbler) values (?);`, name)
+	id, err := config.Insert(p.db, `insert into babblers (babbler) values (?);`, name)
 	if err == nil {
-		id, err := res.LastInsertId()
-		if err != nil {
-			log.Error().Err(err)
-			return nil, err
-		}
 		return &Babbler{
 			BabblerId: id,
 			Name:      name,
@@ -243,12 +267,7 @@ func (p *BabblerPlugin) getWord(word string) (*BabblerWord, error) {
 }
 
 func (p *BabblerPlugin) createNewWord(word string) (*BabblerWord, error) {
-	res, err := p.db.Exec(`insert into babblerWords (word) values (?);`, word)
-	if err != nil {
-		log.Error().Err(err)
-		return nil, err
-	}
-	id, err := res.LastInsertId()
+	id, err := config.Insert(p.db, `insert into babblerWords (word) values (?);`, word)
 	if err != nil {
 		log.Error().Err(err)
 		return nil, err
@@ -294,13 +313,7 @@ func (p *BabblerPlugin) createBabblerNode(babbler *Babbler, word string) (*Babbl
 		return nil, err
 	}
 
-	res, err := p.db.Exec(`insert into babblerNodes (babblerId, wordId, root, rootFrequency) values (?, ?, 0, 0)`, babbler.BabblerId, w.WordId)
-	if err != nil {
-		log.Error().Err(err)
-		return nil, err
-	}
-
-	id, err := res.LastInsertId()
+	id, err := config.Insert(p.db, `insert into babblerNodes (babblerId, wordId, root, rootFrequency) values (?, ?, 0, 0)`, babbler.BabblerId, w.WordId)
 	if err != nil {
 		log.Error().Err(err)
 		return nil, err
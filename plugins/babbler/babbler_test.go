@@ -282,6 +282,8 @@ func TestBabblerMerge(t *testing.T) {
 	mb := bot.NewMockBot()
 	bp := newBabblerPlugin(mb)
 	assert.NotNil(t, bp)
+	mb.Permissions().Grant("", "tester", bot.Moderator)
+	defer mb.Permissions().Revoke("", "tester")
 
 	c, k, seabass := makeMessage("<seabass> This is a message")
 	seabass.User = &user.User{Name: "seabass"}
@@ -307,11 +309,18 @@ func TestBabblerMerge(t *testing.T) {
 	assert.Contains(t, mb.Messages[1], "message")
 }
 
+func TestBabblerMergeNeedsModerator(t *testing.T) {
+	mb := bot.NewMockBot()
+	bp := newBabblerPlugin(mb)
+	res := bp.message(makeMessage("!merge babbler seabass into seabass2"))
+	assert.True(t, res)
+	assert.Len(t, mb.Messages, 1)
+	assert.Equal(t, bot.NoPermission, mb.Messages[0])
+}
+
 func TestHelp(t *testing.T) {
 	mb := bot.NewMockBot()
 	bp := newBabblerPlugin(mb)
 	assert.NotNil(t, bp)
-	c := &cli.CliPlugin{}
-	bp.help(c, bot.Help, msg.Message{Channel: "channel"}, []string{})
-	assert.Len(t, mb.Messages, 1)
+	assert.Contains(t, mb.Help(bp), "<who> says [<start...>]")
 }
@@ -16,10 +16,32 @@ import (
 	"github.com/jmoiron/sqlx"
 	"github.com/rs/zerolog/log"
 	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/migrate"
 	"github.com/velour/catbase/bot/msg"
-	"github.com/velour/catbase/plugins/counter"
+	"github.com/velour/catbase/bot/schedule"
+	"github.com/velour/catbase/config"
 )
 
+func init() {
+	migrate.Register("beers", migrate.Step{
+		Version: 1,
+		Name:    "create untappd table",
+		SQL: `create table if not exists untappd (
+			id integer primary key,
+			untappdUser string,
+			channel string,
+			lastCheckin integer,
+			chanNick string
+		);`,
+	})
+	config.Declare(
+		config.Key{Name: "Untappd.Freq", Type: config.Int, Default: "120", Min: 0, Max: 86400,
+			Description: "seconds between untappd checks, 0 to stop checking"},
+		config.Key{Name: "Untappd.Channels", Type: config.Array, Description: "targets that hear about checkins"},
+		config.Key{Name: "Untappd.Token", Secret: true, Description: "untappd API token"},
+	)
+}
+
 // This is a skeleton plugin to serve as an example and quick copy/paste for new plugins.
 
 const itemName = ":beer:"
@@ -39,24 +61,33 @@ type untappdUser struct {
 
 // New BeersPlugin creates a new BeersPlugin with the Plugin interface
 func New(b bot.Bot) *BeersPlugin {
-	if _, err := b.DB().Exec(`create table if not exists untappd (
-			id integer primary key,
-			untappdUser string,
-			channel string,
-			lastCheckin integer,
-			chanNick string
-		);`); err != nil {
-		log.Fatal().Err(err)
-	}
+	migrate.MustUp(b.DB(), "beers")
 	p := &BeersPlugin{
 		Bot: b,
 		db:  b.DB(),
 	}
-	for _, channel := range b.Config().GetArray("Untappd.Channels", []string{}) {
-		go p.untappdLoop(b.DefaultConnector(), channel)
+	b.Scheduler().Handle("beers.untappd", p.untappdLoop)
+	frequency := time.Duration(b.Config().GetInt("Untappd.Freq", 120)) * time.Second
+	checked := []string{}
+	for _, target := range b.Config().GetArray("Untappd.Channels", []string{}) {
+		if c, _ := b.ResolveTarget(target); c == nil {
+			log.Error().Msgf("Unknown connector for untappd channel %s", target)
+			continue
+		}
+		if frequency == 0 {
+			continue
+		}
+		if err := b.Scheduler().Every("beers.untappd:"+target, "beers.untappd", frequency, frequency/10, target); err != nil {
+			log.Error().Err(err).Msgf("Could not schedule untappd checks for %s", target)
+		}
+		checked = append(checked, target)
+	}
+	if err := b.Scheduler().Prune("beers.untappd", checked); err != nil {
+		log.Error().Err(err).Msg("Could not cancel old untappd checks")
 	}
+	log.Info().Msgf("Checking untappd every %v", frequency)
 	b.Register(p, bot.Message, p.message)
-	b.Register(p, bot.Help, p.help)
+	p.registerCommands()
 	return p
 }
 
@@ -93,7 +124,7 @@ func (p *BeersPlugin) message(c bot.Connector, kind bot.Kind, message msg.Messag
 				return true
 			}
 			if parts[1] == "+=" {
-				p.addBeers(nick, count)
+				p.checkIn(nick, count, false, bot.Target(message.Connector, channel))
 				p.randomReply(c, channel)
 			} else if parts[1] == "=" {
 				if count == 0 {
@@ -124,7 +155,7 @@ func (p *BeersPlugin) message(c bot.Connector, kind bot.Kind, message msg.Messag
 	}
 
 	if message.Command && parts[0] == "imbibe" {
-		p.addBeers(nick, 1)
+		p.checkIn(nick, 1, false, bot.Target(message.Connector, channel))
 		p.randomReply(c, channel)
 		return true
 	}
@@ -181,7 +212,7 @@ func (p *BeersPlugin) message(c bot.Connector, kind bot.Kind, message msg.Messag
 
 		p.Bot.Send(c, bot.Message, channel, "I'll be watching you.")
 
-		p.checkUntappd(c, channel)
+		p.checkUntappd(c, channel, bot.Target(message.Connector, channel))
 
 		return true
 	}
@@ -190,46 +221,65 @@ func (p *BeersPlugin) message(c bot.Connector, kind bot.Kind, message msg.Messag
 		log.Info().
 			Str("user", message.User.Name).
 			Msgf("Checking untappd at request of user.")
-		p.checkUntappd(c, channel)
+		p.checkUntappd(c, channel, bot.Target(message.Connector, channel))
 		return true
 	}
 
 	return false
 }
 
-// Help responds to help requests. Every plugin must implement a help function.
-func (p *BeersPlugin) help(c bot.Connector, kind bot.Kind, message msg.Message, args ...interface{}) bool {
-	msg := "Beers: imbibe by using either beers +=,=,++ or with the !imbibe/drink " +
-		"commands. I'll keep a count of how many beers you've had and then if you want " +
-		"to reset, just !puke it all up!"
-	p.Bot.Send(c, bot.Message, message.Channel, msg)
-	return true
-}
-
-func getUserBeers(db *sqlx.DB, user string) counter.Item {
-	booze, _ := counter.GetItem(db, user, itemName)
-	return booze
+func (p *BeersPlugin) registerCommands() {
+	p.Bot.RegisterCommand(p, bot.Command{
+		Pattern: "beers {who?}",
+		Usage:   "shows how many beers you, or somebody, have had",
+	})
+	p.Bot.RegisterCommand(p, bot.Command{
+		Pattern:  "beers += {n:int}",
+		Usage:    "counts more beers",
+		Examples: []string{"beers += 2"},
+	})
+	p.Bot.RegisterCommand(p, bot.Command{
+		Pattern: "beers = {n:int}",
+		Usage:   "sets how many beers you have had",
+	})
+	p.Bot.RegisterCommand(p, bot.Command{
+		Pattern: "imbibe",
+		Usage:   "counts one beer",
+	})
+	p.Bot.RegisterCommand(p, bot.Command{
+		Pattern: "puke",
+		Usage:   "resets your beers",
+	})
+	p.Bot.RegisterCommand(p, bot.Command{
+		Pattern: "reguntappd {untappd} {nick?}",
+		Usage:   "checks your untappd account for beers",
+	})
+	p.Bot.RegisterCommand(p, bot.Command{
+		Pattern: "checkuntappd",
+		Usage:   "checks untappd for beers now",
+	})
 }
 
 func (p *BeersPlugin) setBeers(user string, amount int) {
-	ub := getUserBeers(p.db, user)
-	err := ub.Update(amount)
-	if err != nil {
-		log.Error().Err(err).Msgf("Error saving beers")
-	}
+	p.Bot.Publish(bot.UpdateCounter{Nick: user, Item: itemName, Set: true, Value: amount})
 }
 
 func (p *BeersPlugin) addBeers(user string, delta int) {
-	ub := getUserBeers(p.db, user)
-	err := ub.UpdateDelta(delta)
-	if err != nil {
-		log.Error().Err(err).Msgf("Error saving beers")
-	}
+	p.Bot.Publish(bot.UpdateCounter{Nick: user, Item: itemName, Delta: delta})
+}
+
+// checkIn counts beers someone drank, tells the other plugins and gives their new total
+func (p *BeersPlugin) checkIn(nick string, count int, untappd bool, target string) int {
+	p.addBeers(nick, count)
+	total := p.getBeers(nick)
+	p.Bot.Publish(bot.BeerCheckedIn{Nick: nick, Count: count, Total: total, Untappd: untappd, Target: target})
+	return total
 }
 
 func (p *BeersPlugin) getBeers(nick string) int {
-	ub := getUserBeers(p.db, nick)
-	return ub.Count
+	count := 0
+	p.Bot.Publish(bot.UpdateCounter{Nick: nick, Item: itemName, Result: &count})
+	return count
 }
 
 func (p *BeersPlugin) reportCount(c bot.Connector, nick, channel string, himself bool) {
@@ -343,7 +393,7 @@ func (p *BeersPlugin) pullUntappd() ([]checkin, error) {
 	return beers.Response.Checkins.Items, nil
 }
 
-func (p *BeersPlugin) checkUntappd(c bot.Connector, channel string) {
+func (p *BeersPlugin) checkUntappd(c bot.Connector, channel, target string) {
 	token := p.Bot.Config().Get("Untappd.Token", "NONE")
 	if token == "NONE" {
 		log.Info().
@@ -395,8 +445,7 @@ func (p *BeersPlugin) checkUntappd(c bot.Connector, channel string) {
 		log.Debug().
 			Msgf("user.chanNick: %s, user.untappdUser: %s, checkin.User.User_name: %s",
 				user.chanNick, user.untappdUser, checkin.User.User_name)
-		p.addBeers(user.chanNick, 1)
-		drunken := p.getBeers(user.chanNick)
+		drunken := p.checkIn(user.chanNick, 1, true, target)
 
 		msg := fmt.Sprintf("%s just drank %s by %s%s, bringing his drunkeness to %d",
 			user.chanNick, beerName, breweryName, venue, drunken)
@@ -438,16 +487,11 @@ func (p *BeersPlugin) checkUntappd(c bot.Connector, channel string) {
 	}
 }
 
-func (p *BeersPlugin) untappdLoop(c bot.Connector, channel string) {
-	frequency := p.Bot.Config().GetInt("Untappd.Freq", 120)
-	if frequency == 0 {
+// untappdLoop runs every Untappd.Freq seconds for each untappd channel
+func (p *BeersPlugin) untappdLoop(job schedule.Job) {
+	c, channel := p.Bot.ResolveTarget(job.Payload)
+	if c == nil {
 		return
 	}
-
-	log.Info().Msgf("Checking every %v seconds", frequency)
-
-	for {
-		time.Sleep(time.Duration(frequency) * time.Second)
-		p.checkUntappd(c, channel)
-	}
+	p.checkUntappd(c, channel, job.Payload)
 }
@@ -123,6 +123,5 @@ func TestBeersReport(t *testing.T) {
 
 func TestHelp(t *testing.T) {
 	b, mb := makeBeersPlugin(t)
-	b.help(&cli.CliPlugin{}, bot.Help, msg.Message{Channel: "channel"}, []string{})
-	assert.Len(t, mb.Messages, 1)
+	assert.Contains(t, mb.Help(b), "imbibe - counts one beer")
 }
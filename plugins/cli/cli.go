@@ -9,7 +9,6 @@ import (
 	"github.com/rs/zerolog/log"
 	"github.com/velour/catbase/bot"
 	"github.com/velour/catbase/bot/msg"
-	"github.com/velour/catbase/bot/user"
 	"html/template"
 	"net/http"
 	"time"
@@ -22,6 +21,7 @@ type CliPlugin struct {
 	counter int
 }
 
+// New makes the web console, which main adds as the cli connector when type lists it
 func New(b bot.Bot) *CliPlugin {
 	cp := &CliPlugin{
 		bot: b,
@@ -41,10 +41,13 @@ func (p *CliPlugin) handleWebAPI(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintf(w, "Incorrect HTTP method")
 		return
 	}
+	u, ok := p.bot.Accounts().Authorize(w, r, "")
+	if !ok {
+		return
+	}
 	info := struct {
-		User     string `json:"user"`
-		Payload  string `json:"payload"`
-		Password string `json:"password"`
+		User    string `json:"user"`
+		Payload string `json:"payload"`
 	}{}
 	decoder := json.NewDecoder(r.Body)
 	err := decoder.Decode(&info)
@@ -56,19 +59,9 @@ func (p *CliPlugin) handleWebAPI(w http.ResponseWriter, r *http.Request) {
 	log.Debug().
 		Interface("postbody", info).
 		Msg("Got a POST")
-	if info.Password != p.bot.GetPassword() {
-		w.WriteHeader(http.StatusForbidden)
-		j, _ := json.Marshal(struct{ Err string }{Err: "Invalid Password"})
-		w.Write(j)
-		return
-	}
 
 	p.bot.Receive(p, bot.Message, msg.Message{
-		User: &user.User{
-			ID:    info.User,
-			Name:  info.User,
-			Admin: false,
-		},
+		User:    u.User(),
 		Channel: "web",
 		Body:    info.Payload,
 		Raw:     info.Payload,
@@ -92,7 +85,11 @@ func (p *CliPlugin) handleWebAPI(w http.ResponseWriter, r *http.Request) {
 var tpl = template.Must(template.New("factoidIndex").Parse(indexHTML))
 
 func (p *CliPlugin) handleWeb(w http.ResponseWriter, r *http.Request) {
-	tpl.Execute(w, struct{ Nav []bot.EndPoint }{p.bot.GetWebNavigation()})
+	u, _ := p.bot.Accounts().Session(r)
+	tpl.Execute(w, struct {
+		Nav  []bot.EndPoint
+		User string
+	}{p.bot.GetWebNavigation(), u.Name})
 }
 
 // Completing the Connector interface, but will not actually be a connector
@@ -114,4 +111,5 @@ func (p *CliPlugin) Send(kind bot.Kind, args ...interface{}) (string, error) {
 }
 func (p *CliPlugin) GetEmojiList() map[string]string { return nil }
 func (p *CliPlugin) Serve() error                    { return nil }
+func (p *CliPlugin) Status() bot.Status              { return bot.Status{State: bot.Connected} }
 func (p *CliPlugin) Who(s string) []string           { return nil }
@@ -34,9 +34,8 @@ var indexHTML = `
         {{ "{{ err }}" }}
     </b-alert>
     <b-container>
-		<b-row>
-			<b-col cols="5">Password:</b-col>
-			<b-col><b-input v-model="answer"></b-col>
+		<b-row v-if="!authenticated" class="my-2">
+			Say login to me in chat to get a link that logs you in.
 		</b-row>
         <b-row>
             <b-form-textarea
@@ -53,12 +52,6 @@ var indexHTML = `
             <b-form
                 @submit="send">
                 <b-row>
-                <b-col>
-                    <b-form-input
-                            type="text"
-                            placeholder="Username"
-                            v-model="user"></b-form-input>
-                </b-col>
                 <b-col>
                     <b-form-input
                             type="text"
@@ -81,10 +74,9 @@ var indexHTML = `
         data: {
             err: '',
 			nav: {{ .Nav }},
-            answer: '',
             correct: 0,
             textarea: [],
-            user: '',
+            user: {{ .User }},
             input: '',
         },
         computed: {
@@ -110,7 +102,7 @@ var indexHTML = `
                 if (!this.authenticated) {
                     return;
                 }
-                const payload = {user: this.user, payload: this.input, password: this.answer};
+                const payload = {payload: this.input};
                 this.addText(this.user, this.input);
 				this.input = "";
                 axios.post('/cli/api', payload)
@@ -119,7 +111,7 @@ var indexHTML = `
                         this.addText(data.user, data.payload.trim());
 						this.err = '';
                     })
-                    .catch(err => (this.err = err));
+                    .catch(err => (this.err = (err.response && err.response.data.Err) || err));
             }
         }
     })
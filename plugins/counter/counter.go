@@ -15,9 +15,38 @@ import (
 
 	"github.com/jmoiron/sqlx"
 	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/backup"
+	"github.com/velour/catbase/bot/migrate"
 	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/config"
 )
 
+func init() {
+	backup.Register("counter", backup.Table{Name: "counter"}, backup.Table{Name: "counter_alias"})
+	migrate.Register("counter",
+		migrate.Step{
+			Version: 1,
+			Name:    "create counter tables",
+			SQL: `create table if not exists counter (
+				id integer primary key,
+				nick string,
+				item string,
+				count integer
+			);
+			create table if not exists counter_alias (
+				id integer PRIMARY KEY AUTOINCREMENT,
+				item string NOT NULL UNIQUE,
+				points_to string NOT NULL
+			);`,
+		},
+		migrate.Step{
+			Version: 2,
+			Name:    "index counters by nick and item",
+			SQL:     `create index if not exists counter_nick_item on counter (nick, item);`,
+		},
+	)
+}
+
 // This is a counter plugin to count arbitrary things.
 
 var teaMatcher = regexp.MustCompile("(?i)^([^.]+)\\. [^.]*\\. ([^.]*\\.?)+$")
@@ -61,7 +90,7 @@ func GetAllItems(db *sqlx.DB) ([]Item, error) {
 // GetItems returns all counters for a subject
 func GetItems(db *sqlx.DB, nick string) ([]Item, error) {
 	var items []Item
-	err := db.Select(&items, `select * from counter where nick = ?`, nick)
+	err := db.Select(&items, `select * from counter where nick = ? order by id`, nick)
 	if err != nil {
 		return nil, err
 	}
@@ -73,7 +102,11 @@ func GetItems(db *sqlx.DB, nick string) ([]Item, error) {
 }
 
 func LeaderAll(db *sqlx.DB) ([]Item, error) {
-	s := `select id,item,nick,max(count) as count from counter group by item having count(nick) > 1 and max(count) > 1 order by count desc`
+	s := `select id, item, nick, count from counter c
+		where id = (select id from counter where item = c.item order by count desc, id limit 1)
+		and count > 1
+		and (select count(nick) from counter where item = c.item) > 1
+		order by count desc`
 	var items []Item
 	err := db.Select(&items, s)
 	if err != nil {
@@ -102,7 +135,7 @@ func Leader(db *sqlx.DB, itemName string) ([]Item, error) {
 func MkAlias(db *sqlx.DB, item, pointsTo string) (*alias, error) {
 	item = strings.ToLower(item)
 	pointsTo = strings.ToLower(pointsTo)
-	res, err := db.Exec(`insert into counter_alias (item, points_to) values (?, ?)`,
+	id, err := config.Insert(db, `insert into counter_alias (item, points_to) values (?, ?)`,
 		item, pointsTo)
 	if err != nil {
 		_, err := db.Exec(`update counter_alias set points_to=? where item=?`, pointsTo, item)
@@ -115,7 +148,6 @@ func MkAlias(db *sqlx.DB, item, pointsTo string) (*alias, error) {
 		}
 		return &a, nil
 	}
-	id, _ := res.LastInsertId()
 
 	return &alias{db, id, item, pointsTo}, nil
 }
@@ -152,12 +184,11 @@ func GetItem(db *sqlx.DB, nick, itemName string) (Item, error) {
 
 // Create saves a counter
 func (i *Item) Create() error {
-	res, err := i.Exec(`insert into counter (nick, item, count) values (?, ?, ?);`,
+	id, err := config.Insert(i.DB, `insert into counter (nick, item, count) values (?, ?, ?);`,
 		i.Nick, i.Item, i.Count)
 	if err != nil {
 		return err
 	}
-	id, _ := res.LastInsertId()
 	// hackhackhack?
 	i.ID = id
 	return err
@@ -195,27 +226,57 @@ func (i *Item) Delete() error {
 	return err
 }
 
+// updateDelta changes an item and tells the other plugins
+func (p *CounterPlugin) updateDelta(item *Item, delta int) {
+	if err := item.UpdateDelta(delta); err != nil {
+		log.Error().Err(err).Interface("item", item).Msg("Error updating item")
+		return
+	}
+	p.Bot.Publish(bot.CounterChanged{Nick: item.Nick, Item: item.Item, Count: item.Count, Delta: delta})
+}
+
+// update changes a counter another plugin asked for on the bus
+func (p *CounterPlugin) update(evt bot.BusEvent) {
+	u := evt.(bot.UpdateCounter)
+	item, err := GetItem(p.DB, u.Nick, u.Item)
+	if err != nil {
+		log.Error().Err(err).Msgf("Could not find %s's %s", u.Nick, u.Item)
+		return
+	}
+	delta := u.Delta
+	if u.Set {
+		delta = u.Value - item.Count
+	}
+	if delta != 0 {
+		p.updateDelta(&item, delta)
+	}
+	if u.Result != nil {
+		*u.Result = item.Count
+	}
+}
+
+// delete removes an item and tells the other plugins
+func (p *CounterPlugin) delete(item *Item) error {
+	count := item.Count
+	if err := item.Delete(); err != nil {
+		return err
+	}
+	p.Bot.Publish(bot.CounterChanged{Nick: item.Nick, Item: item.Item, Count: 0, Delta: -count})
+	return nil
+}
+
 // NewCounterPlugin creates a new CounterPlugin with the Plugin interface
 func New(b bot.Bot) *CounterPlugin {
-	tx := b.DB().MustBegin()
-	b.DB().MustExec(`create table if not exists counter (
-			id integer primary key,
-			nick string,
-			item string,
-			count integer
-		);`)
-	b.DB().MustExec(`create table if not exists counter_alias (
-			id integer PRIMARY KEY AUTOINCREMENT,
-			item string NOT NULL UNIQUE,
-			points_to string NOT NULL
-		);`)
-	tx.Commit()
+	migrate.MustUp(b.DB(), "counter")
 	cp := &CounterPlugin{
 		Bot: b,
 		DB:  b.DB(),
 	}
+	// changing somebody else's counters from the web pages
+	b.Permissions().Declare("counter.others", bot.Trusted)
 	b.Register(cp, bot.Message, cp.message)
-	b.Register(cp, bot.Help, cp.help)
+	b.Subscribe(cp, bot.UpdateCounter{}.Topic(), cp.update)
+	cp.registerCommands()
 	cp.registerWeb()
 	return cp
 }
@@ -234,171 +295,9 @@ func (p *CounterPlugin) message(c bot.Connector, kind bot.Kind, message msg.Mess
 		return false
 	}
 
-	if len(parts) == 3 && strings.ToLower(parts[0]) == "mkalias" {
-		if _, err := MkAlias(p.DB, parts[1], parts[2]); err != nil {
-			log.Error().Err(err)
-			return false
-		}
-		p.Bot.Send(c, bot.Message, channel, fmt.Sprintf("Created alias %s -> %s",
-			parts[1], parts[2]))
-		return true
-	} else if strings.ToLower(parts[0]) == "leaderboard" {
-		var cmd func() ([]Item, error)
-		itNameTxt := ""
-
-		if len(parts) == 1 {
-			cmd = func() ([]Item, error) { return LeaderAll(p.DB) }
-		} else {
-			itNameTxt = fmt.Sprintf(" for %s", parts[1])
-			cmd = func() ([]Item, error) { return Leader(p.DB, parts[1]) }
-		}
-
-		its, err := cmd()
-		if err != nil {
-			log.Error().Err(err)
-			return false
-		} else if len(its) == 0 {
-			return false
-		}
-
-		out := fmt.Sprintf("Leaderboard%s:\n", itNameTxt)
-		for _, it := range its {
-			out += fmt.Sprintf("%s with %d %s\n",
-				it.Nick,
-				it.Count,
-				it.Item,
-			)
-		}
-		p.Bot.Send(c, bot.Message, channel, out)
-		return true
-	} else if match := teaMatcher.MatchString(message.Body); match {
+	if match := teaMatcher.MatchString(message.Body); match {
 		// check for tea match TTT
 		return p.checkMatch(c, message)
-	} else if message.Command && message.Body == "reset me" {
-		items, err := GetItems(p.DB, strings.ToLower(nick))
-		if err != nil {
-			log.Error().
-				Err(err).
-				Str("nick", nick).
-				Msg("Error getting items to reset")
-			p.Bot.Send(c, bot.Message, channel, "Something is technically wrong with your counters.")
-			return true
-		}
-		log.Debug().Msgf("Items: %+v", items)
-		for _, item := range items {
-			item.Delete()
-		}
-		p.Bot.Send(c, bot.Message, channel, fmt.Sprintf("%s, you are as new, my son.", nick))
-		return true
-	} else if message.Command && parts[0] == "inspect" && len(parts) == 2 {
-		var subject string
-
-		if parts[1] == "me" {
-			subject = strings.ToLower(nick)
-		} else {
-			subject = strings.ToLower(parts[1])
-		}
-
-		log.Debug().
-			Str("subject", subject).
-			Msg("Getting counter")
-		// pull all of the items associated with "subject"
-		items, err := GetItems(p.DB, subject)
-		if err != nil {
-			log.Error().
-				Err(err).
-				Str("subject", subject).
-				Msg("Error retrieving items")
-			p.Bot.Send(c, bot.Message, channel, "Something went wrong finding that counter;")
-			return true
-		}
-
-		resp := fmt.Sprintf("%s has the following counters:", subject)
-		count := 0
-		for _, it := range items {
-			count += 1
-			if count > 1 {
-				resp += ","
-			}
-			resp += fmt.Sprintf(" %s: %d", it.Item, it.Count)
-			if count > 20 {
-				resp += ", and a few others"
-				break
-			}
-		}
-		resp += "."
-
-		if count == 0 {
-			p.Bot.Send(c, bot.Message, channel, fmt.Sprintf("%s has no counters.", subject))
-			return true
-		}
-
-		p.Bot.Send(c, bot.Message, channel, resp)
-		return true
-	} else if message.Command && len(parts) == 2 && parts[0] == "clear" {
-		subject := strings.ToLower(nick)
-		itemName := strings.ToLower(parts[1])
-
-		it, err := GetItem(p.DB, subject, itemName)
-		if err != nil {
-			log.Error().
-				Err(err).
-				Str("subject", subject).
-				Str("itemName", itemName).
-				Msg("Error getting item to remove")
-			p.Bot.Send(c, bot.Message, channel, "Something went wrong removing that counter;")
-			return true
-		}
-		err = it.Delete()
-		if err != nil {
-			log.Error().
-				Err(err).
-				Str("subject", subject).
-				Str("itemName", itemName).
-				Msg("Error removing item")
-			p.Bot.Send(c, bot.Message, channel, "Something went wrong removing that counter;")
-			return true
-		}
-
-		p.Bot.Send(c, bot.Action, channel, fmt.Sprintf("chops a few %s out of his brain",
-			itemName))
-		return true
-
-	} else if message.Command && parts[0] == "count" {
-		var subject string
-		var itemName string
-
-		if len(parts) == 3 {
-			// report count for parts[1]
-			subject = strings.ToLower(parts[1])
-			itemName = strings.ToLower(parts[2])
-		} else if len(parts) == 2 {
-			subject = strings.ToLower(nick)
-			itemName = strings.ToLower(parts[1])
-		} else {
-			return false
-		}
-
-		var item Item
-		item, err := GetItem(p.DB, subject, itemName)
-		switch {
-		case err == sql.ErrNoRows:
-			p.Bot.Send(c, bot.Message, channel, fmt.Sprintf("I don't think %s has any %s.",
-				subject, itemName))
-			return true
-		case err != nil:
-			log.Error().
-				Err(err).
-				Str("subject", subject).
-				Str("itemName", itemName).
-				Msg("Error retrieving item count")
-			return true
-		}
-
-		p.Bot.Send(c, bot.Message, channel, fmt.Sprintf("%s has %d %s.", subject, item.Count,
-			itemName))
-
-		return true
 	} else if len(parts) <= 2 {
 		if (len(parts) == 2) && (parts[1] == "++" || parts[1] == "--") {
 			parts = []string{parts[0] + parts[1]}
@@ -429,7 +328,7 @@ func (p *CounterPlugin) message(c bot.Connector, kind bot.Kind, message msg.Mess
 				return false
 			}
 			log.Debug().Msgf("About to update item: %#v", item)
-			item.UpdateDelta(1)
+			p.updateDelta(&item, 1)
 			p.Bot.Send(c, bot.Message, channel, fmt.Sprintf("%s has %d %s.", subject,
 				item.Count, item.Item))
 			return true
@@ -445,7 +344,7 @@ func (p *CounterPlugin) message(c bot.Connector, kind bot.Kind, message msg.Mess
 				// Item ain't there, I guess
 				return false
 			}
-			item.UpdateDelta(-1)
+			p.updateDelta(&item, -1)
 			p.Bot.Send(c, bot.Message, channel, fmt.Sprintf("%s has %d %s.", subject,
 				item.Count, item.Item))
 			return true
@@ -478,7 +377,7 @@ func (p *CounterPlugin) message(c bot.Connector, kind bot.Kind, message msg.Mess
 			}
 			n, _ := strconv.Atoi(parts[2])
 			log.Debug().Msgf("About to update item by %d: %#v", n, item)
-			item.UpdateDelta(n)
+			p.updateDelta(&item, n)
 			p.Bot.Send(c, bot.Message, channel, fmt.Sprintf("%s has %d %s.", subject,
 				item.Count, item.Item))
 			return true
@@ -496,7 +395,7 @@ func (p *CounterPlugin) message(c bot.Connector, kind bot.Kind, message msg.Mess
 			}
 			n, _ := strconv.Atoi(parts[2])
 			log.Debug().Msgf("About to update item by -%d: %#v", n, item)
-			item.UpdateDelta(-n)
+			p.updateDelta(&item, -n)
 			p.Bot.Send(c, bot.Message, channel, fmt.Sprintf("%s has %d %s.", subject,
 				item.Count, item.Item))
 			return true
@@ -506,12 +405,240 @@ func (p *CounterPlugin) message(c bot.Connector, kind bot.Kind, message msg.Mess
 	return false
 }
 
-// Help responds to help requests. Every plugin must implement a help function.
-func (p *CounterPlugin) help(c bot.Connector, kind bot.Kind, message msg.Message, args ...interface{}) bool {
-	p.Bot.Send(c, bot.Message, message.Channel, "You can set counters incrementally by using "+
-		"<noun>++ and <noun>--. You can see all of your counters using "+
-		"\"inspect\", erase them with \"clear\", and view single counters with "+
-		"\"count\".")
+func (p *CounterPlugin) registerCommands() {
+	p.Bot.RegisterCommand(p, bot.Command{
+		Pattern:  "mkalias {item} {to}",
+		Usage:    "makes one counter count as another",
+		Examples: []string{"mkalias tea :tea:"},
+		Ambient:  true,
+		Handler:  p.mkAlias,
+	})
+	p.Bot.RegisterCommand(p, bot.Command{
+		Pattern:  "leaderboard {item?}",
+		Usage:    "shows who has the most of everything, or of one item",
+		Examples: []string{"leaderboard", "leaderboard beer"},
+		Ambient:  true,
+		Handler:  p.leaderboard,
+	})
+	p.Bot.RegisterCommand(p, bot.Command{
+		Pattern: "reset me",
+		Usage:   "erases all of your counters",
+		Handler: p.reset,
+	})
+	p.Bot.RegisterCommand(p, bot.Command{
+		Pattern:    "reset {who}",
+		Usage:      "erases all of somebody else's counters",
+		Permission: "counter.reset",
+		Role:       bot.Moderator,
+		Handler:    p.reset,
+	})
+	p.Bot.RegisterCommand(p, bot.Command{
+		Pattern:  "inspect {who}",
+		Usage:    "lists somebody's counters",
+		Examples: []string{"inspect me"},
+		Handler:  p.inspect,
+	})
+	p.Bot.RegisterCommand(p, bot.Command{
+		Pattern: "clear {item}",
+		Usage:   "erases one of your counters",
+		Handler: p.clear,
+	})
+	p.Bot.RegisterCommand(p, bot.Command{
+		Pattern: "count {item}",
+		Usage:   "shows one of your counters",
+		Handler: p.count,
+	})
+	p.Bot.RegisterCommand(p, bot.Command{
+		Pattern: "count {who} {item}",
+		Usage:   "shows one of somebody's counters",
+		Handler: p.count,
+	})
+	p.Bot.RegisterCommand(p, bot.Command{
+		Pattern:  "{item}++",
+		Usage:    "counts one more item, use -- to count one less",
+		Examples: []string{"beer++", "alice.beer--"},
+	})
+	p.Bot.RegisterCommand(p, bot.Command{
+		Pattern:  "{item} += {n:int}",
+		Usage:    "counts several more items, use -= to count fewer",
+		Examples: []string{"beer += 2"},
+	})
+}
+
+func (p *CounterPlugin) mkAlias(c bot.Connector, message msg.Message, args bot.Args) bool {
+	item, to := args.String("item"), args.String("to")
+	if _, err := MkAlias(p.DB, item, to); err != nil {
+		log.Error().Err(err)
+		return false
+	}
+	p.Bot.Send(c, bot.Message, message.Channel, fmt.Sprintf("Created alias %s -> %s",
+		item, to))
+	return true
+}
+
+func (p *CounterPlugin) leaderboard(c bot.Connector, message msg.Message, args bot.Args) bool {
+	var cmd func() ([]Item, error)
+	itNameTxt := ""
+
+	if !args.Has("item") {
+		cmd = func() ([]Item, error) { return LeaderAll(p.DB) }
+	} else {
+		itNameTxt = fmt.Sprintf(" for %s", args.String("item"))
+		cmd = func() ([]Item, error) { return Leader(p.DB, args.String("item")) }
+	}
+
+	its, err := cmd()
+	if err != nil {
+		log.Error().Err(err)
+		return false
+	} else if len(its) == 0 {
+		return false
+	}
+
+	out := fmt.Sprintf("Leaderboard%s:\n", itNameTxt)
+	for _, it := range its {
+		out += fmt.Sprintf("%s with %d %s\n",
+			it.Nick,
+			it.Count,
+			it.Item,
+		)
+	}
+	p.Bot.Send(c, bot.Message, message.Channel, out)
+	return true
+}
+
+// reset erases the counters of the sender, or of somebody else for moderators
+func (p *CounterPlugin) reset(c bot.Connector, message msg.Message, args bot.Args) bool {
+	nick := message.User.Name
+	channel := message.Channel
+	subject := nick
+	if args.Has("who") {
+		subject = args.String("who")
+	}
+	items, err := GetItems(p.DB, strings.ToLower(subject))
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("nick", subject).
+			Msg("Error getting items to reset")
+		p.Bot.Send(c, bot.Message, channel, "Something is technically wrong with your counters.")
+		return true
+	}
+	log.Debug().Msgf("Items: %+v", items)
+	for _, item := range items {
+		p.delete(&item)
+	}
+	if subject == nick {
+		p.Bot.Send(c, bot.Message, channel, fmt.Sprintf("%s, you are as new, my son.", nick))
+	} else {
+		p.Bot.Send(c, bot.Message, channel, fmt.Sprintf("%s is as new.", subject))
+	}
+	return true
+}
+
+func (p *CounterPlugin) inspect(c bot.Connector, message msg.Message, args bot.Args) bool {
+	channel := message.Channel
+	subject := strings.ToLower(args.String("who"))
+	if subject == "me" {
+		subject = strings.ToLower(message.User.Name)
+	}
+
+	log.Debug().
+		Str("subject", subject).
+		Msg("Getting counter")
+	// pull all of the items associated with "subject"
+	items, err := GetItems(p.DB, subject)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("subject", subject).
+			Msg("Error retrieving items")
+		p.Bot.Send(c, bot.Message, channel, "Something went wrong finding that counter;")
+		return true
+	}
+
+	resp := fmt.Sprintf("%s has the following counters:", subject)
+	count := 0
+	for _, it := range items {
+		count += 1
+		if count > 1 {
+			resp += ","
+		}
+		resp += fmt.Sprintf(" %s: %d", it.Item, it.Count)
+		if count > 20 {
+			resp += ", and a few others"
+			break
+		}
+	}
+	resp += "."
+
+	if count == 0 {
+		p.Bot.Send(c, bot.Message, channel, fmt.Sprintf("%s has no counters.", subject))
+		return true
+	}
+
+	p.Bot.Send(c, bot.Message, channel, resp)
+	return true
+}
+
+func (p *CounterPlugin) clear(c bot.Connector, message msg.Message, args bot.Args) bool {
+	channel := message.Channel
+	subject := strings.ToLower(message.User.Name)
+	itemName := strings.ToLower(args.String("item"))
+
+	it, err := GetItem(p.DB, subject, itemName)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("subject", subject).
+			Str("itemName", itemName).
+			Msg("Error getting item to remove")
+		p.Bot.Send(c, bot.Message, channel, "Something went wrong removing that counter;")
+		return true
+	}
+	err = p.delete(&it)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("subject", subject).
+			Str("itemName", itemName).
+			Msg("Error removing item")
+		p.Bot.Send(c, bot.Message, channel, "Something went wrong removing that counter;")
+		return true
+	}
+
+	p.Bot.Send(c, bot.Action, channel, fmt.Sprintf("chops a few %s out of his brain",
+		itemName))
+	return true
+}
+
+func (p *CounterPlugin) count(c bot.Connector, message msg.Message, args bot.Args) bool {
+	channel := message.Channel
+	subject := strings.ToLower(message.User.Name)
+	if args.Has("who") {
+		subject = strings.ToLower(args.String("who"))
+	}
+	itemName := strings.ToLower(args.String("item"))
+
+	var item Item
+	item, err := GetItem(p.DB, subject, itemName)
+	switch {
+	case err == sql.ErrNoRows:
+		p.Bot.Send(c, bot.Message, channel, fmt.Sprintf("I don't think %s has any %s.",
+			subject, itemName))
+		return true
+	case err != nil:
+		log.Error().
+			Err(err).
+			Str("subject", subject).
+			Str("itemName", itemName).
+			Msg("Error retrieving item count")
+		return true
+	}
+
+	p.Bot.Send(c, bot.Message, channel, fmt.Sprintf("%s has %d %s.", subject, item.Count,
+		itemName))
+
 	return true
 }
 
@@ -536,7 +663,7 @@ func (p *CounterPlugin) checkMatch(c bot.Connector, message msg.Message) bool {
 		return false
 	}
 	log.Debug().Msgf("About to update item: %#v", item)
-	item.UpdateDelta(1)
+	p.updateDelta(&item, 1)
 	p.Bot.Send(c, bot.Message, channel, fmt.Sprintf("%s... %s has %d %s",
 		strings.Join(everyDayImShuffling([]string{"bleep", "bloop", "blop"}), "-"), nick, item.Count, itemName))
 	return true
@@ -566,11 +693,14 @@ func (p *CounterPlugin) handleCounter(w http.ResponseWriter, r *http.Request) {
 func (p *CounterPlugin) handleCounterAPI(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPost {
 		info := struct {
-			User     string
-			Thing    string
-			Action   string
-			Password string
+			User   string
+			Thing  string
+			Action string
 		}{}
+		u, ok := p.Bot.Accounts().Authorize(w, r, "")
+		if !ok {
+			return
+		}
 		decoder := json.NewDecoder(r.Body)
 		err := decoder.Decode(&info)
 		if err != nil {
@@ -581,9 +711,9 @@ func (p *CounterPlugin) handleCounterAPI(w http.ResponseWriter, r *http.Request)
 		log.Debug().
 			Interface("postbody", info).
 			Msg("Got a POST")
-		if info.Password != p.Bot.GetPassword() {
+		if strings.ToLower(info.User) != strings.ToLower(u.Name) && !p.Bot.Accounts().Allowed(u, "counter.others") {
 			w.WriteHeader(http.StatusForbidden)
-			j, _ := json.Marshal(struct{ Err string }{Err: "Invalid Password"})
+			j, _ := json.Marshal(struct{ Err string }{Err: bot.NoPermission})
 			w.Write(j)
 			return
 		}
@@ -598,10 +728,16 @@ func (p *CounterPlugin) handleCounterAPI(w http.ResponseWriter, r *http.Request)
 			fmt.Fprint(w, err)
 			return
 		}
+		log.Info().
+			Str("user", u.Name).
+			Str("subject", info.User).
+			Str("itemName", info.Thing).
+			Str("action", info.Action).
+			Msg("Counter changed from the web")
 		if info.Action == "++" {
-			item.UpdateDelta(1)
+			p.updateDelta(&item, 1)
 		} else if info.Action == "--" {
-			item.UpdateDelta(-1)
+			p.updateDelta(&item, -1)
 		} else {
 			w.WriteHeader(400)
 			fmt.Fprint(w, "Invalid increment")
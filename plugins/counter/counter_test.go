@@ -5,6 +5,8 @@ package counter
 import (
 	"fmt"
 	"github.com/velour/catbase/plugins/cli"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 
@@ -128,12 +130,31 @@ func TestResetMe(t *testing.T) {
 	mb, c := setup(t)
 	assert.NotNil(t, c)
 	c.message(makeMessage("test++"))
-	c.message(makeMessage("!reset me"))
+	mb.Receive(makeMessage("!reset me"))
 	items, err := GetItems(mb.DB(), "tester")
 	assert.Nil(t, err)
 	assert.Len(t, items, 0)
 }
 
+func TestResetOtherNeedsModerator(t *testing.T) {
+	mb, c := setup(t)
+	_, k, m := makeMessage("test++")
+	m.User = &user.User{Name: "other"}
+	c.message(&cli.CliPlugin{}, k, m)
+	mb.Receive(makeMessage("!reset other"))
+	items, err := GetItems(mb.DB(), "other")
+	assert.Nil(t, err)
+	assert.Len(t, items, 1)
+	assert.Contains(t, mb.Messages, bot.NoPermission)
+
+	mb.Permissions().Grant("", "tester", bot.Moderator)
+	defer mb.Permissions().Revoke("", "tester")
+	mb.Receive(makeMessage("!reset other"))
+	items, err = GetItems(mb.DB(), "other")
+	assert.Nil(t, err)
+	assert.Len(t, items, 0)
+}
+
 func TestCounterOne(t *testing.T) {
 	mb, c := setup(t)
 	assert.NotNil(t, c)
@@ -208,7 +229,7 @@ func TestClear(t *testing.T) {
 		c.message(makeMessage("test++"))
 		assert.Equal(t, mb.Messages[i], fmt.Sprintf("tester has %d test.", i+1))
 	}
-	res := c.message(makeMessage("!clear test"))
+	res := mb.Receive(makeMessage("!clear test"))
 	assert.True(t, res)
 	assert.Len(t, mb.Actions, 1)
 	assert.Equal(t, mb.Actions[0], "chops a few test out of his brain")
@@ -221,7 +242,7 @@ func TestCount(t *testing.T) {
 		c.message(makeMessage("test++"))
 		assert.Equal(t, mb.Messages[i], fmt.Sprintf("tester has %d test.", i+1))
 	}
-	res := c.message(makeMessage("!count test"))
+	res := mb.Receive(makeMessage("!count test"))
 	assert.True(t, res)
 	assert.Len(t, mb.Messages, 5)
 	assert.Equal(t, mb.Messages[4], "tester has 4 test.")
@@ -242,7 +263,7 @@ func TestInspectMe(t *testing.T) {
 		c.message(makeMessage("cheese++"))
 		assert.Equal(t, mb.Messages[i+6], fmt.Sprintf("tester has %d cheese.", i+1))
 	}
-	res := c.message(makeMessage("!inspect me"))
+	res := mb.Receive(makeMessage("!inspect me"))
 	assert.True(t, res)
 	assert.Len(t, mb.Messages, 27)
 	assert.Equal(t, mb.Messages[26], "tester has the following counters: test: 4, fucks: 2, cheese: 20.")
@@ -251,6 +272,43 @@ func TestInspectMe(t *testing.T) {
 func TestHelp(t *testing.T) {
 	mb, c := setup(t)
 	assert.NotNil(t, c)
-	c.help(&cli.CliPlugin{}, bot.Help, msg.Message{Channel: "channel"}, []string{})
-	assert.Len(t, mb.Messages, 1)
+	help := mb.Help(c)
+	assert.Contains(t, help, "inspect <who> - lists somebody's counters")
+	assert.Contains(t, help, "<item>++")
+}
+
+func TestChangesArePublished(t *testing.T) {
+	mb, c := setup(t)
+	c.message(makeMessage("cheese += 3"))
+	assert.Equal(t, []bot.BusEvent{
+		bot.CounterChanged{Nick: "tester", Item: "cheese", Count: 3, Delta: 3},
+	}, mb.Events)
+}
+
+// login gives a request the session of a chat user
+func login(t *testing.T, mb *bot.MockBot, r *http.Request, name string) {
+	link, err := mb.Accounts().LoginLink("", name, name)
+	assert.Nil(t, err)
+	session, _, err := mb.Accounts().Login(link[strings.Index(link, "token=")+6:])
+	assert.Nil(t, err)
+	r.AddCookie(&http.Cookie{Name: bot.SessionCookie, Value: session})
+}
+
+func TestWebAPINeedsLogin(t *testing.T) {
+	mb, c := setup(t)
+	mb.DB().MustExec(`delete from roles`)
+	post := func(body string, as string) int {
+		r := httptest.NewRequest(http.MethodPost, "/counter/api", strings.NewReader(body))
+		if as != "" {
+			login(t, mb, r, as)
+		}
+		w := httptest.NewRecorder()
+		c.handleCounterAPI(w, r)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusUnauthorized, post(`{"User": "tester", "Thing": "tea", "Action": "++"}`, ""))
+	assert.Equal(t, http.StatusOK, post(`{"User": "tester", "Thing": "tea", "Action": "++"}`, "tester"))
+	assert.Equal(t, http.StatusForbidden, post(`{"User": "tester", "Thing": "tea", "Action": "++"}`, "mallory"))
+	item, _ := GetItem(mb.DB(), "tester", "tea")
+	assert.Equal(t, 1, item.Count)
 }
@@ -32,10 +32,6 @@ var html = `
                     {{ "{{ err }}" }}
             </b-alert>
             <b-container>
-                <b-row>
-                    <b-col cols="5">Password:</b-col>
-                    <b-col><b-input v-model="answer"></b-col>
-                </b-row>
                 <b-row v-for="(counter, user) in counters">
                     {{ "{{ user }}" }}:
                     <b-container>
@@ -73,7 +69,6 @@ var html = `
         	data: {
                 err: '',
 				nav: {{ .Nav }},
-                answer: '',
                 correct: 0,
                 counters: {}
         	},
@@ -85,15 +80,15 @@ var html = `
         	methods: {
         		add(user, thing, count) {
 					axios.post('/counter/api',
-						{user: user, thing: thing, action: '++', password: this.answer})
+						{user: user, thing: thing, action: '++'})
 						.then(resp => {this.counters = convertData(resp.data); this.err = '';})
-						.catch(err => this.err = err);
+						.catch(err => this.err = (err.response && err.response.data.Err) || err);
                 },
         		subtract(user, thing, count) {
 					axios.post('/counter/api',
-						{user: user, thing: thing, action: '--', password: this.answer})
+						{user: user, thing: thing, action: '--'})
 						.then(resp => {this.counters = convertData(resp.data); this.err = '';})
-						.catch(err => this.err = err);
+						.catch(err => this.err = (err.response && err.response.data.Err) || err);
                 }
         	}
         })
@@ -10,6 +10,7 @@ import (
 import (
 	"fmt"
 	"math/rand"
+	"time"
 )
 
 // This is a dice plugin to serve as an example and quick copy/paste for new plugins.
@@ -24,7 +25,7 @@ func New(b bot.Bot) *DicePlugin {
 		Bot: b,
 	}
 	b.Register(dp, bot.Message, dp.message)
-	b.Register(dp, bot.Help, dp.help)
+	dp.registerCommands()
 	return dp
 }
 
@@ -48,6 +49,10 @@ func (p *DicePlugin) message(c bot.Connector, kind bot.Kind, message msg.Message
 		return false
 	}
 
+	if !p.Bot.Limits().Allow(c, message, bot.Cooldown{Name: "dice", User: 5 * time.Second}) {
+		return true
+	}
+
 	if sides < 2 || nDice < 1 || nDice > 20 {
 		p.Bot.Send(c, bot.Message, channel, "You're a dick.")
 		return true
@@ -69,8 +74,10 @@ func (p *DicePlugin) message(c bot.Connector, kind bot.Kind, message msg.Message
 
 }
 
-// Help responds to help requests. Every plugin must implement a help function.
-func (p *DicePlugin) help(c bot.Connector, kind bot.Kind, message msg.Message, args ...interface{}) bool {
-	p.Bot.Send(c, bot.Message, message.Channel, "Roll dice using notation XdY. Try \"3d20\".")
-	return true
+func (p *DicePlugin) registerCommands() {
+	p.Bot.RegisterCommand(p, bot.Command{
+		Pattern:  "{n}d{sides}",
+		Usage:    "rolls n dice with some sides",
+		Examples: []string{"3d20"},
+	})
 }
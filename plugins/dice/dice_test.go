@@ -87,6 +87,5 @@ func TestHelp(t *testing.T) {
 	mb := bot.NewMockBot()
 	c := New(mb)
 	assert.NotNil(t, c)
-	c.help(&cli.CliPlugin{}, bot.Help, msg.Message{Channel: "channel"}, []string{})
-	assert.Len(t, mb.Messages, 1)
+	assert.Contains(t, mb.Help(c), "e.g. 3d20")
 }
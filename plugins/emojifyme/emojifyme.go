@@ -13,8 +13,17 @@ import (
 
 	"github.com/velour/catbase/bot"
 	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/config"
 )
 
+func init() {
+	config.Declare(
+		config.Key{Name: "Emojify.Chance", Type: config.Float, Default: "0.02", Min: 0, Max: 1,
+			Description: "chance of reacting for each emoji a message mentions"},
+		config.Key{Name: "Emojify.Scoreless", Type: config.Array, Description: "emoji that don't make a reaction likelier"},
+	)
+}
+
 type EmojifyMePlugin struct {
 	Bot         bot.Bot
 	GotBotEmoji bool
@@ -61,7 +70,7 @@ func New(b bot.Bot) *EmojifyMePlugin {
 func (p *EmojifyMePlugin) message(c bot.Connector, kind bot.Kind, message msg.Message, args ...interface{}) bool {
 	if !p.GotBotEmoji {
 		p.GotBotEmoji = true
-		emojiMap := p.Bot.GetEmojiList()
+		emojiMap := p.Bot.GetEmojiList(c)
 		for e := range emojiMap {
 			p.Emoji[e] = e
 		}
@@ -91,7 +100,8 @@ func (p *EmojifyMePlugin) message(c bot.Connector, kind bot.Kind, message msg.Me
 		}
 	}
 
-	if emojied > 0 && rand.Float64() <= p.Bot.Config().GetFloat64("Emojify.Chance", 0.02)*emojied {
+	chance := p.Bot.Config().Scope(bot.Target(message.Connector, message.Channel)).GetFloat64("Emojify.Chance", 0.02)
+	if emojied > 0 && rand.Float64() <= chance*emojied {
 		for _, e := range emojys {
 			p.Bot.Send(c, bot.Reaction, message.Channel, e, message)
 		}
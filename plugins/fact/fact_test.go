@@ -58,3 +58,43 @@ func TestReactCantLearnSpaces(t *testing.T) {
 	assert.Len(t, mb.Messages, 1)
 	assert.Contains(t, mb.Messages[0], "not a valid")
 }
+
+func TestForgetThatAsksFirst(t *testing.T) {
+	p, mb := makePlugin(t)
+	mb.Permissions().Grant("", "user1", bot.Trusted)
+	p.message(c, bot.Message, makeMessage("user1", "!forgettable thing <is> gone"))
+	p.message(c, bot.Message, makeMessage("user1", "!forget that"))
+	assert.Contains(t, mb.Messages[len(mb.Messages)-1], "Forget that forgettable thing is gone? (yes/no)")
+
+	assert.False(t, mb.Receive(c, bot.Message, makeMessage("user2", "yes")))
+	_, err := GetSingleFact(mb.DB(), "forgettable thing")
+	assert.Nil(t, err)
+
+	assert.True(t, mb.Receive(c, bot.Message, makeMessage("user1", "yes")))
+	_, err = GetSingleFact(mb.DB(), "forgettable thing")
+	assert.NotNil(t, err)
+	assert.Nil(t, p.LastFact)
+}
+
+func TestForgetThatCanBeDeclined(t *testing.T) {
+	p, mb := makePlugin(t)
+	mb.Permissions().Grant("", "user1", bot.Trusted)
+	p.message(c, bot.Message, makeMessage("user1", "!keepable thing <is> kept"))
+	p.message(c, bot.Message, makeMessage("user1", "!forget that"))
+	assert.True(t, mb.Receive(c, bot.Message, makeMessage("user1", "no")))
+	assert.Equal(t, "Okay, I'll keep it.", mb.Messages[len(mb.Messages)-1])
+	_, err := GetSingleFact(mb.DB(), "keepable thing")
+	assert.Nil(t, err)
+}
+
+func TestForgetThatNeedsAYes(t *testing.T) {
+	p, mb := makePlugin(t)
+	mb.Permissions().Grant("", "user1", bot.Trusted)
+	p.message(c, bot.Message, makeMessage("user1", "!sticky thing <is> stuck"))
+	p.message(c, bot.Message, makeMessage("user1", "!forget that"))
+	assert.False(t, mb.Receive(c, bot.Message, makeMessage("user1", "what?")))
+	assert.Equal(t, "That's not a yes, so I didn't forget anything.", mb.Messages[len(mb.Messages)-1])
+	assert.False(t, mb.Receive(c, bot.Message, makeMessage("user1", "yes")))
+	_, err := GetSingleFact(mb.DB(), "sticky thing")
+	assert.Nil(t, err)
+}
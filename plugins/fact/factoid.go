@@ -11,15 +11,61 @@ import (
 	"net/http"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/rs/zerolog/log"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/backup"
+	"github.com/velour/catbase/bot/migrate"
 	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/bot/schedule"
+	"github.com/velour/catbase/config"
 )
 
+func init() {
+	backup.Register("fact", backup.Table{Name: "factoid"}, backup.Table{Name: "factoid_alias"})
+	migrate.Register("fact",
+		migrate.Step{
+			Version: 1,
+			Name:    "create factoid tables",
+			SQL: `create table if not exists factoid (
+				id integer primary key,
+				fact string,
+				tidbit string,
+				verb string,
+				owner string,
+				created integer,
+				accessed integer,
+				count integer
+			);
+			create table if not exists factoid_alias (
+				fact string,
+				next string,
+				primary key (fact, next)
+			);`,
+		},
+		migrate.Step{
+			Version: 2,
+			Name:    "index factoids by trigger",
+			SQL:     `create index if not exists factoid_fact on factoid (fact);`,
+		},
+	)
+	config.Declare(
+		config.Key{Name: "Factoid.QuoteTime", Type: config.Int, Default: "30", Min: 1, Max: 10080,
+			Description: "minutes of quiet before I might share a fact"},
+		config.Key{Name: "Factoid.QuoteChance", Type: config.Float, Default: "0.99", Min: 0, Max: 1,
+			Description: "chance of sharing a fact once the channel has been quiet"},
+		config.Key{Name: "Factoid.QuoteCheck", Type: config.Int, Default: "60", Min: 1, Max: 86400,
+			Description: "seconds between checks for a quiet channel"},
+		config.Key{Name: "Factoid.MinLen", Type: config.Int, Default: "4", Min: 0, Max: 1000,
+			Description: "shortest trigger a factoid may have"},
+		config.Key{Name: "Factoid.StartupFact", Default: "speed test", Description: "fact I share when I start"},
+	)
+}
+
 // The factoid plugin provides a learning system to the bot so that it can
 // respond to queries in a way that is unpredictable and fun
 
@@ -79,7 +125,7 @@ func (a *alias) save(db *sqlx.DB) error {
 	if err != nil {
 		return fmt.Errorf("there is no fact at that destination")
 	}
-	q = `insert or replace into factoid_alias (fact, next) values (?, ?)`
+	q = `insert into factoid_alias (fact, next) values (?, ?) on conflict(fact, next) do nothing`
 	_, err = db.Exec(q, a.Fact, a.Next)
 	if err != nil {
 		return err
@@ -114,7 +160,7 @@ func (f *Factoid) Save(db *sqlx.DB) error {
 		f.Created = time.Now()
 		f.Accessed = time.Now()
 		// insert
-		res, err := db.Exec(`insert into factoid (
+		id, err := config.Insert(db, `insert into factoid (
 			fact,
 			tidbit,
 			verb,
@@ -134,7 +180,6 @@ func (f *Factoid) Save(db *sqlx.DB) error {
 		if err != nil {
 			return err
 		}
-		id, err := res.LastInsertId()
 		// hackhackhack?
 		f.ID.Int64 = id
 		f.ID.Valid = true
@@ -163,8 +208,8 @@ func getFacts(db *sqlx.DB, fact string, tidbit string) ([]*Factoid, error) {
 			accessed,
 			count
 		from factoid
-		where fact like ?
-		and tidbit like ?;`
+		where lower(fact) like lower(?)
+		and lower(tidbit) like lower(?);`
 	rows, err := db.Query(query,
 		"%"+fact+"%", "%"+tidbit+"%")
 	if err != nil {
@@ -224,6 +269,37 @@ func GetSingle(db *sqlx.DB) (*Factoid, error) {
 	return &f, err
 }
 
+// getFact finds a factoid by its ID
+func getFact(db *sqlx.DB, id int64) (*Factoid, error) {
+	var f Factoid
+	var tmpCreated int64
+	var tmpAccessed int64
+	err := db.QueryRow(`select
+			id,
+			fact,
+			tidbit,
+			verb,
+			owner,
+			created,
+			accessed,
+			count
+		from factoid
+		where id=?;`,
+		id).Scan(
+		&f.ID,
+		&f.Fact,
+		&f.Tidbit,
+		&f.Verb,
+		&f.Owner,
+		&tmpCreated,
+		&tmpAccessed,
+		&f.Count,
+	)
+	f.Created = time.Unix(tmpCreated, 0)
+	f.Accessed = time.Unix(tmpAccessed, 0)
+	return &f, err
+}
+
 func GetSingleFact(db *sqlx.DB, fact string) (*Factoid, error) {
 	var f Factoid
 	var tmpCreated int64
@@ -238,7 +314,7 @@ func GetSingleFact(db *sqlx.DB, fact string) (*Factoid, error) {
 			accessed,
 			count
 		from factoid
-		where fact like ?
+		where lower(fact) like lower(?)
 		order by random() limit 1;`,
 		fact).Scan(
 		&f.ID,
@@ -261,6 +337,10 @@ type FactoidPlugin struct {
 	NotFound []string
 	LastFact *Factoid
 	db       *sqlx.DB
+
+	// lastQuote is when a random fact was last said in each channel
+	lastQuote     map[string]time.Time
+	lastQuoteLock sync.Mutex
 }
 
 // NewFactoid creates a new Factoid with the Plugin interface
@@ -275,51 +355,45 @@ func New(botInst bot.Bot) *FactoidPlugin {
 			"NOPE! NOPE! NOPE!",
 			"One time, I learned how to jump rope.",
 		},
-		db: botInst.DB(),
-	}
-
-	c := botInst.DefaultConnector()
-
-	if _, err := p.db.Exec(`create table if not exists factoid (
-			id integer primary key,
-			fact string,
-			tidbit string,
-			verb string,
-			owner string,
-			created integer,
-			accessed integer,
-			count integer
-		);`); err != nil {
-		log.Fatal().Err(err)
-	}
-
-	if _, err := p.db.Exec(`create table if not exists factoid_alias (
-			fact string,
-			next string,
-			primary key (fact, next)
-		);`); err != nil {
-		log.Fatal().Err(err)
-	}
-
-	for _, channel := range botInst.Config().GetArray("channels", []string{}) {
-		go p.factTimer(c, channel)
-
-		go func(ch string) {
-			// Some random time to start up
-			time.Sleep(time.Duration(15) * time.Second)
-			if ok, fact := p.findTrigger(p.Bot.Config().Get("Factoid.StartupFact", "speed test")); ok {
-				p.sayFact(c, msg.Message{
-					Channel: ch,
-					Body:    "speed test", // BUG: This is defined in the config too
-					Command: true,
-					Action:  false,
-				}, *fact)
-			}
-		}(channel)
+		db:        botInst.DB(),
+		lastQuote: make(map[string]time.Time),
 	}
 
+	migrate.MustUp(p.db, "fact")
+
+	sched := botInst.Scheduler()
+	sched.Handle("fact.quote", p.factTimer)
+	sched.Handle("fact.startup", p.startupFact)
+	check := time.Duration(botInst.Config().GetInt("Factoid.QuoteCheck", 60)) * time.Second
+	quoted := []string{}
+	for _, target := range botInst.Config().GetArray("channels", []string{}) {
+		if c, _ := botInst.ResolveTarget(target); c == nil {
+			log.Error().Msgf("Unknown connector for channel %s", target)
+			continue
+		}
+		p.lastQuote[target] = time.Now()
+		if err := sched.Every("fact.quote:"+target, "fact.quote", check, check/4, target); err != nil {
+			log.Error().Err(err).Msgf("Could not schedule facts for %s", target)
+		}
+		quoted = append(quoted, target)
+		// Some random time to start up
+		if err := sched.Once("fact.startup:"+target, "fact.startup", time.Now().Add(15*time.Second), target); err != nil {
+			log.Error().Err(err).Msgf("Could not schedule the startup fact for %s", target)
+		}
+	}
+
+	for _, handler := range []string{"fact.quote", "fact.startup"} {
+		if err := sched.Prune(handler, quoted); err != nil {
+			log.Error().Err(err).Msg("Could not cancel old fact timers")
+		}
+	}
+
+	botInst.Permissions().Declare("fact.forget", bot.Trusted)
+	// changing somebody else's factoids from the web pages
+	botInst.Permissions().Declare("fact.edit", bot.Trusted)
 	botInst.Register(p, bot.Message, p.message)
-	botInst.Register(p, bot.Help, p.help)
+	botInst.Subscribe(p, bot.LearnFactoid{}.Topic(), p.learnFor)
+	p.registerCommands()
 
 	p.registerWeb()
 
@@ -386,9 +460,45 @@ func (p *FactoidPlugin) learnFact(message msg.Message, fact, verb, tidbit string
 		return fmt.Errorf("My brain is overheating.")
 	}
 
+	p.Bot.Publish(bot.FactoidLearned{
+		ID:     n.ID.Int64,
+		Fact:   n.Fact,
+		Verb:   n.Verb,
+		Tidbit: n.Tidbit,
+		Owner:  n.Owner,
+		Target: bot.Target(message.Connector, message.Channel),
+	})
 	return nil
 }
 
+// learnFor saves a factoid another plugin asked for on the bus
+func (p *FactoidPlugin) learnFor(evt bot.BusEvent) {
+	l := evt.(bot.LearnFactoid)
+	n := Factoid{
+		Fact:     l.Fact,
+		Tidbit:   l.Tidbit,
+		Verb:     l.Verb,
+		Owner:    l.Owner,
+		Created:  time.Now(),
+		Accessed: time.Now(),
+	}
+	if err := n.Save(p.db); err != nil {
+		log.Error().Err(err).Msg("Error inserting fact")
+		return
+	}
+	if l.Learned != nil {
+		*l.Learned = true
+	}
+	p.Bot.Publish(bot.FactoidLearned{
+		ID:     n.ID.Int64,
+		Fact:   n.Fact,
+		Verb:   n.Verb,
+		Tidbit: n.Tidbit,
+		Owner:  n.Owner,
+		Target: l.Target,
+	})
+}
+
 // findTrigger checks to see if a given string is a trigger or not
 func (p *FactoidPlugin) findTrigger(fact string) (bool, *Factoid) {
 	fact = strings.ToLower(fact) // TODO: make sure this needs to be lowered here
@@ -516,26 +626,66 @@ func changeOperator(body string) string {
 }
 
 // If the user requesting forget is either the owner of the last learned fact or
-// an admin, it may be deleted
+// an admin, it may be deleted once they confirm it
 func (p *FactoidPlugin) forgetLastFact(c bot.Connector, message msg.Message) bool {
-	if p.LastFact == nil {
+	if !p.Bot.Permissions().Allowed(message, "fact.forget") {
+		p.Bot.Send(c, bot.Message, message.Channel, bot.NoPermission)
+		return true
+	}
+	fact := p.LastFact
+	if fact == nil {
 		p.Bot.Send(c, bot.Message, message.Channel, "I refuse.")
 		return true
 	}
 
-	err := p.LastFact.delete(p.db)
+	p.Bot.Ask(p, bot.Prompt{
+		Connector: c,
+		Channel:   message.Channel,
+		User:      bot.UserKey(message),
+		Question:  fmt.Sprintf("Forget that %s %s %s? (yes/no)", fact.Fact, fact.Verb, fact.Tidbit),
+		Timeout:   confirmTimeout,
+		Answer: func(c bot.Connector, answer msg.Message) bool {
+			switch strings.ToLower(strings.TrimSpace(answer.Body)) {
+			case "yes", "y":
+				p.forget(c, answer, fact)
+			case "no", "n":
+				p.Bot.Send(c, bot.Message, answer.Channel, "Okay, I'll keep it.")
+			default:
+				// anything else is not a yes, and the message is still theirs to say
+				p.Bot.Send(c, bot.Message, answer.Channel, "That's not a yes, so I didn't forget anything.")
+				return false
+			}
+			return true
+		},
+	})
+	return true
+}
+
+// confirmTimeout is how long forget that waits for a yes
+const confirmTimeout = time.Minute
+
+func (p *FactoidPlugin) forget(c bot.Connector, message msg.Message, fact *Factoid) {
+	err := fact.delete(p.db)
 	if err != nil {
 		log.Error().
 			Err(err).
-			Interface("LastFact", p.LastFact).
+			Interface("LastFact", fact).
 			Msg("Error removing fact")
+	} else {
+		p.Bot.Publish(bot.FactoidForgotten{
+			ID:     fact.ID.Int64,
+			Fact:   fact.Fact,
+			Verb:   fact.Verb,
+			Tidbit: fact.Tidbit,
+			By:     message.User.Name,
+			Target: bot.Target(message.Connector, message.Channel),
+		})
 	}
-	fmt.Printf("Forgot #%d: %s %s %s\n", p.LastFact.ID.Int64, p.LastFact.Fact,
-		p.LastFact.Verb, p.LastFact.Tidbit)
+	fmt.Printf("Forgot #%d: %s %s %s\n", fact.ID.Int64, fact.Fact, fact.Verb, fact.Tidbit)
 	p.Bot.Send(c, bot.Action, message.Channel, "hits himself over the head with a skillet")
-	p.LastFact = nil
-
-	return true
+	if p.LastFact == fact {
+		p.LastFact = nil
+	}
 }
 
 // Allow users to change facts with a simple regexp
@@ -693,11 +843,33 @@ func (p *FactoidPlugin) message(c bot.Connector, kind bot.Kind, message msg.Mess
 	return true
 }
 
-// Help responds to help requests. Every plugin must implement a help function.
-func (p *FactoidPlugin) help(c bot.Connector, kind bot.Kind, message msg.Message, args ...interface{}) bool {
-	p.Bot.Send(c, bot.Message, message.Channel, "I can learn facts and spit them back out. You can say \"this is that\" or \"he <has> $5\". Later, trigger the factoid by just saying the trigger word, \"this\" or \"he\" in these examples.")
-	p.Bot.Send(c, bot.Message, message.Channel, "I can also figure out some variables including: $nonzero, $digit, $nick, and $someone.")
-	return true
+func (p *FactoidPlugin) registerCommands() {
+	p.Bot.RegisterCommand(p, bot.Command{
+		Pattern:  "{trigger} is {tidbit:text}",
+		Usage:    "learns a fact, said again when someone says the trigger",
+		Examples: []string{"this is that"},
+	})
+	p.Bot.RegisterCommand(p, bot.Command{
+		Pattern:  "{trigger} <{verb}> {tidbit:text}",
+		Usage:    "learns a fact with any verb, or <reply>, <action> or <react>",
+		Examples: []string{"he <has> $5"},
+	})
+	p.Bot.RegisterCommand(p, bot.Command{
+		Pattern: "what was that?",
+		Usage:   "tells where the last fact came from",
+	})
+	p.Bot.RegisterCommand(p, bot.Command{
+		Pattern: "forget that",
+		Usage:   "forgets the last fact, once you say yes",
+	})
+	p.Bot.RegisterCommand(p, bot.Command{
+		Pattern: "alias {from} {to}",
+		Usage:   "makes one trigger say another's facts",
+	})
+	p.Bot.RegisterCommand(p, bot.Command{
+		Pattern: "factoid",
+		Usage:   "says a random fact",
+	})
 }
 
 // Pull a fact at random from the database
@@ -710,57 +882,76 @@ func (p *FactoidPlugin) randomFact() *Factoid {
 	return f
 }
 
-// factTimer spits out a fact at a given interval and with given probability
-func (p *FactoidPlugin) factTimer(c bot.Connector, channel string) {
-	quoteTime := p.Bot.Config().GetInt("Factoid.QuoteTime", 30)
-	if quoteTime == 0 {
-		quoteTime = 30
-		p.Bot.Config().Set("Factoid.QuoteTime", "30")
+// startupFact says hello to a channel once the bot is up
+func (p *FactoidPlugin) startupFact(job schedule.Job) {
+	c, ch := p.Bot.ResolveTarget(job.Payload)
+	if c == nil {
+		return
+	}
+	if ok, fact := p.findTrigger(p.Bot.Config().Get("Factoid.StartupFact", "speed test")); ok {
+		p.sayFact(c, msg.Message{
+			Channel: ch,
+			Body:    "speed test", // BUG: This is defined in the config too
+			Command: true,
+			Action:  false,
+		}, *fact)
+	}
+}
+
+// factTimer spits out a fact when a channel has been quiet long enough, with given probability
+func (p *FactoidPlugin) factTimer(job schedule.Job) {
+	c, channel := p.Bot.ResolveTarget(job.Payload)
+	if c == nil {
+		return
 	}
+	quoteTime := p.Bot.Config().GetInt("Factoid.QuoteTime", 30)
 	duration := time.Duration(quoteTime) * time.Minute
-	myLastMsg := time.Now()
-	for {
-		time.Sleep(time.Duration(5) * time.Second) // why 5?
 
-		lastmsg, err := p.Bot.LastMessage(channel)
-		if err != nil {
-			// Probably no previous message to time off of
-			continue
-		}
+	connector, _ := bot.ParseTarget(job.Payload)
+	lastmsg, err := p.Bot.LastMessage(connector, channel)
+	if err != nil {
+		// Probably no previous message to time off of
+		return
+	}
 
-		tdelta := time.Since(lastmsg.Time)
-		earlier := time.Since(myLastMsg) > tdelta
-		chance := rand.Float64()
-		quoteChance := p.Bot.Config().GetFloat64("Factoid.QuoteChance", 0.99)
-		if quoteChance == 0.0 {
-			quoteChance = 0.99
-			p.Bot.Config().Set("Factoid.QuoteChance", "0.99")
-		}
-		success := chance < quoteChance
+	p.lastQuoteLock.Lock()
+	myLastMsg, ok := p.lastQuote[job.Payload]
+	p.lastQuoteLock.Unlock()
+	if !ok {
+		myLastMsg = time.Now()
+	}
 
-		if success && tdelta > duration && earlier {
-			fact := p.randomFact()
-			if fact == nil {
-				log.Debug().Msg("Didn't find a random fact to say")
-				continue
-			}
+	tdelta := time.Since(lastmsg.Time)
+	earlier := time.Since(myLastMsg) > tdelta
+	chance := rand.Float64()
+	quoteChance := p.Bot.Config().GetFloat64("Factoid.QuoteChance", 0.99)
+	success := chance < quoteChance
+
+	if success && tdelta > duration && earlier {
+		fact := p.randomFact()
+		if fact == nil {
+			log.Debug().Msg("Didn't find a random fact to say")
+			return
+		}
 
-			users := p.Bot.Who(channel)
+		users := p.Bot.Who(c, channel)
 
-			// we need to fabricate a message so that bot.Filter can operate
-			message := msg.Message{
-				User:    &users[rand.Intn(len(users))],
-				Channel: channel,
-			}
-			p.sayFact(c, message, *fact)
-			myLastMsg = time.Now()
+		// we need to fabricate a message so that bot.Filter can operate
+		message := msg.Message{
+			User:    &users[rand.Intn(len(users))],
+			Channel: channel,
 		}
+		p.sayFact(c, message, *fact)
+		p.lastQuoteLock.Lock()
+		p.lastQuote[job.Payload] = time.Now()
+		p.lastQuoteLock.Unlock()
 	}
 }
 
 // Register any web URLs desired
 func (p *FactoidPlugin) registerWeb() {
 	http.HandleFunc("/factoid/api", p.serveAPI)
+	http.HandleFunc("/factoid/edit", p.serveEdit)
 	http.HandleFunc("/factoid/req", p.serveQuery)
 	http.HandleFunc("/factoid", p.serveQuery)
 	p.Bot.RegisterWeb("/factoid", "Factoid")
@@ -807,6 +998,78 @@ func (p *FactoidPlugin) serveAPI(w http.ResponseWriter, r *http.Request) {
 	w.Write(data)
 }
 
+// serveEdit changes or forgets a factoid for somebody logged in
+// People may edit their own factoids; anybody else's needs fact.edit, or fact.forget to forget it.
+func (p *FactoidPlugin) serveEdit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		fmt.Fprintf(w, "Incorrect HTTP method")
+		return
+	}
+	u, ok := p.Bot.Accounts().Authorize(w, r, "")
+	if !ok {
+		return
+	}
+	info := struct {
+		ID     int64
+		Tidbit string
+		Forget bool
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&info); err != nil {
+		w.WriteHeader(400)
+		fmt.Fprint(w, err)
+		return
+	}
+	f, err := getFact(p.db, info.ID)
+	if err != nil {
+		w.WriteHeader(404)
+		fmt.Fprint(w, err)
+		return
+	}
+	perm := "fact.edit"
+	if info.Forget {
+		perm = "fact.forget"
+	}
+	if !strings.EqualFold(f.Owner, u.Name) && !p.Bot.Accounts().Allowed(u, perm) {
+		w.WriteHeader(http.StatusForbidden)
+		j, _ := json.Marshal(struct{ Err string }{Err: bot.NoPermission})
+		w.Write(j)
+		return
+	}
+
+	if info.Forget {
+		err = f.delete(p.db)
+		if err == nil {
+			p.Bot.Publish(bot.FactoidForgotten{
+				ID:     info.ID,
+				Fact:   f.Fact,
+				Verb:   f.Verb,
+				Tidbit: f.Tidbit,
+				By:     u.Name,
+			})
+		}
+	} else if strings.TrimSpace(info.Tidbit) == "" {
+		w.WriteHeader(400)
+		fmt.Fprint(w, "A factoid needs a tidbit")
+		return
+	} else {
+		f.Tidbit = info.Tidbit
+		err = f.Save(p.db)
+	}
+	if err != nil {
+		log.Error().Err(err).Int64("id", info.ID).Msg("Could not edit factoid")
+		w.WriteHeader(500)
+		fmt.Fprint(w, err)
+		return
+	}
+	log.Info().
+		Str("user", u.Name).
+		Int64("id", info.ID).
+		Bool("forget", info.Forget).
+		Msg("Factoid edited from the web")
+	j, _ := json.Marshal(f)
+	w.Write(j)
+}
+
 var tpl = template.Must(template.New("factoidIndex").Parse(factoidIndex))
 
 func (p *FactoidPlugin) serveQuery(w http.ResponseWriter, r *http.Request) {
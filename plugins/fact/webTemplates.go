@@ -57,7 +57,12 @@ var factoidIndex = `
             <b-table
                     fixed
                     :items="results"
-                    :fields="fields"></b-table>
+                    :fields="fields">
+                <template v-slot:cell(Edit)="data">
+                    <b-button size="sm" @click="edit(data.item)">Edit</b-button>
+                    <b-button size="sm" variant="danger" @click="forget(data.item)">Forget</b-button>
+                </template>
+            </b-table>
             </b-col>
         </b-row>
     </b-container>
@@ -81,7 +86,8 @@ var factoidIndex = `
                 { key: 'Fact', sortable: true },
                 { key: 'Tidbit', sortable: true },
                 { key: 'Owner', sortable: true },
-                { key: 'Count' }
+                { key: 'Count' },
+                { key: 'Edit', label: '' }
             ]
         },
         mounted() {
@@ -106,6 +112,20 @@ var factoidIndex = `
                         this.results = resp.data;
                     })
                     .catch(err => (this.err = err));
+            },
+            edit: function(fact) {
+                var tidbit = prompt('Change the tidbit of ' + fact.Fact, fact.Tidbit);
+                if (tidbit === null) {
+                    return;
+                }
+                axios.post('/factoid/edit', {id: fact.ID.Int64, tidbit: tidbit})
+                    .then(resp => this.runQuery())
+                    .catch(err => (this.err = (err.response && err.response.data.Err) || err));
+            },
+            forget: function(fact) {
+                axios.post('/factoid/edit', {id: fact.ID.Int64, forget: true})
+                    .then(resp => this.runQuery())
+                    .catch(err => (this.err = (err.response && err.response.data.Err) || err));
             }
         }
     })
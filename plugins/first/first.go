@@ -12,9 +12,25 @@ import (
 	"github.com/jmoiron/sqlx"
 	"github.com/rs/zerolog/log"
 	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/migrate"
 	"github.com/velour/catbase/bot/msg"
 )
 
+func init() {
+	migrate.Register("first", migrate.Step{
+		Version: 1,
+		Name:    "create first table",
+		SQL: `create table if not exists first (
+			id integer primary key,
+			day integer,
+			time integer,
+			channel string,
+			body string,
+			nick string
+		);`,
+	})
+}
+
 // This is a first plugin to serve as an example and quick copy/paste for new plugins.
 
 type FirstPlugin struct {
@@ -49,19 +65,7 @@ func (fe *FirstEntry) save(db *sqlx.DB) error {
 
 // NewFirstPlugin creates a new FirstPlugin with the Plugin interface
 func New(b bot.Bot) *FirstPlugin {
-	_, err := b.DB().Exec(`create table if not exists first (
-			id integer primary key,
-			day integer,
-			time integer,
-			channel string,
-			body string,
-			nick string
-		);`)
-	if err != nil {
-		log.Fatal().
-			Err(err).
-			Msg("Could not create first table")
-	}
+	migrate.MustUp(b.DB(), "first")
 
 	log.Info().Msgf("First plugin initialized with day: %s",
 		midnight(time.Now()))
@@ -71,7 +75,7 @@ func New(b bot.Bot) *FirstPlugin {
 		db:  b.DB(),
 	}
 	b.Register(fp, bot.Message, fp.message)
-	b.Register(fp, bot.Help, fp.help)
+	fp.registerCommands()
 	return fp
 }
 
@@ -84,8 +88,9 @@ func getLastFirst(db *sqlx.DB, channel string) (*FirstEntry, error) {
 	var nick sql.NullString
 
 	err := db.QueryRow(`select
-		id, max(day), time, body, nick from first
+		id, day, time, body, nick from first
 		where channel = ?
+		order by day desc, id desc
 		limit 1;
 	`, channel).Scan(
 		&id,
@@ -229,6 +234,12 @@ func (p *FirstPlugin) recordFirst(c bot.Connector, message msg.Message) {
 		return
 	}
 	p.announceFirst(c, first)
+	p.Bot.Publish(bot.FirstClaimed{
+		Nick:   first.nick,
+		Body:   first.body,
+		Time:   first.time,
+		Target: bot.Target(message.Connector, message.Channel),
+	})
 }
 
 func (p *FirstPlugin) announceFirst(c bot.Connector, first *FirstEntry) {
@@ -237,8 +248,9 @@ func (p *FirstPlugin) announceFirst(c bot.Connector, first *FirstEntry) {
 		first.nick, first.time.Format("15:04"), first.body))
 }
 
-// Help responds to help requests. Every plugin must implement a help function.
-func (p *FirstPlugin) help(c bot.Connector, kind bot.Kind, message msg.Message, args ...interface{}) bool {
-	p.Bot.Send(c, bot.Message, message.Channel, "You can ask 'who's on first?' to find out.")
-	return true
+func (p *FirstPlugin) registerCommands() {
+	p.Bot.RegisterCommand(p, bot.Command{
+		Pattern: "who's on first?",
+		Usage:   "tells who spoke first today",
+	})
 }
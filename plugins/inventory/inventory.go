@@ -13,10 +13,21 @@ import (
 
 	"github.com/jmoiron/sqlx"
 	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/migrate"
 	"github.com/velour/catbase/bot/msg"
 	"github.com/velour/catbase/config"
 )
 
+func init() {
+	migrate.Register("inventory", migrate.Step{
+		Version: 1,
+		Name:    "create inventory table",
+		SQL: `create table if not exists inventory (
+			item string primary key
+		);`,
+	})
+}
+
 type InventoryPlugin struct {
 	*sqlx.DB
 	bot                bot.Bot
@@ -49,13 +60,7 @@ func New(b bot.Bot) *InventoryPlugin {
 	b.RegisterFilter("$item", p.itemFilter)
 	b.RegisterFilter("$giveitem", p.giveItemFilter)
 
-	_, err = p.DB.Exec(`create table if not exists inventory (
-			item string primary key
-		);`)
-
-	if err != nil {
-		log.Fatal().Err(err)
-	}
+	migrate.MustUp(p.DB, "inventory")
 
 	b.Register(p, bot.Message, p.message)
 
@@ -6,7 +6,6 @@ package leftpad
 import (
 	"fmt"
 	"strconv"
-	"strings"
 
 	"github.com/chrissexton/leftpad"
 	"github.com/velour/catbase/bot"
@@ -25,7 +24,12 @@ func New(b bot.Bot) *LeftpadPlugin {
 		bot:    b,
 		config: b.Config(),
 	}
-	b.Register(p, bot.Message, p.message)
+	b.RegisterCommand(p, bot.Command{
+		Pattern:  "leftpad {padchar} {length} {text:text}",
+		Usage:    "pads text on the left out to length",
+		Examples: []string{"leftpad - 10 catbase"},
+		Handler:  p.leftpad,
+	})
 	return p
 }
 
@@ -33,32 +37,21 @@ type leftpadResp struct {
 	Str string
 }
 
-func (p *LeftpadPlugin) message(c bot.Connector, kind bot.Kind, message msg.Message, args ...interface{}) bool {
-	if !message.Command {
-		return false
+func (p *LeftpadPlugin) leftpad(c bot.Connector, message msg.Message, args bot.Args) bool {
+	length, err := strconv.Atoi(args.String("length"))
+	if err != nil {
+		p.bot.Send(c, bot.Message, message.Channel, "Invalid padding number")
+		return true
 	}
-
-	parts := strings.Fields(message.Body)
-	if len(parts) > 3 && parts[0] == "leftpad" {
-		padchar := parts[1]
-		length, err := strconv.Atoi(parts[2])
-		if err != nil {
-			p.bot.Send(c, bot.Message, message.Channel, "Invalid padding number")
-			return true
-		}
-		maxLen, who := p.config.GetInt("LeftPad.MaxLen", 50), p.config.Get("LeftPad.Who", "Putin")
-		if length > maxLen && maxLen > 0 {
-			msg := fmt.Sprintf("%s would kill me if I did that.", who)
-			p.bot.Send(c, bot.Message, message.Channel, msg)
-			return true
-		}
-		text := strings.Join(parts[3:], " ")
-
-		res := leftpad.LeftPad(text, length, padchar)
-
-		p.bot.Send(c, bot.Message, message.Channel, res)
+	maxLen, who := p.config.GetInt("LeftPad.MaxLen", 50), p.config.Get("LeftPad.Who", "Putin")
+	if length > maxLen && maxLen > 0 {
+		msg := fmt.Sprintf("%s would kill me if I did that.", who)
+		p.bot.Send(c, bot.Message, message.Channel, msg)
 		return true
 	}
 
-	return false
+	res := leftpad.LeftPad(args.String("text"), length, args.String("padchar"))
+
+	p.bot.Send(c, bot.Message, message.Channel, res)
+	return true
 }
@@ -37,29 +37,29 @@ func makePlugin(t *testing.T) (*LeftpadPlugin, *bot.MockBot) {
 }
 
 func TestLeftpad(t *testing.T) {
-	p, mb := makePlugin(t)
-	p.message(makeMessage("!leftpad test 8 test"))
+	_, mb := makePlugin(t)
+	mb.Receive(makeMessage("!leftpad test 8 test"))
 	assert.Contains(t, mb.Messages[0], "testtest")
 	assert.Len(t, mb.Messages, 1)
 }
 
 func TestBadNumber(t *testing.T) {
-	p, mb := makePlugin(t)
-	p.message(makeMessage("!leftpad test fuck test"))
+	_, mb := makePlugin(t)
+	mb.Receive(makeMessage("!leftpad test fuck test"))
 	assert.Contains(t, mb.Messages[0], "Invalid")
 	assert.Len(t, mb.Messages, 1)
 }
 
 func TestNotCommand(t *testing.T) {
-	p, mb := makePlugin(t)
-	p.message(makeMessage("leftpad test fuck test"))
+	_, mb := makePlugin(t)
+	mb.Receive(makeMessage("leftpad test fuck test"))
 	assert.Len(t, mb.Messages, 0)
 }
 
 func TestNoMaxLen(t *testing.T) {
 	p, mb := makePlugin(t)
 	p.config.Set("LeftPad.MaxLen", "0")
-	p.message(makeMessage("!leftpad dicks 100 dicks"))
+	mb.Receive(makeMessage("!leftpad dicks 100 dicks"))
 	assert.Len(t, mb.Messages, 1)
 	assert.Contains(t, mb.Messages[0], "dicks")
 }
@@ -68,7 +68,7 @@ func Test50Padding(t *testing.T) {
 	p, mb := makePlugin(t)
 	p.config.Set("LeftPad.MaxLen", "50")
 	assert.Equal(t, 50, p.config.GetInt("LeftPad.MaxLen", 100))
-	p.message(makeMessage("!leftpad dicks 100 dicks"))
+	mb.Receive(makeMessage("!leftpad dicks 100 dicks"))
 	assert.Len(t, mb.Messages, 1)
 	assert.Contains(t, mb.Messages[0], "kill me")
 }
@@ -76,13 +76,13 @@ func Test50Padding(t *testing.T) {
 func TestUnder50Padding(t *testing.T) {
 	p, mb := makePlugin(t)
 	p.config.Set("LeftPad.MaxLen", "50")
-	p.message(makeMessage("!leftpad dicks 49 dicks"))
+	mb.Receive(makeMessage("!leftpad dicks 49 dicks"))
 	assert.Len(t, mb.Messages, 1)
 	assert.Contains(t, mb.Messages[0], "dicks")
 }
 
 func TestNotPadding(t *testing.T) {
-	p, mb := makePlugin(t)
-	p.message(makeMessage("!lololol"))
+	_, mb := makePlugin(t)
+	mb.Receive(makeMessage("!lololol"))
 	assert.Len(t, mb.Messages, 0)
 }
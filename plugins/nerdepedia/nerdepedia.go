@@ -33,7 +33,7 @@ func New(b bot.Bot) *NerdepediaPlugin {
 		config: b.Config(),
 	}
 	b.Register(np, bot.Message, np.message)
-	b.Register(np, bot.Help, np.help)
+	np.registerCommands()
 	return np
 }
 
@@ -56,7 +56,11 @@ func (p *NerdepediaPlugin) message(c bot.Connector, kind bot.Kind, message msg.M
 	}
 
 	if query != "" {
-		resp, err := http.Get(query)
+		req, err := http.NewRequestWithContext(message.Ctx(), http.MethodGet, query, nil)
+		if err != nil {
+			return false
+		}
+		resp, err := http.DefaultClient.Do(req)
 		if err != nil {
 			return false
 		}
@@ -89,8 +93,10 @@ func (p *NerdepediaPlugin) message(c bot.Connector, kind bot.Kind, message msg.M
 	return false
 }
 
-// Help responds to help requests. Every plugin must implement a help function.
-func (p *NerdepediaPlugin) help(c bot.Connector, kind bot.Kind, message msg.Message, args ...interface{}) bool {
-	p.bot.Send(c, bot.Message, message.Channel, "nerd stuff")
-	return true
+func (p *NerdepediaPlugin) registerCommands() {
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern:  "may the force be with you",
+		Usage:    "links some nerd stuff, as do a few other famous lines",
+		Examples: []string{"beam me up scotty", "one does not simply walk into mordor"},
+	})
 }
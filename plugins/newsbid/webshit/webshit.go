@@ -13,8 +13,35 @@ import (
 	"github.com/jmoiron/sqlx"
 	"github.com/mmcdole/gofeed"
 	"github.com/rs/zerolog/log"
+	"github.com/velour/catbase/bot/migrate"
 )
 
+func init() {
+	migrate.Register("webshit", migrate.Step{
+		Version: 1,
+		Name:    "create bid tables",
+		SQL: `create table if not exists webshit_bids (
+			id integer primary key autoincrement,
+			user string,
+			title string,
+			url string,
+			bid integer,
+			placed integer
+		);
+		create table if not exists webshit_balances (
+			user string primary key,
+			balance int,
+			score int
+		);`,
+	}, migrate.Step{
+		// Postgres reserves user, so every query had to quote it
+		Version: 2,
+		Name:    "rename user columns to player",
+		SQL: `alter table webshit_bids rename column "user" to player;
+		alter table webshit_balances rename column "user" to player;`,
+	})
+}
+
 type Config struct {
 	HNFeed          string
 	HNLimit         int
@@ -52,7 +79,7 @@ func (s Stories) Titles() string {
 
 type Bid struct {
 	ID     int
-	User   string
+	User   string `db:"player"`
 	Title  string
 	URL    string
 	Bid    int
@@ -89,19 +116,7 @@ func NewConfig(db *sqlx.DB, cfg Config) *Webshit {
 
 // setup will create any necessary SQL tables and populate them with minimal data
 func (w *Webshit) setup() {
-	w.db.MustExec(`create table if not exists webshit_bids (
-		id integer primary key autoincrement,
-		user string,
-		title string,
-		url string,
-		bid integer,
-		placed integer
-	)`)
-	w.db.MustExec(`create table if not exists webshit_balances (
-		user string primary key,
-		balance int,
-		score int
-	)`)
+	migrate.MustUp(w.db, "webshit")
 }
 
 func (w *Webshit) Check() ([]WeeklyResult, error) {
@@ -111,7 +126,7 @@ func (w *Webshit) Check() ([]WeeklyResult, error) {
 	}
 
 	var bids []Bid
-	if err = w.db.Select(&bids, `select user,title,url,bid from webshit_bids where placed < ?`,
+	if err = w.db.Select(&bids, `select player,title,url,bid from webshit_bids where placed < ?`,
 		published.Unix()); err != nil {
 		return nil, err
 	}
@@ -258,7 +273,7 @@ func (w *Webshit) GetWeekly() ([]Story, *time.Time, error) {
 // GetBalances returns the current balance for all known users
 // Any unknown user has a default balance on their first bid
 func (w *Webshit) GetBalance(user string) int {
-	q := `select balance from webshit_balances where user=?`
+	q := `select balance from webshit_balances where player=?`
 	var balance int
 	err := w.db.Get(&balance, q, user)
 	if err != nil {
@@ -268,7 +283,7 @@ func (w *Webshit) GetBalance(user string) int {
 }
 
 func (w *Webshit) GetScore(user string) int {
-	q := `select score from webshit_balances where user=?`
+	q := `select score from webshit_balances where player=?`
 	var score int
 	err := w.db.Get(&score, q, user)
 	if err != nil {
@@ -312,14 +327,14 @@ func (w *Webshit) Bid(user string, amount int, URL string) (Bid, error) {
 	ts := time.Now().Unix()
 
 	tx := w.db.MustBegin()
-	_, err = tx.Exec(`insert into webshit_bids (user,title,url,bid,placed) values (?,?,?,?,?)`,
+	_, err = tx.Exec(`insert into webshit_bids (player,title,url,bid,placed) values (?,?,?,?,?)`,
 		user, story.Title, story.URL, amount, ts)
 	if err != nil {
 		tx.Rollback()
 		return Bid{}, err
 	}
-	q := `insert into webshit_balances (user,balance,score) values (?,?,0)
-		on conflict(user) do update  set balance=?`
+	q := `insert into webshit_balances (player,balance,score) values (?,?,0)
+		on conflict(player) do update  set balance=?`
 	_, err = tx.Exec(q, user, bal-amount, bal-amount)
 	if err != nil {
 		tx.Rollback()
@@ -371,7 +386,7 @@ func (w *Webshit) getStoryByURL(URL string) (Story, error) {
 func (w *Webshit) updateScores(results []WeeklyResult) error {
 	tx := w.db.MustBegin()
 	for _, res := range results {
-		if _, err := tx.Exec(`update webshit_balances set score=? where user=?`,
+		if _, err := tx.Exec(`update webshit_balances set score=? where player=?`,
 			res.Score, res.User); err != nil {
 			tx.Rollback()
 			return err
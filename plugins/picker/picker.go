@@ -25,7 +25,7 @@ func New(b bot.Bot) *PickerPlugin {
 		bot: b,
 	}
 	b.Register(pp, bot.Message, pp.message)
-	b.Register(pp, bot.Help, pp.help)
+	pp.registerCommands()
 	return pp
 }
 
@@ -110,8 +110,10 @@ func (p *PickerPlugin) parse(body string) (int, []string, error) {
 	return n, items, nil
 }
 
-// Help responds to help requests. Every plugin must implement a help function.
-func (p *PickerPlugin) help(c bot.Connector, kind bot.Kind, message msg.Message, args ...interface{}) bool {
-	p.bot.Send(c, bot.Message, message.Channel, "Choose from a list of options. Try \"pick {a,b,c}\".")
-	return true
+func (p *PickerPlugin) registerCommands() {
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern:  "pick {n?} {options:text}",
+		Usage:    "chooses from a list of options",
+		Examples: []string{"pick {a,b,c}", "pick 2 {a,b,c}"},
+	})
 }
@@ -10,6 +10,20 @@ import (
 	"github.com/velour/catbase/config"
 )
 
+func init() {
+	config.Declare(
+		config.Key{Name: "Reaction.GeneralChance", Type: config.Float, Default: "0.01", Min: 0, Max: 1,
+			Description: "chance of reacting to a message"},
+		config.Key{Name: "Reaction.HarrassChance", Type: config.Float, Default: "0.05", Min: 0, Max: 1,
+			Description: "chance of reacting to somebody on Reaction.HarrassList"},
+		config.Key{Name: "Reaction.NegativeHarrassmentMultiplier", Type: config.Int, Default: "2", Min: 1, Max: 100,
+			Description: "how much likelier negative reactions are when harrassing"},
+		config.Key{Name: "Reaction.HarrassList", Type: config.Array, Description: "nicks to react to more often"},
+		config.Key{Name: "Reaction.PositiveReactions", Type: config.Array, Description: "emoji for positive reactions"},
+		config.Key{Name: "Reaction.NegativeReactions", Type: config.Array, Description: "emoji for negative reactions"},
+	)
+}
+
 type ReactionPlugin struct {
 	bot    bot.Bot
 	config *config.Config
@@ -33,10 +47,11 @@ func (p *ReactionPlugin) message(c bot.Connector, kind bot.Kind, message msg.Mes
 		}
 	}
 
-	chance := p.config.GetFloat64("Reaction.GeneralChance", 0.01)
+	channel := p.config.Scope(bot.Target(message.Connector, message.Channel))
+	chance := channel.GetFloat64("Reaction.GeneralChance", 0.01)
 	negativeWeight := 1
 	if harrass {
-		chance = p.config.GetFloat64("Reaction.HarrassChance", 0.05)
+		chance = channel.GetFloat64("Reaction.HarrassChance", 0.05)
 		negativeWeight = p.config.GetInt("Reaction.NegativeHarrassmentMultiplier", 2)
 	}
 
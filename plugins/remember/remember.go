@@ -10,30 +10,30 @@ import (
 	"github.com/jmoiron/sqlx"
 	"github.com/velour/catbase/bot"
 	"github.com/velour/catbase/bot/msg"
-	"github.com/velour/catbase/plugins/fact"
 )
 
 type RememberPlugin struct {
 	bot bot.Bot
-	log map[string][]msg.Message
 	db  *sqlx.DB
 }
 
 func New(b bot.Bot) *RememberPlugin {
 	p := &RememberPlugin{
 		bot: b,
-		log: make(map[string][]msg.Message),
 		db:  b.DB(),
 	}
 
 	b.Register(p, bot.Message, p.message)
-	b.Register(p, bot.Help, p.help)
+	p.registerCommands()
 
 	return p
 }
 
 func (p *RememberPlugin) message(c bot.Connector, kind bot.Kind, message msg.Message, args ...interface{}) bool {
 	if strings.ToLower(message.Body) == "quote" && message.Command {
+		if !p.bot.Limits().Allow(c, message, bot.Cooldown{Name: "quote", User: 10 * time.Second}) {
+			return true
+		}
 		q := p.randQuote()
 		p.bot.Send(c, bot.Message, message.Channel, q)
 
@@ -51,8 +51,13 @@ func (p *RememberPlugin) message(c bot.Connector, kind bot.Kind, message msg.Mes
 		// fuck this hoser
 		nick := parts[1]
 		snip := strings.Join(parts[2:], " ")
-		for i := len(p.log[message.Channel]) - 1; i >= 0; i-- {
-			entry := p.log[message.Channel][i]
+		limit := p.bot.Config().GetInt("Remember.SearchLimit", 100)
+		history, err := p.bot.MessageLog().Search(message.Connector, message.Channel, snip, limit)
+		if err != nil {
+			log.Error().Err(err).Msg("Could not search message log")
+		}
+		for i := len(history) - 1; i >= 0; i-- {
+			entry := history[i]
 			log.Debug().Msgf("Comparing %s:%s with %s:%s",
 				entry.User.Name, entry.Body, nick, snip)
 			if strings.ToLower(entry.User.Name) == strings.ToLower(nick) &&
@@ -71,17 +76,16 @@ func (p *RememberPlugin) message(c bot.Connector, kind bot.Kind, message msg.Mes
 
 				trigger := fmt.Sprintf("%s quotes", entry.User.Name)
 
-				fact := fact.Factoid{
-					Fact:     strings.ToLower(trigger),
-					Verb:     "reply",
-					Tidbit:   msg,
-					Owner:    user.Name,
-					Created:  time.Now(),
-					Accessed: time.Now(),
-					Count:    0,
-				}
-				if err := fact.Save(p.db); err != nil {
-					log.Error().Err(err)
+				learned := false
+				p.bot.Publish(bot.LearnFactoid{
+					Fact:    strings.ToLower(trigger),
+					Verb:    "reply",
+					Tidbit:  msg,
+					Owner:   user.Name,
+					Target:  bot.Target(message.Connector, message.Channel),
+					Learned: &learned,
+				})
+				if !learned {
 					p.bot.Send(c, bot.Message, message.Channel, "Tell somebody I'm broke.")
 				}
 
@@ -93,60 +97,39 @@ func (p *RememberPlugin) message(c bot.Connector, kind bot.Kind, message msg.Mes
 				msg = fmt.Sprintf("Okay, %s, remembering '%s'.",
 					message.User.Name, msg)
 				p.bot.Send(c, bot.Message, message.Channel, msg)
-				p.recordMsg(message)
 				return true
 
 			}
 		}
 		p.bot.Send(c, bot.Message, message.Channel, "Sorry, I don't know that phrase.")
-		p.recordMsg(message)
 		return true
 	}
 
-	p.recordMsg(message)
 	return false
 }
 
-func (p *RememberPlugin) help(c bot.Connector, kind bot.Kind, message msg.Message, args ...interface{}) bool {
-	msg := "remember will let you quote your idiot friends. Just type " +
-		"!remember <nick> <snippet> to remember what they said. Snippet can " +
-		"be any part of their message. Later on, you can ask for a random " +
-		"!quote."
-
-	p.bot.Send(c, bot.Message, message.Channel, msg)
-	return true
+func (p *RememberPlugin) registerCommands() {
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern:  "remember {who} {snippet:text}",
+		Usage:    "quotes what somebody said, found by a few words of their message",
+		Examples: []string{"remember alice idiot"},
+	})
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern: "quote",
+		Usage:   "says a random quote",
+	})
 }
 
 // deliver a random quote out of the db.
 // Note: this is the same cache for all channels joined. This plugin needs to be
 // expanded to have this function execute a quote for a particular channel
 func (p *RememberPlugin) randQuote() string {
-
-	var f fact.Factoid
-	var tmpCreated int64
-	var tmpAccessed int64
-	err := p.db.QueryRow(`select * from factoid where fact like '%quotes'
-		order by random() limit 1;`).Scan(
-		&f.ID,
-		&f.Fact,
-		&f.Tidbit,
-		&f.Verb,
-		&f.Owner,
-		&tmpCreated,
-		&tmpAccessed,
-		&f.Count,
-	)
+	var quote string
+	err := p.db.Get(&quote, `select tidbit from factoid where fact like '%quotes'
+		order by random() limit 1;`)
 	if err != nil {
 		log.Error().Err(err).Msg("Error getting quotes")
 		return "I had a problem getting your quote."
 	}
-	f.Created = time.Unix(tmpCreated, 0)
-	f.Accessed = time.Unix(tmpAccessed, 0)
-
-	return f.Tidbit
-}
-
-func (p *RememberPlugin) recordMsg(message msg.Message) {
-	log.Debug().Msgf("Logging message: %s: %s", message.User.Name, message.Body)
-	p.log[message.Channel] = append(p.log[message.Channel], message)
+	return quote
 }
@@ -45,6 +45,8 @@ func TestCornerCaseBug(t *testing.T) {
 
 	for _, m := range msgs {
 		p.message(&cli.CliPlugin{}, bot.Message, m)
+		// the bot logs each message after the plugins have seen it
+		mb.MessageLog().Log(m)
 	}
 	assert.Len(t, mb.Messages, 1)
 	assert.Contains(t, mb.Messages[0], "horse dick")
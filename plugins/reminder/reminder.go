@@ -18,10 +18,36 @@ import (
 	"github.com/olebedev/when/rules/en"
 
 	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/backup"
+	"github.com/velour/catbase/bot/migrate"
 	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/bot/schedule"
 	"github.com/velour/catbase/config"
 )
 
+func init() {
+	backup.Register("reminder", backup.Table{Name: "reminders"})
+	migrate.Register("reminder",
+		migrate.Step{
+			Version: 1,
+			Name:    "create reminders table",
+			SQL: `create table if not exists reminders (
+				id integer primary key,
+				fromWho string,
+				toWho string,
+				what string,
+				remindWhen string,
+				channel string
+			);`,
+		},
+		migrate.Step{
+			Version: 2,
+			Name:    "index reminders by time",
+			SQL:     `create index if not exists reminders_remindWhen on reminders (remindWhen);`,
+		},
+	)
+}
+
 const (
 	TIMESTAMP = "2006-01-02 15:04:05"
 )
@@ -30,7 +56,6 @@ type ReminderPlugin struct {
 	bot    bot.Bot
 	db     *sqlx.DB
 	mutex  *sync.Mutex
-	timer  *time.Timer
 	config *config.Config
 	when   *when.Parser
 }
@@ -45,20 +70,7 @@ type Reminder struct {
 }
 
 func New(b bot.Bot) *ReminderPlugin {
-	if _, err := b.DB().Exec(`create table if not exists reminders (
-			id integer primary key,
-			fromWho string,
-			toWho string,
-			what string,
-			remindWhen string,
-			channel string
-		);`); err != nil {
-		log.Fatal().Err(err)
-	}
-
-	dur, _ := time.ParseDuration("1h")
-	timer := time.NewTimer(dur)
-	timer.Stop()
+	migrate.MustUp(b.DB(), "reminder")
 
 	w := when.New(nil)
 	w.Add(en.All...)
@@ -68,23 +80,23 @@ func New(b bot.Bot) *ReminderPlugin {
 		bot:    b,
 		db:     b.DB(),
 		mutex:  &sync.Mutex{},
-		timer:  timer,
 		config: b.Config(),
 		when:   w,
 	}
 
+	b.Scheduler().Handle("reminder", plugin.reminderer)
 	plugin.queueUpNextReminder()
 
-	go reminderer(b.DefaultConnector(), plugin)
-
 	b.Register(plugin, bot.Message, plugin.message)
-	b.Register(plugin, bot.Help, plugin.help)
+	plugin.registerCommands()
 
 	return plugin
 }
 
 func (p *ReminderPlugin) message(c bot.Connector, kind bot.Kind, message msg.Message, args ...interface{}) bool {
 	channel := message.Channel
+	// reminders remember which connector they came from
+	target := bot.Target(message.Connector, channel)
 	from := message.User.Name
 
 	var dur, dur2 time.Duration
@@ -128,7 +140,7 @@ func (p *ReminderPlugin) message(c bot.Connector, kind bot.Kind, message msg.Mes
 					who:     who,
 					what:    what,
 					when:    when,
-					channel: channel,
+					channel: target,
 				})
 
 			} else if operator == "every" && strings.ToLower(parts[4]) == "for" {
@@ -159,7 +171,7 @@ func (p *ReminderPlugin) message(c bot.Connector, kind bot.Kind, message msg.Mes
 						who:     who,
 						what:    what,
 						when:    when,
-						channel: channel,
+						channel: target,
 					})
 
 					when = when.Add(dur)
@@ -216,9 +228,26 @@ func (p *ReminderPlugin) message(c bot.Connector, kind bot.Kind, message msg.Mes
 	return false
 }
 
-func (p *ReminderPlugin) help(c bot.Connector, kind bot.Kind, message msg.Message, args ...interface{}) bool {
-	p.bot.Send(c, bot.Message, message.Channel, "Pester someone with a reminder. Try \"remind <user> in <duration> message\".\n\nUnsure about duration syntax? Check https://golang.org/pkg/time/#ParseDuration")
-	return true
+func (p *ReminderPlugin) registerCommands() {
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern:  "remind {who} in {when:duration} {what:text}",
+		Usage:    "pesters somebody later, also at or on a time",
+		Examples: []string{"remind me in 1h stretch"},
+	})
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern:  "remind {who} every {interval:duration} for {total:duration} {what:text}",
+		Usage:    "pesters somebody again and again",
+		Examples: []string{"remind bob every 24h for 168h buy a kit"},
+	})
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern:  "list reminders",
+		Usage:    "lists the reminders in this channel, or to or from someone",
+		Examples: []string{"list reminders to me"},
+	})
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern: "cancel reminder {id:int}",
+		Usage:   "cancels a reminder",
+	})
 }
 
 func (p *ReminderPlugin) getNextReminder() *Reminder {
@@ -343,39 +372,48 @@ func (p *ReminderPlugin) getAllRemindersToMeFormatted(channel, me string) (strin
 	return p.getRemindersFormatted(fmt.Sprintf("where toWho = '%s'", me))
 }
 
+// queueUpNextReminder schedules a job for the soonest reminder
 func (p *ReminderPlugin) queueUpNextReminder() {
 	nextReminder := p.getNextReminder()
 
 	if nextReminder != nil {
-		p.timer.Reset(nextReminder.when.Sub(time.Now().UTC()))
+		at := time.Now().Add(nextReminder.when.Sub(time.Now().UTC()))
+		if err := p.bot.Scheduler().Once("reminder.next", "reminder", at, ""); err != nil {
+			log.Error().Err(err).Msg("Could not schedule the next reminder")
+		}
 	}
 }
 
-func reminderer(c bot.Connector, p *ReminderPlugin) {
-	for {
-		<-p.timer.C
+// reminderer sends the reminder that is due and schedules the next one
+func (p *ReminderPlugin) reminderer(job schedule.Job) {
+	reminder := p.getNextReminder()
 
-		reminder := p.getNextReminder()
-
-		if reminder != nil && time.Now().UTC().After(reminder.when) {
-			var message string
-			if reminder.from == reminder.who {
-				reminder.from = "you"
-				message = fmt.Sprintf("Hey %s, you wanted to be reminded: %s", reminder.who, reminder.what)
-			} else {
-				message = fmt.Sprintf("Hey %s, %s wanted you to be reminded: %s", reminder.who, reminder.from, reminder.what)
-			}
-
-			p.bot.Send(c, bot.Message, reminder.channel, message)
-
-			if err := p.deleteReminder(reminder.id); err != nil {
-				log.Error().
-					Int64("id", reminder.id).
-					Err(err).
-					Msg("this will cause problems, we need to stop now.")
-			}
+	if reminder != nil && time.Now().UTC().After(reminder.when) {
+		var message string
+		if reminder.from == reminder.who {
+			reminder.from = "you"
+			message = fmt.Sprintf("Hey %s, you wanted to be reminded: %s", reminder.who, reminder.what)
+		} else {
+			message = fmt.Sprintf("Hey %s, %s wanted you to be reminded: %s", reminder.who, reminder.from, reminder.what)
 		}
 
-		p.queueUpNextReminder()
+		c, channel := p.bot.ResolveTarget(reminder.channel)
+		p.bot.Send(c, bot.Message, channel, message)
+		p.bot.Publish(bot.ReminderFired{
+			ID:     reminder.id,
+			From:   reminder.from,
+			Who:    reminder.who,
+			What:   reminder.what,
+			Target: reminder.channel,
+		})
+
+		if err := p.deleteReminder(reminder.id); err != nil {
+			log.Error().
+				Int64("id", reminder.id).
+				Err(err).
+				Msg("this will cause problems, we need to stop now.")
+		}
 	}
+
+	p.queueUpNextReminder()
 }
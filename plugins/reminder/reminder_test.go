@@ -224,6 +224,5 @@ func TestLimitList(t *testing.T) {
 func TestHelp(t *testing.T) {
 	c, mb := setup(t)
 	assert.NotNil(t, c)
-	c.help(&cli.CliPlugin{}, bot.Help, msg.Message{Channel: "channel"}, []string{})
-	assert.Len(t, mb.Messages, 1)
+	assert.Contains(t, mb.Help(c), "remind <who> in <when> <what...>")
 }
@@ -3,6 +3,9 @@ package rpgORdie
 import (
 	"fmt"
 	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
 
 	"github.com/velour/catbase/bot"
 	"github.com/velour/catbase/bot/msg"
@@ -19,9 +22,11 @@ const (
 	WIN     = iota
 )
 
+// idleTimeout is how long a game waits for a move before it is abandoned
+var idleTimeout = time.Hour
+
 type RPGPlugin struct {
-	bot       bot.Bot
-	listenFor map[string]*board
+	bot bot.Bot
 }
 
 type board struct {
@@ -99,61 +104,74 @@ func (b *board) checkAndMove(dx, dy int) int {
 
 func New(b bot.Bot) *RPGPlugin {
 	rpg := &RPGPlugin{
-		bot:       b,
-		listenFor: map[string]*board{},
+		bot: b,
 	}
 	b.Register(rpg, bot.Message, rpg.message)
-	b.Register(rpg, bot.Reply, rpg.replyMessage)
-	b.Register(rpg, bot.Help, rpg.help)
+	rpg.registerCommands()
 	return rpg
 }
 
 func (p *RPGPlugin) message(c bot.Connector, kind bot.Kind, message msg.Message, args ...interface{}) bool {
 	if strings.ToLower(message.Body) == "start rpg" {
 		b := NewRandomBoard()
-		ts, _ := p.bot.Send(c, bot.Message, message.Channel, b.toMessageString())
-		p.listenFor[ts] = b
-		p.bot.Send(c, bot.Reply, message.Channel, "Over here.", ts)
+		ts, err := p.bot.SendAndWait(c, bot.Message, message.Channel, b.toMessageString())
+		if err != nil {
+			log.Error().Err(err).Msg("Could not show the board")
+			return true
+		}
+		p.play(c, message.Channel, ts, b, "Over here.")
 		return true
 	}
 	return false
 }
 
-func (p *RPGPlugin) help(c bot.Connector, kind bot.Kind, message msg.Message, args ...interface{}) bool {
-	p.bot.Send(c, bot.Message, message.Channel, "Go find a walkthrough or something.")
-	return true
+func (p *RPGPlugin) registerCommands() {
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern: "start rpg",
+		Usage:   "starts a game; reply up, down, left or right to move",
+	})
 }
 
-func (p *RPGPlugin) replyMessage(c bot.Connector, kind bot.Kind, message msg.Message, args ...interface{}) bool {
-	identifier := args[0].(string)
-	if strings.ToLower(message.User.Name) != strings.ToLower(p.bot.Config().Get("Nick", "bot")) {
-		if b, ok := p.listenFor[identifier]; ok {
-
-			var res int
-
-			if message.Body == "left" {
-				res = b.checkAndMove(-1, 0)
-			} else if message.Body == "right" {
-				res = b.checkAndMove(1, 0)
-			} else if message.Body == "up" {
-				res = b.checkAndMove(0, -1)
-			} else if message.Body == "down" {
-				res = b.checkAndMove(0, 1)
-			} else {
-				return false
-			}
-
-			switch res {
-			case OK:
-				p.bot.Send(c, bot.Edit, message.Channel, b.toMessageString(), identifier)
-			case WIN:
-				p.bot.Send(c, bot.Edit, message.Channel, b.toMessageString(), identifier)
-				p.bot.Send(c, bot.Reply, message.Channel, "congratulations, you beat the easiest level imaginable.", identifier)
-			case INVALID:
-				p.bot.Send(c, bot.Reply, message.Channel, fmt.Sprintf("you can't move %s", message.Body), identifier)
-			}
-			return true
-		}
+// play waits for the next move in the board's thread
+func (p *RPGPlugin) play(c bot.Connector, channel, ts string, b *board, question string) {
+	p.bot.Ask(p, bot.Prompt{
+		Connector: c,
+		Channel:   channel,
+		Thread:    ts,
+		Question:  question,
+		Timeout:   idleTimeout,
+		Answer: func(c bot.Connector, message msg.Message) bool {
+			return p.move(c, message, ts, b)
+		},
+	})
+}
+
+func (p *RPGPlugin) move(c bot.Connector, message msg.Message, ts string, b *board) bool {
+	var res int
+
+	if message.Body == "left" {
+		res = b.checkAndMove(-1, 0)
+	} else if message.Body == "right" {
+		res = b.checkAndMove(1, 0)
+	} else if message.Body == "up" {
+		res = b.checkAndMove(0, -1)
+	} else if message.Body == "down" {
+		res = b.checkAndMove(0, 1)
+	} else {
+		p.play(c, message.Channel, ts, b, "")
+		return false
 	}
-	return false
+
+	switch res {
+	case OK:
+		p.bot.Send(c, bot.Edit, message.Channel, b.toMessageString(), ts)
+	case WIN:
+		p.bot.Send(c, bot.Edit, message.Channel, b.toMessageString(), ts)
+		p.bot.Send(c, bot.Reply, message.Channel, "congratulations, you beat the easiest level imaginable.", ts)
+		return true
+	case INVALID:
+		p.bot.Send(c, bot.Reply, message.Channel, fmt.Sprintf("you can't move %s", message.Body), ts)
+	}
+	p.play(c, message.Channel, ts, b, "")
+	return true
 }
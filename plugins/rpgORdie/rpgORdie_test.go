@@ -1 +1,69 @@
 package rpgORdie
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/bot/user"
+	"github.com/velour/catbase/plugins/cli"
+)
+
+var c = &cli.CliPlugin{}
+
+func makeMessage(body string) msg.Message {
+	return msg.Message{
+		User:    &user.User{Name: "tester"},
+		Channel: "test",
+		Body:    body,
+	}
+}
+
+// start begins a game and gives the ID of its board
+func start(t *testing.T) (*RPGPlugin, *bot.MockBot, string) {
+	mb := bot.NewMockBot()
+	p := New(mb)
+	assert.True(t, p.message(c, bot.Message, makeMessage("start rpg")))
+	assert.Len(t, mb.Messages, 1)
+	assert.Equal(t, []string{"Over here."}, mb.Replies)
+	return p, mb, "m-0"
+}
+
+func move(mb *bot.MockBot, board, dir string) bool {
+	return mb.Receive(c, bot.Reply, makeMessage(dir), board)
+}
+
+func TestMove(t *testing.T) {
+	_, mb, board := start(t)
+	before := mb.Messages[0]
+	assert.True(t, move(mb, board, "up"))
+	assert.NotEqual(t, before, mb.Messages[0])
+	assert.True(t, move(mb, board, "right"))
+	assert.Equal(t, "you can't move right", mb.Replies[len(mb.Replies)-1])
+}
+
+func TestOnlyMovesAreAnswers(t *testing.T) {
+	_, mb, board := start(t)
+	assert.False(t, move(mb, board, "hello"))
+	assert.True(t, move(mb, board, "up"))
+	assert.False(t, mb.Receive(c, bot.Message, makeMessage("up")), "moves are made in the board's thread")
+}
+
+func TestWin(t *testing.T) {
+	_, mb, board := start(t)
+	for _, dir := range []string{"up", "up", "left", "left", "left", "down", "left", "up", "up"} {
+		assert.True(t, move(mb, board, dir))
+	}
+	assert.Equal(t, "congratulations, you beat the easiest level imaginable.", mb.Replies[len(mb.Replies)-1])
+	assert.False(t, move(mb, board, "down"), "the game is over")
+}
+
+func TestIdleGamesAreAbandoned(t *testing.T) {
+	defer func(d time.Duration) { idleTimeout = d }(idleTimeout)
+	idleTimeout = 10 * time.Millisecond
+	_, mb, board := start(t)
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, move(mb, board, "up"))
+}
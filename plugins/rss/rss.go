@@ -3,17 +3,31 @@ package rss
 import (
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/velour/catbase/bot"
 	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/config"
 
 	"github.com/mmcdole/gofeed"
 )
 
+func init() {
+	config.Declare(
+		config.Key{Name: "rss.shelfLife", Type: config.Int, Default: "20", Min: 1, Max: 10080,
+			Description: "minutes a feed is cached"},
+		config.Key{Name: "rss.maxLines", Type: config.Int, Default: "5", Min: 1, Max: 100,
+			Description: "feed lines shown at a time"},
+	)
+}
+
 type RSSPlugin struct {
-	bot       bot.Bot
-	cache     map[string]*cacheItem
+	bot   bot.Bot
+	cache map[string]*cacheItem
+
+	// settings are reloaded whenever they are changed
+	sync.Mutex
 	shelfLife time.Duration
 	maxLines  int
 }
@@ -51,23 +65,38 @@ func (c *cacheItem) getCurrentPage(maxLines int) string {
 
 func New(b bot.Bot) *RSSPlugin {
 	rss := &RSSPlugin{
-		bot:       b,
-		cache:     map[string]*cacheItem{},
-		shelfLife: time.Minute * time.Duration(b.Config().GetInt("rss.shelfLife", 20)),
-		maxLines:  b.Config().GetInt("rss.maxLines", 5),
+		bot:   b,
+		cache: map[string]*cacheItem{},
 	}
+	rss.loadSettings(config.Change{})
+	b.Config().Subscribe("rss.shelfLife", rss.loadSettings)
+	b.Config().Subscribe("rss.maxLines", rss.loadSettings)
 	b.Register(rss, bot.Message, rss.message)
-	b.Register(rss, bot.Help, rss.help)
+	rss.registerCommands()
 	return rss
 }
 
+func (p *RSSPlugin) loadSettings(config.Change) {
+	p.Lock()
+	defer p.Unlock()
+	p.shelfLife = time.Minute * time.Duration(p.bot.Config().GetInt("rss.shelfLife", 20))
+	p.maxLines = p.bot.Config().GetInt("rss.maxLines", 5)
+}
+
+func (p *RSSPlugin) settings() (time.Duration, int) {
+	p.Lock()
+	defer p.Unlock()
+	return p.shelfLife, p.maxLines
+}
+
 func (p *RSSPlugin) message(c bot.Connector, kind bot.Kind, message msg.Message, args ...interface{}) bool {
 	tokens := strings.Fields(message.Body)
 	numTokens := len(tokens)
 
 	if numTokens == 2 && strings.ToLower(tokens[0]) == "rss" {
+		shelfLife, maxLines := p.settings()
 		if item, ok := p.cache[strings.ToLower(tokens[1])]; ok && time.Now().Before(item.expiration) {
-			p.bot.Send(c, bot.Message, message.Channel, item.getCurrentPage(p.maxLines))
+			p.bot.Send(c, bot.Message, message.Channel, item.getCurrentPage(maxLines))
 			return true
 		} else {
 			fp := gofeed.NewParser()
@@ -79,7 +108,7 @@ func (p *RSSPlugin) message(c bot.Connector, kind bot.Kind, message msg.Message,
 			item := &cacheItem{
 				key:         strings.ToLower(tokens[1]),
 				data:        []string{feed.Title},
-				expiration:  time.Now().Add(p.shelfLife),
+				expiration:  time.Now().Add(shelfLife),
 				currentLine: 0,
 			}
 
@@ -89,7 +118,7 @@ func (p *RSSPlugin) message(c bot.Connector, kind bot.Kind, message msg.Message,
 
 			p.cache[strings.ToLower(tokens[1])] = item
 
-			p.bot.Send(c, bot.Message, message.Channel, item.getCurrentPage(p.maxLines))
+			p.bot.Send(c, bot.Message, message.Channel, item.getCurrentPage(maxLines))
 			return true
 		}
 	}
@@ -97,8 +126,10 @@ func (p *RSSPlugin) message(c bot.Connector, kind bot.Kind, message msg.Message,
 	return false
 }
 
-// Help responds to help requests. Every plugin must implement a help function.
-func (p *RSSPlugin) help(c bot.Connector, kind bot.Kind, message msg.Message, args ...interface{}) bool {
-	p.bot.Send(c, bot.Message, message.Channel, "try '!rss http://rss.cnn.com/rss/edition.rss'")
-	return true
+func (p *RSSPlugin) registerCommands() {
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern:  "rss {url}",
+		Usage:    "shows the latest items of a feed",
+		Examples: []string{"rss http://rss.cnn.com/rss/edition.rss"},
+	})
 }
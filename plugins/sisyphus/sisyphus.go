@@ -5,12 +5,14 @@ import (
 	"math/rand"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/rs/zerolog/log"
 
 	"github.com/velour/catbase/bot"
 	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/bot/schedule"
 )
 
 const (
@@ -18,14 +20,21 @@ const (
 	MOUNTAIN = ":new_moon:"
 )
 
+// gameTimeout is how long a game waits for a reply, well past when the boulder rolls back down
+var gameTimeout = 24 * time.Hour
+
 type SisyphusPlugin struct {
-	bot       bot.Bot
-	listenFor map[string]*game
+	bot bot.Bot
+
+	// the lock guards games and everything in them, since timers and answers arrive on their own goroutines
+	sync.Mutex
+	games map[string]*game
 }
 
 type game struct {
 	id       string
 	channel  string
+	conn     bot.Connector
 	bot      bot.Bot
 	who      string
 	start    time.Time
@@ -33,85 +42,76 @@ type game struct {
 	current  int
 	nextPush time.Time
 	nextDec  time.Time
-	timers   [2]*time.Timer
 	ended    bool
 	nextAns  int
+	conv     *bot.Conversation
 }
 
-func NewRandomGame(c bot.Connector, b bot.Bot, channel, who string) *game {
+func NewRandomGame(c bot.Connector, b bot.Bot, channel, who string) (*game, error) {
 	size := rand.Intn(9) + 2
 	g := game{
 		channel: channel,
+		conn:    c,
 		bot:     b,
 		who:     who,
 		start:   time.Now(),
 		size:    size,
 		current: size / 2,
 	}
-	g.id, _ = b.Send(c, bot.Message, channel, g.toMessageString())
+	id, err := b.SendAndWait(c, bot.Message, channel, g.toMessageString())
+	if err != nil {
+		return nil, err
+	}
+	g.id = id
 
-	g.schedulePush(c)
-	g.scheduleDecrement(c)
+	g.schedulePush()
+	g.scheduleDecrement()
 
-	return &g
+	return &g, nil
 }
 
-func (g *game) scheduleDecrement(c bot.Connector) {
-	if g.timers[0] != nil {
-		g.timers[0].Stop()
-	}
+func (g *game) scheduleDecrement() {
 	minDec := g.bot.Config().GetInt("Sisyphus.MinDecrement", 10)
 	maxDec := g.bot.Config().GetInt("Sisyphus.MaxDecrement", 30)
 	g.nextDec = time.Now().Add(time.Duration(minDec+rand.Intn(maxDec)) * time.Minute)
-	go func() {
-		t := time.NewTimer(g.nextDec.Sub(time.Now()))
-		g.timers[0] = t
-		select {
-		case <-t.C:
-			g.handleDecrement(c)
-		}
-	}()
+	if err := g.bot.Scheduler().Once("sisyphus.decrement:"+g.id, "sisyphus.decrement", g.nextDec, g.id); err != nil {
+		log.Error().Err(err).Msg("Could not schedule the boulder rolling back")
+	}
 }
 
-func (g *game) schedulePush(c bot.Connector) {
-	if g.timers[1] != nil {
-		g.timers[1].Stop()
-	}
+func (g *game) schedulePush() {
 	minPush := g.bot.Config().GetInt("Sisyphus.MinPush", 1)
 	maxPush := g.bot.Config().GetInt("Sisyphus.MaxPush", 10)
 	g.nextPush = time.Now().Add(time.Duration(rand.Intn(maxPush)+minPush) * time.Minute)
-	go func() {
-		t := time.NewTimer(g.nextPush.Sub(time.Now()))
-		g.timers[1] = t
-		select {
-		case <-t.C:
-			g.handleNotify(c)
-		}
-	}()
+	if err := g.bot.Scheduler().Once("sisyphus.push:"+g.id, "sisyphus.push", g.nextPush, g.id); err != nil {
+		log.Error().Err(err).Msg("Could not schedule the next push")
+	}
 }
 
 func (g *game) endGame() {
-	for _, t := range g.timers {
-		t.Stop()
+	if g.conv != nil {
+		g.conv.Cancel()
 	}
+	g.bot.Scheduler().Cancel("sisyphus.decrement:" + g.id)
+	g.bot.Scheduler().Cancel("sisyphus.push:" + g.id)
 	g.ended = true
 }
 
-func (g *game) handleDecrement(c bot.Connector) {
+func (g *game) handleDecrement() {
 	g.current++
-	g.bot.Send(c, bot.Edit, g.channel, g.toMessageString(), g.id)
+	g.bot.Send(g.conn, bot.Edit, g.channel, g.toMessageString(), g.id)
 	if g.current > g.size-2 {
-		g.bot.Send(c, bot.Reply, g.channel, "you lose", g.id)
+		g.bot.Send(g.conn, bot.Reply, g.channel, "you lose", g.id)
 		msg := fmt.Sprintf("%s just lost the game after %s", g.who, time.Now().Sub(g.start))
-		g.bot.Send(c, bot.Message, g.channel, msg)
+		g.bot.Send(g.conn, bot.Message, g.channel, msg)
 		g.endGame()
 	} else {
-		g.scheduleDecrement(c)
+		g.scheduleDecrement()
 	}
 }
 
-func (g *game) handleNotify(c bot.Connector) {
-	g.bot.Send(c, bot.Reply, g.channel, "You can push now.\n"+g.generateQuestion(), g.id)
+func (g *game) handleNotify() {
+	g.bot.Send(g.conn, bot.Reply, g.channel, "You can push now.\n"+g.generateQuestion(), g.id)
 }
 
 func (g *game) generateQuestion() string {
@@ -164,63 +164,105 @@ func (g *game) toMessageString() string {
 
 func New(b bot.Bot) *SisyphusPlugin {
 	sp := &SisyphusPlugin{
-		bot:       b,
-		listenFor: map[string]*game{},
+		bot:   b,
+		games: map[string]*game{},
 	}
+	b.Scheduler().Handle("sisyphus.decrement", sp.gameJob((*game).handleDecrement))
+	b.Scheduler().Handle("sisyphus.push", sp.gameJob((*game).handleNotify))
 	b.Register(sp, bot.Message, sp.message)
-	b.Register(sp, bot.Reply, sp.replyMessage)
-	b.Register(sp, bot.Help, sp.help)
+	sp.registerCommands()
 	return sp
 }
 
+// gameJob runs a timer of the game a job is for
+// Games only live in memory, so jobs left over from before a restart are dropped.
+func (p *SisyphusPlugin) gameJob(f func(*game)) schedule.Handler {
+	return func(job schedule.Job) {
+		p.Lock()
+		defer p.Unlock()
+		if g, ok := p.games[job.Payload]; ok {
+			f(g)
+			p.forgetEnded(g)
+		}
+	}
+}
+
+// forgetEnded drops a game once it is over
+// The plugin must be locked.
+func (p *SisyphusPlugin) forgetEnded(g *game) {
+	if g.ended {
+		delete(p.games, g.id)
+	}
+}
+
 func (p *SisyphusPlugin) message(c bot.Connector, kind bot.Kind, message msg.Message, args ...interface{}) bool {
 	if strings.ToLower(message.Body) == "start sisyphus" {
-		b := NewRandomGame(c, p.bot, message.Channel, message.User.Name)
-		p.listenFor[b.id] = b
-		p.bot.Send(c, bot.Reply, message.Channel, "Over here.", b.id)
+		p.Lock()
+		defer p.Unlock()
+		g, err := NewRandomGame(c, p.bot, message.Channel, message.User.Name)
+		if err != nil {
+			log.Error().Err(err).Msg("Could not show the mountain")
+			return true
+		}
+		p.games[g.id] = g
+		p.listen(g, "Over here.")
 		return true
 	}
 	return false
 }
 
-func (p *SisyphusPlugin) help(c bot.Connector, kind bot.Kind, message msg.Message, args ...interface{}) bool {
-	p.bot.Send(c, bot.Message, message.Channel, "https://en.wikipedia.org/wiki/Sisyphus")
-	return true
+func (p *SisyphusPlugin) registerCommands() {
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern: "start sisyphus",
+		Usage:   "starts pushing a boulder up a hill; answer in its thread to push, or say end game",
+	})
+}
+
+// listen waits for the next reply in the game's thread
+func (p *SisyphusPlugin) listen(g *game, question string) {
+	g.conv = p.bot.Ask(p, bot.Prompt{
+		Connector: g.conn,
+		Channel:   g.channel,
+		Thread:    g.id,
+		Question:  question,
+		Timeout:   gameTimeout,
+		Answer: func(c bot.Connector, message msg.Message) bool {
+			return p.answer(c, message, g)
+		},
+	})
 }
 
-func (p *SisyphusPlugin) replyMessage(c bot.Connector, kind bot.Kind, message msg.Message, args ...interface{}) bool {
-	identifier := args[0].(string)
-	if strings.ToLower(message.User.Name) != strings.ToLower(p.bot.Config().Get("Nick", "bot")) {
-		if g, ok := p.listenFor[identifier]; ok {
-
-			log.Debug().Msgf("got message on %s: %+v", identifier, message)
-
-			if g.ended {
-				return false
-			}
-
-			if strings.ToLower(message.Body) == "end game" {
-				g.endGame()
-				return true
-			}
-
-			if time.Now().After(g.nextPush) {
-				if g.checkAnswer(message.Body) {
-					p.bot.Send(c, bot.Edit, message.Channel, g.toMessageString(), identifier)
-					g.schedulePush(c)
-					msg := fmt.Sprintf("Ok. You can push again in %s", g.nextPush.Sub(time.Now()))
-					p.bot.Send(c, bot.Reply, message.Channel, msg, identifier)
-				} else {
-					p.bot.Send(c, bot.Reply, message.Channel, "you lose", identifier)
-					msg := fmt.Sprintf("%s just lost the sisyphus game after %s", g.who, time.Now().Sub(g.start))
-					p.bot.Send(c, bot.Message, message.Channel, msg)
-					g.endGame()
-				}
-			} else {
-				p.bot.Send(c, bot.Reply, message.Channel, "you cannot push yet", identifier)
-			}
+func (p *SisyphusPlugin) answer(c bot.Connector, message msg.Message, g *game) bool {
+	log.Debug().Msgf("got message on %s: %+v", g.id, message)
+
+	p.Lock()
+	defer p.Unlock()
+	defer p.forgetEnded(g)
+	if g.ended {
+		return false
+	}
+
+	if strings.ToLower(message.Body) == "end game" {
+		g.endGame()
+		return true
+	}
+
+	if time.Now().After(g.nextPush) {
+		if g.checkAnswer(message.Body) {
+			p.bot.Send(c, bot.Edit, message.Channel, g.toMessageString(), g.id)
+			g.schedulePush()
+			msg := fmt.Sprintf("Ok. You can push again in %s", g.nextPush.Sub(time.Now()))
+			p.bot.Send(c, bot.Reply, message.Channel, msg, g.id)
+		} else {
+			p.bot.Send(c, bot.Reply, message.Channel, "you lose", g.id)
+			msg := fmt.Sprintf("%s just lost the sisyphus game after %s", g.who, time.Now().Sub(g.start))
+			p.bot.Send(c, bot.Message, message.Channel, msg)
+			g.endGame()
 			return true
 		}
+	} else {
+		p.bot.Send(c, bot.Reply, message.Channel, "you cannot push yet", g.id)
 	}
-	return false
+	p.listen(g, "")
+	return true
 }
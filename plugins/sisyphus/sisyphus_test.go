@@ -1 +1,111 @@
 package sisyphus
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/bot/schedule"
+	"github.com/velour/catbase/bot/user"
+	"github.com/velour/catbase/plugins/cli"
+)
+
+var c = &cli.CliPlugin{}
+
+func makeMessage(body string) msg.Message {
+	return msg.Message{
+		User:    &user.User{Name: "tester"},
+		Channel: "test",
+		Body:    body,
+	}
+}
+
+// start begins a game and hands back the game itself
+func start(t *testing.T) (*SisyphusPlugin, *bot.MockBot, *game) {
+	mb := bot.NewMockBot()
+	p := New(mb)
+	assert.True(t, p.message(c, bot.Message, makeMessage("start sisyphus")))
+	assert.Len(t, mb.Messages, 1)
+	assert.Equal(t, []string{"Over here."}, mb.Replies)
+	g, ok := p.games["m-0"]
+	assert.True(t, ok)
+	return p, mb, g
+}
+
+func say(mb *bot.MockBot, g *game, body string) bool {
+	return mb.Receive(c, bot.Reply, makeMessage(body), g.id)
+}
+
+// ready lets the game take a push and gives its answer
+func ready(p *SisyphusPlugin, g *game) string {
+	p.Lock()
+	defer p.Unlock()
+	g.nextPush = time.Now().Add(-time.Second)
+	g.nextAns = 42
+	return strconv.Itoa(g.nextAns)
+}
+
+func lastReply(mb *bot.MockBot) string {
+	return mb.Replies[len(mb.Replies)-1]
+}
+
+func TestCannotPushYet(t *testing.T) {
+	p, mb, g := start(t)
+	p.Lock()
+	g.nextPush = time.Now().Add(time.Hour)
+	p.Unlock()
+	assert.True(t, say(mb, g, "42"))
+	assert.Equal(t, "you cannot push yet", lastReply(mb))
+	assert.True(t, say(mb, g, "42"), "the game keeps listening")
+}
+
+func TestPush(t *testing.T) {
+	p, mb, g := start(t)
+	p.Lock()
+	g.current = 2
+	p.Unlock()
+	assert.True(t, say(mb, g, ready(p, g)))
+	assert.Contains(t, lastReply(mb), "Ok. You can push again in")
+	assert.Equal(t, 1, g.current)
+	assert.False(t, g.ended)
+}
+
+func TestWrongAnswerLoses(t *testing.T) {
+	p, mb, g := start(t)
+	ready(p, g)
+	assert.True(t, say(mb, g, "7"))
+	assert.Equal(t, "you lose", lastReply(mb))
+	assert.True(t, g.ended)
+	assert.NotContains(t, p.games, g.id)
+	assert.False(t, say(mb, g, "42"), "the game is over")
+}
+
+func TestRollingBackLoses(t *testing.T) {
+	p, mb, g := start(t)
+	roll := p.gameJob((*game).handleDecrement)
+	for !g.ended {
+		roll(schedule.Job{Payload: g.id})
+	}
+	assert.Equal(t, "you lose", lastReply(mb))
+	assert.NotContains(t, p.games, g.id)
+	assert.False(t, say(mb, g, "end game"), "the game is over")
+}
+
+func TestEndGame(t *testing.T) {
+	p, mb, g := start(t)
+	assert.True(t, say(mb, g, "end game"))
+	assert.True(t, g.ended)
+	assert.NotContains(t, p.games, g.id)
+	assert.False(t, say(mb, g, ready(p, g)))
+}
+
+func TestIdleGamesStopListening(t *testing.T) {
+	defer func(d time.Duration) { gameTimeout = d }(gameTimeout)
+	gameTimeout = 10 * time.Millisecond
+	p, mb, g := start(t)
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, say(mb, g, ready(p, g)))
+}
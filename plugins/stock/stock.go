@@ -7,13 +7,19 @@ import (
 	"net/http"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/rs/zerolog/log"
 
 	"github.com/velour/catbase/bot"
 	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/config"
 )
 
+func init() {
+	config.Declare(config.Key{Name: "Stock.API_KEY", Secret: true, Description: "alphavantage API key"})
+}
+
 type StockPlugin struct {
 	bot    bot.Bot
 	apiKey string
@@ -25,7 +31,7 @@ func New(b bot.Bot) *StockPlugin {
 		apiKey: b.Config().GetString("Stock.API_KEY", "0E1DP61SJ7GF81IE"),
 	}
 	b.Register(s, bot.Message, s.message)
-	b.Register(s, bot.Help, s.help)
+	s.registerCommands()
 	return s
 }
 
@@ -55,16 +61,27 @@ func (p *StockPlugin) message(c bot.Connector, kind bot.Kind, message msg.Messag
 	numTokens := len(tokens)
 
 	if numTokens == 2 && strings.ToLower(tokens[0]) == "stock-price" {
+		if !p.bot.Limits().Allow(c, message, bot.Cooldown{Name: "stock", User: 30 * time.Second}) {
+			return true
+		}
 		query := fmt.Sprintf("https://www.alphavantage.co/query?function=GLOBAL_QUOTE&symbol=%s&apikey=%s", tokens[1], p.apiKey)
 
-		resp, err := http.Get(query)
+		req, err := http.NewRequestWithContext(message.Ctx(), http.MethodGet, query, nil)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to build stock request")
+			return false
+		}
+		resp, err := http.DefaultClient.Do(req)
 		if err != nil {
-			log.Fatal().Err(err).Msg("Failed to get stock info")
+			log.Error().Err(err).Msg("Failed to get stock info")
+			p.bot.Send(c, bot.Message, message.Channel, "Failed to retrieve data for stock symbol: "+tokens[1])
+			return true
 		}
 		body, err := ioutil.ReadAll(resp.Body)
 		resp.Body.Close()
 		if err != nil {
-			log.Fatal().Err(err).Msg("Error stock info body")
+			log.Error().Err(err).Msg("Error stock info body")
+			return true
 		}
 
 		response := "Failed to retrieve data for stock symbol: " + tokens[1]
@@ -88,7 +105,10 @@ func (p *StockPlugin) message(c bot.Connector, kind bot.Kind, message msg.Messag
 	return false
 }
 
-func (p *StockPlugin) help(c bot.Connector, kind bot.Kind, message msg.Message, args ...interface{}) bool {
-	p.bot.Send(c, bot.Message, message.Channel, "try '!stock-price SYMBOL'")
-	return true
+func (p *StockPlugin) registerCommands() {
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern:  "stock-price {symbol}",
+		Usage:    "shows a stock's price",
+		Examples: []string{"stock-price AAPL"},
+	})
 }
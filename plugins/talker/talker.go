@@ -57,7 +57,7 @@ func New(b bot.Bot) *TalkerPlugin {
 		config: b.Config(),
 	}
 	b.Register(tp, bot.Message, tp.message)
-	b.Register(tp, bot.Help, tp.help)
+	tp.registerCommands()
 	tp.registerWeb(b.DefaultConnector())
 	return tp
 }
@@ -110,9 +110,23 @@ func (p *TalkerPlugin) message(c bot.Connector, kind bot.Kind, message msg.Messa
 	return false
 }
 
-func (p *TalkerPlugin) help(c bot.Connector, kind bot.Kind, message msg.Message, args ...interface{}) bool {
-	p.bot.Send(c, bot.Message, message.Channel, "Hi, this is talker. I like to talk about FredFelps!")
-	return true
+func (p *TalkerPlugin) registerCommands() {
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern: "say {text:text}",
+		Usage:   "says something",
+	})
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern: "cowsay {text:text}",
+		Usage:   "has a cow say something",
+	})
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern: "list cows",
+		Usage:   "lists the cows",
+	})
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern: "goatse {who?}",
+		Usage:   "don't",
+	})
 }
 
 func (p *TalkerPlugin) cowSay(text string) (string, error) {
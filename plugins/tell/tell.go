@@ -17,20 +17,26 @@ type TellPlugin struct {
 
 func New(b bot.Bot) *TellPlugin {
 	tp := &TellPlugin{b, make(map[string][]string)}
+	b.RegisterCommand(tp, bot.Command{
+		Pattern:  "tell {who} {what:text}",
+		Usage:    "passes a message on the next time somebody speaks",
+		Examples: []string{"tell alice the build is fixed"},
+		Ambient:  true,
+		Handler:  tp.tell,
+	})
 	b.Register(tp, bot.Message, tp.message)
 	return tp
 }
 
+func (t *TellPlugin) tell(c bot.Connector, message msg.Message, args bot.Args) bool {
+	target := strings.ToLower(args.String("who"))
+	newMessage := fmt.Sprintf("Hey, %s. %s said: %s", target, message.User.Name, args.String("what"))
+	t.users[target] = append(t.users[target], newMessage)
+	t.b.Send(c, bot.Message, message.Channel, fmt.Sprintf("Okay. I'll tell %s.", target))
+	return true
+}
+
 func (t *TellPlugin) message(c bot.Connector, kind bot.Kind, message msg.Message, args ...interface{}) bool {
-	if strings.HasPrefix(strings.ToLower(message.Body), "tell") {
-		parts := strings.Split(message.Body, " ")
-		target := strings.ToLower(parts[1])
-		newMessage := strings.Join(parts[2:], " ")
-		newMessage = fmt.Sprintf("Hey, %s. %s said: %s", target, message.User.Name, newMessage)
-		t.users[target] = append(t.users[target], newMessage)
-		t.b.Send(c, bot.Message, message.Channel, fmt.Sprintf("Okay. I'll tell %s.", target))
-		return true
-	}
 	uname := strings.ToLower(message.User.Name)
 	if msg, ok := t.users[uname]; ok && len(msg) > 0 {
 		for _, m := range msg {
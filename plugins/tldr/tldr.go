@@ -14,38 +14,25 @@ import (
 )
 
 type TLDRPlugin struct {
-	bot         bot.Bot
-	history     []history
-	index       int
-	lastRequest time.Time
-}
-
-type history struct {
-	timestamp time.Time
-	user      string
-	body      string
+	bot bot.Bot
 }
 
 func New(b bot.Bot) *TLDRPlugin {
 	plugin := &TLDRPlugin{
-		bot:         b,
-		history:     []history{},
-		index:       0,
-		lastRequest: time.Now().Add(-24 * time.Hour),
+		bot: b,
 	}
 	b.Register(plugin, bot.Message, plugin.message)
-	b.Register(plugin, bot.Help, plugin.help)
+	plugin.registerCommands()
 	return plugin
 }
 
 func (p *TLDRPlugin) message(c bot.Connector, kind bot.Kind, message msg.Message, args ...interface{}) bool {
 	timeLimit := time.Duration(p.bot.Config().GetInt("TLDR.HourLimit", 1))
 	lowercaseMessage := strings.ToLower(message.Body)
-	if lowercaseMessage == "tl;dr" && p.lastRequest.After(time.Now().Add(-timeLimit*time.Hour)) {
-		p.bot.Send(c, bot.Message, message.Channel, "Slow down, cowboy. Read that tiny backlog.")
-		return true
-	} else if lowercaseMessage == "tl;dr" {
-		p.lastRequest = time.Now()
+	if lowercaseMessage == "tl;dr" {
+		if !p.bot.Limits().Allow(c, message, bot.Cooldown{Name: "tldr", Channel: timeLimit * time.Hour}) {
+			return true
+		}
 		nTopics := p.bot.Config().GetInt("TLDR.Topics", 5)
 
 		stopWordSlice := p.bot.Config().GetArray("TLDR.StopWords", []string{})
@@ -54,10 +41,16 @@ func (p *TLDRPlugin) message(c bot.Connector, kind bot.Kind, message msg.Message
 			p.bot.Config().SetArray("TLDR.StopWords", stopWordSlice)
 		}
 
+		history, err := p.getHistory(message.Connector, message.Channel)
+		if err != nil {
+			log.Error().Err(err).Msg("Could not read message log")
+			return false
+		}
+
 		vectoriser := nlp.NewCountVectoriser(stopWordSlice...)
 		lda := nlp.NewLatentDirichletAllocation(nTopics)
 		pipeline := nlp.NewPipeline(vectoriser, lda)
-		docsOverTopics, err := pipeline.FitTransform(p.getTopics()...)
+		docsOverTopics, err := pipeline.FitTransform(getTopics(history)...)
 
 		if err != nil {
 			log.Error().Err(err)
@@ -65,12 +58,12 @@ func (p *TLDRPlugin) message(c bot.Connector, kind bot.Kind, message msg.Message
 		}
 
 		bestScores := make([][]float64, nTopics)
-		bestDocs := make([][]history, nTopics)
+		bestDocs := make([][]msg.Message, nTopics)
 
 		supportingDocs := p.bot.Config().GetInt("TLDR.Support", 3)
 		for i := 0; i < nTopics; i++ {
 			bestScores[i] = make([]float64, supportingDocs)
-			bestDocs[i] = make([]history, supportingDocs)
+			bestDocs[i] = make([]msg.Message, supportingDocs)
 		}
 
 		dr, dc := docsOverTopics.Dims()
@@ -81,7 +74,7 @@ func (p *TLDRPlugin) message(c bot.Connector, kind bot.Kind, message msg.Message
 				score := docsOverTopics.At(topic, doc)
 				if score > minScore {
 					bestScores[topic][minIndex] = score
-					bestDocs[topic][minIndex] = p.history[doc]
+					bestDocs[topic][minIndex] = history[doc]
 					minScore, minIndex = min(bestScores[topic])
 				}
 			}
@@ -108,8 +101,11 @@ func (p *TLDRPlugin) message(c bot.Connector, kind bot.Kind, message msg.Message
 				}
 			}
 			response += fmt.Sprintf("\n*Topic #%d: %s*\n", topic, bestTopic)
-			for i := range bestDocs[topic] {
-				response += fmt.Sprintf("<%s>%s\n", bestDocs[topic][i].user, bestDocs[topic][i].body)
+			for _, doc := range bestDocs[topic] {
+				if doc.User == nil {
+					continue
+				}
+				response += fmt.Sprintf("<%s>%s\n", doc.User.Name, strings.ToLower(doc.Body))
 			}
 
 		}
@@ -119,52 +115,41 @@ func (p *TLDRPlugin) message(c bot.Connector, kind bot.Kind, message msg.Message
 		return true
 	}
 
-	hist := history{
-		body:      lowercaseMessage,
-		user:      message.User.Name,
-		timestamp: time.Now(),
-	}
-	p.addHistory(hist)
-
 	return false
 }
 
-func (p *TLDRPlugin) addHistory(hist history) {
-	p.history = append(p.history, hist)
-	sz := len(p.history)
+// getHistory reads the recent backlog of a channel from the bot's message log
+func (p *TLDRPlugin) getHistory(connector, channel string) (msg.Messages, error) {
 	max := p.bot.Config().GetInt("TLDR.HistorySize", 1000)
 	keepHrs := time.Duration(p.bot.Config().GetInt("TLDR.KeepHours", 24))
-	// Clamp the size of the history
-	if sz > max {
-		p.history = p.history[len(p.history)-max:]
+	now := time.Now()
+	history, err := p.bot.MessageLog().Range(connector, channel, now.Add(-keepHrs*time.Hour), now, max)
+	if err != nil {
+		return nil, err
 	}
-	// Remove old entries
-	yesterday := time.Now().Add(-keepHrs * time.Hour)
-	begin := 0
-	for i, m := range p.history {
-		if !m.timestamp.Before(yesterday) {
-			begin = i - 1 // should keep this message
-			if begin < 0 {
-				begin = 0
-			}
-			break
+	// earlier requests are in the log too, but they aren't interesting
+	backlog := msg.Messages{}
+	for _, m := range history {
+		if strings.ToLower(m.Body) != "tl;dr" {
+			backlog = append(backlog, m)
 		}
 	}
-	p.history = p.history[begin:]
+	return backlog, nil
 }
 
-func (p *TLDRPlugin) getTopics() []string {
+func getTopics(history msg.Messages) []string {
 	hist := []string{}
-	for _, h := range p.history {
-		hist = append(hist, h.body)
+	for _, h := range history {
+		hist = append(hist, strings.ToLower(h.Body))
 	}
 	return hist
 }
 
-// Help responds to help requests. Every plugin must implement a help function.
-func (p *TLDRPlugin) help(c bot.Connector, kind bot.Kind, message msg.Message, args ...interface{}) bool {
-	p.bot.Send(c, bot.Message, message.Channel, "tl;dr")
-	return true
+func (p *TLDRPlugin) registerCommands() {
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern: "tl;dr",
+		Usage:   "sums up what was said lately",
+	})
 }
 
 func min(slice []float64) (float64, int) {
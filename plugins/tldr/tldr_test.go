@@ -43,59 +43,75 @@ func setup(t *testing.T) (*TLDRPlugin, *bot.MockBot) {
 	return r, mb
 }
 
+// sender hands messages to the plugin and then logs them like the bot would
+func sender(c *TLDRPlugin, mb *bot.MockBot) func(bot.Connector, bot.Kind, msg.Message) bool {
+	return func(conn bot.Connector, kind bot.Kind, m msg.Message) bool {
+		res := c.message(conn, kind, m)
+		mb.MessageLog().Log(m)
+		return res
+	}
+}
+
 func Test(t *testing.T) {
 	c, mb := setup(t)
-	res := c.message(makeMessage("The quick brown fox jumped over the lazy dog"))
-	res = c.message(makeMessage("The cow jumped over the moon"))
-	res = c.message(makeMessage("The little dog laughed to see such fun"))
-	res = c.message(makeMessage("tl;dr"))
+	send := sender(c, mb)
+	res := send(makeMessage("The quick brown fox jumped over the lazy dog"))
+	res = send(makeMessage("The cow jumped over the moon"))
+	res = send(makeMessage("The little dog laughed to see such fun"))
+	res = send(makeMessage("tl;dr"))
 	assert.True(t, res)
 	assert.Len(t, mb.Messages, 1)
 }
 
 func TestDoubleUp(t *testing.T) {
 	c, mb := setup(t)
-	res := c.message(makeMessage("The quick brown fox jumped over the lazy dog"))
-	res = c.message(makeMessage("The cow jumped over the moon"))
-	res = c.message(makeMessage("The little dog laughed to see such fun"))
-	res = c.message(makeMessage("tl;dr"))
-	res = c.message(makeMessage("tl;dr"))
+	mb.Config().Set("flood.refusal", "rude")
+	send := sender(c, mb)
+	res := send(makeMessage("The quick brown fox jumped over the lazy dog"))
+	res = send(makeMessage("The cow jumped over the moon"))
+	res = send(makeMessage("The little dog laughed to see such fun"))
+	res = send(makeMessage("tl;dr"))
+	res = send(makeMessage("tl;dr"))
 	assert.True(t, res)
 	assert.Len(t, mb.Messages, 2)
 	assert.Contains(t, mb.Messages[1], "Slow down, cowboy.")
 }
 
-func TestAddHistoryLimitsMessages(t *testing.T) {
-	c, _ := setup(t)
+func logAt(mb *bot.MockBot, channel string, when time.Time) {
+	mb.MessageLog().Log(msg.Message{
+		User:    &user.User{Name: "tester"},
+		Channel: channel,
+		Body:    "test",
+		Time:    when,
+	})
+}
+
+func TestHistoryLimitsMessages(t *testing.T) {
+	c, mb := setup(t)
 	max := 1000
 	c.bot.Config().Set("TLDR.HistorySize", strconv.Itoa(max))
 	c.bot.Config().Set("TLDR.KeepHours", "24")
-	t0 := time.Now().Add(-24 * time.Hour)
+	t0 := time.Now().Add(-12 * time.Hour)
 	for i := 0; i < max*2; i++ {
-		hist := history{
-			body:      "test",
-			user:      "tester",
-			timestamp: t0.Add(time.Duration(i) * time.Second),
-		}
-		c.addHistory(hist)
+		logAt(mb, "limits", t0.Add(time.Duration(i)*time.Second))
 	}
-	assert.Len(t, c.history, max)
+	history, err := c.getHistory("", "limits")
+	assert.Nil(t, err)
+	assert.Len(t, history, max)
 }
 
-func TestAddHistoryLimitsDays(t *testing.T) {
-	c, _ := setup(t)
+func TestHistoryLimitsDays(t *testing.T) {
+	c, mb := setup(t)
 	hrs := 24
 	expected := 24
 	c.bot.Config().Set("TLDR.HistorySize", "100")
 	c.bot.Config().Set("TLDR.KeepHours", strconv.Itoa(hrs))
-	t0 := time.Now().Add(-time.Duration(hrs*2) * time.Hour)
+	// offset by half an hour to stay clear of the cutoff
+	t0 := time.Now().Add(-time.Duration(hrs*2)*time.Hour + 30*time.Minute)
 	for i := 0; i < 48; i++ {
-		hist := history{
-			body:      "test",
-			user:      "tester",
-			timestamp: t0.Add(time.Duration(i) * time.Hour),
-		}
-		c.addHistory(hist)
+		logAt(mb, "days", t0.Add(time.Duration(i)*time.Hour))
 	}
-	assert.Len(t, c.history, expected, "%d != %d", len(c.history), expected)
+	history, err := c.getHistory("", "days")
+	assert.Nil(t, err)
+	assert.Len(t, history, expected, "%d != %d", len(history), expected)
 }
@@ -14,9 +14,20 @@ import (
 	"github.com/rs/zerolog/log"
 	"github.com/velour/catbase/bot"
 	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/bot/schedule"
 	"github.com/velour/catbase/config"
 )
 
+func init() {
+	config.Declare(
+		config.Key{Name: "Twitch.Freq", Type: config.Int, Default: "60", Min: 1, Max: 86400,
+			Description: "seconds between checks for streams"},
+		config.Key{Name: "Twitch.Channels", Type: config.Array, Description: "targets that hear about streams"},
+		config.Key{Name: "Twitch.ClientID", Secret: true, Description: "twitch API client ID"},
+		config.Key{Name: "Twitch.Authorization", Secret: true, Description: "twitch API authorization header"},
+	)
+}
+
 const (
 	isStreamingTplFallback      = "{{.Name}} is streaming {{.Game}} at {{.URL}}"
 	notStreamingTplFallback     = "{{.Name}} is not streaming"
@@ -64,8 +75,11 @@ func New(b bot.Bot) *TwitchPlugin {
 		config:     b.Config(),
 		twitchList: map[string]*Twitcher{},
 	}
+	b.Scheduler().Handle("twitch.check", p.twitchLoop)
 
-	for _, ch := range p.config.GetArray("Twitch.Channels", []string{}) {
+	checked := []string{}
+	for _, target := range p.config.GetArray("Twitch.Channels", []string{}) {
+		c, ch := b.ResolveTarget(target)
 		for _, twitcherName := range p.config.GetArray("Twitch."+ch+".Users", []string{}) {
 			if _, ok := p.twitchList[twitcherName]; !ok {
 				p.twitchList[twitcherName] = &Twitcher{
@@ -74,11 +88,27 @@ func New(b bot.Bot) *TwitchPlugin {
 				}
 			}
 		}
-		go p.twitchLoop(b.DefaultConnector(), ch)
+		if c == nil {
+			log.Error().Msgf("Unknown connector for twitch channel %s", target)
+			continue
+		}
+		p.scheduleChecks(target)
+		checked = append(checked, target)
 	}
+	if err := b.Scheduler().Prune("twitch.check", checked); err != nil {
+		log.Error().Err(err).Msg("Could not cancel old twitch checks")
+	}
+	// a new frequency takes effect without a restart
+	p.config.Subscribe("Twitch.Freq", func(config.Change) {
+		for _, target := range p.config.GetArray("Twitch.Channels", []string{}) {
+			if c, _ := b.ResolveTarget(target); c != nil {
+				p.scheduleChecks(target)
+			}
+		}
+	})
 
 	b.Register(p, bot.Message, p.message)
-	b.Register(p, bot.Help, p.help)
+	p.registerCommands()
 	p.registerWeb()
 
 	return p
@@ -140,32 +170,42 @@ func (p *TwitchPlugin) message(c bot.Connector, kind bot.Kind, message msg.Messa
 	return false
 }
 
-func (p *TwitchPlugin) help(c bot.Connector, kind bot.Kind, message msg.Message, args ...interface{}) bool {
-	msg := "You can set the templates for streams with\n"
-	msg += fmt.Sprintf("twitch.istpl (default: %s)\n", isStreamingTplFallback)
-	msg += fmt.Sprintf("twitch.nottpl (default: %s)\n", notStreamingTplFallback)
-	msg += fmt.Sprintf("twitch.stoppedtpl (default: %s)\n", stoppedStreamingTplFallback)
-	msg += "You can reset all messages with `!reset twitch`"
-	msg += "And you can ask who is streaming with `!twitch status`"
-	p.bot.Send(c, bot.Message, message.Channel, msg)
-	return true
+func (p *TwitchPlugin) registerCommands() {
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern: "twitch status",
+		Usage:   "tells who is streaming",
+	})
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern: "reset twitch",
+		Usage:   "puts the twitch.istpl, twitch.nottpl and twitch.stoppedtpl templates back to their defaults",
+	})
 }
 
-func (p *TwitchPlugin) twitchLoop(c bot.Connector, channel string) {
+// scheduleChecks polls twitch for a channel every Twitch.Freq seconds
+func (p *TwitchPlugin) scheduleChecks(target string) {
+	name := "twitch.check:" + target
 	frequency := p.config.GetInt("Twitch.Freq", 60)
 	if p.config.Get("twitch.clientid", "") == "" || p.config.Get("twitch.authorization", "") == "" {
 		log.Info().Msgf("Disabling twitch autochecking.")
+		p.bot.Scheduler().Cancel(name)
 		return
 	}
 
 	log.Info().Msgf("Checking every %d seconds", frequency)
 
-	for {
-		time.Sleep(time.Duration(frequency) * time.Second)
+	interval := time.Duration(frequency) * time.Second
+	if err := p.bot.Scheduler().Every(name, "twitch.check", interval, interval/10, target); err != nil {
+		log.Error().Err(err).Msgf("Could not schedule twitch checks for %s", target)
+	}
+}
 
-		for _, twitcherName := range p.config.GetArray("Twitch."+channel+".Users", []string{}) {
-			p.checkTwitch(c, channel, p.twitchList[twitcherName], false)
-		}
+func (p *TwitchPlugin) twitchLoop(job schedule.Job) {
+	c, channel := p.bot.ResolveTarget(job.Payload)
+	if c == nil {
+		return
+	}
+	for _, twitcherName := range p.config.GetArray("Twitch."+channel+".Users", []string{}) {
+		p.checkTwitch(c, channel, p.twitchList[twitcherName], false)
 	}
 }
 
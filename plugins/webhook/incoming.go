@@ -0,0 +1,296 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+package webhook
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/bot/user"
+	"github.com/velour/catbase/config"
+)
+
+const (
+	// maxPayload caps the size of an incoming hook's body
+	maxPayload = 1 << 16
+	// defaultTemplate says the text field of a payload
+	defaultTemplate = "{{.text}}"
+)
+
+// Incoming is a /hook/<name> endpoint that says what is posted to it in a channel
+type Incoming struct {
+	ID     int64
+	Name   string
+	Target string
+	// Token is a hash of the token callers must give
+	Token    string
+	Template string
+	// Command has the rendered text received as a command instead of said
+	Command bool
+	Created int64
+}
+
+func (p *WebhookPlugin) registerIncoming() {
+	http.HandleFunc("/hook/", p.serveHook)
+
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern:    "add incoming hook {name} {target} {template:text?}",
+		Usage:      "makes /hook/<name> say what is posted to it in a connector:channel, through a Go template",
+		Examples:   []string{"add incoming hook ci irc:#dev build {{.status}}: {{.url}}"},
+		Permission: "webhook.manage",
+		Handler: func(c bot.Connector, message msg.Message, args bot.Args) bool {
+			return p.addIncoming(c, message, args, false)
+		},
+	})
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern:    "add incoming command hook {name} {target} {template:text?}",
+		Usage:      "makes /hook/<name> run what is posted to it as a command in a connector:channel",
+		Permission: "webhook.manage",
+		Handler: func(c bot.Connector, message msg.Message, args bot.Args) bool {
+			return p.addIncoming(c, message, args, true)
+		},
+	})
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern:    "incoming hooks",
+		Usage:      "lists the incoming hooks",
+		Permission: "webhook.manage",
+		Handler:    p.listIncoming,
+	})
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern:    "rotate incoming hook {name}",
+		Usage:      "gives an incoming hook a new token",
+		Permission: "webhook.manage",
+		Handler:    p.rotateIncoming,
+	})
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern:    "remove incoming hook {name}",
+		Usage:      "turns an incoming hook off",
+		Permission: "webhook.manage",
+		Handler:    p.removeIncoming,
+	})
+}
+
+func newToken() (string, string) {
+	raw := make([]byte, 24)
+	rand.Read(raw)
+	token := hex.EncodeToString(raw)
+	return token, hashToken(token)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (p *WebhookPlugin) incoming(name string) (Incoming, bool) {
+	var h Incoming
+	err := p.db.Get(&h, `select id, name, target, token, template, command <> 0 as command, created
+		from incoming_hooks where name=?`, name)
+	return h, err == nil
+}
+
+func (p *WebhookPlugin) addIncoming(c bot.Connector, message msg.Message, args bot.Args, command bool) bool {
+	name := args.String("name")
+	tpl := args.String("template")
+	if tpl == "" {
+		tpl = defaultTemplate
+	}
+	if _, err := template.New(name).Parse(tpl); err != nil {
+		return p.reply(c, message, "That template doesn't work: %s", err)
+	}
+	if _, ok := p.incoming(name); ok {
+		return p.reply(c, message, "There's already an incoming hook called %s.", name)
+	}
+	token, hash := newToken()
+	// command is an integer column, which Postgres won't fill from a bool
+	asCommand := 0
+	if command {
+		asCommand = 1
+	}
+	_, err := p.db.Exec(`insert into incoming_hooks (name, target, token, template, command, created)
+		values (?, ?, ?, ?, ?, ?)`, name, args.String("target"), hash, tpl, asCommand, time.Now().Unix())
+	if err != nil {
+		log.Error().Err(err).Msg("Could not add incoming hook")
+		return p.reply(c, message, "I couldn't save that hook.")
+	}
+	return p.sendToken(c, message, fmt.Sprintf("POST to /hook/%s with the header \"Authorization: Bearer %s\". "+
+		"I won't show the token again.", name, token))
+}
+
+// sendToken gives a hook's token only to whoever asked for it
+func (p *WebhookPlugin) sendToken(c bot.Connector, message msg.Message, text string) bool {
+	if _, err := p.bot.Send(c, bot.Message, bot.DMChannel(message), text); err != nil {
+		log.Error().Err(err).Msg("Could not send a hook token")
+		return p.reply(c, message, "I couldn't send you a private message.")
+	}
+	if !message.IsIM {
+		p.reply(c, message, "I sent you the token.")
+	}
+	return true
+}
+
+func (p *WebhookPlugin) listIncoming(c bot.Connector, message msg.Message, args bot.Args) bool {
+	hooks := []Incoming{}
+	err := p.db.Select(&hooks, `select id, name, target, token, template, command <> 0 as command, created
+		from incoming_hooks order by name`)
+	if err != nil {
+		log.Error().Err(err).Msg("Could not list incoming hooks")
+		return p.reply(c, message, "I couldn't find the hooks.")
+	}
+	if len(hooks) == 0 {
+		return p.reply(c, message, "There are no incoming hooks.")
+	}
+	out := "Incoming hooks:"
+	for _, h := range hooks {
+		how := "says"
+		if h.Command {
+			how = "runs"
+		}
+		out += fmt.Sprintf("\n/hook/%s %s %s in %s", h.Name, how, h.Template, h.Target)
+	}
+	return p.reply(c, message, "%s", out)
+}
+
+func (p *WebhookPlugin) rotateIncoming(c bot.Connector, message msg.Message, args bot.Args) bool {
+	name := args.String("name")
+	if _, ok := p.incoming(name); !ok {
+		return p.reply(c, message, "There's no incoming hook called %s.", name)
+	}
+	token, hash := newToken()
+	if _, err := p.db.Exec(`update incoming_hooks set token=? where name=?`, hash, name); err != nil {
+		log.Error().Err(err).Msg("Could not rotate incoming hook")
+		return p.reply(c, message, "I couldn't change the token.")
+	}
+	return p.sendToken(c, message, fmt.Sprintf("The new token for /hook/%s is %s", name, token))
+}
+
+func (p *WebhookPlugin) removeIncoming(c bot.Connector, message msg.Message, args bot.Args) bool {
+	name := args.String("name")
+	res, err := p.db.Exec(`delete from incoming_hooks where name=?`, name)
+	if err != nil {
+		log.Error().Err(err).Msg("Could not remove incoming hook")
+		return p.reply(c, message, "I couldn't remove that hook.")
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return p.reply(c, message, "There's no incoming hook called %s.", name)
+	}
+	return p.reply(c, message, "Okay, /hook/%s is gone.", name)
+}
+
+// token finds the token a caller gave, as a bearer token or a token parameter
+func token(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return r.URL.Query().Get("token")
+}
+
+// payloadOf reads a JSON or form body for the template
+func payloadOf(r *http.Request) (interface{}, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPayload+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxPayload {
+		return nil, fmt.Errorf("the payload is over %d bytes", maxPayload)
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var data interface{}
+		err := json.Unmarshal(body, &data)
+		return data, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	data := map[string]string{}
+	for k, v := range r.Form {
+		if k != "token" {
+			data[k] = v[0]
+		}
+	}
+	return data, nil
+}
+
+func hookError(w http.ResponseWriter, status int, format string, args ...interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	j, _ := json.Marshal(struct {
+		Err string `json:"error"`
+	}{fmt.Sprintf(format, args...)})
+	w.Write(j)
+}
+
+func (p *WebhookPlugin) serveHook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		hookError(w, http.StatusMethodNotAllowed, "hooks only take POST")
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/hook/")
+	h, ok := p.incoming(name)
+	given := hashToken(token(r))
+	if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(h.Token)) != 1 {
+		// unknown hooks look the same as bad tokens
+		hookError(w, http.StatusUnauthorized, "bad hook or token")
+		return
+	}
+	data, err := payloadOf(r)
+	if err != nil {
+		hookError(w, http.StatusBadRequest, "could not read the payload: %s", err)
+		return
+	}
+	tpl, err := template.New(h.Name).Option("missingkey=error").Parse(h.Template)
+	if err != nil {
+		hookError(w, http.StatusInternalServerError, "the hook's template is broken: %s", err)
+		return
+	}
+	var out bytes.Buffer
+	if err := tpl.Execute(&out, data); err != nil {
+		hookError(w, http.StatusBadRequest, "the payload doesn't fit the template: %s", err)
+		return
+	}
+	text := strings.TrimSpace(out.String())
+	if text == "" {
+		hookError(w, http.StatusBadRequest, "the template rendered nothing")
+		return
+	}
+	conn, channel := p.bot.ResolveTarget(h.Target)
+	if conn == nil {
+		hookError(w, http.StatusInternalServerError, "there is no connector for %s", h.Target)
+		return
+	}
+
+	log.Info().Str("hook", h.Name).Str("target", h.Target).Msg("Incoming hook called")
+	if h.Command {
+		p.bot.Receive(conn, bot.Message, msg.Message{
+			User:    &user.User{ID: "hook:" + h.Name, Name: "hook:" + h.Name},
+			Channel: channel,
+			Body:    text,
+			Raw:     text,
+			Command: true,
+			Time:    time.Now(),
+		})
+	} else if _, err := p.bot.Send(conn, bot.Message, channel, text); err != nil {
+		hookError(w, http.StatusBadGateway, "could not send: %s", config.Redact(err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	j, _ := json.Marshal(struct {
+		Sent string `json:"sent"`
+	}{text})
+	w.Write(j)
+}
@@ -0,0 +1,112 @@
+package webhook
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/plugins/cli"
+)
+
+var bearer = regexp.MustCompile(`Bearer (\w+)`)
+
+// addIncoming adds a hook with a command and returns the token it was sent privately
+func addIncoming(t *testing.T, mb *bot.MockBot, cmd string) string {
+	mb.Receive(makeMessage(cmd))
+	assert.Equal(t, "I sent you the token.", mb.Messages[len(mb.Messages)-1])
+	m := bearer.FindStringSubmatch(mb.Messages[len(mb.Messages)-2])
+	if m == nil {
+		t.Fatalf("no token in %q", mb.Messages[len(mb.Messages)-2])
+	}
+	return m[1]
+}
+
+func post(p *WebhookPlugin, name, token, contentType, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/hook/"+name, strings.NewReader(body))
+	r.Header.Set("Content-Type", contentType)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	p.serveHook(w, r)
+	return w
+}
+
+func TestIncomingJSON(t *testing.T) {
+	p, mb := setup(t)
+	mb.Conn = &cli.CliPlugin{}
+	token := addIncoming(t, mb, "!add incoming hook ci cli:#dev build {{.status}}: {{.url}}")
+
+	w := post(p, "ci", token, "application/json", `{"status": "passed", "url": "http://ci/1"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "build passed: http://ci/1", mb.Messages[len(mb.Messages)-1])
+}
+
+func TestIncomingForm(t *testing.T) {
+	p, mb := setup(t)
+	mb.Conn = &cli.CliPlugin{}
+	token := addIncoming(t, mb, "!add incoming hook cron cli:#ops")
+
+	form := url.Values{"text": {"backups are done"}}
+	w := post(p, "cron", token, "application/x-www-form-urlencoded", form.Encode())
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "backups are done", mb.Messages[len(mb.Messages)-1])
+}
+
+func TestIncomingAuth(t *testing.T) {
+	p, mb := setup(t)
+	mb.Conn = &cli.CliPlugin{}
+	token := addIncoming(t, mb, "!add incoming hook ci cli:#dev")
+	sent := len(mb.Messages)
+
+	assert.Equal(t, http.StatusUnauthorized, post(p, "ci", "", "application/json", `{"text": "hi"}`).Code)
+	assert.Equal(t, http.StatusUnauthorized, post(p, "ci", "nope", "application/json", `{"text": "hi"}`).Code)
+	assert.Equal(t, http.StatusUnauthorized, post(p, "cd", token, "application/json", `{"text": "hi"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, post(p, "ci", token, "application/json", `{"text": `).Code)
+	assert.Equal(t, http.StatusBadRequest, post(p, "ci", token, "application/json", `{}`).Code)
+	assert.Len(t, mb.Messages, sent)
+
+	mb.Receive(makeMessage("!rotate incoming hook ci"))
+	assert.Equal(t, "I sent you the token.", mb.Messages[len(mb.Messages)-1])
+	assert.Equal(t, http.StatusUnauthorized, post(p, "ci", token, "application/json", `{"text": "hi"}`).Code)
+	mb.Receive(makeMessage("!remove incoming hook ci"))
+	mb.Receive(makeMessage("!incoming hooks"))
+	assert.Equal(t, "There are no incoming hooks.", mb.Messages[len(mb.Messages)-1])
+}
+
+type echo struct{}
+
+func TestIncomingCommand(t *testing.T) {
+	p, mb := setup(t)
+	mb.Conn = &cli.CliPlugin{}
+	var got msg.Message
+	mb.RegisterCommand(echo{}, bot.Command{
+		Pattern: "deploy {what}",
+		Handler: func(c bot.Connector, message msg.Message, args bot.Args) bool {
+			got = message
+			return true
+		},
+	})
+	token := addIncoming(t, mb, "!add incoming command hook deploys cli:#ops deploy {{.app}}")
+
+	w := post(p, "deploys", token, "application/json", `{"app": "catbase"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "deploy catbase", got.Body)
+	assert.Equal(t, "#ops", got.Channel)
+	assert.Equal(t, "hook:deploys", got.User.Name)
+}
+
+func TestBadIncoming(t *testing.T) {
+	_, mb := setup(t)
+	mb.Receive(makeMessage("!add incoming hook x cli:#dev {{.text"))
+	assert.Contains(t, mb.Messages[0], "That template doesn't work")
+	addIncoming(t, mb, "!add incoming hook x cli:#dev")
+	mb.Receive(makeMessage("!add incoming hook x cli:#dev"))
+	assert.Contains(t, mb.Messages[3], "already an incoming hook called x")
+}
@@ -0,0 +1,539 @@
+// © 2016 the CatBase Authors under the WTFPL license. See AUTHORS for the list of authors.
+
+// Package webhook POSTs signed JSON to other services when things happen in chat
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog/log"
+
+	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/backup"
+	"github.com/velour/catbase/bot/migrate"
+	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/bot/schedule"
+	"github.com/velour/catbase/config"
+)
+
+func init() {
+	config.Declare(
+		config.Key{Name: "Webhook.Secret", Secret: true,
+			Description: "key webhook bodies are signed with, in the X-Catbase-Signature header"},
+		config.Key{Name: "Webhook.MaxAttempts", Type: config.Int, Default: "5", Min: 1, Max: 20,
+			Description: "tries before a webhook delivery is given up on"},
+		config.Key{Name: "Webhook.Timeout", Type: config.Int, Default: "10", Min: 1, Max: 120,
+			Description: "seconds to wait for a webhook to answer"},
+		config.Key{Name: "Webhook.LogSize", Type: config.Int, Default: "100", Min: 1, Max: 10000,
+			Description: "deliveries kept in the log for each webhook"},
+	)
+	backup.Register("webhook", backup.Table{Name: "webhooks"}, backup.Table{Name: "incoming_hooks"})
+	migrate.Register("webhook", migrate.Step{
+		Version: 1,
+		Name:    "create webhook tables",
+		SQL: `create table if not exists webhooks (
+			id integer primary key,
+			name string unique,
+			url string,
+			event string,
+			filter string,
+			created integer
+		);
+		create table if not exists webhook_deliveries (
+			id integer primary key,
+			hook string,
+			event string,
+			body string,
+			status string,
+			attempts integer,
+			result string,
+			updated integer
+		);
+		create index if not exists webhook_deliveries_hook on webhook_deliveries (hook);`,
+	}, migrate.Step{
+		Version: 2,
+		Name:    "create incoming hooks",
+		SQL: `create table if not exists incoming_hooks (
+			id integer primary key,
+			name string unique,
+			target string,
+			token string,
+			template string,
+			command integer,
+			created integer
+		);`,
+	})
+}
+
+const (
+	// messageEvent is every message said in a channel, filtered by a regex
+	messageEvent = "message"
+	// testEvent is sent by the test command
+	testEvent = "test"
+
+	pending   = "pending"
+	delivered = "delivered"
+	failed    = "failed"
+
+	firstRetry = 30 * time.Second
+	maxRetry   = time.Hour
+)
+
+// events are what a hook can be added for, with what its filter means
+var events = map[string]string{
+	messageEvent:                   "a regex messages must match",
+	bot.CounterChanged{}.Topic():   "the counter item, only increments are sent",
+	bot.FactoidLearned{}.Topic():   "",
+	bot.FactoidForgotten{}.Topic(): "",
+	bot.ReminderFired{}.Topic():    "",
+}
+
+// Hook is a URL that is sent an event
+type Hook struct {
+	ID      int64
+	Name    string
+	URL     string
+	Event   string
+	Filter  string
+	Created int64
+
+	re *regexp.Regexp
+}
+
+// Delivery is one event sent, or being sent, to a hook
+type Delivery struct {
+	ID       int64
+	Hook     string
+	Event    string
+	Body     string
+	Status   string
+	Attempts int
+	Result   string
+	Updated  int64
+}
+
+// payload is the JSON body a hook receives
+type payload struct {
+	ID    int64       `json:"id"`
+	Hook  string      `json:"hook"`
+	Event string      `json:"event"`
+	Time  time.Time   `json:"time"`
+	Data  interface{} `json:"data"`
+}
+
+type WebhookPlugin struct {
+	bot    bot.Bot
+	db     *sqlx.DB
+	cfg    *config.Config
+	client *http.Client
+
+	sync.RWMutex
+	hooks []*Hook
+}
+
+func New(b bot.Bot) *WebhookPlugin {
+	migrate.MustUp(b.DB(), "webhook")
+	p := &WebhookPlugin{
+		bot:    b,
+		db:     b.DB(),
+		cfg:    b.Config(),
+		client: &http.Client{},
+	}
+	if err := p.loadHooks(); err != nil {
+		log.Error().Err(err).Msg("Could not load webhooks")
+	}
+	b.Register(p, bot.Message, p.message)
+	b.Subscribe(p, bot.AllEvents, p.event)
+	b.Scheduler().Handle("webhook.deliver", p.deliver)
+	p.registerCommands()
+	p.registerIncoming()
+	return p
+}
+
+func (p *WebhookPlugin) loadHooks() error {
+	hooks := []*Hook{}
+	if err := p.db.Select(&hooks, `select id, name, url, event, filter, created from webhooks order by name`); err != nil {
+		return err
+	}
+	for _, h := range hooks {
+		if err := h.compile(); err != nil {
+			log.Error().Err(err).Msgf("Webhook %s has a bad filter", h.Name)
+		}
+	}
+	p.Lock()
+	defer p.Unlock()
+	p.hooks = hooks
+	return nil
+}
+
+func (h *Hook) compile() error {
+	if h.Event != messageEvent || h.Filter == "" {
+		return nil
+	}
+	re, err := regexp.Compile(h.Filter)
+	if err != nil {
+		return err
+	}
+	h.re = re
+	return nil
+}
+
+// matching lists the hooks for an event that want the data
+func (p *WebhookPlugin) matching(event string, match func(*Hook) bool) []*Hook {
+	p.RLock()
+	defer p.RUnlock()
+	hooks := []*Hook{}
+	for _, h := range p.hooks {
+		if h.Event == event && match(h) {
+			hooks = append(hooks, h)
+		}
+	}
+	return hooks
+}
+
+func (p *WebhookPlugin) message(c bot.Connector, kind bot.Kind, message msg.Message, args ...interface{}) bool {
+	hooks := p.matching(messageEvent, func(h *Hook) bool {
+		return h.re == nil || h.re.MatchString(message.Body)
+	})
+	for _, h := range hooks {
+		p.queue(h.Name, messageEvent, map[string]interface{}{
+			"nick":   message.User.Name,
+			"target": bot.Target(message.Connector, message.Channel),
+			"body":   message.Body,
+		})
+	}
+	// other plugins still get the message
+	return false
+}
+
+func (p *WebhookPlugin) event(evt bot.BusEvent) {
+	hooks := p.matching(evt.Topic(), func(h *Hook) bool {
+		if c, ok := evt.(bot.CounterChanged); ok {
+			return c.Delta > 0 && (h.Filter == "" || strings.EqualFold(h.Filter, c.Item))
+		}
+		return true
+	})
+	for _, h := range hooks {
+		p.queue(h.Name, evt.Topic(), evt)
+	}
+}
+
+// queue records a delivery and has the scheduler send it, so retries survive a restart
+func (p *WebhookPlugin) queue(hook, event string, data interface{}) {
+	now := time.Now()
+	id, err := config.Insert(p.db, `insert into webhook_deliveries (hook, event, body, status, attempts, result, updated)
+		values (?, ?, '', ?, 0, '', ?)`, hook, event, pending, now.Unix())
+	if err != nil {
+		log.Error().Err(err).Msgf("Could not queue a delivery for %s", hook)
+		return
+	}
+	body, err := json.Marshal(payload{ID: id, Hook: hook, Event: event, Time: now, Data: data})
+	if err != nil {
+		log.Error().Err(err).Msgf("Could not encode a delivery for %s", hook)
+		return
+	}
+	if _, err := p.db.Exec(`update webhook_deliveries set body=? where id=?`, string(body), id); err != nil {
+		log.Error().Err(err).Msgf("Could not queue a delivery for %s", hook)
+		return
+	}
+	p.prune(hook)
+	if err := p.bot.Scheduler().Once(jobName(id), "webhook.deliver", now, strconv.FormatInt(id, 10)); err != nil {
+		log.Error().Err(err).Msgf("Could not schedule a delivery for %s", hook)
+	}
+}
+
+func jobName(id int64) string {
+	return fmt.Sprintf("webhook.deliver:%d", id)
+}
+
+// prune keeps the newest Webhook.LogSize deliveries of a hook
+func (p *WebhookPlugin) prune(hook string) {
+	keep := p.cfg.GetInt("Webhook.LogSize", 100)
+	_, err := p.db.Exec(`delete from webhook_deliveries where hook=? and id <= (
+		select id from webhook_deliveries where hook=? order by id desc limit 1 offset ?)`,
+		hook, hook, keep)
+	if err != nil {
+		log.Error().Err(err).Msgf("Could not prune deliveries of %s", hook)
+	}
+}
+
+// deliver makes one attempt at a delivery and schedules the next if it fails
+func (p *WebhookPlugin) deliver(job schedule.Job) {
+	id, _ := strconv.ParseInt(job.Payload, 10, 64)
+	var d Delivery
+	err := p.db.Get(&d, `select id, hook, event, body, status, attempts, result, updated
+		from webhook_deliveries where id=?`, id)
+	if err != nil {
+		log.Error().Err(err).Msgf("Could not find webhook delivery %d", id)
+		return
+	}
+	h, ok := p.hook(d.Hook)
+	if !ok {
+		p.record(&d, failed, "the hook was removed")
+		return
+	}
+
+	d.Attempts++
+	result, err := p.send(h, []byte(d.Body))
+	switch {
+	case err == nil:
+		p.record(&d, delivered, result)
+	case d.Attempts >= p.cfg.GetInt("Webhook.MaxAttempts", 5):
+		log.Error().Err(err).Msgf("Giving up on delivery %d to %s", d.ID, d.Hook)
+		p.record(&d, failed, err.Error())
+	default:
+		wait := backoff(d.Attempts)
+		log.Info().Err(err).Msgf("Delivery %d to %s failed, trying again in %s", d.ID, d.Hook, wait)
+		p.record(&d, pending, err.Error())
+		if err := p.bot.Scheduler().Once(jobName(d.ID), "webhook.deliver", time.Now().Add(wait), job.Payload); err != nil {
+			log.Error().Err(err).Msgf("Could not schedule a retry of delivery %d", d.ID)
+		}
+	}
+}
+
+// backoff doubles the wait after each failed attempt
+func backoff(attempts int) time.Duration {
+	wait := firstRetry
+	for i := 1; i < attempts && wait < maxRetry; i++ {
+		wait *= 2
+	}
+	if wait > maxRetry {
+		wait = maxRetry
+	}
+	return wait
+}
+
+func (p *WebhookPlugin) record(d *Delivery, status, result string) {
+	d.Status = status
+	d.Result = config.Redact(result)
+	_, err := p.db.Exec(`update webhook_deliveries set status=?, attempts=?, result=?, updated=? where id=?`,
+		d.Status, d.Attempts, d.Result, time.Now().Unix(), d.ID)
+	if err != nil {
+		log.Error().Err(err).Msgf("Could not record delivery %d", d.ID)
+	}
+}
+
+// Sign gives the X-Catbase-Signature header for a body
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// send POSTs a body to a hook, saying how it went
+func (p *WebhookPlugin) send(h *Hook, body []byte) (string, error) {
+	secret := p.cfg.Get("Webhook.Secret", "")
+	if secret == "" {
+		return "", errors.New("Webhook.Secret is not set, so there is nothing to sign with")
+	}
+	timeout := time.Duration(p.cfg.GetInt("Webhook.Timeout", 10)) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", h.URL, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "catbase")
+	req.Header.Set("X-Catbase-Signature", Sign(secret, body))
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("got %s", resp.Status)
+	}
+	return resp.Status, nil
+}
+
+func (p *WebhookPlugin) hook(name string) (*Hook, bool) {
+	p.RLock()
+	defer p.RUnlock()
+	for _, h := range p.hooks {
+		if h.Name == name {
+			return h, true
+		}
+	}
+	return nil, false
+}
+
+func (p *WebhookPlugin) registerCommands() {
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern:    "add webhook {name} {event} {url} {filter:text?}",
+		Usage:      "POSTs events to a URL: message, counter.changed, fact.learned, fact.forgotten or reminder.fired",
+		Examples:   []string{"add webhook lights counter.changed https://example.com/hook coffee"},
+		Permission: "webhook.manage",
+		Role:       bot.Admin,
+		Handler:    p.add,
+	})
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern:    "webhooks",
+		Usage:      "lists the webhooks",
+		Permission: "webhook.manage",
+		Handler:    p.list,
+	})
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern:    "test webhook {name}",
+		Usage:      "sends a test event to a webhook right away",
+		Permission: "webhook.manage",
+		Handler:    p.test,
+	})
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern:    "remove webhook {name}",
+		Usage:      "stops sending events to a webhook",
+		Permission: "webhook.manage",
+		Handler:    p.remove,
+	})
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern:    "webhook log {name}",
+		Usage:      "shows the latest deliveries to a webhook",
+		Permission: "webhook.manage",
+		Handler:    p.showLog,
+	})
+}
+
+func (p *WebhookPlugin) reply(c bot.Connector, message msg.Message, format string, args ...interface{}) bool {
+	p.bot.Send(c, bot.Message, message.Channel, fmt.Sprintf(format, args...))
+	return true
+}
+
+func (p *WebhookPlugin) add(c bot.Connector, message msg.Message, args bot.Args) bool {
+	h := &Hook{
+		Name:    args.String("name"),
+		URL:     args.String("url"),
+		Event:   args.String("event"),
+		Filter:  args.String("filter"),
+		Created: time.Now().Unix(),
+	}
+	// some chat services wrap links in <>
+	h.URL = strings.Trim(h.URL, "<>")
+	if _, ok := events[h.Event]; !ok {
+		return p.reply(c, message, "I don't send %s events.", h.Event)
+	}
+	if u, err := url.Parse(h.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return p.reply(c, message, "%s isn't a web address.", h.URL)
+	}
+	if err := h.compile(); err != nil {
+		return p.reply(c, message, "That filter doesn't work: %s", err)
+	}
+	if _, ok := p.hook(h.Name); ok {
+		return p.reply(c, message, "There's already a webhook called %s.", h.Name)
+	}
+	id, err := config.Insert(p.db, `insert into webhooks (name, url, event, filter, created) values (?, ?, ?, ?, ?)`,
+		h.Name, h.URL, h.Event, h.Filter, h.Created)
+	if err != nil {
+		log.Error().Err(err).Msg("Could not add webhook")
+		return p.reply(c, message, "I couldn't save that webhook.")
+	}
+	h.ID = id
+	p.Lock()
+	p.hooks = append(p.hooks, h)
+	p.Unlock()
+	out := fmt.Sprintf("Okay, I'll send %s events to %s.", h.Event, h.Name)
+	if p.cfg.Get("Webhook.Secret", "") == "" {
+		out += " Set Webhook.Secret before it can be signed."
+	}
+	return p.reply(c, message, "%s", out)
+}
+
+func (p *WebhookPlugin) list(c bot.Connector, message msg.Message, args bot.Args) bool {
+	p.RLock()
+	defer p.RUnlock()
+	if len(p.hooks) == 0 {
+		return p.reply(c, message, "There are no webhooks.")
+	}
+	out := "Webhooks:"
+	for _, h := range p.hooks {
+		out += fmt.Sprintf("\n%s: %s to %s", h.Name, h.Event, h.URL)
+		if h.Filter != "" {
+			out += fmt.Sprintf(" when %s", h.Filter)
+		}
+	}
+	return p.reply(c, message, "%s", out)
+}
+
+func (p *WebhookPlugin) remove(c bot.Connector, message msg.Message, args bot.Args) bool {
+	name := args.String("name")
+	if _, ok := p.hook(name); !ok {
+		return p.reply(c, message, "There's no webhook called %s.", name)
+	}
+	if _, err := p.db.Exec(`delete from webhooks where name=?`, name); err != nil {
+		log.Error().Err(err).Msg("Could not remove webhook")
+		return p.reply(c, message, "I couldn't remove that webhook.")
+	}
+	p.Lock()
+	for i, h := range p.hooks {
+		if h.Name == name {
+			p.hooks = append(p.hooks[:i], p.hooks[i+1:]...)
+			break
+		}
+	}
+	p.Unlock()
+	return p.reply(c, message, "Okay, no more events for %s.", name)
+}
+
+// test sends straight away instead of queueing, so the answer says how it went
+func (p *WebhookPlugin) test(c bot.Connector, message msg.Message, args bot.Args) bool {
+	h, ok := p.hook(args.String("name"))
+	if !ok {
+		return p.reply(c, message, "There's no webhook called %s.", args.String("name"))
+	}
+	body, _ := json.Marshal(payload{Hook: h.Name, Event: testEvent, Time: time.Now(),
+		Data: map[string]string{"by": message.User.Name}})
+	d := Delivery{Hook: h.Name, Event: testEvent, Body: string(body), Attempts: 1}
+	result, err := p.send(h, body)
+	d.Status, d.Result = delivered, result
+	if err != nil {
+		d.Status, d.Result = failed, config.Redact(err.Error())
+	}
+	_, dbErr := p.db.Exec(`insert into webhook_deliveries (hook, event, body, status, attempts, result, updated)
+		values (?, ?, ?, ?, ?, ?, ?)`, d.Hook, d.Event, d.Body, d.Status, d.Attempts, d.Result, time.Now().Unix())
+	if dbErr != nil {
+		log.Error().Err(dbErr).Msg("Could not log a test delivery")
+	}
+	if err != nil {
+		return p.reply(c, message, "%s didn't take it: %s", h.Name, d.Result)
+	}
+	return p.reply(c, message, "%s says %s.", h.Name, result)
+}
+
+func (p *WebhookPlugin) showLog(c bot.Connector, message msg.Message, args bot.Args) bool {
+	name := args.String("name")
+	ds := []Delivery{}
+	err := p.db.Select(&ds, `select id, hook, event, body, status, attempts, result, updated
+		from webhook_deliveries where hook=? order by id desc limit 5`, name)
+	if err != nil {
+		log.Error().Err(err).Msg("Could not read the webhook log")
+		return p.reply(c, message, "I couldn't read the log.")
+	}
+	if len(ds) == 0 {
+		return p.reply(c, message, "Nothing has been sent to %s.", name)
+	}
+	out := fmt.Sprintf("Latest deliveries to %s:", name)
+	for _, d := range ds {
+		ago := time.Since(time.Unix(d.Updated, 0)).Round(time.Second)
+		out += fmt.Sprintf("\n#%d %s %s after %d tries, %s ago", d.ID, d.Event, d.Status, d.Attempts, ago)
+		if d.Result != "" {
+			out += ": " + d.Result
+		}
+	}
+	return p.reply(c, message, "%s", out)
+}
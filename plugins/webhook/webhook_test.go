@@ -0,0 +1,168 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/velour/catbase/bot"
+	"github.com/velour/catbase/bot/msg"
+	"github.com/velour/catbase/bot/user"
+	"github.com/velour/catbase/plugins/cli"
+)
+
+const secret = "hook secret"
+
+type request struct {
+	body      []byte
+	signature string
+}
+
+// server answers with status and hands over every request it gets
+func server(t *testing.T, status int) (*httptest.Server, chan request) {
+	reqs := make(chan request, 10)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		reqs <- request{body, r.Header.Get("X-Catbase-Signature")}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(s.Close)
+	return s, reqs
+}
+
+func setup(t *testing.T) (*WebhookPlugin, *bot.MockBot) {
+	mb := bot.NewMockBot()
+	p := New(mb)
+	mb.DB().MustExec(`delete from webhooks; delete from webhook_deliveries; delete from incoming_hooks; delete from config; delete from roles;`)
+	assert.Nil(t, p.loadHooks())
+	mb.Permissions().Grant("", "tester", bot.Admin)
+	mb.Config().Set("Webhook.Secret", secret)
+	return p, mb
+}
+
+func makeMessage(payload string) (bot.Connector, bot.Kind, msg.Message) {
+	isCmd := strings.HasPrefix(payload, "!")
+	if isCmd {
+		payload = payload[1:]
+	}
+	return &cli.CliPlugin{}, bot.Message, msg.Message{
+		User:    &user.User{Name: "tester"},
+		Channel: "test",
+		Body:    payload,
+		Command: isCmd,
+	}
+}
+
+func wait(t *testing.T, reqs chan request) request {
+	select {
+	case r := <-reqs:
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatal("the webhook was never called")
+	}
+	return request{}
+}
+
+func status(t *testing.T, p *WebhookPlugin) Delivery {
+	var d Delivery
+	for i := 0; i < 50; i++ {
+		err := p.db.Get(&d, `select id, hook, event, body, status, attempts, result, updated
+			from webhook_deliveries order by id desc limit 1`)
+		if err == nil && d.Attempts > 0 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return d
+}
+
+func TestCounterIsDelivered(t *testing.T) {
+	p, mb := setup(t)
+	s, reqs := server(t, http.StatusOK)
+	mb.Receive(makeMessage("!add webhook lights counter.changed " + s.URL + " coffee"))
+	assert.Contains(t, mb.Messages[0], "Okay")
+
+	mb.Publish(bot.CounterChanged{Nick: "tester", Item: "tea", Count: 1, Delta: 1})
+	mb.Publish(bot.CounterChanged{Nick: "tester", Item: "coffee", Count: 0, Delta: -1})
+	mb.Publish(bot.CounterChanged{Nick: "tester", Item: "Coffee", Count: 2, Delta: 1})
+
+	r := wait(t, reqs)
+	assert.Equal(t, Sign(secret, r.body), r.signature)
+	var got struct {
+		Hook  string
+		Event string
+		Data  bot.CounterChanged
+	}
+	assert.Nil(t, json.Unmarshal(r.body, &got))
+	assert.Equal(t, "lights", got.Hook)
+	assert.Equal(t, "counter.changed", got.Event)
+	assert.Equal(t, 2, got.Data.Count)
+	assert.Equal(t, delivered, status(t, p).Status)
+	assert.Len(t, reqs, 0)
+}
+
+func TestMessageFilter(t *testing.T) {
+	p, mb := setup(t)
+	s, reqs := server(t, http.StatusOK)
+	mb.Receive(makeMessage("!add webhook doorbell message " + s.URL + " ^ding"))
+	assert.False(t, p.message(makeMessage("not this one")))
+	assert.False(t, p.message(makeMessage("ding dong")))
+	r := wait(t, reqs)
+	assert.Contains(t, string(r.body), `"body":"ding dong"`)
+	assert.Equal(t, delivered, status(t, p).Status)
+	assert.Len(t, reqs, 0)
+}
+
+func TestFailuresAreRetried(t *testing.T) {
+	p, mb := setup(t)
+	s, reqs := server(t, http.StatusInternalServerError)
+	mb.Receive(makeMessage("!add webhook broken reminder.fired " + s.URL))
+	mb.Publish(bot.ReminderFired{ID: 1, Who: "tester", What: "stretch"})
+	wait(t, reqs)
+	d := status(t, p)
+	assert.Equal(t, pending, d.Status)
+	assert.Equal(t, 1, d.Attempts)
+	assert.Contains(t, d.Result, "500")
+	_, ok := mb.Scheduler().Get(jobName(d.ID))
+	assert.True(t, ok)
+
+	mb.Receive(makeMessage("!webhook log broken"))
+	assert.Contains(t, mb.Messages[len(mb.Messages)-1], "reminder.fired pending after 1 tries")
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, 30*time.Second, backoff(1))
+	assert.Equal(t, 2*time.Minute, backoff(3))
+	assert.Equal(t, time.Hour, backoff(20))
+}
+
+func TestTestAndRemove(t *testing.T) {
+	_, mb := setup(t)
+	s, reqs := server(t, http.StatusNoContent)
+	mb.Receive(makeMessage("!add webhook lights fact.learned " + s.URL))
+	mb.Receive(makeMessage("!test webhook lights"))
+	assert.Contains(t, mb.Messages[1], "lights says 204")
+	r := <-reqs
+	assert.Contains(t, string(r.body), `"event":"test"`)
+
+	mb.Receive(makeMessage("!webhooks"))
+	assert.Contains(t, mb.Messages[2], "lights: fact.learned to "+s.URL)
+	mb.Receive(makeMessage("!remove webhook lights"))
+	mb.Receive(makeMessage("!webhooks"))
+	assert.Equal(t, "There are no webhooks.", mb.Messages[4])
+}
+
+func TestBadHooks(t *testing.T) {
+	_, mb := setup(t)
+	mb.Receive(makeMessage("!add webhook x beers.spilled http://example.com"))
+	mb.Receive(makeMessage("!add webhook x message ftp://example.com"))
+	mb.Receive(makeMessage("!add webhook x message http://example.com ("))
+	assert.Contains(t, mb.Messages[0], "I don't send beers.spilled events")
+	assert.Contains(t, mb.Messages[1], "isn't a web address")
+	assert.Contains(t, mb.Messages[2], "That filter doesn't work")
+}
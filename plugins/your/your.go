@@ -23,7 +23,7 @@ func New(b bot.Bot) *YourPlugin {
 		config: b.Config(),
 	}
 	b.Register(yp, bot.Message, yp.message)
-	b.Register(yp, bot.Help, yp.help)
+	yp.registerCommands()
 	return yp
 }
 
@@ -52,8 +52,9 @@ func (p *YourPlugin) message(c bot.Connector, kind bot.Kind, message msg.Message
 	return false
 }
 
-// Help responds to help requests. Every plugin must implement a help function.
-func (p *YourPlugin) help(c bot.Connector, kind bot.Kind, message msg.Message, args ...interface{}) bool {
-	p.bot.Send(c, bot.Message, message.Channel, "Your corrects people's grammar.")
-	return true
+func (p *YourPlugin) registerCommands() {
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern: "{message:text}",
+		Usage:   "corrects people's grammar, now and then",
+	})
 }
@@ -25,15 +25,18 @@ type ZorkPlugin struct {
 	sync.Mutex
 	// zorks is a map from channels to their corresponding zork instances.
 	zorks map[string]io.WriteCloser
+	// cmds holds the dfrotz process behind each channel's game
+	cmds map[string]*exec.Cmd
 }
 
 func New(b bot.Bot) bot.Plugin {
 	z := &ZorkPlugin{
 		bot:   b,
 		zorks: make(map[string]io.WriteCloser),
+		cmds:  make(map[string]*exec.Cmd),
 	}
 	b.Register(z, bot.Message, z.message)
-	b.Register(z, bot.Help, z.help)
+	z.registerCommands()
 	return z
 }
 
@@ -88,10 +91,25 @@ func (p *ZorkPlugin) runZork(c bot.Connector, ch string) error {
 		}
 		p.Lock()
 		p.zorks[ch] = nil
+		delete(p.cmds, ch)
 		p.Unlock()
 	}()
 	log.Info().Msgf("zork is running in %s\n", ch)
 	p.zorks[ch] = w
+	p.cmds[ch] = cmd
+	return nil
+}
+
+// Stop ends every game so no dfrotz outlives the bot
+func (p *ZorkPlugin) Stop() error {
+	p.Lock()
+	defer p.Unlock()
+	for ch, cmd := range p.cmds {
+		log.Info().Msgf("Stopping zork in %s", ch)
+		if err := cmd.Process.Kill(); err != nil {
+			log.Error().Err(err).Msgf("Could not stop zork in %s", ch)
+		}
+	}
 	return nil
 }
 
@@ -117,7 +135,10 @@ func (p *ZorkPlugin) message(c bot.Connector, kind bot.Kind, message msg.Message
 	return true
 }
 
-func (p *ZorkPlugin) help(c bot.Connector, kind bot.Kind, message msg.Message, args ...interface{}) bool {
-	p.bot.Send(c, bot.Message, message.Channel, "Play zork using 'zork <zork command>'.")
-	return true
+func (p *ZorkPlugin) registerCommands() {
+	p.bot.RegisterCommand(p, bot.Command{
+		Pattern:  "zork {command:text?}",
+		Usage:    "plays zork in this channel",
+		Examples: []string{"zork open mailbox"},
+	})
 }